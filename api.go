@@ -12,8 +12,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"sync"
+	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -23,28 +24,63 @@ import (
 // ErrorClosed indicates that an operation has been attempted on a Connection that has been closed.
 var ErrorClosed = errors.New("Connection closed")
 
+// ErrorInvalidPassword is returned by Connect when the device rejects the password.
+var ErrorInvalidPassword = errors.New("invalid password")
+
 // ESPHomeConnection represents a connection to a device that speaks the ESPHome protocol
 type ESPHomeConnection struct {
 	Password   string
 	ClientInfo string
 	conn       net.Conn
 	reader     *bufio.Reader
-	receivers  map[chan proto.Message]map[MessageID]bool
+	receivers  map[chan proto.Message]*receiver
+	mu         sync.Mutex
+	wmu        sync.Mutex
 	closed     bool
-	Debug      bool
+	done       chan struct{}
+	device     string
+	// Logger receives the diagnostic messages of the connection, including
+	// every message sent and received at LevelDebug
+	Logger Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+	// Tap receives a copy of every frame, it must be set before Dial
+	Tap Tap
+}
+
+// Direction is the direction of a frame as seen by the client
+type Direction int
+
+//go:generate stringer -type=Direction -trimprefix=Direction
+
+// Directions of a frame
+const (
+	// DirectionSent is a frame sent by the client to the device
+	DirectionSent Direction = 1
+	// DirectionReceived is a frame received by the client from the device
+	DirectionReceived Direction = 2
+)
+
+// Tap receives every frame sent and received by an ESPHomeConnection,
+// payload is the encoded message without the preamble, size and type and
+// must not be kept after Frame returns
+type Tap interface {
+	Frame(t time.Time, dir Direction, msgType MessageID, payload []byte)
 }
 
 // Dial creates a new ESPHomeConnection over TCP
 func (c *ESPHomeConnection) Dial(address string) error {
-	conn, err := net.Dial("tcp", address)
+	return c.DialTimeout(address, 0)
+}
+
+// DialTimeout is like Dial but gives up connecting after timeout
+func (c *ESPHomeConnection) DialTimeout(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
 	if err != nil {
 		return err
 	}
 
-	c.conn = conn
-	c.reader = bufio.NewReader(conn)
-	c.closed = false
-	go c.receiveLoop()
+	c.start(conn)
 
 	return nil
 }
@@ -53,13 +89,61 @@ func (c *ESPHomeConnection) Dial(address string) error {
 // this is primarily used for testing
 func (c *ESPHomeConnection) Pipe() net.Conn {
 	client, server := net.Pipe()
+	c.start(client)
 
-	c.conn = client
-	c.reader = bufio.NewReader(c.conn)
+	return server
+}
+
+func (c *ESPHomeConnection) start(conn net.Conn) {
+	c.mu.Lock()
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.device = conn.RemoteAddr().String()
 	c.closed = false
-	go c.receiveLoop()
+	c.done = make(chan struct{})
+	c.mu.Unlock()
 
-	return server
+	go c.receiveLoop(conn, c.reader, c.done)
+}
+
+// Close closes the underlying connection without sending a DisconnectRequest,
+// use Disconnect to close the connection cleanly
+func (c *ESPHomeConnection) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.closed = true
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// Done returns a channel that is closed once the connection has been closed
+// for any reason
+func (c *ESPHomeConnection) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done == nil {
+		c.done = make(chan struct{})
+	}
+	return c.done
+}
+
+// Closed reports whether the connection has been closed
+func (c *ESPHomeConnection) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+func (c *ESPHomeConnection) setClosed() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
 }
 
 func encodeMessage(m proto.Message, msgType MessageID) (*bytes.Buffer, error) {
@@ -68,6 +152,11 @@ func encodeMessage(m proto.Message, msgType MessageID) (*bytes.Buffer, error) {
 		return nil, err
 	}
 
+	return encodeFrame(msgType, b), nil
+}
+
+// encodeFrame adds the preamble, size and type to the encoded message b
+func encodeFrame(msgType MessageID, b []byte) *bytes.Buffer {
 	buf := bytes.Buffer{}
 	ibuf := make([]byte, binary.MaxVarintLen64)
 
@@ -79,50 +168,166 @@ func encodeMessage(m proto.Message, msgType MessageID) (*bytes.Buffer, error) {
 	buf.Write(ibuf[:nb])
 	buf.Write(b)
 
-	return &buf, nil
+	return &buf
 }
 
-func (c *ESPHomeConnection) sendMessage(m proto.Message, msgType MessageID) error {
+// WriteMessage frames m and writes it to w
+func WriteMessage(w io.Writer, m proto.Message) error {
+	msgType := GetMessageID(m)
+	if msgType == 0 {
+		return fmt.Errorf("unknown message type: %T", m)
+	}
+
 	buf, err := encodeMessage(m, msgType)
-	if c.Debug {
-		log.Printf(">>> SENDING %d %d %x\n", buf.Len(), msgType, buf.Bytes())
+	if err != nil {
+		return err
 	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// WriteFrame writes payload, an encoded message of type msgType, as a single frame
+func WriteFrame(w io.Writer, msgType MessageID, payload []byte) error {
+	_, err := w.Write(encodeFrame(msgType, payload).Bytes())
+	return err
+}
+
+// ReadFrame reads a single frame from r and returns the type and the encoded
+// message without decoding it
+func ReadFrame(r *bufio.Reader) (MessageID, []byte, error) {
+	return receiveMessage(r)
+}
+
+// DecodeMessage decodes payload, the encoded message of a frame of type msgType
+func DecodeMessage(msgType MessageID, payload []byte) (proto.Message, error) {
+	return decodeMessage(payload, msgType)
+}
+
+// ReadMessage reads a single framed message from r and decodes it
+func ReadMessage(r *bufio.Reader) (MessageID, proto.Message, error) {
+	msgType, raw, err := receiveMessage(r)
+	if err != nil {
+		return msgType, nil, err
+	}
+
+	m, err := decodeMessage(raw, msgType)
+	return msgType, m, err
+}
+
+// Send sends any known message to the device, responses have to be received
+// with AddReceiver
+func (c *ESPHomeConnection) Send(m proto.Message) error {
+	msgType := GetMessageID(m)
+	if msgType == 0 {
+		return fmt.Errorf("unknown message type: %T", m)
+	}
+	return c.sendMessage(m, msgType)
+}
+
+func (c *ESPHomeConnection) sendMessage(m proto.Message, msgType MessageID) error {
+	if c.Closed() {
+		return ErrorClosed
+	}
+	payload, err := proto.Marshal(m)
 	if err != nil {
 		return err
 	}
+	c.logMessage("send", msgType, len(payload), m)
 
-	c.conn.Write(buf.Bytes())
+	// messages are written from several goroutines, don't let frames interleave
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.Tap != nil {
+		c.Tap.Frame(time.Now(), DirectionSent, msgType, payload)
+	}
+	_, err = c.conn.Write(encodeFrame(msgType, payload).Bytes())
 
-	return nil
+	return err
 }
 
-func (c *ESPHomeConnection) receiveLoop() {
+func (c *ESPHomeConnection) receiveLoop(conn net.Conn, reader *bufio.Reader, done chan struct{}) {
 	for {
-		msgType, respBytes, err := receiveMessage(c.reader)
+		msgType, respBytes, err := receiveMessage(reader)
 
-		if err == io.EOF || c.closed {
-			c.closed = true
+		if err != nil || c.Closed() {
+			// the framing can't be recovered after a short read or a bad
+			// preamble so any error ends the connection
+			if err != nil && !c.Closed() {
+				c.log(LevelInfo, "connection lost", "error", err)
+			}
+			c.setClosed()
 			break
 		}
 
-		if err != nil {
-			// log.Printf("receive failed: %v", err)
+		if c.Tap != nil {
+			c.Tap.Frame(time.Now(), DirectionReceived, msgType, respBytes)
 		}
 
 		resp, err := decodeMessage(respBytes, msgType)
+		if err != nil {
+			c.log(LevelWarn, "unable to decode message", "type", msgType, "size", len(respBytes), "error", err)
+		} else {
+			c.logMessage("receive", msgType, len(respBytes), resp)
+		}
 
-		for r, filter := range c.receivers {
-			ok := filter[msgType]
-			if ok {
-				r <- resp
+		// requests the device may send at any time
+		switch msgType {
+		case PingRequestID:
+			c.sendMessage(&PingResponse{}, PingResponseID)
+		case GetTimeRequestID:
+			c.sendMessage(&GetTimeResponse{EpochSeconds: uint32(time.Now().Unix())}, GetTimeResponseID)
+		case DisconnectRequestID:
+			c.sendMessage(&DisconnectResponse{}, DisconnectResponseID)
+			c.setClosed()
+		}
+
+		// receivers expect messages of the types they asked for
+		if err == nil {
+			for _, r := range c.receiversFor(msgType) {
+				select {
+				case r.ch <- resp:
+				case <-r.removed:
+				}
 			}
 		}
+
+		if msgType == DisconnectRequestID {
+			break
+		}
 	}
 
-	c.conn.Close()
+	conn.Close()
+	c.mu.Lock()
 	for r := range c.receivers {
 		close(r)
 	}
+	c.receivers = nil
+	c.mu.Unlock()
+	close(done)
+}
+
+// receiver is a channel registered with AddReceiver
+type receiver struct {
+	ch     chan proto.Message
+	filter map[MessageID]bool
+	// removed is closed by RemoveReceiver, which aborts a delivery to ch
+	// in progress
+	removed chan struct{}
+}
+
+func (c *ESPHomeConnection) receiversFor(msgType MessageID) []*receiver {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	receivers := []*receiver{}
+	for _, r := range c.receivers {
+		if r.filter[msgType] {
+			receivers = append(receivers, r)
+		}
+	}
+
+	return receivers
 }
 
 func receiveMessage(r *bufio.Reader) (MessageID, []byte, error) {
@@ -147,7 +352,7 @@ func receiveMessage(r *bufio.Reader) (MessageID, []byte, error) {
 	msgType := MessageID(msgTypeRaw)
 
 	respBytes := make([]byte, size)
-	n, err := r.Read(respBytes)
+	n, err := io.ReadFull(r, respBytes)
 	if n != int(size) {
 		return 0, nil, fmt.Errorf("didn't read the right number of bytes! %d != %d", n, size)
 	}
@@ -157,41 +362,74 @@ func receiveMessage(r *bufio.Reader) (MessageID, []byte, error) {
 
 // AddReceiver registers a channel used to receive events for given message types
 func (c *ESPHomeConnection) AddReceiver(r chan proto.Message, filters ...MessageID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.receivers == nil {
-		c.receivers = make(map[chan proto.Message]map[MessageID]bool)
+		c.receivers = make(map[chan proto.Message]*receiver)
 	}
 	// warn if changing filter?
 	for _, f := range filters {
 		if c.receivers[r] == nil {
-			c.receivers[r] = make(map[MessageID]bool)
+			c.receivers[r] = &receiver{ch: r, filter: make(map[MessageID]bool), removed: make(chan struct{})}
 		}
-		c.receivers[r][f] = true
+		c.receivers[r].filter[f] = true
 	}
 }
 
-// RemoveReceiver removes a channel from this list of receivers
+// RemoveReceiver removes a channel from this list of receivers. A message
+// the connection is delivering to the channel at the time is dropped, so
+// the channel doesn't need to be drained after it is removed.
 func (c *ESPHomeConnection) RemoveReceiver(r chan proto.Message) {
-	delete(c.receivers, r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rcv, ok := c.receivers[r]; ok {
+		close(rcv.removed)
+		delete(c.receivers, r)
+	}
 }
 
 func (c *ESPHomeConnection) sendMessageGetResponse(m proto.Message, msgType MessageID, respTypes ...MessageID) (chan proto.Message, error) {
-	if c.closed {
+	if c.Closed() {
 		return nil, ErrorClosed
 	}
 	r := make(chan proto.Message)
 	c.AddReceiver(r, respTypes...)
-	c.sendMessage(m, msgType)
+	if err := c.sendMessage(m, msgType); err != nil {
+		c.RemoveReceiver(r)
+		return nil, err
+	}
 	return r, nil
 }
 
-func (c *ESPHomeConnection) logMessage(name string, msg protoreflect.ProtoMessage) {
-	j, err := protojson.Marshal(msg)
-	if err != nil {
-		// log.Fatal(err)
+// logger returns the Logger to use
+func (c *ESPHomeConnection) logger() Logger {
+	return ResolveLogger(c.Logger, c.Debug)
+}
+
+// log logs a message with the device field added
+func (c *ESPHomeConnection) log(level Level, msg string, keyvals ...interface{}) {
+	l := c.logger()
+	if !l.Enabled(level) {
 		return
 	}
+	c.mu.Lock()
+	device := c.device
+	c.mu.Unlock()
+	l.Log(level, msg, append([]interface{}{"device", device}, keyvals...)...)
+}
 
-	log.Printf("%s : msg : %s\n", name, string(j))
+// logMessage logs a message sent or received, direction is "send" or "receive"
+func (c *ESPHomeConnection) logMessage(direction string, msgType MessageID, size int, msg proto.Message) {
+	if !c.logger().Enabled(LevelDebug) {
+		return
+	}
+	j, err := protojson.Marshal(msg)
+	if err != nil {
+		j = []byte(err.Error())
+	}
+	c.log(LevelDebug, direction, "direction", direction, "type", msgType, "size", size, "message", string(j))
 }
 
 // Hello sends the Hello message
@@ -202,16 +440,11 @@ func (c *ESPHomeConnection) Hello() error {
 		return err
 	}
 
-	raw, ok := <-receiver
+	_, ok := <-receiver
 	c.RemoveReceiver(receiver)
 	if !ok {
 		return ErrorClosed
 	}
-	resp := raw.(*HelloResponse)
-
-	if c.Debug {
-		c.logMessage("Hello", resp)
-	}
 
 	return nil
 }
@@ -232,14 +465,9 @@ func (c *ESPHomeConnection) Connect() error {
 	}
 
 	resp := raw.(*ConnectResponse)
-	if c.Debug {
-		c.logMessage("Connect", resp)
-	}
-
 	if resp.InvalidPassword {
-		c.conn.Close()
-		c.closed = true
-		return fmt.Errorf("invalid password")
+		c.Close()
+		return ErrorInvalidPassword
 	}
 
 	return nil
@@ -252,20 +480,13 @@ func (c *ESPHomeConnection) Disconnect() error {
 	if err != nil {
 		return err
 	}
-	raw, ok := <-receiver
+	_, ok := <-receiver
 	c.RemoveReceiver(receiver)
 	if !ok {
 		return ErrorClosed
 	}
-	resp := raw.(*DisconnectResponse)
 
-	c.closed = true
-
-	if c.Debug {
-		c.logMessage("Disconnect", resp)
-	}
-
-	c.conn.Close()
+	c.Close()
 
 	return nil
 }
@@ -284,10 +505,6 @@ func (c *ESPHomeConnection) DeviceInfo() (*DeviceInfoResponse, error) {
 	}
 	resp := raw.(*DeviceInfoResponse)
 
-	if c.Debug {
-		c.logMessage("DeviceInfo", resp)
-	}
-
 	return resp, nil
 }
 
@@ -298,10 +515,6 @@ type Entity interface {
 	GetObjectId() string
 }
 
-type XEnt struct {
-	Entity
-}
-
 type EntityID int32
 
 //go:generate stringer -type=EntityID
@@ -344,7 +557,14 @@ func GetEntityType(e Entity) EntityID {
 	}
 }
 
+// ListEntities returns the entities provided by the device
 func (c *ESPHomeConnection) ListEntities() ([]Entity, error) {
+	entities, _, err := c.ListEntitiesAndServices()
+	return entities, err
+}
+
+// ListEntitiesAndServices returns the entities and the user defined services provided by the device
+func (c *ESPHomeConnection) ListEntitiesAndServices() ([]Entity, []*ListEntitiesServicesResponse, error) {
 	req := ListEntitiesRequest{}
 	receiver, err := c.sendMessageGetResponse(&req, ListEntitiesRequestID,
 		ListEntitiesBinarySensorResponseID,
@@ -359,30 +579,33 @@ func (c *ESPHomeConnection) ListEntities() ([]Entity, error) {
 		ListEntitiesSwitchResponseID,
 		ListEntitiesTextSensorResponseID)
 	if err != nil {
-		return []Entity{}, err
+		return []Entity{}, nil, err
 	}
 	defer c.RemoveReceiver(receiver)
 
 	entities := []Entity{}
+	services := []*ListEntitiesServicesResponse{}
 
 	done := false
 	for done != true {
 		resp, ok := <-receiver
 		if !ok {
-			return entities, ErrorClosed
+			return entities, services, ErrorClosed
 		}
 		switch m := resp.(type) {
 		case *ListEntitiesDoneResponse:
 			done = true
 			continue
+		case *ListEntitiesServicesResponse:
+			services = append(services, m)
 		case Entity:
 			entities = append(entities, m)
 		default:
-			log.Printf("Unsupported message: %t", resp)
+			c.log(LevelWarn, "unsupported message in entity list", "message", fmt.Sprintf("%T", resp))
 		}
 	}
 
-	return entities, nil
+	return entities, services, nil
 }
 
 func (c *ESPHomeConnection) SwitchCommand(key uint32, state bool) error {
@@ -392,22 +615,81 @@ func (c *ESPHomeConnection) SwitchCommand(key uint32, state bool) error {
 	return err
 }
 
+// LightCommand sends a LightCommandRequest, only the fields with their has_* flag set are applied
+func (c *ESPHomeConnection) LightCommand(req *LightCommandRequest) error {
+	return c.sendMessage(req, LightCommandRequestID)
+}
+
+// CoverCommand sends a CoverCommandRequest
+func (c *ESPHomeConnection) CoverCommand(req *CoverCommandRequest) error {
+	return c.sendMessage(req, CoverCommandRequestID)
+}
+
+// FanCommand sends a FanCommandRequest
+func (c *ESPHomeConnection) FanCommand(req *FanCommandRequest) error {
+	return c.sendMessage(req, FanCommandRequestID)
+}
+
+// ClimateCommand sends a ClimateCommandRequest
+func (c *ESPHomeConnection) ClimateCommand(req *ClimateCommandRequest) error {
+	return c.sendMessage(req, ClimateCommandRequestID)
+}
+
+// ExecuteService calls a user defined service, args must be in the order
+// listed in the ListEntitiesServicesResponse
+func (c *ESPHomeConnection) ExecuteService(key uint32, args ...*ExecuteServiceArgument) error {
+	req := ExecuteServiceRequest{Key: key, Args: args}
+	return c.sendMessage(&req, ExecuteServiceRequestID)
+}
+
+// CameraImage requests a single image and returns it once all of its chunks
+// have been received from the camera with the given key
+func (c *ESPHomeConnection) CameraImage(key uint32) ([]byte, error) {
+	req := CameraImageRequest{Single: true}
+	receiver, err := c.sendMessageGetResponse(&req, CameraImageRequestID, CameraImageResponseID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.RemoveReceiver(receiver)
+
+	image := []byte{}
+	for {
+		raw, ok := <-receiver
+		if !ok {
+			return nil, ErrorClosed
+		}
+		resp := raw.(*CameraImageResponse)
+		if resp.Key != key {
+			continue
+		}
+		image = append(image, resp.Data...)
+		if resp.Done {
+			return image, nil
+		}
+	}
+}
+
+// CameraImageWith sends req and returns a channel that receives every
+// *CameraImageResponse chunk, from any camera, until it is removed with
+// RemoveReceiver
+func (c *ESPHomeConnection) CameraImageWith(req *CameraImageRequest) (chan protoreflect.ProtoMessage, error) {
+	receiver := make(chan protoreflect.ProtoMessage)
+	c.AddReceiver(receiver, CameraImageResponseID)
+	err := c.sendMessage(req, CameraImageRequestID)
+	return receiver, err
+}
+
 func (c *ESPHomeConnection) Ping() error {
 	req := PingRequest{}
 	receiver, err := c.sendMessageGetResponse(&req, PingRequestID, PingResponseID)
 	if err != nil {
 		return err
 	}
-	raw, ok := <-receiver
+	_, ok := <-receiver
 	c.RemoveReceiver(receiver)
 	if !ok {
 		return ErrorClosed
 	}
-	resp := raw.(*PingResponse)
-
-	if c.Debug {
-		c.logMessage("Ping", resp)
-	}
 
 	return nil
 }
@@ -429,10 +711,17 @@ func (c *ESPHomeConnection) SubscribeStates() (chan protoreflect.ProtoMessage, e
 	return receiver, err
 }
 
+// SubscribeLogs subscribes to log messages at level and above, asking the
+// device to dump its configuration first
 func (c *ESPHomeConnection) SubscribeLogs(level LogLevel) (chan protoreflect.ProtoMessage, error) {
-	req := SubscribeLogsRequest{Level: level, DumpConfig: true}
+	return c.SubscribeLogsWith(&SubscribeLogsRequest{Level: level, DumpConfig: true})
+}
+
+// SubscribeLogsWith subscribes to log messages with the options in req, the
+// channel receives a *SubscribeLogsResponse for each message
+func (c *ESPHomeConnection) SubscribeLogsWith(req *SubscribeLogsRequest) (chan protoreflect.ProtoMessage, error) {
 	receiver := make(chan protoreflect.ProtoMessage)
 	c.AddReceiver(receiver, SubscribeLogsResponseID)
-	err := c.sendMessage(&req, SubscribeLogsRequestID)
+	err := c.sendMessage(req, SubscribeLogsRequestID)
 	return receiver, err
 }
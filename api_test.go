@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"testing"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -200,3 +201,60 @@ func TestUnexpectedClose(t *testing.T) {
 		t.Errorf("expected ErrorClosed, got %v", err)
 	}
 }
+
+func TestUndecodableMessage(t *testing.T) {
+	client := ESPHomeConnection{ClientInfo: "test-client"}
+	conn := client.Pipe()
+	defer client.Close()
+
+	logs := make(chan proto.Message, 2)
+	client.AddReceiver(logs, SubscribeLogsResponseID)
+
+	// a truncated varint field can't be decoded
+	bad := []byte{0, 2, byte(SubscribeLogsResponseID), 0x08, 0xff}
+	good, err := encodeMessage(&SubscribeLogsResponse{Message: "ok"}, SubscribeLogsResponseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go conn.Write(append(bad, good.Bytes()...))
+
+	m := <-logs
+	if r, ok := m.(*SubscribeLogsResponse); !ok || r.Message != "ok" {
+		t.Errorf("unexpected message %v", m)
+	}
+}
+
+func TestRemoveReceiver(t *testing.T) {
+	client := ESPHomeConnection{ClientInfo: "test-client"}
+	conn := client.Pipe()
+	defer client.Close()
+
+	// stalled is never read, the connection is blocked delivering to it
+	stalled := make(chan proto.Message)
+	client.AddReceiver(stalled, SubscribeLogsResponseID)
+	logs := make(chan proto.Message, 2)
+	client.AddReceiver(logs, SubscribeLogsResponseID)
+
+	var messages []byte
+	for _, msg := range []string{"first", "second"} {
+		b, err := encodeMessage(&SubscribeLogsResponse{Message: msg}, SubscribeLogsResponseID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, b.Bytes()...)
+	}
+	go conn.Write(messages)
+	time.Sleep(20 * time.Millisecond)
+	client.RemoveReceiver(stalled)
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case m := <-logs:
+			if r := m.(*SubscribeLogsResponse); r.Message != want {
+				t.Errorf("got %q, want %q", r.Message, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("the connection is blocked by a removed receiver")
+		}
+	}
+}
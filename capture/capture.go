@@ -0,0 +1,219 @@
+// Package capture records the native API traffic of a connection to a file
+// and replays it as a fake device.
+//
+// A capture file starts with a 12 byte header, the magic "ESPGOCAP" followed
+// by the format version as a big endian uint32, currently 1. The header is
+// followed by one record per frame until the end of the file:
+//
+//	time     int64, big endian, nanoseconds since the Unix epoch
+//	dir      uint8, 1 for a frame sent by the client, 2 for one received
+//	type     uvarint, the MessageID
+//	size     uvarint, the length of payload
+//	payload  the encoded protobuf message
+//
+// The preamble byte of the wire format is not stored. Frames are in the order
+// they were written to or read from the socket.
+//
+// Record a connection by setting a Writer as its Tap:
+//
+//	w, err := capture.NewWriter(f)
+//	c := &espgohome.ESPHomeConnection{Tap: w}
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Magic starts every capture file
+const Magic = "ESPGOCAP"
+
+// Version is the version of the format written by Writer
+const Version = 1
+
+// ErrorBadMagic is returned by NewReader for files that aren't captures
+var ErrorBadMagic = errors.New("not a capture file")
+
+// maxPayload guards against reading garbage as a huge frame
+const maxPayload = 1 << 24
+
+// Frame is a single recorded frame
+type Frame struct {
+	Time      time.Time
+	Direction espgohome.Direction
+	Type      espgohome.MessageID
+	Payload   []byte
+}
+
+// Message decodes the payload
+func (f Frame) Message() (proto.Message, error) {
+	return espgohome.DecodeMessage(f.Type, f.Payload)
+}
+
+// Writer writes a capture file, it implements espgohome.Tap and can be used
+// by several connections at once
+type Writer struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	count int
+	err   error
+}
+
+// NewWriter writes the file header to w and returns a Writer for the frames.
+// Call Flush once done.
+func NewWriter(w io.Writer) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w)}
+
+	var header [12]byte
+	copy(header[:], Magic)
+	binary.BigEndian.PutUint32(header[8:], Version)
+	if _, err := cw.w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteFrame appends f to the file
+func (w *Writer) WriteFrame(f Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	buf := make([]byte, 9+2*binary.MaxVarintLen64, 9+2*binary.MaxVarintLen64+len(f.Payload))
+	binary.BigEndian.PutUint64(buf, uint64(f.Time.UnixNano()))
+	buf[8] = byte(f.Direction)
+	n := 9
+	n += binary.PutUvarint(buf[n:], uint64(f.Type))
+	n += binary.PutUvarint(buf[n:], uint64(len(f.Payload)))
+	buf = append(buf[:n], f.Payload...)
+
+	if _, err := w.w.Write(buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// Frame implements espgohome.Tap, errors are kept for Flush and Err
+func (w *Writer) Frame(t time.Time, dir espgohome.Direction, msgType espgohome.MessageID, payload []byte) {
+	w.WriteFrame(Frame{Time: t, Direction: dir, Type: msgType, Payload: payload})
+}
+
+// Count returns the number of frames written
+func (w *Writer) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.count
+}
+
+// Err returns the first error writing the file
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Flush writes any buffered frames to the underlying writer
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// Reader reads a capture file
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader checks the file header and returns a Reader for the frames
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+
+	var header [12]byte
+	if _, err := io.ReadFull(cr.r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrorBadMagic
+		}
+		return nil, err
+	}
+	if string(header[:8]) != Magic {
+		return nil, ErrorBadMagic
+	}
+	if v := binary.BigEndian.Uint32(header[8:]); v != Version {
+		return nil, fmt.Errorf("unsupported capture version %d", v)
+	}
+	return cr, nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the file
+func (r *Reader) Next() (Frame, error) {
+	var head [9]byte
+	if _, err := io.ReadFull(r.r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Frame{}, fmt.Errorf("truncated frame: %v", err)
+		}
+		return Frame{}, err
+	}
+
+	msgType, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Frame{}, fmt.Errorf("truncated frame: %v", err)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Frame{}, fmt.Errorf("truncated frame: %v", err)
+	}
+	if size > maxPayload {
+		return Frame{}, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return Frame{}, fmt.Errorf("truncated frame: %v", err)
+	}
+
+	return Frame{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(head[:8]))),
+		Direction: espgohome.Direction(head[8]),
+		Type:      espgohome.MessageID(msgType),
+		Payload:   payload,
+	}, nil
+}
+
+// ReadAll reads every frame of the capture file in r
+func ReadAll(r io.Reader) ([]Frame, error) {
+	cr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []Frame
+	for {
+		f, err := cr.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, f)
+	}
+}
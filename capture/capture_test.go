@@ -0,0 +1,149 @@
+package capture
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// session runs the same conversation against a real or replayed device
+func session(t *testing.T, c *espgohome.ESPHomeConnection) (*espgohome.DeviceInfoResponse, []espgohome.Entity) {
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	info, err := c.DeviceInfo()
+	if err != nil {
+		t.Fatalf("device info failed: %v", err)
+	}
+	entities, err := c.ListEntities()
+	if err != nil {
+		t.Fatalf("list entities failed: %v", err)
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("disconnect failed: %v", err)
+	}
+	return info, entities
+}
+
+func record(t *testing.T) ([]byte, *espgohome.DeviceInfoResponse, []espgohome.Entity) {
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "gadget", EsphomeVersion: "1.15.0"}}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	address := espgohometest.Serve(t, s)
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b)
+	if err != nil {
+		t.Fatalf("writer failed: %v", err)
+	}
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client", Tap: w}
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	info, entities := session(t, c)
+	<-c.Done()
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	return b.Bytes(), info, entities
+}
+
+func TestCapture(t *testing.T) {
+	data, _, _ := record(t)
+
+	frames, err := ReadAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	want := []struct {
+		dir espgohome.Direction
+		typ espgohome.MessageID
+	}{
+		{espgohome.DirectionSent, espgohome.HelloRequestID},
+		{espgohome.DirectionReceived, espgohome.HelloResponseID},
+		{espgohome.DirectionSent, espgohome.ConnectRequestID},
+		{espgohome.DirectionReceived, espgohome.ConnectResponseID},
+		{espgohome.DirectionSent, espgohome.DeviceInfoRequestID},
+		{espgohome.DirectionReceived, espgohome.DeviceInfoResponseID},
+		{espgohome.DirectionSent, espgohome.ListEntitiesRequestID},
+		{espgohome.DirectionReceived, espgohome.ListEntitiesSwitchResponseID},
+		{espgohome.DirectionReceived, espgohome.ListEntitiesDoneResponseID},
+		{espgohome.DirectionSent, espgohome.DisconnectRequestID},
+		{espgohome.DirectionReceived, espgohome.DisconnectResponseID},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("expected %d frames, got %d", len(want), len(frames))
+	}
+	for i, f := range frames {
+		if f.Direction != want[i].dir || f.Type != want[i].typ || f.Time.IsZero() {
+			t.Errorf("frame %d: got %s %s, want %s %s", i, f.Direction, f.Type, want[i].dir, want[i].typ)
+		}
+	}
+
+	m, err := frames[1].Message()
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if hello, ok := m.(*espgohome.HelloResponse); !ok || hello.ApiVersionMajor != 1 {
+		t.Errorf("unexpected message %v", m)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	data, wantInfo, wantEntities := record(t)
+	frames, err := ReadAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	r := &Replayer{Frames: frames}
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client"}
+	conn := c.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- r.Serve(conn) }()
+
+	info, entities := session(t, c)
+	if !proto.Equal(info, wantInfo) {
+		t.Errorf("got %v, want %v", info, wantInfo)
+	}
+	if len(entities) != len(wantEntities) || !proto.Equal(entities[0].(proto.Message), wantEntities[0].(proto.Message)) {
+		t.Errorf("got %v, want %v", entities, wantEntities)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("replay failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("replay didn't finish")
+	}
+}
+
+func TestBadFiles(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("PCAPNG")); err != ErrorBadMagic {
+		t.Errorf("expected ErrorBadMagic, got %v", err)
+	}
+	if _, err := NewReader(strings.NewReader(Magic + "\x00\x00\x00\x09")); err == nil {
+		t.Error("accepted version 9")
+	}
+
+	data, _, _ := record(t)
+	frames, err := ReadAll(bytes.NewReader(data[:len(data)-1]))
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("expected a truncated frame, got %v", err)
+	}
+	if len(frames) != 10 {
+		t.Errorf("expected the 10 complete frames, got %d", len(frames))
+	}
+}
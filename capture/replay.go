@@ -0,0 +1,58 @@
+package capture
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// Replayer plays the device side of a capture back to a client
+type Replayer struct {
+	Frames []Frame
+	// Speed scales the delays between frames, 1 keeps the original timing
+	// and 0 sends the frames as fast as possible
+	Speed float64
+	// Logger receives the diagnostic messages of the replay
+	Logger espgohome.Logger
+}
+
+// Serve plays the capture back on conn, the device side of a connection such
+// as the one returned by ESPHomeConnection.Pipe. Frames received in the
+// capture are sent to the client, and for each frame sent in the capture
+// Serve waits for the client to send a frame of the same type, ignoring any
+// others. conn is closed once every frame has been played.
+func (r *Replayer) Serve(conn net.Conn) error {
+	defer conn.Close()
+
+	logger := espgohome.ResolveLogger(r.Logger, false)
+	reader := bufio.NewReader(conn)
+
+	var previous time.Time
+	for i, f := range r.Frames {
+		if r.Speed > 0 && !previous.IsZero() && f.Direction == espgohome.DirectionReceived {
+			time.Sleep(time.Duration(float64(f.Time.Sub(previous)) / r.Speed))
+		}
+		previous = f.Time
+
+		switch f.Direction {
+		case espgohome.DirectionReceived:
+			if err := espgohome.WriteFrame(conn, f.Type, f.Payload); err != nil {
+				return err
+			}
+		case espgohome.DirectionSent:
+			for {
+				msgType, _, err := espgohome.ReadFrame(reader)
+				if err != nil {
+					return err
+				}
+				if msgType == f.Type {
+					break
+				}
+				logger.Log(espgohome.LevelDebug, "capture: ignoring unexpected frame", "frame", i, "type", msgType, "want", f.Type)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/capture"
+	"github.com/jdugan1024/espgohome/logs"
+	"google.golang.org/protobuf/proto"
+)
+
+func runCapture(o *options, args []string) error {
+	fs := o.flags()
+	output := fs.String("o", "espgohome.cap", "write the capture to `file`")
+	states := fs.Bool("states", true, "subscribe to states")
+	levels := fs.String("logs", "", "also subscribe to logs at `level`, see logs -level")
+	duration := fs.Duration("duration", 0, "stop after this long")
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+	var filter *logs.Filter
+	if *levels != "" {
+		var err error
+		if filter, err = logs.ParseFilter(*levels); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := capture.NewWriter(f)
+	if err != nil {
+		return err
+	}
+
+	o.tap = w
+	c, dev, err := o.load()
+	if err != nil {
+		w.Flush()
+		return err
+	}
+	if _, err := c.DeviceInfo(); err != nil {
+		o.disconnect(c)
+		return err
+	}
+	if *states {
+		if err := dev.Subscribe(); err != nil {
+			o.disconnect(c)
+			return err
+		}
+	}
+	if filter != nil {
+		records, err := logs.Subscribe(c, logs.Options{Filter: filter, DumpConfig: true})
+		if err != nil {
+			o.disconnect(c)
+			return err
+		}
+		drainRecords(records)
+	}
+
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	select {
+	case <-timeout:
+	case <-interrupted():
+	case <-c.Done():
+	}
+	o.disconnect(c)
+	<-c.Done()
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.stderr, "captured %d frames to %s\n", w.Count(), *output)
+	return f.Close()
+}
+
+func runReplay(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", "127.0.0.1:6053", "serve the capture as a device on `address`")
+	speed := fs.Float64("speed", 1, "scale the timing of the capture, 0 replays as fast as possible")
+	printFrames := fs.Bool("print", false, "print the frames instead of serving them")
+	files, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return o.usageError(fs, "replay takes a capture file")
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		return err
+	}
+	frames, err := capture.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if *printFrames {
+		var start time.Time
+		if len(frames) > 0 {
+			start = frames[0].Time
+		}
+		for _, f := range frames {
+			m, err := f.Message()
+			o.printFrame(frameInfo{
+				Time:      f.Time,
+				Offset:    f.Time.Sub(start),
+				Direction: f.Direction,
+				Type:      f.Type,
+				Size:      len(f.Payload),
+				Message:   m,
+				Err:       err,
+			})
+		}
+		return nil
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Fprintf(o.stderr, "replaying %d frames on %s\n", len(frames), l.Addr())
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := &capture.Replayer{
+				Frames: frames,
+				Speed:  *speed,
+				Logger: espgohome.ResolveLogger(nil, o.debug),
+			}
+			go func() {
+				if err := r.Serve(conn); err != nil {
+					fmt.Fprintf(o.stderr, "%s: %v\n", conn.RemoteAddr(), err)
+				}
+			}()
+		}
+	}()
+
+	<-interrupted()
+	return nil
+}
+
+// frameInfo describes a frame for printFrame
+type frameInfo struct {
+	Time      time.Time
+	Offset    time.Duration
+	Direction espgohome.Direction
+	Stream    string
+	Type      espgohome.MessageID
+	Size      int
+	Message   proto.Message
+	// Malformed is set if the frame couldn't be split from the stream
+	Malformed bool
+	Err       error
+}
+
+// frameJSON is how frames are printed with -json
+type frameJSON struct {
+	Time      time.Time       `json:"time"`
+	Offset    float64         `json:"offset"`
+	Direction string          `json:"direction"`
+	Stream    string          `json:"stream,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Size      int             `json:"size"`
+	Message   json.RawMessage `json:"message,omitempty"`
+	Malformed bool            `json:"malformed,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// messageName returns the name of the message type of a MessageID
+func messageName(t espgohome.MessageID) string {
+	return strings.TrimSuffix(t.String(), "ID")
+}
+
+// directionName returns "sent", "received" or "unknown"
+func directionName(d espgohome.Direction) string {
+	if d == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(d.String())
+}
+
+func (o *options) printFrame(f frameInfo) {
+	var message json.RawMessage
+	if f.Message != nil {
+		message = protoJSON(f.Message)
+	}
+
+	if o.json {
+		fj := frameJSON{
+			Time:      f.Time,
+			Offset:    f.Offset.Seconds(),
+			Direction: directionName(f.Direction),
+			Stream:    f.Stream,
+			Size:      f.Size,
+			Message:   message,
+			Malformed: f.Malformed,
+		}
+		if !f.Malformed {
+			fj.Type = messageName(f.Type)
+		}
+		if f.Err != nil {
+			fj.Error = f.Err.Error()
+		}
+		o.printJSONLine(fj)
+		return
+	}
+
+	var b strings.Builder
+	if !f.Time.IsZero() {
+		fmt.Fprintf(&b, "%s %+10.6f ", f.Time.Format("15:04:05.000000"), f.Offset.Seconds())
+	}
+	if f.Stream != "" {
+		fmt.Fprintf(&b, "%s ", f.Stream)
+	}
+	fmt.Fprintf(&b, "%-8s ", directionName(f.Direction))
+	switch {
+	case f.Malformed:
+		fmt.Fprintf(&b, "MALFORMED (%d bytes) %v", f.Size, f.Err)
+	case f.Err != nil:
+		fmt.Fprintf(&b, "%s (%d bytes) error: %v", messageName(f.Type), f.Size, f.Err)
+	default:
+		fmt.Fprintf(&b, "%s (%d bytes) %s", messageName(f.Type), f.Size, message)
+	}
+	fmt.Fprintln(o.stdout, b.String())
+}
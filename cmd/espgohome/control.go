@@ -0,0 +1,360 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// action is run against the device once the arguments have been parsed
+type action func(dev *entity.Device) error
+
+// control parses the flags and arguments of a command that acts on the
+// device. Controls are shared by the CLI, which connects for each command,
+// and the shell, which runs them on its own connection.
+type control func(o *options, fs *flag.FlagSet, args []string) (action, error)
+
+// runControl returns the run function of a command built from a control
+func runControl(ctl control) func(o *options, args []string) error {
+	return func(o *options, args []string) error {
+		act, err := ctl(o, o.flags(), args)
+		if err != nil {
+			return err
+		}
+
+		c, dev, err := o.load()
+		if err != nil {
+			return err
+		}
+		defer o.disconnect(c)
+
+		return act(dev)
+	}
+}
+
+// target finds the entity named id, which must be of type t
+func target(dev *entity.Device, id string, t espgohome.EntityID) (entity.Entity, error) {
+	e, err := findEntity(dev, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type() != t {
+		return nil, fmt.Errorf("%s is a %s, not a %s", e.ObjectID(), e.Type(), t)
+	}
+	return e, nil
+}
+
+// isSet reports whether a flag was given on the command line
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func switchControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, o.usageError(fs, "switch takes an entity and on, off or toggle")
+	}
+	on := false
+	if args[1] != "toggle" {
+		if on, err = value.ParseOnOff(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Switch)
+		if err != nil {
+			return err
+		}
+		sw := e.(*entity.Switch)
+
+		if args[1] == "toggle" {
+			if err := o.waitForState(dev, sw); err != nil {
+				return err
+			}
+			return sw.Toggle()
+		}
+		return sw.Set(on)
+	}, nil
+}
+
+func lightControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	brightness := fs.Float64("brightness", 0, "brightness from 0 to 1")
+	rgb := fs.String("rgb", "", "colour as `r,g,b` with each from 0 to 1")
+	white := fs.Float64("white", 0, "white value from 0 to 1")
+	colorTemp := fs.Float64("color-temp", 0, "colour temperature in `mireds`")
+	transition := fs.Duration("transition", 0, "transition length")
+	flash := fs.Duration("flash", 0, "flash length")
+	effect := fs.String("effect", "", "effect name")
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, o.usageError(fs, "light takes an entity and on, off or toggle")
+	}
+
+	var opts []entity.LightOption
+	if isSet(fs, "brightness") {
+		opts = append(opts, entity.WithBrightness(float32(*brightness)))
+	}
+	if *rgb != "" {
+		parts := strings.Split(*rgb, ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("-rgb takes three comma separated values")
+		}
+		var c [3]float32
+		for i, p := range parts {
+			if c[i], err = value.ParseFloat(strings.TrimSpace(p)); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, entity.WithRGB(c[0], c[1], c[2]))
+	}
+	if isSet(fs, "white") {
+		opts = append(opts, entity.WithWhite(float32(*white)))
+	}
+	if isSet(fs, "color-temp") {
+		opts = append(opts, entity.WithColorTemperature(float32(*colorTemp)))
+	}
+	if isSet(fs, "transition") {
+		opts = append(opts, entity.WithTransition(*transition))
+	}
+	if isSet(fs, "flash") {
+		opts = append(opts, entity.WithFlash(*flash))
+	}
+	if *effect != "" {
+		opts = append(opts, entity.WithEffect(*effect))
+	}
+	on := false
+	if args[1] != "toggle" {
+		if on, err = value.ParseOnOff(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Light)
+		if err != nil {
+			return err
+		}
+		light := e.(*entity.Light)
+
+		on := on
+		if args[1] == "toggle" {
+			if err := o.waitForState(dev, light); err != nil {
+				return err
+			}
+			on = !light.State().On
+		}
+		if on {
+			return light.TurnOn(opts...)
+		}
+		return light.TurnOff(opts...)
+	}, nil
+}
+
+func coverControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return nil, o.usageError(fs, "cover takes an entity and an action")
+	}
+
+	var level float32
+	switch args[1] {
+	case "open", "close", "stop":
+		if len(args) != 2 {
+			return nil, o.usageError(fs, "%s takes no value", args[1])
+		}
+	case "position", "tilt":
+		if len(args) != 3 {
+			return nil, o.usageError(fs, "%s takes a value from 0 to 1", args[1])
+		}
+		if level, err = value.ParseFloat(args[2]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, o.usageError(fs, "unknown cover action %q", args[1])
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Cover)
+		if err != nil {
+			return err
+		}
+		cover := e.(*entity.Cover)
+
+		switch args[1] {
+		case "open":
+			return cover.Open()
+		case "close":
+			return cover.Close()
+		case "stop":
+			return cover.Stop()
+		case "position":
+			return cover.SetPosition(level)
+		default:
+			return cover.SetTilt(level)
+		}
+	}, nil
+}
+
+func fanControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 2 {
+		return nil, o.usageError(fs, "fan takes an entity and an action")
+	}
+
+	var command func(f *entity.Fan) error
+	switch args[1] {
+	case "on", "off":
+		if len(args) != 2 {
+			return nil, o.usageError(fs, "%s takes no value", args[1])
+		}
+		on := args[1] == "on"
+		command = func(f *entity.Fan) error {
+			if on {
+				return f.TurnOn()
+			}
+			return f.TurnOff()
+		}
+	case "speed", "oscillate", "direction":
+		if len(args) != 3 {
+			return nil, o.usageError(fs, "%s takes a value", args[1])
+		}
+		command, err = fanCommand(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, o.usageError(fs, "unknown fan action %q", args[1])
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Fan)
+		if err != nil {
+			return err
+		}
+		return command(e.(*entity.Fan))
+	}, nil
+}
+
+func fanCommand(action, arg string) (func(f *entity.Fan) error, error) {
+	switch action {
+	case "speed":
+		speed, err := parseEnum(espgohome.FanSpeed_name, value.FanSpeedPrefixes, arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *entity.Fan) error { return f.SetSpeed(espgohome.FanSpeed(speed)) }, nil
+	case "oscillate":
+		on, err := value.ParseOnOff(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *entity.Fan) error { return f.SetOscillating(on) }, nil
+	default:
+		direction, err := parseEnum(espgohome.FanDirection_name, value.FanDirectionPrefixes, arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(f *entity.Fan) error { return f.SetDirection(espgohome.FanDirection(direction)) }, nil
+	}
+}
+
+func climateControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 3 {
+		return nil, o.usageError(fs, "climate takes an entity, an action and a value")
+	}
+
+	command, err := climateCommand(args[1], args[2:])
+	if err != nil {
+		return nil, o.usageError(fs, "%v", err)
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Climate)
+		if err != nil {
+			return err
+		}
+		return command(e.(*entity.Climate))
+	}, nil
+}
+
+func climateCommand(action string, values []string) (func(c *entity.Climate) error, error) {
+	want := 1
+	if action == "range" {
+		want = 2
+	}
+	if len(values) != want {
+		return nil, fmt.Errorf("%s takes %d values", action, want)
+	}
+
+	switch action {
+	case "mode":
+		mode, err := parseEnum(espgohome.ClimateMode_name, value.ClimateModePrefixes, values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetMode(espgohome.ClimateMode(mode)) }, nil
+	case "target":
+		t, err := value.ParseFloat(values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetTargetTemperature(t) }, nil
+	case "range":
+		low, err := value.ParseFloat(values[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := value.ParseFloat(values[1])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetTargetTemperatureRange(low, high) }, nil
+	case "away":
+		away, err := value.ParseOnOff(values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetAway(away) }, nil
+	case "fan":
+		mode, err := parseEnum(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes, values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetFanMode(espgohome.ClimateFanMode(mode)) }, nil
+	case "swing":
+		mode, err := parseEnum(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes, values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(c *entity.Climate) error { return c.SetSwingMode(espgohome.ClimateSwingMode(mode)) }, nil
+	default:
+		return nil, fmt.Errorf("unknown climate action %q", action)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jdugan1024/espgohome/dissect"
+)
+
+func runDecode(o *options, args []string) error {
+	fs := o.flags()
+	hexDump := fs.Bool("hex", false, "read a hex dump even if the input looks like a pcap file")
+	files, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) > 1 {
+		return o.usageError(fs, "decode takes a single file")
+	}
+
+	var in io.Reader = os.Stdin
+	if len(files) == 1 && files[0] != "-" {
+		f, err := os.Open(files[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r := bufio.NewReader(in)
+
+	var frames []dissect.Frame
+	header, _ := r.Peek(4)
+	if !*hexDump && dissect.IsPcap(header) {
+		frames, err = dissect.ReadPcap(r, o.port)
+	} else {
+		frames, err = dissect.ReadHex(r)
+	}
+
+	var start time.Time
+	for _, f := range frames {
+		if start.IsZero() {
+			start = f.Time
+		}
+		info := frameInfo{
+			Time:      f.Time,
+			Offset:    f.Time.Sub(start),
+			Direction: f.Direction,
+			Stream:    f.Stream,
+			Type:      f.Type,
+			Size:      len(f.Payload),
+			Malformed: f.Err != nil,
+			Err:       f.Err,
+		}
+		if f.Err == nil {
+			info.Message, info.Err = f.Message()
+		}
+		o.printFrame(info)
+	}
+
+	// the frames read before an error are still worth showing
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/sink"
+)
+
+// envInfluxToken is used when -token is not given
+const envInfluxToken = "ESPGOHOME_INFLUX_TOKEN"
+
+func runExport(o *options, args []string) error {
+	fs := o.flags()
+	format := fs.String("format", "influx", "write the readings as influx line protocol or csv")
+	output := fs.String("o", "", "append the readings to `file` instead of stdout")
+	endpoint := fs.String("url", "", "post the readings to the InfluxDB write endpoint at `url` instead")
+	token := fs.String("token", os.Getenv(envInfluxToken), "InfluxDB API `token` (default $"+envInfluxToken+")")
+	batch := fs.Int("batch", 0, "write at most `n` readings at once (default 1000 with -url, 1 otherwise)")
+	flush := fs.Duration("flush", 10*time.Second, "write partial batches after this `interval`")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format != "influx" && *format != "csv" {
+		return o.usageError(fs, "unknown format %q", *format)
+	}
+	if *endpoint != "" && *format != "influx" {
+		return o.usageError(fs, "-url only takes influx line protocol")
+	}
+
+	var s sink.Sink
+	size := *batch
+	if *endpoint != "" {
+		s = &sink.InfluxHTTP{URL: *endpoint, Token: *token, Client: &http.Client{Timeout: o.timeout}}
+	} else {
+		// files and streams are written as the states arrive
+		if size == 0 {
+			size = 1
+		}
+		var w io.Writer = o.stdout
+		appending := false
+		if *output != "" && *output != "-" {
+			f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+				appending = true
+			}
+			w = f
+		}
+		if *format == "csv" {
+			s = &sink.CSV{W: w, NoHeader: appending}
+		} else {
+			s = &sink.LineProtocol{W: w}
+		}
+	}
+
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	b := &sink.Batcher{
+		Manager:       m,
+		Sink:          s,
+		BatchSize:     size,
+		FlushInterval: *flush,
+		Logger:        espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		b.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := b.Start(); err != nil {
+		return err
+	}
+	defer b.Close()
+	fmt.Fprintf(o.stderr, "exporting %d devices\n", len(m.Devices()))
+
+	<-interrupted()
+	return nil
+}
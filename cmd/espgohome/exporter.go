@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/jdugan1024/espgohome/exporter"
+)
+
+func runExporter(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":9102", "serve the metrics on `address`")
+	path := fs.String("path", "/metrics", "serve the metrics at `path`")
+	namespace := fs.String("namespace", exporter.DefaultNamespace, "prefix of the metric names")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(*path, &exporter.Exporter{Manager: m, Namespace: *namespace})
+	srv := &http.Server{Handler: mux}
+	fmt.Fprintf(o.stderr, "serving metrics for %d devices on http://%s%s\n", len(m.Devices()), l.Addr(), *path)
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	select {
+	case err := <-done:
+		return err
+	case <-interrupted():
+	}
+	return srv.Shutdown(context.Background())
+}
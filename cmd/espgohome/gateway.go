@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/gateway"
+)
+
+const envGatewayToken = "ESPGOHOME_GATEWAY_TOKEN"
+
+func runGateway(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":8080", "serve the API on `address`")
+	token := fs.String("token", os.Getenv(envGatewayToken), "`token` of the commands and service calls, a random one is printed if empty (default $"+envGatewayToken+")")
+	logFilter := fs.String("logs", "", "stream the device logs matching `filter` on /events, as in the logs command")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		*token = hex.EncodeToString(b)
+		fmt.Fprintf(o.stderr, "token: %s\n", *token)
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	g := &gateway.Gateway{Manager: m, Token: *token, Logs: *logFilter, Logger: espgohome.StdLogger(espgohome.LevelInfo)}
+	if o.debug {
+		g.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := g.Start(); err != nil {
+		return err
+	}
+	defer g.Close()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: g}
+	fmt.Fprintf(o.stderr, "serving %d devices on http://%s\n", len(m.Devices()), l.Addr())
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	select {
+	case err := <-done:
+		return err
+	case <-interrupted():
+	}
+	// the event streams only end when the gateway closes
+	g.Close()
+	return srv.Shutdown(context.Background())
+}
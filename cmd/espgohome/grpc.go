@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/grpcapi"
+	"google.golang.org/grpc"
+)
+
+func runGRPC(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":50051", "serve the gRPC API on `address`")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	srv := &grpcapi.Server{Manager: m, Logger: espgohome.StdLogger(espgohome.LevelInfo)}
+	if o.debug {
+		srv.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	gs := grpc.NewServer()
+	grpcapi.RegisterAPIConnectionServer(gs, srv)
+	fmt.Fprintf(o.stderr, "serving %d devices over gRPC on %s\n", len(m.Devices()), l.Addr())
+
+	done := make(chan error, 1)
+	go func() { done <- gs.Serve(l) }()
+	select {
+	case err := <-done:
+		return err
+	case <-interrupted():
+	}
+	// the subscriptions never end on their own so there is no graceful stop
+	gs.Stop()
+	return nil
+}
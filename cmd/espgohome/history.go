@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/history"
+)
+
+// defaultHistoryDir is where record and history keep the history
+const defaultHistoryDir = "espgohome-history"
+
+// pointJSON is how history points are printed with -json
+type pointJSON struct {
+	Time     time.Time       `json:"time"`
+	Device   string          `json:"device"`
+	ObjectID string          `json:"object_id"`
+	Type     string          `json:"type"`
+	State    json.RawMessage `json:"state"`
+	Missing  bool            `json:"missing,omitempty"`
+}
+
+// statsJSON is how history statistics are printed with -json
+type statsJSON struct {
+	Device   string    `json:"device"`
+	ObjectID string    `json:"object_id"`
+	Count    int       `json:"count"`
+	Min      float64   `json:"min"`
+	Max      float64   `json:"max"`
+	Avg      float64   `json:"avg"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+}
+
+func runRecord(o *options, args []string) error {
+	fs := o.flags()
+	dir := fs.String("dir", defaultHistoryDir, "keep the history in `directory`")
+	retention := fs.Duration("retention", 30*24*time.Hour, "remove the days older than this, 0 keeps everything")
+	downsampleAfter := fs.Duration("downsample-after", 7*24*time.Hour, "average the sensor states of the days older than this, 0 keeps them")
+	resolution := fs.Duration("resolution", 5*time.Minute, "average the sensor states over this `interval`")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	store, err := history.Open(*dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	r := &history.Recorder{
+		Manager: m,
+		Store:   store,
+		Policy:  history.Policy{Retention: *retention, DownsampleAfter: *downsampleAfter, Resolution: *resolution},
+		Logger:  espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		r.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := r.Start(); err != nil {
+		return err
+	}
+	defer r.Close()
+	fmt.Fprintf(o.stderr, "recording %d devices to %s\n", len(m.Devices()), store.Dir())
+
+	<-interrupted()
+	return nil
+}
+
+func runHistory(o *options, args []string) error {
+	fs := o.flags()
+	dir := fs.String("dir", defaultHistoryDir, "read the history in `directory`")
+	since := fs.Duration("since", 24*time.Hour, "show the states of this last `duration`")
+	from := fs.String("from", "", "show the states from `time`, in RFC 3339, instead of -since")
+	to := fs.String("to", "", "show the states until `time`, in RFC 3339")
+	last := fs.Int("last", 0, "show the last `n` states instead of a range")
+	stats := fs.Bool("stats", false, "show the minimum, maximum and average instead of the states")
+	ids, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	start := time.Now().Add(-*since)
+	if *from != "" {
+		if start, err = time.Parse(time.RFC3339, *from); err != nil {
+			return o.usageError(fs, "invalid -from: %v", err)
+		}
+	}
+	var end time.Time
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			return o.usageError(fs, "invalid -to: %v", err)
+		}
+	}
+	store, err := history.Open(*dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if len(ids) == 0 {
+		devices, err := store.Devices()
+		if err != nil {
+			return err
+		}
+		if o.json {
+			return o.printJSON(devices)
+		}
+		for _, d := range devices {
+			fmt.Fprintln(o.stdout, d)
+		}
+		return nil
+	}
+
+	var points []devicePoint
+	var summaries []statsJSON
+	for _, id := range ids {
+		// an id is a device or device/object_id
+		device, objectID := id, ""
+		if i := strings.Index(id, "/"); i >= 0 {
+			device, objectID = id[:i], id[i+1:]
+		}
+		var found []history.Point
+		if *last > 0 {
+			found, err = store.Last(device, objectID, *last)
+		} else {
+			found, err = store.Query(device, objectID, start, end)
+		}
+		if err != nil {
+			return err
+		}
+		if !*stats {
+			for _, p := range found {
+				points = append(points, devicePoint{device, p})
+			}
+			continue
+		}
+		entities := objectIDs(found)
+		if objectID != "" {
+			entities = []string{objectID}
+		}
+		for _, objectID := range entities {
+			st := history.Summarize(filterPoints(found, objectID))
+			summaries = append(summaries, statsJSON{device, objectID, st.Count, st.Min, st.Max, st.Avg, st.First, st.Last})
+		}
+	}
+
+	tw := tabwriter.NewWriter(o.stdout, 0, 8, 2, ' ', 0)
+	if *stats {
+		if o.json {
+			return o.printJSON(summaries)
+		}
+		fmt.Fprintf(tw, "DEVICE\tOBJECT_ID\tCOUNT\tMIN\tMAX\tAVG\tFIRST\tLAST\n")
+		for _, st := range summaries {
+			if st.Count == 0 {
+				fmt.Fprintf(tw, "%s\t%s\t0\n", st.Device, st.ObjectID)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%g\t%g\t%g\t%s\t%s\n", st.Device, st.ObjectID, st.Count, st.Min, st.Max, st.Avg,
+				st.First.Format(time.RFC3339), st.Last.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+
+	if o.json {
+		for _, p := range points {
+			err := o.printJSONLine(pointJSON{
+				Time:     p.Time,
+				Device:   p.device,
+				ObjectID: p.ObjectID,
+				Type:     strings.TrimSuffix(espgohome.GetMessageID(p.State).String(), "ID"),
+				State:    protoJSON(p.State),
+				Missing:  p.Missing,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fmt.Fprintf(tw, "TIME\tDEVICE\tOBJECT_ID\tSTATE\n")
+	for _, p := range points {
+		state := formatState(nil, p.State)
+		if p.Missing {
+			state = "missing"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Time.Format(time.RFC3339), p.device, p.ObjectID, state)
+	}
+	return tw.Flush()
+}
+
+// devicePoint is a history point and its device
+type devicePoint struct {
+	device string
+	history.Point
+}
+
+// objectIDs returns the object ids of points in the order they first appear
+func objectIDs(points []history.Point) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, p := range points {
+		if !seen[p.ObjectID] {
+			seen[p.ObjectID] = true
+			ids = append(ids, p.ObjectID)
+		}
+	}
+	return ids
+}
+
+func filterPoints(points []history.Point, objectID string) []history.Point {
+	var out []history.Point
+	for _, p := range points {
+		if p.ObjectID == objectID {
+			out = append(out, p)
+		}
+	}
+	return out
+}
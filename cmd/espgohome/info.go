@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+func runInfo(o *options, args []string) error {
+	fs := o.flags()
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, err := o.connect()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	info, err := c.DeviceInfo()
+	if err != nil {
+		return err
+	}
+
+	if o.json {
+		return o.printJSON(protoJSON(info))
+	}
+
+	tw := tabwriter.NewWriter(o.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(tw, "MAC address:\t%s\n", info.MacAddress)
+	fmt.Fprintf(tw, "ESPHome version:\t%s\n", info.EsphomeVersion)
+	fmt.Fprintf(tw, "Compiled:\t%s\n", info.CompilationTime)
+	fmt.Fprintf(tw, "Model:\t%s\n", info.Model)
+	fmt.Fprintf(tw, "Uses password:\t%t\n", info.UsesPassword)
+	fmt.Fprintf(tw, "Deep sleep:\t%t\n", info.HasDeepSleep)
+
+	return tw.Flush()
+}
+
+// pingJSON is how ping results are printed with -json
+type pingJSON struct {
+	Seq  int     `json:"seq"`
+	Time float64 `json:"time_ms"`
+}
+
+func runPing(o *options, args []string) error {
+	fs := o.flags()
+	count := fs.Int("count", 4, "number of pings, 0 to ping until interrupted")
+	interval := fs.Duration("interval", time.Second, "time between pings")
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, err := o.connect()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	interrupt := interrupted()
+	for seq := 1; *count == 0 || seq <= *count; seq++ {
+		if seq > 1 {
+			select {
+			case <-interrupt:
+				return nil
+			case <-time.After(*interval):
+			}
+		}
+
+		start := time.Now()
+		if err := c.Ping(); err != nil {
+			return err
+		}
+		rtt := time.Since(start)
+
+		if o.json {
+			o.printJSONLine(pingJSON{Seq: seq, Time: float64(rtt) / float64(time.Millisecond)})
+		} else {
+			fmt.Fprintf(o.stdout, "seq=%d time=%s\n", seq, rtt.Round(time.Microsecond))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/logs"
+)
+
+func runLogs(o *options, args []string) error {
+	fs := o.flags()
+	levels := fs.String("level", "debug", "most verbose `level` to show: error, warn, info, debug, verbose or very_verbose, followed by tag=level for single tags such as debug,wifi=none,sensor*=verbose")
+	dumpConfig := fs.Bool("dump-config", true, "ask the device to log its configuration first")
+	color := fs.Bool("color", isTerminal(o.stdout), "colour the output by level")
+	count := fs.Int("count", 0, "exit after `n` lines")
+	duration := fs.Duration("duration", 0, "exit after this long")
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+	filter, err := logs.ParseFilter(*levels)
+	if err != nil {
+		return err
+	}
+
+	c, err := o.connect()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	records, err := logs.Subscribe(c, logs.Options{Filter: filter, DumpConfig: *dumpConfig})
+	if err != nil {
+		return err
+	}
+	defer drainRecords(records)
+
+	w := o.logWriter(*color)
+
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	interrupt := interrupted()
+
+	for n := 0; *count == 0 || n < *count; n++ {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				return espgohome.ErrorClosed
+			}
+			if err := w.WriteRecord(r); err != nil {
+				return err
+			}
+		case <-timeout:
+			return nil
+		case <-interrupt:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// logWriter returns the writer for the output format selected by the flags
+func (o *options) logWriter(color bool) logs.Writer {
+	switch {
+	case o.json:
+		return &logs.JSONWriter{Out: o.stdout}
+	case color:
+		return &logs.ColorWriter{Out: o.stdout}
+	}
+	return &logs.TextWriter{Out: o.stdout}
+}
+
+// drainRecords discards records until the connection is closed
+func drainRecords(ch <-chan logs.Record) {
+	go func() {
+		for range ch {
+		}
+	}()
+}
+
+// isTerminal reports whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
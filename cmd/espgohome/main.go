@@ -1,75 +1,138 @@
+// Command espgohome talks to ESPHome devices over the native API.
+//
+// Usage:
+//
+//	espgohome <command> [flags] [arguments]
+//
+// Every command accepts -host, -port, -password, -password-file, -json,
+// -timeout and -debug. The device is found with mDNS if -host and
+// $ESPGOHOME_HOST are both empty. The password is taken from -password,
+// -password-file or $ESPGOHOME_PASSWORD in that order.
+//
+// Entities are selected by object_id or by key.
 package main
 
 import (
-	"log"
-	"time"
-
-	"github.com/jdugan1024/espgohome"
-	"google.golang.org/protobuf/reflect/protoreflect"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
 )
 
-func states(c chan protoreflect.ProtoMessage) {
-	for m := range c {
-		switch state := m.(type) {
-		case *espgohome.BinarySensorStateResponse:
-			log.Printf("Binary sensor %d %t", state.Key, state.State)
-		case *espgohome.CoverStateResponse:
-			log.Printf("Cover state %d", state.Key)
-		case *espgohome.FanStateResponse:
-			log.Printf("Fan state")
-		case *espgohome.LightStateResponse:
-			log.Printf("Light state")
-		case *espgohome.SensorStateResponse:
-			log.Printf("Sensor state")
-		case *espgohome.SwitchStateResponse:
-			log.Printf("Switch state %d %t", state.Key, state.State)
-		case *espgohome.TextSensorStateResponse:
-			log.Printf("TextSensor state")
-		case *espgohome.HomeAssistantStateResponse:
-			log.Printf("HomeAssistant state")
-		case *espgohome.ClimateStateResponse:
-			log.Printf("Climate state")
-		}
-	}
+// command is a subcommand of espgohome
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(o *options, args []string) error
 }
 
-func logs(c chan protoreflect.ProtoMessage) {
-	for m := range c {
-		l := m.(*espgohome.SubscribeLogsResponse)
-		log.Printf("L|%s %s %s", l.Level, l.Tag, l.Message)
+// commands is filled in by init to avoid an initialization loop through help
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"info", "", "show the device information", runInfo},
+		{"entities", "[-states]", "list the entities and services", runEntities},
+		{"watch", "[-count n] [-duration d] [entity...]", "print state changes", runWatch},
+		{"logs", "[-level level[,tag=level...]] [-dump-config=false] [-color] [-count n] [-duration d]", "print the device logs", runLogs},
+		{"switch", "<entity> on|off|toggle", "control a switch", runControl(switchControl)},
+		{"light", "<entity> on|off|toggle", "control a light", runControl(lightControl)},
+		{"cover", "<entity> open|close|stop|position <p>|tilt <t>", "control a cover", runControl(coverControl)},
+		{"fan", "<entity> on|off|speed <s>|oscillate on|off|direction <d>", "control a fan", runControl(fanControl)},
+		{"climate", "<entity> mode <m>|target <t>|range <low> <high>|away on|off|fan <m>|swing <m>", "control a climate device", runControl(climateControl)},
+		{"service", "<name> [arg=value...]", "call a user defined service", runControl(serviceControl)},
+		{"camera", "<entity> [-o file]", "save an image from a camera", runControl(cameraControl)},
+		{"ping", "[-count n]", "measure the round trip time", runPing},
+		{"capture", "[-o file] [-states=false] [-logs level] [-duration d]", "record the traffic with a device to a file", runCapture},
+		{"replay", "[-listen address] [-speed s] [-print] <file>", "serve a capture as a fake device", runReplay},
+		{"decode", "[-hex] [-port p] [file]", "decode the frames in a pcap file or hex dump", runDecode},
+		{"exporter", "[-listen address] [-path path] [-namespace ns] [address...]", "serve Prometheus metrics for one or more devices", runExporter},
+		{"mqtt", "[-broker address] [-prefix p] [-discovery] [address...]", "bridge one or more devices to an MQTT broker", runMQTT},
+		{"gateway", "[-listen address] [-token token] [-logs filter] [address...]", "serve one or more devices over HTTP", runGateway},
+		{"grpc", "[-listen address] [address...]", "serve one or more devices over gRPC", runGRPC},
+		{"websocket", "[-listen address] [-token token] [address...]", "relay one or more devices to WebSocket clients", runWebSocket},
+		{"proxy", "[-listen address] [-client name=password]... [-logs level] [address...]", "share the connection to one or more devices between API clients", runProxy},
+		{"record", "[-dir directory] [-retention d] [-downsample-after d] [-resolution d] [address...]", "record the state changes of one or more devices", runRecord},
+		{"history", "[-dir directory] [-since d|-from t [-to t]|-last n] [-stats] [device[/object_id]...]", "show the recorded states", runHistory},
+		{"export", "[-format influx|csv] [-o file|-url url [-token token]] [-batch n] [-flush d] [address...]", "write the sensor readings of one or more devices as InfluxDB line protocol or CSV", runExport},
+		{"rules", "[-rules file] [-dry-run] [-check] [address...]", "run automation rules against one or more devices", runRules},
+		{"schedule", "[-jobs file] [-state file] [-list] [address...]", "send commands to the entities of one or more devices on a schedule", runSchedule},
+		{"scene", "capture|apply [-scene file] [-groups file] [-group name]... [-entity id]... [-transition d] [-dry-run] [address...]", "capture or restore the states of entities across one or more devices", runScene},
+		{"serve", "[-listen address] [-logs filter] [address...]", "hold the connections to one or more devices, printing their states and logs, with health endpoints and reload on SIGHUP", runServe},
+		{"shell", "[-history file]", "start an interactive shell", runShell},
+		{"help", "[command]", "show help for a command", runHelp},
 	}
 }
+
 func main() {
-	c := &espgohome.ESPHomeConnection{
-		ClientInfo: "client-info",
-		Password:   "foobar",
-		Debug:      true,
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(2)
 	}
-	err := c.Dial("10.37.0.187:6053")
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "espgohome: %v\n", err)
+		os.Exit(1)
 	}
-	c.Hello()
-	c.Connect()
-	info, err := c.DeviceInfo()
-	if err != nil {
-		panic(err)
+}
+
+// run runs the command named by args[0]
+func run(args []string, stdout, stderr io.Writer) error {
+	o := &options{stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		usage(stderr)
+		return flag.ErrHelp
 	}
-	log.Printf("INFO: %v\n", info)
-	c.Ping()
-	entities, err := c.ListEntities()
-	for _, e := range entities {
-		log.Printf("|%d %s %s %s\n", e.GetKey(), espgohome.GetEntityType(e), e.GetName(), e.GetObjectId())
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		usage(stderr)
+		return fmt.Errorf("unknown command %q", args[0])
 	}
-	receiver, err := c.SubscribeStates()
-	go states(receiver)
-	receiver, err = c.SubscribeLogs(espgohome.LogLevel_LOG_LEVEL_VERBOSE)
-	go logs(receiver)
+	o.command = cmd
+
+	err := cmd.run(o, args[1:])
+	if o.watcher != nil {
+		o.watcher.Close()
+	}
+	return err
+}
 
-	c.SwitchCommand(714259650, true)
-	// c.Ping()
-	time.Sleep(20 * time.Second)
-	// TODO: add pings to keep the connection alive.
-	c.SwitchCommand(714259650, false)
-	c.Disconnect()
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: espgohome <command> [flags] [arguments]\n\ncommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nrun \"espgohome help <command>\" for the flags of a command\n")
+}
+
+func runHelp(o *options, args []string) error {
+	if len(args) == 0 {
+		usage(o.stdout)
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	// every command prints its usage when given -h
+	o.stderr = o.stdout
+	o.command = cmd
+	if err := cmd.run(o, []string{"-h"}); err != flag.ErrHelp {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/history"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+func startServer(t *testing.T) (*server.Server, string) {
+	s := &server.Server{
+		Password:   "secret",
+		ServerInfo: "test-server",
+		Info:       &espgohome.DeviceInfoResponse{Name: "gadget", MacAddress: "AC:BC:32:89:0E:A9", EsphomeVersion: "1.15.0"},
+	}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 2, Name: "Temperature", UnitOfMeasurement: "°C"})
+	s.AddService(&espgohome.ListEntitiesServicesResponse{
+		Name: "beep",
+		Key:  3,
+		Args: []*espgohome.ListEntitiesServicesArgument{
+			{Name: "count", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT},
+			{Name: "tones", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY},
+		},
+	})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: true})
+	s.SetState(&espgohome.SensorStateResponse{Key: 2, State: 21.5})
+
+	return s, espgohometest.Serve(t, s)
+}
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestInfo(t *testing.T) {
+	_, addr := startServer(t)
+
+	out, err := runCommand(t, "info", "-host", addr, "-password", "secret", "-json")
+	if err != nil {
+		t.Fatalf("info failed: %v", err)
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if info["name"] != "gadget" || info["esphome_version"] != "1.15.0" {
+		t.Errorf("unexpected info %v", info)
+	}
+
+	if _, err := runCommand(t, "info", "-host", addr, "-password", "wrong"); err != espgohome.ErrorInvalidPassword {
+		t.Errorf("expected ErrorInvalidPassword, got %v", err)
+	}
+}
+
+func TestPasswordFromEnvironment(t *testing.T) {
+	_, addr := startServer(t)
+	os.Setenv(envHost, addr)
+	os.Setenv(envPassword, "secret")
+	defer os.Unsetenv(envHost)
+	defer os.Unsetenv(envPassword)
+
+	out, err := runCommand(t, "info")
+	if err != nil {
+		t.Fatalf("info failed: %v", err)
+	}
+	if !strings.Contains(out, "gadget") {
+		t.Errorf("expected the device name in %q", out)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	_, addr := startServer(t)
+
+	out, err := runCommand(t, "entities", "-host", addr, "-password", "secret", "-states")
+	if err != nil {
+		t.Fatalf("entities failed: %v", err)
+	}
+	for _, want := range []string{"relay", "on", "temperature", "21.5 °C", "beep", "(count int, tones float_array)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+
+	out, err = runCommand(t, "entities", "-host", addr, "-password", "secret", "-json")
+	if err != nil {
+		t.Fatalf("entities failed: %v", err)
+	}
+	var list struct {
+		Entities []entityJSON  `json:"entities"`
+		Services []serviceJSON `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(list.Entities) != 2 || list.Entities[0].ObjectID != "relay" || list.Entities[0].Type != "Switch" {
+		t.Errorf("unexpected entities %+v", list.Entities)
+	}
+	if len(list.Services) != 1 || list.Services[0].Name != "beep" {
+		t.Errorf("unexpected services %+v", list.Services)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	s, addr := startServer(t)
+	commands := make(chan *espgohome.SwitchCommandRequest, 4)
+	s.OnSwitchCommand = func(req *espgohome.SwitchCommandRequest) { commands <- req }
+
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"relay", "off"}, false},
+		{[]string{"1", "on"}, true},
+		{[]string{"relay", "toggle"}, false},
+	} {
+		args := append([]string{"switch", "-host", addr, "-password", "secret"}, tc.args...)
+		if _, err := runCommand(t, args...); err != nil {
+			t.Fatalf("%v failed: %v", tc.args, err)
+		}
+		req := <-commands
+		if req.Key != 1 || req.State != tc.want {
+			t.Errorf("%v: unexpected command %v", tc.args, req)
+		}
+	}
+
+	if _, err := runCommand(t, "switch", "-host", addr, "-password", "secret", "temperature", "on"); err == nil {
+		t.Error("switched a sensor!")
+	}
+	if _, err := runCommand(t, "switch", "-host", addr, "-password", "secret", "missing", "on"); err == nil {
+		t.Error("switched a missing entity!")
+	}
+}
+
+func TestClimate(t *testing.T) {
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "thermostat"}}
+	s.AddEntity(&espgohome.ListEntitiesClimateResponse{ObjectId: "hvac", Key: 1, Name: "HVAC"})
+	commands := espgohometest.Commands(s)
+	addr := espgohometest.Serve(t, s)
+
+	for _, tc := range []struct {
+		args []string
+		want *espgohome.ClimateCommandRequest
+	}{
+		{[]string{"mode", "heat"}, &espgohome.ClimateCommandRequest{Key: 1, HasMode: true, Mode: espgohome.ClimateMode_CLIMATE_MODE_HEAT}},
+		{[]string{"swing", "vertical"}, &espgohome.ClimateCommandRequest{Key: 1, HasSwingMode: true, SwingMode: espgohome.ClimateSwingMode_CLIMATE_SWING_VERTICAL}},
+		{[]string{"swing", "horizontal"}, &espgohome.ClimateCommandRequest{Key: 1, HasSwingMode: true, SwingMode: espgohome.ClimateSwingMode_CLIMATE_SWINT_HORIZONTAL}},
+	} {
+		args := append([]string{"climate", "-host", addr, "hvac"}, tc.args...)
+		if _, err := runCommand(t, args...); err != nil {
+			t.Fatalf("%v failed: %v", tc.args, err)
+		}
+		if req := espgohometest.NextCommand(t, commands); !proto.Equal(req, tc.want) {
+			t.Errorf("%v: unexpected command %v", tc.args, req)
+		}
+	}
+
+	if _, err := runCommand(t, "climate", "-host", addr, "hvac", "swing", "diagonal"); err == nil {
+		t.Error("set an unknown swing mode!")
+	}
+}
+
+func TestService(t *testing.T) {
+	s, addr := startServer(t)
+	calls := make(chan *espgohome.ExecuteServiceRequest, 1)
+	s.OnExecuteService = func(req *espgohome.ExecuteServiceRequest) { calls <- req }
+
+	if _, err := runCommand(t, "service", "-host", addr, "-password", "secret", "beep", "count=3", "tones=1.5,2"); err != nil {
+		t.Fatalf("service failed: %v", err)
+	}
+	req := <-calls
+	if req.Key != 3 || len(req.Args) != 2 || req.Args[0].Int_ != 3 || len(req.Args[1].FloatArray) != 2 {
+		t.Errorf("unexpected call %v", req)
+	}
+
+	if _, err := runCommand(t, "service", "-host", addr, "-password", "secret", "beep", "count=3"); err == nil {
+		t.Error("called a service with a missing argument!")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	_, addr := startServer(t)
+
+	out, err := runCommand(t, "watch", "-host", addr, "-password", "secret", "-json", "-count", "1", "temperature")
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	var st stateJSON
+	if err := json.Unmarshal([]byte(out), &st); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if st.ObjectID != "temperature" || st.Type != "Sensor" {
+		t.Errorf("unexpected state %+v", st)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	s, addr := startServer(t)
+	s.Config = []string{"\x1b[0;35m[C][logger:185]: Logger:\x1b[0m", "[C][wifi:443]:   SSID: 'home'"}
+
+	out, err := runCommand(t, "logs", "-host", addr, "-password", "secret", "-level", "info,wifi=none", "-count", "1")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	if !strings.HasSuffix(out, " [C][logger:185]: Logger:\n") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	out, err = runCommand(t, "logs", "-host", addr, "-password", "secret", "-json", "-count", "2")
+	if err != nil {
+		t.Fatalf("logs failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[1], err)
+	}
+	if record["tag"] != "wifi" || record["line"] != 443.0 || record["config"] != true || record["message"] != "  SSID: 'home'" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestCaptureAndReplay(t *testing.T) {
+	_, addr := startServer(t)
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.cap")
+
+	if _, err := runCommand(t, "capture", "-host", addr, "-password", "secret", "-o", file, "-duration", "50ms"); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+
+	out, err := runCommand(t, "replay", "-print", "-json", file)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	var frames []frameJSON
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var f frameJSON
+		if err := json.Unmarshal([]byte(line), &f); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) < 4 || frames[0].Type != "HelloRequest" || frames[0].Direction != "sent" || frames[1].Type != "HelloResponse" {
+		t.Fatalf("unexpected frames %+v", frames)
+	}
+	if !strings.Contains(string(frames[0].Message), `"client_info":"espgohome"`) {
+		t.Errorf("unexpected message %s", frames[0].Message)
+	}
+	if last := frames[len(frames)-1]; last.Type != "DisconnectResponse" {
+		t.Errorf("expected the capture to end with the disconnect, got %s", last.Type)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dump.txt")
+
+	// a HelloRequest from the client and garbage from the device
+	dump := "> 00 06 01 0a 04 74 65 73 74\n< ff 00 00 07 00 05\n"
+	if err := ioutil.WriteFile(file, []byte(dump), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCommand(t, "decode", file)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	want := []string{
+		`sent     HelloRequest (6 bytes) {"client_info":"test"}`,
+		`received MALFORMED (1 bytes) invalid preamble 0xff, skipped 1 bytes`,
+		`received PingRequest (0 bytes) {}`,
+		`received MALFORMED (2 bytes) truncated frame, 2 bytes left at the end of the stream`,
+	}
+	if got := strings.TrimSpace(out); got != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		store.Append("gadget", history.Point{
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			ObjectID: "temperature",
+			State:    &espgohome.SensorStateResponse{Key: 2, State: float32(20 + i)},
+		})
+	}
+	store.Close()
+
+	out, err := runCommand(t, "history", "-dir", dir, "-json", "-last", "2", "gadget/temperature")
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var p pointJSON
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &p); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(lines) != 2 || p.Type != "SensorStateResponse" || string(p.State) != `{"key":2,"state":23,"missing_state":false}` {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	out, err = runCommand(t, "history", "-dir", dir, "-stats", "gadget")
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	if fields := strings.Fields(strings.Split(out, "\n")[1]); len(fields) != 8 || fields[2] != "4" || fields[3] != "20" || fields[4] != "23" || fields[5] != "21.5" {
+		t.Errorf("unexpected stats %q", out)
+	}
+}
+
+func TestRulesCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rules.yaml")
+	rules := "rules:\n  - name: night\n    when: [{at: \"23:00\"}]\n    then: [{entity: gadget/relay, command: \"off\"}]\n"
+	if err := ioutil.WriteFile(file, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCommand(t, "rules", "-rules", file, "-check")
+	if err != nil || out != "1 rules ok\n" {
+		t.Errorf("unexpected output %q, %v", out, err)
+	}
+
+	ioutil.WriteFile(file, []byte(strings.Replace(rules, "off", "sideways", 1)), 0644)
+	if _, err := runCommand(t, "rules", "-rules", file, "-check"); err == nil || !strings.Contains(err.Error(), "sideways") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestScheduleList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schedule.yaml")
+	jobs := "jobs:\n  - name: evening\n    when: \"18:00\"\n    entity: gadget/relay\n    command: {state: true}\n"
+	if err := ioutil.WriteFile(file, []byte(jobs), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCommand(t, "schedule", "-jobs", file, "-list", "-json")
+	if err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	var runs []nextRunJSON
+	if err := json.Unmarshal([]byte(out), &runs); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if len(runs) != 1 || runs[0].Job != "evening" || runs[0].Next.Hour() != 18 || time.Until(runs[0].Next) > 24*time.Hour {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestScene(t *testing.T) {
+	_, addr := startServer(t)
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "scene.yaml")
+
+	if _, err := runCommand(t, "scene", "capture", "-host", addr, "-password", "secret", "-entity", "gadget/relay", "-name", "on", "-scene", file); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+	out, err := runCommand(t, "scene", "apply", "-scene", file, "-dry-run")
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "gadget/relay\t") || !strings.Contains(out, `"state":true`) {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	_, addr := startServer(t)
+	dir, err := ioutil.TempDir("", "espgohome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "espgohome.yaml")
+	if err := ioutil.WriteFile(file, []byte("devices:\n  - address: "+addr+"\n    password: !secret gadget\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "secrets.yaml"), []byte("gadget: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCommand(t, "info", "-config", file, "-json")
+	if err != nil {
+		t.Fatalf("info failed: %v", err)
+	}
+	if !strings.Contains(out, `"gadget"`) {
+		t.Errorf("unexpected output %q", out)
+	}
+	if _, err := runCommand(t, "scene", "capture", "-config", file, "-entity", "gadget/relay", "-scene", filepath.Join(dir, "scene.yaml")); err != nil {
+		t.Errorf("capture failed: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	o := &options{command: findCommand("light"), stderr: &bytes.Buffer{}}
+	fs := o.flags()
+	brightness := fs.Float64("brightness", 0, "")
+
+	args, err := o.parse(fs, []string{"lamp", "-json", "on", "-brightness", "0.5", "--", "-x"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if strings.Join(args, " ") != "lamp on -x" {
+		t.Errorf("unexpected arguments %q", args)
+	}
+	if !o.json || *brightness != 0.5 {
+		t.Errorf("flags not parsed: json=%t brightness=%g", o.json, *brightness)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/mqttbridge"
+)
+
+// envMQTTPassword is used when -broker-password is not given
+const envMQTTPassword = "ESPGOHOME_MQTT_PASSWORD"
+
+func runMQTT(o *options, args []string) error {
+	fs := o.flags()
+	broker := fs.String("broker", "127.0.0.1:1883", "MQTT broker `address`")
+	username := fs.String("broker-user", "", "MQTT user name")
+	password := fs.String("broker-password", os.Getenv(envMQTTPassword), "MQTT password (default $"+envMQTTPassword+")")
+	clientID := fs.String("client-id", mqttbridge.DefaultClientID, "MQTT client identifier")
+	prefix := fs.String("prefix", mqttbridge.DefaultPrefix, "first level of every topic")
+	discovery := fs.Bool("discovery", false, "publish Home Assistant discovery configs")
+	discoveryPrefix := fs.String("discovery-prefix", mqttbridge.DefaultDiscoveryPrefix, "prefix of the discovery topics")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	b := &mqttbridge.Bridge{
+		Manager:         m,
+		Broker:          *broker,
+		ClientID:        *clientID,
+		Username:        *username,
+		Password:        *password,
+		Prefix:          *prefix,
+		Discovery:       *discovery,
+		DiscoveryPrefix: *discoveryPrefix,
+		Logger:          espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		b.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := b.Start(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.stderr, "bridging %d devices to %s\n", len(m.Devices()), *broker)
+
+	<-interrupted()
+	return b.Close()
+}
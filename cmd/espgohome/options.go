@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/config"
+	"github.com/jdugan1024/espgohome/discovery"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// Environment variables used when the flags are not given
+const (
+	envHost     = "ESPGOHOME_HOST"
+	envPassword = "ESPGOHOME_PASSWORD"
+	envConfig   = "ESPGOHOME_CONFIG"
+)
+
+const defaultPort = 6053
+
+// discoveryTimeout is how long to browse when no host is given
+const discoveryTimeout = 2 * time.Second
+
+// options holds the flags shared by every command
+type options struct {
+	command *command
+	stdout  io.Writer
+	stderr  io.Writer
+
+	host         string
+	port         int
+	password     string
+	passwordFile string
+	json         bool
+	timeout      time.Duration
+	debug        bool
+	configFile   string
+
+	// subscribed is set once states have been subscribed to
+	subscribed bool
+	// tap is set on the connection to record the traffic
+	tap espgohome.Tap
+	// watcher reloads the -config file of the manager, it is closed when
+	// the command returns
+	watcher *config.Watcher
+}
+
+// flags returns a FlagSet for the command with the shared flags registered
+func (o *options) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(o.command.name, flag.ContinueOnError)
+	fs.SetOutput(o.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(o.stderr, "usage: espgohome %s [flags] %s\n\n%s\n\nflags:\n", o.command.name, o.command.args, o.command.summary)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&o.host, "host", os.Getenv(envHost), "device `address` as host or host:port, found with mDNS if empty (default $"+envHost+")")
+	fs.IntVar(&o.port, "port", defaultPort, "native API port used when -host has none")
+	fs.StringVar(&o.password, "password", "", "API password (default $"+envPassword+")")
+	fs.StringVar(&o.passwordFile, "password-file", "", "read the API password from `file`")
+	fs.BoolVar(&o.json, "json", false, "print JSON")
+	fs.DurationVar(&o.timeout, "timeout", 10*time.Second, "connection timeout")
+	fs.BoolVar(&o.debug, "debug", false, "log every message")
+	fs.StringVar(&o.configFile, "config", os.Getenv(envConfig), "read the devices from `file` when no host or addresses are given, the first one for single device commands (default $"+envConfig+")")
+
+	return fs
+}
+
+// parse parses flags mixed with positional arguments, which the flag package
+// doesn't do on its own, and returns the positional arguments. Anything after
+// "--" is positional.
+func (o *options) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// usageError prints the usage of the command and returns an error
+func (o *options) usageError(fs *flag.FlagSet, format string, v ...interface{}) error {
+	fs.Usage()
+	return fmt.Errorf(format, v...)
+}
+
+// address returns the host:port to connect to
+func (o *options) address() (string, error) {
+	if o.host == "" {
+		devices, err := discovery.Lookup(discoveryTimeout)
+		if err != nil {
+			return "", fmt.Errorf("discovery failed: %v", err)
+		}
+		switch len(devices) {
+		case 0:
+			return "", errors.New("no devices found, use -host")
+		case 1:
+			return devices[0].Address(), nil
+		default:
+			names := make([]string, len(devices))
+			for i, d := range devices {
+				names[i] = d.Name
+			}
+			return "", fmt.Errorf("found %d devices (%s), use -host", len(devices), strings.Join(names, ", "))
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(o.host); err == nil {
+		return o.host, nil
+	}
+	return net.JoinHostPort(o.host, strconv.Itoa(o.port)), nil
+}
+
+// getPassword returns the password from the flags or the environment
+func (o *options) getPassword() (string, error) {
+	if o.password != "" {
+		return o.password, nil
+	}
+	if o.passwordFile != "" {
+		b, err := ioutil.ReadFile(o.passwordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return os.Getenv(envPassword), nil
+}
+
+// connect dials the device and logs in
+func (o *options) connect() (*espgohome.ESPHomeConnection, error) {
+	var address, password string
+	clientInfo := "espgohome"
+	if o.useConfig() {
+		c, err := config.LoadFile(o.configFile)
+		if err != nil {
+			return nil, err
+		}
+		d := c.Devices[0]
+		address, password = d.Address, d.Password
+		if d.ClientInfo != "" {
+			clientInfo = d.ClientInfo
+		}
+	} else {
+		var err error
+		if address, err = o.address(); err != nil {
+			return nil, err
+		}
+		if password, err = o.getPassword(); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &espgohome.ESPHomeConnection{
+		ClientInfo: clientInfo,
+		Password:   password,
+		Debug:      o.debug,
+		Tap:        o.tap,
+	}
+	if err := c.DialTimeout(address, o.timeout); err != nil {
+		return nil, err
+	}
+
+	// the handshake has no timeout of its own
+	timer := time.AfterFunc(o.timeout, func() { c.Close() })
+	defer timer.Stop()
+
+	if err := c.Hello(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Connect(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load connects and lists the entities
+func (o *options) load() (*espgohome.ESPHomeConnection, *entity.Device, error) {
+	c, err := o.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+	dev, err := entity.Load(c)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+
+	return c, dev, nil
+}
+
+// disconnect says goodbye to the device, giving up after the timeout
+func (o *options) disconnect(c *espgohome.ESPHomeConnection) {
+	timer := time.AfterFunc(o.timeout, func() { c.Close() })
+	c.Disconnect()
+	timer.Stop()
+	c.Close()
+}
+
+// findEntity looks an entity up by object_id, or by key if id is a number
+func findEntity(dev *entity.Device, id string) (entity.Entity, error) {
+	if e := dev.Get(id); e != nil {
+		return e, nil
+	}
+	if key, err := strconv.ParseUint(id, 10, 32); err == nil {
+		if e := dev.GetByKey(uint32(key)); e != nil {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("no entity %q", id)
+}
+
+// waitForState subscribes to states if needed and waits until e has one
+func (o *options) waitForState(dev *entity.Device, e entity.Entity) error {
+	if !o.subscribed {
+		if err := dev.Subscribe(); err != nil {
+			return err
+		}
+		o.subscribed = true
+	}
+
+	deadline := time.Now().Add(o.timeout)
+	for !e.HasState() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no state received for %s", e.ObjectID())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// useConfig reports whether the devices come from the -config file
+func (o *options) useConfig() bool {
+	return o.host == "" && o.configFile != ""
+}
+
+// manager returns a Manager connecting to the devices at addresses, or to the
+// devices of the -config file, which is reloaded when it changes, or to the
+// device given by the flags
+func (o *options) manager(addresses []string) (*manager.Manager, error) {
+	if len(addresses) == 0 && o.useConfig() {
+		m := manager.New("espgohome")
+		m.DialTimeout = o.timeout
+		m.Debug = o.debug
+		o.watcher = &config.Watcher{Manager: m, Path: o.configFile, Logger: espgohome.StdLogger(espgohome.LevelInfo)}
+		if o.debug {
+			o.watcher.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+		}
+		if err := o.watcher.Start(); err != nil {
+			o.watcher = nil
+			m.Close()
+			return nil, err
+		}
+		return m, nil
+	}
+	if len(addresses) == 0 {
+		address, err := o.address()
+		if err != nil {
+			return nil, err
+		}
+		addresses = []string{address}
+	}
+	password, err := o.getPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	m := manager.New("espgohome")
+	m.DialTimeout = o.timeout
+	m.Debug = o.debug
+	for _, address := range addresses {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, strconv.Itoa(o.port))
+		}
+		if _, err := m.Add(manager.DeviceConfig{Address: address, Password: password}); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
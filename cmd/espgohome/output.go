@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// printJSON prints v indented, for commands that print a single result
+func (o *options) printJSON(v interface{}) error {
+	enc := json.NewEncoder(o.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printJSONLine prints v on a single line, for commands that stream results
+func (o *options) printJSONLine(v interface{}) error {
+	return json.NewEncoder(o.stdout).Encode(v)
+}
+
+// protoJSON converts a message to JSON using the field names from api.proto
+func protoJSON(m proto.Message) json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return nil
+	}
+
+	// protojson randomizes its whitespace
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// entityJSON is how entities are printed with -json
+type entityJSON struct {
+	Type     string          `json:"type"`
+	Key      uint32          `json:"key"`
+	ObjectID string          `json:"object_id"`
+	Name     string          `json:"name"`
+	UniqueID string          `json:"unique_id,omitempty"`
+	State    json.RawMessage `json:"state,omitempty"`
+}
+
+// parseEnum parses the short name of an enum value, such as low for
+// FAN_SPEED_LOW
+func parseEnum(names map[int32]string, prefixes []string, s string) (int32, error) {
+	if v, ok := value.ParseEnum(names, prefixes, s); ok {
+		return v, nil
+	}
+
+	var valid []string
+	for v := range names {
+		valid = append(valid, value.EnumString(names, prefixes, v))
+	}
+	sort.Strings(valid)
+	return 0, fmt.Errorf("invalid value %q, expected one of %s", s, strings.Join(valid, ", "))
+}
+
+// formatState returns a short human readable description of a state
+func formatState(e espgohome.Entity, state proto.Message) string {
+	switch m := state.(type) {
+	case *espgohome.BinarySensorStateResponse:
+		if m.MissingState {
+			return "missing"
+		}
+		return value.OnOff(m.State)
+	case *espgohome.SensorStateResponse:
+		if m.MissingState {
+			return "missing"
+		}
+		s := fmt.Sprintf("%g", m.State)
+		if meta, ok := e.(*espgohome.ListEntitiesSensorResponse); ok && meta.UnitOfMeasurement != "" {
+			s += " " + meta.UnitOfMeasurement
+		}
+		return s
+	case *espgohome.TextSensorStateResponse:
+		if m.MissingState {
+			return "missing"
+		}
+		return m.State
+	case *espgohome.SwitchStateResponse:
+		return value.OnOff(m.State)
+	case *espgohome.LightStateResponse:
+		if !m.State {
+			return "off"
+		}
+		s := fmt.Sprintf("on brightness=%g", m.Brightness)
+		if m.Effect != "" {
+			s += " effect=" + m.Effect
+		}
+		return s
+	case *espgohome.CoverStateResponse:
+		return fmt.Sprintf("position=%g tilt=%g %s", m.Position, m.Tilt,
+			value.EnumString(espgohome.CoverOperation_name, value.CoverOperationPrefixes, int32(m.CurrentOperation)))
+	case *espgohome.FanStateResponse:
+		if !m.State {
+			return "off"
+		}
+		return fmt.Sprintf("on speed=%s oscillating=%t direction=%s",
+			value.EnumString(espgohome.FanSpeed_name, value.FanSpeedPrefixes, int32(m.Speed)), m.Oscillating,
+			value.EnumString(espgohome.FanDirection_name, value.FanDirectionPrefixes, int32(m.Direction)))
+	case *espgohome.ClimateStateResponse:
+		return fmt.Sprintf("mode=%s current=%g target=%g action=%s",
+			value.EnumString(espgohome.ClimateMode_name, value.ClimateModePrefixes, int32(m.Mode)), m.CurrentTemperature, m.TargetTemperature,
+			value.EnumString(espgohome.ClimateAction_name, value.ClimateActionPrefixes, int32(m.Action)))
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", m)
+	}
+}
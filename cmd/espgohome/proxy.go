@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/proxy"
+)
+
+// clientsFlag collects the repeated -client name=password flags
+type clientsFlag map[string]string
+
+func (f clientsFlag) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (f clientsFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("invalid client %q, expected name=password", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+func runProxy(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":6053", "serve the first device on `address`, the others on the following ports")
+	level := fs.String("logs", "none", "subscribe to the device logs at `level` for the clients")
+	clients := clientsFlag{}
+	fs.Var(clients, "client", "accept the client whose client info is name with `name=password`, can be repeated, any client is accepted without it")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	logLevel, err := logs.ParseLevel(*level)
+	if err != nil {
+		return o.usageError(fs, "%v", err)
+	}
+	host, port, err := net.SplitHostPort(*listen)
+	if err != nil {
+		return o.usageError(fs, "invalid -listen: %v", err)
+	}
+	firstPort, err := strconv.Atoi(port)
+	if err != nil {
+		return o.usageError(fs, "invalid -listen port %q", port)
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	logger := espgohome.StdLogger(espgohome.LevelInfo)
+	if o.debug {
+		logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	done := make(chan error, len(m.Devices()))
+	for i, d := range m.Devices() {
+		l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(firstPort+i)))
+		if err != nil {
+			return err
+		}
+		p := &proxy.Proxy{Manager: m, Device: d.Config().Address, LogLevel: logLevel, Logger: logger}
+		if len(clients) > 0 {
+			p.Clients = clients
+		}
+		defer p.Close()
+		fmt.Fprintf(o.stderr, "proxying %s on %s\n", d.Config().Address, l.Addr())
+		go func() { done <- p.Serve(l) }()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-interrupted():
+	}
+	return nil
+}
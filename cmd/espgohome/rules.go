@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/rules"
+)
+
+func runRules(o *options, args []string) error {
+	fs := o.flags()
+	file := fs.String("rules", "rules.yaml", "read the rules from `file`")
+	dryRun := fs.Bool("dry-run", false, "log the actions instead of running them")
+	check := fs.Bool("check", false, "check the rules and exit")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	rs, err := rules.LoadFile(*file)
+	if err != nil {
+		return err
+	}
+	if *check {
+		fmt.Fprintf(o.stdout, "%d rules ok\n", len(rs))
+		return nil
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	e := &rules.Engine{
+		Manager: m,
+		Rules:   rs,
+		DryRun:  *dryRun,
+		Logger:  espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		e.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := e.Start(); err != nil {
+		return err
+	}
+	defer e.Close()
+	fmt.Fprintf(o.stderr, "running %d rules for %d devices\n", len(rs), len(m.Devices()))
+
+	<-interrupted()
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jdugan1024/espgohome/scene"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// listFlag collects the values of a repeated flag
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+func runScene(o *options, args []string) error {
+	fs := o.flags()
+	file := fs.String("scene", "scene.yaml", "read or write the scene in `file`, - for stdin or stdout")
+	groupsFile := fs.String("groups", "", "read the entity groups from `file`")
+	name := fs.String("name", "", "name of the captured scene")
+	var groups, entities listFlag
+	fs.Var(&groups, "group", "capture the entities of group `name`, can be repeated")
+	fs.Var(&entities, "entity", "capture entity `device/object_id`, can be repeated")
+	transition := fs.Duration("transition", 0, "fade the lights over `d` when applying")
+	dryRun := fs.Bool("dry-run", false, "print the commands instead of applying them")
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || (args[0] != "capture" && args[0] != "apply") {
+		return o.usageError(fs, "expected capture or apply")
+	}
+	action, addresses := args[0], args[1:]
+
+	if action == "apply" {
+		s, err := loadScene(*file)
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			return printScene(o, s)
+		}
+		var ids []string
+		for _, st := range s.States {
+			ids = append(ids, st.Entity)
+		}
+		m, err := o.manager(addresses)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		if err := scene.Wait(m, ids, o.timeout); err != nil {
+			return err
+		}
+		if err := s.Apply(m, *transition); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.stderr, "applied %d states\n", len(s.States))
+		return nil
+	}
+
+	var g scene.Groups
+	if *groupsFile != "" {
+		if g, err = scene.LoadGroupsFile(*groupsFile); err != nil {
+			return err
+		}
+	}
+	if len(groups) > 0 && g == nil {
+		return o.usageError(fs, "-group needs -groups")
+	}
+	ids, err := g.Resolve(append(groups, entities...)...)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return o.usageError(fs, "no entities, use -group or -entity")
+	}
+
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	if err := scene.Wait(m, ids, o.timeout); err != nil {
+		return err
+	}
+	s, err := scene.Capture(m, *name, ids)
+	if err != nil {
+		return err
+	}
+	if *file == "-" {
+		return s.Write(o.stdout)
+	}
+	if err := s.WriteFile(*file); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.stderr, "captured %d states to %s\n", len(s.States), *file)
+	return nil
+}
+
+func loadScene(file string) (*scene.Scene, error) {
+	if file == "-" {
+		return scene.Load(os.Stdin)
+	}
+	return scene.LoadFile(file)
+}
+
+// printScene prints the commands of a scene, one per line
+func printScene(o *options, s *scene.Scene) error {
+	for _, st := range s.States {
+		b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(st.Command)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.stdout, "%s\t%T\t%s\n", st.Entity, st.Command, b)
+	}
+	return nil
+}
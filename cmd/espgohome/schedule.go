@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/schedule"
+)
+
+// nextRunJSON is how the next runs are printed with -list -json
+type nextRunJSON struct {
+	Job    string    `json:"job"`
+	Entity string    `json:"entity"`
+	When   string    `json:"when"`
+	Next   time.Time `json:"next"`
+}
+
+func runSchedule(o *options, args []string) error {
+	fs := o.flags()
+	file := fs.String("jobs", "schedule.yaml", "read the jobs from `file`")
+	stateFile := fs.String("state", "", "keep the last runs in `file` to catch up the missed ones after a restart")
+	list := fs.Bool("list", false, "print the next run of every job and exit")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	c, err := schedule.LoadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		now := time.Now()
+		var runs []nextRunJSON
+		for _, j := range c.Jobs {
+			spec, err := schedule.Parse(j.When, c.Latitude, c.Longitude)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, nextRunJSON{j.Name, j.Entity, j.When, spec.Next(now)})
+		}
+		if o.json {
+			return o.printJSON(runs)
+		}
+		tw := tabwriter.NewWriter(o.stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "JOB\tENTITY\tWHEN\tNEXT\n")
+		for _, r := range runs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Job, r.Entity, r.When, r.Next.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	s := &schedule.Scheduler{
+		Manager:   m,
+		Jobs:      c.Jobs,
+		Latitude:  c.Latitude,
+		Longitude: c.Longitude,
+		StateFile: *stateFile,
+		Logger:    espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		s.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := s.Start(); err != nil {
+		return err
+	}
+	defer s.Close()
+	fmt.Fprintf(o.stderr, "scheduling %d jobs for %d devices\n", len(c.Jobs), len(m.Devices()))
+
+	<-interrupted()
+	return nil
+}
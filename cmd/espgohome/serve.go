@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/daemon"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+func runServe(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":8081", "serve /healthz and /readyz on `address`, none if empty")
+	logFilter := fs.String("logs", "info", "print the device logs matching `filter`, as in the logs command, none if empty")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	var filter *logs.Filter
+	if *logFilter != "" {
+		if filter, err = logs.ParseFilter(*logFilter); err != nil {
+			return err
+		}
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	d := &daemon.Daemon{
+		Manager: m,
+		Logs:    filter,
+		OnState: func(e manager.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(o.stdout, "%s %s: %s\n", e.Time.Format("15:04:05.000"), e.EntityID(), formatState(e.State.Entity, e.State.State))
+		},
+		OnLog: func(device string, r logs.Record) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(o.stdout, "%s %s %s\n", r.Time.Format("15:04:05.000"), device, r)
+		},
+		Logger: espgohome.StdLogger(espgohome.LevelInfo),
+	}
+	if o.debug {
+		d.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	if err := d.Start(); err != nil {
+		m.Close()
+		return err
+	}
+
+	done := make(chan error, 1)
+	var srv *http.Server
+	if *listen != "" {
+		l, err := net.Listen("tcp", *listen)
+		if err != nil {
+			d.Shutdown()
+			return err
+		}
+		srv = &http.Server{Handler: d.Handler()}
+		go func() { done <- srv.Serve(l) }()
+		fmt.Fprintf(o.stderr, "serving %d devices, health on http://%s/healthz\n", len(m.Devices()), l.Addr())
+	} else {
+		fmt.Fprintf(o.stderr, "serving %d devices\n", len(m.Devices()))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case err := <-done:
+			d.Shutdown()
+			return err
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				// Shutdown sends a DisconnectRequest to every device,
+				// readiness fails from then on
+				d.Shutdown()
+				if srv != nil {
+					return srv.Shutdown(context.Background())
+				}
+				return nil
+			}
+			if o.watcher == nil {
+				d.Logger.Log(espgohome.LevelWarn, "serve: nothing to reload without -config")
+				continue
+			}
+			if err := o.watcher.Reload(); err == nil {
+				d.Logger.Log(espgohome.LevelInfo, "serve: reloaded", "path", o.watcher.Path, "devices", len(o.watcher.Config().Devices))
+			}
+		}
+	}
+}
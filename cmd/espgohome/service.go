@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// serviceJSON is how services are printed with -json
+type serviceJSON struct {
+	Key  uint32           `json:"key"`
+	Name string           `json:"name"`
+	Args []serviceArgJSON `json:"args"`
+}
+
+type serviceArgJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func newServiceJSON(svc *entity.Service) serviceJSON {
+	sj := serviceJSON{Key: svc.Key, Name: svc.Name, Args: []serviceArgJSON{}}
+	for _, a := range svc.Args {
+		sj.Args = append(sj.Args, serviceArgJSON{Name: a.Name, Type: argTypeName(a.Type)})
+	}
+	return sj
+}
+
+func argTypeName(t espgohome.ServiceArgType) string {
+	return value.EnumString(espgohome.ServiceArgType_name, value.ServiceArgTypePrefixes, int32(t))
+}
+
+// serviceSignature describes the arguments of a service, e.g. "(level int, name string)"
+func serviceSignature(svc *entity.Service) string {
+	args := make([]string, len(svc.Args))
+	for i, a := range svc.Args {
+		args[i] = a.Name + " " + argTypeName(a.Type)
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+func serviceControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, o.usageError(fs, "service takes a service name")
+	}
+
+	given := map[string]string{}
+	for _, a := range args[1:] {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return nil, o.usageError(fs, "service arguments must be name=value, got %q", a)
+		}
+		given[kv[0]] = kv[1]
+	}
+
+	return func(dev *entity.Device) error {
+		svc := dev.Service(args[0])
+		if svc == nil {
+			return fmt.Errorf("no service %q", args[0])
+		}
+
+		values := make([]interface{}, len(svc.Args))
+		for i, a := range svc.Args {
+			s, ok := given[a.Name]
+			if !ok {
+				return fmt.Errorf("missing argument %s, %s takes %s", a.Name, svc.Name, serviceSignature(svc))
+			}
+			var err error
+			if values[i], err = parseServiceArg(a.Type, s); err != nil {
+				return fmt.Errorf("argument %s: %v", a.Name, err)
+			}
+		}
+		if len(given) > len(svc.Args) {
+			return fmt.Errorf("too many arguments, %s takes %s", svc.Name, serviceSignature(svc))
+		}
+
+		return svc.Execute(values...)
+	}, nil
+}
+
+// parseServiceArg converts a command line value to the Go type expected by
+// entity.ServiceArgument, arrays are comma separated
+func parseServiceArg(t espgohome.ServiceArgType, s string) (interface{}, error) {
+	switch t {
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL:
+		return value.ParseOnOff(s)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT:
+		return strconv.Atoi(s)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT:
+		return value.ParseFloat(s)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING:
+		return s, nil
+	}
+
+	var parts []string
+	if s != "" {
+		parts = strings.Split(s, ",")
+	}
+	switch t {
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL_ARRAY:
+		bs := []bool{}
+		for _, p := range parts {
+			b, err := value.ParseOnOff(p)
+			if err != nil {
+				return nil, err
+			}
+			bs = append(bs, b)
+		}
+		return bs, nil
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT_ARRAY:
+		is := []int{}
+		for _, p := range parts {
+			i, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, err
+			}
+			is = append(is, i)
+		}
+		return is, nil
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY:
+		fs := []float32{}
+		for _, p := range parts {
+			f, err := value.ParseFloat(p)
+			if err != nil {
+				return nil, err
+			}
+			fs = append(fs, f)
+		}
+		return fs, nil
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING_ARRAY:
+		if parts == nil {
+			parts = []string{}
+		}
+		return parts, nil
+	}
+
+	return nil, fmt.Errorf("unknown argument type %s", t)
+}
+
+func cameraControl(o *options, fs *flag.FlagSet, args []string) (action, error) {
+	output := fs.String("o", "", "write the image to `file` instead of stdout")
+	args, err := o.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, o.usageError(fs, "camera takes an entity")
+	}
+
+	return func(dev *entity.Device) error {
+		e, err := target(dev, args[0], espgohome.Camera)
+		if err != nil {
+			return err
+		}
+		image, err := e.(*entity.Camera).Image()
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			_, err = o.stdout.Write(image)
+			return err
+		}
+		if err := ioutil.WriteFile(*output, image, 0644); err != nil {
+			return err
+		}
+		if o.json {
+			return o.printJSON(struct {
+				File  string `json:"file"`
+				Bytes int    `json:"bytes"`
+			}{*output, len(image)})
+		}
+		fmt.Fprintf(o.stdout, "wrote %d bytes to %s\n", len(image), *output)
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/peterh/liner"
+	"google.golang.org/protobuf/proto"
+)
+
+// shell is an interactive session on a single connection
+type shell struct {
+	o    *options
+	conn *espgohome.ESPHomeConnection
+	dev  *entity.Device
+
+	// mu serializes output and guards the pane settings
+	mu         sync.Mutex
+	showStates bool
+	showLogs   bool
+	logFilter  *logs.Filter
+	logLevel   espgohome.LogLevel
+	logs       <-chan logs.Record
+}
+
+// shellCommand is a command available at the shell prompt
+type shellCommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(s *shell, args []string) error
+	// complete returns the candidates for args[len(args)-1], the earlier
+	// arguments are complete
+	complete func(s *shell, args []string) []string
+}
+
+// shellCommands is filled in by init to avoid an initialization loop through help
+var shellCommands []*shellCommand
+
+func init() {
+	shellCommands = []*shellCommand{
+		{"help", "[command]", "show the commands", (*shell).help, completeShellCommands},
+		{"list", "[type]", "list the entities and their states", (*shell).list, completeTypes},
+		{"get", "<entity>", "show the full state of an entity", (*shell).get, completeEntities(espgohome.UndefinedEntity)},
+		{"info", "", "show the device information", (*shell).info, nil},
+		{"ping", "", "measure the round trip time", (*shell).ping, nil},
+		{"switch", "<entity> on|off|toggle", "control a switch", shellControl("switch", switchControl), completeSwitch},
+		{"light", "<entity> on|off|toggle [-brightness b] ...", "control a light", shellControl("light", lightControl), completeLight},
+		{"cover", "<entity> open|close|stop|position <p>|tilt <t>", "control a cover", shellControl("cover", coverControl), completeCover},
+		{"fan", "<entity> on|off|speed <s>|oscillate on|off|direction <d>", "control a fan", shellControl("fan", fanControl), completeFan},
+		{"climate", "<entity> mode <m>|target <t>|range <low> <high>|away on|off|fan <m>|swing <m>", "control a climate device", shellControl("climate", climateControl), completeClimate},
+		{"service", "<name> [arg=value...]", "call a user defined service", shellControl("service", serviceControl), completeService},
+		{"camera", "<entity> -o <file>", "save an image from a camera", shellControl("camera", cameraControl), completeEntities(espgohome.Camera)},
+		{"states", "on|off", "show state changes as they happen", (*shell).states, completeOnOff},
+		{"logs", "<level>[,tag=level...]|off", "show the device logs as they happen", (*shell).logsCommand, completeLogs},
+		{"quit", "", "disconnect and exit", nil, nil},
+	}
+}
+
+func findShellCommand(name string) *shellCommand {
+	if name == "exit" {
+		name = "quit"
+	}
+	for _, cmd := range shellCommands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// defaultHistory returns the path of the history file in the home directory
+func defaultHistory() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".espgohome_history")
+}
+
+func runShell(o *options, args []string) error {
+	fs := o.flags()
+	history := fs.String("history", defaultHistory(), "command history `file`, empty to disable")
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, dev, err := o.load()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	info, err := c.DeviceInfo()
+	if err != nil {
+		return err
+	}
+	s, err := newShell(o, c, dev)
+	if err != nil {
+		return err
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(s.completeWord)
+
+	if *history != "" {
+		if f, err := os.Open(*history); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+		defer func() {
+			if f, err := os.Create(*history); err == nil {
+				line.WriteHistory(f)
+				f.Close()
+			}
+		}()
+	}
+
+	fmt.Fprintf(o.stdout, "connected to %s, type help for the list of commands\n", info.Name)
+	prompt := info.Name + "> "
+	for {
+		input, err := line.Prompt(prompt)
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprintln(o.stdout)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		if !s.exec(input) {
+			return nil
+		}
+		if c.Closed() {
+			return espgohome.ErrorClosed
+		}
+	}
+}
+
+// newShell subscribes to states so that the entities are kept up to date
+func newShell(o *options, c *espgohome.ESPHomeConnection, dev *entity.Device) (*shell, error) {
+	s := &shell{o: o, conn: c, dev: dev}
+	o.stderr = o.stdout
+
+	dev.Store().AddCallback(s.stateChanged)
+	if err := dev.Subscribe(); err != nil {
+		return nil, err
+	}
+	o.subscribed = true
+
+	return s, nil
+}
+
+// exec runs a line of input and returns false if the shell should exit
+func (s *shell) exec(input string) bool {
+	args, err := splitArgs(input)
+	if err != nil {
+		s.printf("error: %v\n", err)
+		return true
+	}
+	cmd := findShellCommand(args[0])
+	if cmd == nil {
+		s.printf("unknown command %q, type help for the list of commands\n", args[0])
+		return true
+	}
+	if cmd.run == nil {
+		return false
+	}
+	if err := cmd.run(s, args[1:]); err != nil && err != flag.ErrHelp {
+		s.printf("error: %v\n", err)
+	}
+
+	return true
+}
+
+// splitArgs splits a line into words, double quotes group words together
+func splitArgs(input string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// printf writes to the output without interleaving with the panes
+func (s *shell) printf(format string, v ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.o.stdout, format, v...)
+}
+
+// shellControl runs a CLI control on the shell's connection
+func shellControl(name string, ctl control) func(s *shell, args []string) error {
+	return func(s *shell, args []string) error {
+		// the shared flags are reset when a FlagSet is created, so each
+		// command gets its own copy of the options
+		o := *s.o
+		o.command = findCommand(name)
+
+		s.mu.Lock()
+		act, err := ctl(&o, o.flags(), args)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return act(s.dev)
+	}
+}
+
+func (s *shell) help(args []string) error {
+	if len(args) > 0 {
+		cmd := findShellCommand(args[0])
+		if cmd == nil {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		s.printf("%s %s\n  %s\n", cmd.name, cmd.args, cmd.summary)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(s.o.stdout, 0, 8, 2, ' ', 0)
+	for _, cmd := range shellCommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	return tw.Flush()
+}
+
+func (s *shell) list(args []string) error {
+	store := s.dev.Store()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tw := tabwriter.NewWriter(s.o.stdout, 0, 8, 2, ' ', 0)
+	for _, e := range store.Entities() {
+		t := espgohome.GetEntityType(e)
+		if len(args) > 0 && !strings.EqualFold(t.String(), args[0]) {
+			continue
+		}
+		st, _ := store.Get(e.GetKey())
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t, e.GetObjectId(), e.GetName(), formatState(e, st.State))
+	}
+	if len(args) == 0 || strings.EqualFold(args[0], "service") {
+		for _, svc := range s.dev.Services() {
+			fmt.Fprintf(tw, "Service\t%s\t%s\t\n", svc.Name, serviceSignature(svc))
+		}
+	}
+	return tw.Flush()
+}
+
+func (s *shell) get(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("get takes an entity")
+	}
+	e, err := findEntity(s.dev, args[0])
+	if err != nil {
+		return err
+	}
+	st, _ := s.dev.Store().Get(e.Key())
+	if st.State == nil {
+		s.printf("%s has no state yet\n", e.ObjectID())
+		return nil
+	}
+	s.printf("%s\n", protoJSON(st.State))
+	return nil
+}
+
+func (s *shell) info(args []string) error {
+	info, err := s.conn.DeviceInfo()
+	if err != nil {
+		return err
+	}
+	s.printf("%s\n", protoJSON(info))
+	return nil
+}
+
+func (s *shell) ping(args []string) error {
+	start := time.Now()
+	if err := s.conn.Ping(); err != nil {
+		return err
+	}
+	s.printf("time=%s\n", time.Since(start).Round(time.Microsecond))
+	return nil
+}
+
+func (s *shell) states(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("states takes on or off")
+	}
+	on, err := value.ParseOnOff(args[0])
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.showStates = on
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *shell) stateChanged(st espgohome.EntityState, previous proto.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.showStates {
+		fmt.Fprintf(s.o.stdout, "[state] %s %s: %s\n", st.Type, st.Entity.GetObjectId(), formatState(st.Entity, st.State))
+	}
+}
+
+func (s *shell) logsCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("logs takes a level or off")
+	}
+	if args[0] == "off" {
+		s.mu.Lock()
+		s.showLogs = false
+		s.mu.Unlock()
+		return nil
+	}
+
+	filter, err := logs.ParseFilter(args[0])
+	if err != nil {
+		return err
+	}
+	level := filter.MaxLevel()
+
+	s.mu.Lock()
+	s.showLogs = true
+	s.logFilter = filter
+	subscribed := s.logs != nil && s.logLevel == level
+	s.mu.Unlock()
+	if subscribed {
+		return nil
+	}
+
+	// there is no way to unsubscribe, so the previous subscription is left
+	// to drain and only the newest one is printed
+	ch, err := logs.Subscribe(s.conn, logs.Options{Filter: &logs.Filter{Level: level}})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.logs = ch
+	s.logLevel = level
+	s.mu.Unlock()
+
+	go s.printLogs(ch)
+
+	return nil
+}
+
+func (s *shell) printLogs(ch <-chan logs.Record) {
+	w := &logs.TextWriter{Out: s.o.stdout, TimeFormat: "-"}
+	for r := range ch {
+		s.mu.Lock()
+		if s.showLogs && s.logs == ch && s.logFilter.Match(r) {
+			w.WriteRecord(r)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// completeWord completes the word under the cursor
+func (s *shell) completeWord(line string, pos int) (string, []string, string) {
+	head, tail := line[:pos], line[pos:]
+	start := strings.LastIndexAny(head, " \t") + 1
+	words := strings.Fields(head[:start])
+	prefix := head[start:]
+
+	var candidates []string
+	if len(words) == 0 {
+		candidates = completeShellCommands(s, nil)
+	} else if cmd := findShellCommand(words[0]); cmd != nil && cmd.complete != nil {
+		candidates = cmd.complete(s, append(words[1:], prefix))
+	}
+
+	var completions []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			completions = append(completions, c)
+		}
+	}
+	sort.Strings(completions)
+
+	return head[:start], completions, tail
+}
+
+func completeShellCommands(s *shell, args []string) []string {
+	if len(args) > 1 {
+		return nil
+	}
+	var names []string
+	for _, cmd := range shellCommands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+func completeTypes(s *shell, args []string) []string {
+	if len(args) > 1 {
+		return nil
+	}
+	names := []string{"service"}
+	for _, t := range []espgohome.EntityID{
+		espgohome.BinarySensor, espgohome.Cover, espgohome.Fan, espgohome.Light, espgohome.Sensor,
+		espgohome.Switch, espgohome.TextSensor, espgohome.Camera, espgohome.Climate,
+	} {
+		names = append(names, strings.ToLower(t.String()))
+	}
+	return names
+}
+
+// objectIDs returns the object_ids of entities of type t, or all entities if
+// t is UndefinedEntity
+func (s *shell) objectIDs(t espgohome.EntityID) []string {
+	var ids []string
+	for _, e := range s.dev.Entities() {
+		if t == espgohome.UndefinedEntity || e.Type() == t {
+			ids = append(ids, e.ObjectID())
+		}
+	}
+	return ids
+}
+
+func completeEntities(t espgohome.EntityID) func(s *shell, args []string) []string {
+	return func(s *shell, args []string) []string {
+		if len(args) == 1 {
+			return s.objectIDs(t)
+		}
+		return nil
+	}
+}
+
+// completeActions completes an entity of type t followed by one of actions,
+// values completes the argument of an action
+func completeActions(t espgohome.EntityID, actions []string, values map[string][]string) func(s *shell, args []string) []string {
+	return func(s *shell, args []string) []string {
+		switch len(args) {
+		case 1:
+			return s.objectIDs(t)
+		case 2:
+			return actions
+		case 3:
+			return values[args[1]]
+		}
+		return nil
+	}
+}
+
+// enumNames returns the short names of the values of a protobuf enum
+func enumNames(names map[int32]string, prefixes []string) []string {
+	var short []string
+	for v := range names {
+		short = append(short, value.EnumString(names, prefixes, v))
+	}
+	return short
+}
+
+var onOffValues = []string{"on", "off"}
+
+var (
+	completeSwitch = completeActions(espgohome.Switch, []string{"on", "off", "toggle"}, nil)
+	completeLight  = completeActions(espgohome.Light, []string{"on", "off", "toggle"}, nil)
+	completeCover  = completeActions(espgohome.Cover, []string{"open", "close", "stop", "position", "tilt"}, nil)
+	completeFan    = completeActions(espgohome.Fan, []string{"on", "off", "speed", "oscillate", "direction"}, map[string][]string{
+		"speed":     enumNames(espgohome.FanSpeed_name, value.FanSpeedPrefixes),
+		"oscillate": onOffValues,
+		"direction": enumNames(espgohome.FanDirection_name, value.FanDirectionPrefixes),
+	})
+	completeClimate = completeActions(espgohome.Climate, []string{"mode", "target", "range", "away", "fan", "swing"}, map[string][]string{
+		"mode":  enumNames(espgohome.ClimateMode_name, value.ClimateModePrefixes),
+		"away":  onOffValues,
+		"fan":   enumNames(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes),
+		"swing": enumNames(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes),
+	})
+)
+
+func completeService(s *shell, args []string) []string {
+	if len(args) == 1 {
+		var names []string
+		for _, svc := range s.dev.Services() {
+			names = append(names, svc.Name)
+		}
+		return names
+	}
+
+	svc := s.dev.Service(args[0])
+	if svc == nil {
+		return nil
+	}
+	given := map[string]bool{}
+	for _, a := range args[1 : len(args)-1] {
+		given[strings.SplitN(a, "=", 2)[0]] = true
+	}
+	var names []string
+	for _, a := range svc.Args {
+		if !given[a.Name] {
+			names = append(names, a.Name+"=")
+		}
+	}
+	return names
+}
+
+func completeOnOff(s *shell, args []string) []string {
+	if len(args) == 1 {
+		return onOffValues
+	}
+	return nil
+}
+
+func completeLogs(s *shell, args []string) []string {
+	if len(args) == 1 {
+		return append(enumNames(espgohome.LogLevel_name, value.LogLevelPrefixes), "off")
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+func startShell(t *testing.T) (*shell, *bytes.Buffer) {
+	s, addr := startServer(t)
+	s.AddEntity(&espgohome.ListEntitiesFanResponse{ObjectId: "ceiling", Key: 4, Name: "Ceiling"})
+	s.AddEntity(&espgohome.ListEntitiesClimateResponse{ObjectId: "hvac", Key: 5, Name: "HVAC"})
+
+	var out bytes.Buffer
+	o := &options{command: findCommand("shell"), stdout: &out, stderr: &out}
+	o.flags().Parse([]string{"-host", addr, "-password", "secret"})
+
+	c, dev, err := o.load()
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	t.Cleanup(func() { o.disconnect(c) })
+
+	sh, err := newShell(o, c, dev)
+	if err != nil {
+		t.Fatalf("shell failed: %v", err)
+	}
+	return sh, &out
+}
+
+// output returns everything printed so far and resets the buffer
+func (s *shell) output(out *bytes.Buffer) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := out.String()
+	out.Reset()
+	return text
+}
+
+func TestShellCommands(t *testing.T) {
+	sh, out := startShell(t)
+
+	if !sh.exec("switch relay off") {
+		t.Fatal("switch exited the shell")
+	}
+	if text := sh.output(out); text != "" {
+		t.Errorf("unexpected output %q", text)
+	}
+
+	sh.exec("states on")
+	sh.exec("switch relay on")
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(sh.output(out), "[state] Switch relay: on") {
+		if time.Now().After(deadline) {
+			t.Fatal("state change not shown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sh.exec("states off")
+	sh.exec("list switch")
+	if text := sh.output(out); !strings.Contains(text, "relay") || strings.Contains(text, "temperature") {
+		t.Errorf("unexpected list %q", text)
+	}
+
+	sh.exec("switch temperature on")
+	if text := sh.output(out); !strings.Contains(text, "error: temperature is a Sensor") {
+		t.Errorf("expected an error, got %q", text)
+	}
+
+	sh.exec("bogus")
+	if text := sh.output(out); !strings.Contains(text, "unknown command") {
+		t.Errorf("expected unknown command, got %q", text)
+	}
+
+	if sh.exec("quit") {
+		t.Error("quit didn't exit the shell")
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	sh, _ := startShell(t)
+
+	for _, tc := range []struct {
+		line string
+		head string
+		want []string
+	}{
+		{"sw", "", []string{"switch"}},
+		{"switch ", "switch ", []string{"relay"}},
+		{"switch re", "switch ", []string{"relay"}},
+		{"switch relay t", "switch relay ", []string{"toggle"}},
+		{"fan ceiling speed ", "fan ceiling speed ", []string{"high", "low", "medium"}},
+		{"climate hvac swing h", "climate hvac swing ", []string{"horizontal"}},
+		{"service beep count=1 ", "service beep count=1 ", []string{"tones="}},
+		{"logs v", "logs ", []string{"verbose", "very_verbose"}},
+		{"get t", "get ", []string{"temperature"}},
+	} {
+		head, got, tail := sh.completeWord(tc.line, len(tc.line))
+		if head != tc.head || tail != "" || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q %v %q, want %q %v", tc.line, head, got, tail, tc.head, tc.want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`service say text="hello world"  count=2`)
+	if err != nil {
+		t.Fatalf("split failed: %v", err)
+	}
+	want := []string{"service", "say", "text=hello world", "count=2"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %q, want %q", args, want)
+	}
+
+	if _, err := splitArgs(`say "oops`); err == nil {
+		t.Error("accepted an unterminated quote")
+	}
+}
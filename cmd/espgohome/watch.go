@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// drain discards messages until the channel is closed, so that the receive
+// loop isn't blocked while disconnecting
+func drain(ch chan protoreflect.ProtoMessage) {
+	go func() {
+		for range ch {
+		}
+	}()
+}
+
+// interrupted returns a channel that receives SIGINT
+func interrupted() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	return ch
+}
+
+func runEntities(o *options, args []string) error {
+	fs := o.flags()
+	withStates := fs.Bool("states", false, "include the current states")
+	if _, err := o.parse(fs, args); err != nil {
+		return err
+	}
+
+	c, dev, err := o.load()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	if *withStates {
+		if err := dev.Subscribe(); err != nil {
+			return err
+		}
+		// devices send the initial states one at a time, wait until they
+		// have all arrived
+		deadline := time.Now().Add(o.timeout)
+		for time.Now().Before(deadline) && !allStates(dev.Store()) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	store := dev.Store()
+	if o.json {
+		out := struct {
+			Entities []entityJSON  `json:"entities"`
+			Services []serviceJSON `json:"services"`
+		}{Entities: []entityJSON{}, Services: []serviceJSON{}}
+
+		for _, e := range store.Entities() {
+			ej := entityJSON{
+				Type:     espgohome.GetEntityType(e).String(),
+				Key:      e.GetKey(),
+				ObjectID: e.GetObjectId(),
+				Name:     e.GetName(),
+			}
+			if u, ok := e.(interface{ GetUniqueId() string }); ok {
+				ej.UniqueID = u.GetUniqueId()
+			}
+			if st, ok := store.Get(e.GetKey()); ok && *withStates && st.State != nil {
+				ej.State = protoJSON(st.State)
+			}
+			out.Entities = append(out.Entities, ej)
+		}
+		for _, svc := range dev.Services() {
+			out.Services = append(out.Services, newServiceJSON(svc))
+		}
+		return o.printJSON(out)
+	}
+
+	tw := tabwriter.NewWriter(o.stdout, 0, 8, 2, ' ', 0)
+	if *withStates {
+		fmt.Fprintf(tw, "TYPE\tKEY\tOBJECT_ID\tNAME\tSTATE\n")
+	} else {
+		fmt.Fprintf(tw, "TYPE\tKEY\tOBJECT_ID\tNAME\n")
+	}
+	for _, e := range store.Entities() {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s", espgohome.GetEntityType(e), e.GetKey(), e.GetObjectId(), e.GetName())
+		if *withStates {
+			st, _ := store.Get(e.GetKey())
+			fmt.Fprintf(tw, "\t%s", formatState(e, st.State))
+		}
+		fmt.Fprintln(tw)
+	}
+	for _, svc := range dev.Services() {
+		fmt.Fprintf(tw, "Service\t%d\t%s\t%s\n", svc.Key, svc.Name, serviceSignature(svc))
+	}
+
+	return tw.Flush()
+}
+
+// allStates reports whether every entity that has a state has received one
+func allStates(store *espgohome.StateStore) bool {
+	for _, e := range store.Entities() {
+		if espgohome.GetEntityType(e) == espgohome.Camera {
+			continue
+		}
+		if st, ok := store.Get(e.GetKey()); !ok || st.State == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// stateJSON is how state changes are printed with -json
+type stateJSON struct {
+	Time     time.Time       `json:"time"`
+	Type     string          `json:"type"`
+	Key      uint32          `json:"key"`
+	ObjectID string          `json:"object_id"`
+	State    json.RawMessage `json:"state"`
+}
+
+func runWatch(o *options, args []string) error {
+	fs := o.flags()
+	count := fs.Int("count", 0, "exit after `n` state changes")
+	duration := fs.Duration("duration", 0, "exit after this long")
+	ids, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	c, dev, err := o.load()
+	if err != nil {
+		return err
+	}
+	defer o.disconnect(c)
+
+	var filters []espgohome.StateFilter
+	if len(ids) > 0 {
+		var objectIDs []string
+		for _, id := range ids {
+			e, err := findEntity(dev, id)
+			if err != nil {
+				return err
+			}
+			objectIDs = append(objectIDs, e.ObjectID())
+		}
+		filters = append(filters, espgohome.ObjectIDFilter(objectIDs...))
+	}
+
+	changes := make(chan espgohome.EntityState, 16)
+	stop := make(chan struct{})
+	defer close(stop)
+	dev.Store().AddCallback(func(st espgohome.EntityState, previous proto.Message) {
+		select {
+		case changes <- st:
+		case <-stop:
+		}
+	}, filters...)
+	if err := dev.Subscribe(); err != nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	interrupt := interrupted()
+
+	for n := 0; *count == 0 || n < *count; n++ {
+		select {
+		case st := <-changes:
+			o.printState(st)
+		case <-timeout:
+			return nil
+		case <-interrupt:
+			return nil
+		case <-c.Done():
+			return espgohome.ErrorClosed
+		}
+	}
+
+	return nil
+}
+
+func (o *options) printState(st espgohome.EntityState) {
+	if o.json {
+		o.printJSONLine(stateJSON{
+			Time:     st.Updated,
+			Type:     st.Type.String(),
+			Key:      st.Entity.GetKey(),
+			ObjectID: st.Entity.GetObjectId(),
+			State:    protoJSON(st.State),
+		})
+		return
+	}
+
+	fmt.Fprintf(o.stdout, "%s %s %s: %s\n", st.Updated.Format("15:04:05.000"), st.Type,
+		st.Entity.GetObjectId(), formatState(st.Entity, st.State))
+}
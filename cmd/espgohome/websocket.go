@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/wsbridge"
+)
+
+const envWebSocketToken = "ESPGOHOME_WS_TOKEN"
+
+func runWebSocket(o *options, args []string) error {
+	fs := o.flags()
+	listen := fs.String("listen", ":6080", "accept WebSocket clients on `address`")
+	token := fs.String("token", os.Getenv(envWebSocketToken), "`token` of the clients, a random one is printed if empty (default $"+envWebSocketToken+")")
+	addresses, err := o.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		*token = hex.EncodeToString(b)
+		fmt.Fprintf(o.stderr, "token: %s\n", *token)
+	}
+	m, err := o.manager(addresses)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	b := &wsbridge.Bridge{Manager: m, Token: *token, Logger: espgohome.StdLogger(espgohome.LevelInfo)}
+	if o.debug {
+		b.Logger = espgohome.StdLogger(espgohome.LevelDebug)
+	}
+	srv := &http.Server{Handler: b}
+	fmt.Fprintf(o.stderr, "serving %d devices on ws://%s\n", len(m.Devices()), l.Addr())
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	select {
+	case err := <-done:
+		return err
+	case <-interrupted():
+	}
+	// hijacked WebSockets aren't tracked by the server, they end with the
+	// connections to the devices when the manager closes
+	return srv.Shutdown(context.Background())
+}
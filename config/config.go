@@ -0,0 +1,222 @@
+// Package config reads the devices to connect to from a YAML file.
+//
+// Values can refer to environment variables as ${NAME} or ${NAME:-default}
+// and to the secrets file next to the configuration with the !secret tag, as
+// in ESPHome:
+//
+//	client_info: espgohome
+//	keepalive: 20s
+//	devices:
+//	  - address: lounge.local
+//	    password: !secret lounge_password
+//	  - address: ${GARAGE_ADDRESS}:6053
+//	    password_file: /run/secrets/garage
+//	    keepalive: 5s
+//	    log_level: debug
+//
+// A Watcher applies the file to a manager.Manager and reloads it when it
+// changes, adding and removing device connections as needed.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPort is added to the device addresses without one
+const DefaultPort = 6053
+
+// SecretsFile is the name of the secrets file LoadFile reads from the
+// directory of the configuration
+const SecretsFile = "secrets.yaml"
+
+// Config is the content of a configuration file
+type Config struct {
+	// ClientInfo, Keepalive and LogLevel are the defaults of the devices
+	ClientInfo string        `yaml:"client_info"`
+	Keepalive  time.Duration `yaml:"keepalive"`
+	LogLevel   string        `yaml:"log_level"`
+	Devices    []Device      `yaml:"devices"`
+}
+
+// Device is a device of the configuration. Once loaded the defaults of the
+// Config are filled in, the address has a port and the password file has
+// been read into Password.
+type Device struct {
+	// Address is host or host:port
+	Address      string `yaml:"address"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+	ClientInfo   string `yaml:"client_info"`
+	// Keepalive is how often the connection is pinged
+	Keepalive time.Duration `yaml:"keepalive"`
+	// LogLevel is the level of the diagnostic messages logged for the
+	// device: debug, info, warn, error or none
+	LogLevel string `yaml:"log_level"`
+}
+
+// DeviceConfig returns the manager configuration of the device
+func (d Device) DeviceConfig() manager.DeviceConfig {
+	cfg := manager.DeviceConfig{
+		Address:      d.Address,
+		Password:     d.Password,
+		ClientInfo:   d.ClientInfo,
+		PingInterval: d.Keepalive,
+	}
+	if d.LogLevel == "none" {
+		cfg.Logger = espgohome.NopLogger
+	} else if level, ok := levels[d.LogLevel]; ok {
+		cfg.Logger = espgohome.StdLogger(level)
+	}
+	return cfg
+}
+
+var levels = map[string]espgohome.Level{
+	"debug": espgohome.LevelDebug,
+	"info":  espgohome.LevelInfo,
+	"warn":  espgohome.LevelWarn,
+	"error": espgohome.LevelError,
+}
+
+// Load reads a configuration from YAML and validates it. secrets holds the
+// values of the !secret tags, it can be nil.
+func Load(r io.Reader, secrets map[string]string) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	if err := substitute(&root, secrets); err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if root.Kind != 0 {
+		// KnownFields only applies to Decoder, so the node is encoded
+		// again to be decoded strictly
+		b, err := yaml.Marshal(&root)
+		if err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+		dec := yaml.NewDecoder(strings.NewReader(string(b)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil {
+			return nil, fmt.Errorf("config: %v", err)
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// LoadFile reads a configuration from a YAML file, with the secrets of the
+// SecretsFile in the same directory if there is one
+func LoadFile(path string) (*Config, error) {
+	secrets, err := LoadSecretsFile(filepath.Join(filepath.Dir(path), SecretsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f, secrets)
+}
+
+// LoadSecretsFile reads a YAML file of names and values
+func LoadSecretsFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var secrets map[string]string
+	if err := yaml.Unmarshal(b, &secrets); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return secrets, nil
+}
+
+// validate checks the configuration and fills in the devices
+func (c *Config) validate() error {
+	if len(c.Devices) == 0 {
+		return errors.New("config: no devices")
+	}
+	if err := validateCommon(c.Keepalive, c.LogLevel); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	addresses := make(map[string]bool)
+	for i := range c.Devices {
+		d := &c.Devices[i]
+		if err := d.validate(c); err != nil {
+			return fmt.Errorf("config: device %d: %v", i+1, err)
+		}
+		if addresses[d.Address] {
+			return fmt.Errorf("config: duplicate device %s", d.Address)
+		}
+		addresses[d.Address] = true
+	}
+	return nil
+}
+
+func (d *Device) validate(c *Config) error {
+	if d.Address == "" {
+		return errors.New("no address")
+	}
+	host, port, err := net.SplitHostPort(d.Address)
+	if err != nil {
+		host, port = d.Address, strconv.Itoa(DefaultPort)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 || host == "" {
+		return fmt.Errorf("invalid address %q", d.Address)
+	}
+	d.Address = net.JoinHostPort(host, port)
+
+	if d.PasswordFile != "" {
+		if d.Password != "" {
+			return errors.New("password and password_file are both set")
+		}
+		b, err := ioutil.ReadFile(d.PasswordFile)
+		if err != nil {
+			return err
+		}
+		d.Password = strings.TrimRight(string(b), "\r\n")
+	}
+
+	if d.ClientInfo == "" {
+		d.ClientInfo = c.ClientInfo
+	}
+	if d.Keepalive == 0 {
+		d.Keepalive = c.Keepalive
+	}
+	if d.LogLevel == "" {
+		d.LogLevel = c.LogLevel
+	}
+	return validateCommon(d.Keepalive, d.LogLevel)
+}
+
+func validateCommon(keepalive time.Duration, level string) error {
+	if keepalive < 0 {
+		return fmt.Errorf("negative keepalive %s", keepalive)
+	}
+	if _, ok := levels[level]; !ok && level != "" && level != "none" {
+		return fmt.Errorf("invalid log_level %q, expected debug, info, warn, error or none", level)
+	}
+	return nil
+}
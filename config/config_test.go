@@ -0,0 +1,167 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwordFile := filepath.Join(dir, "garage")
+	if err := ioutil.WriteFile(passwordFile, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CONFIG_TEST_HOST", "10.0.0.5")
+	defer os.Unsetenv("CONFIG_TEST_HOST")
+
+	c, err := Load(strings.NewReader(`
+client_info: test
+keepalive: 20s
+devices:
+  - address: lounge.local
+    password: !secret lounge
+  - address: ${CONFIG_TEST_HOST}:${CONFIG_TEST_PORT:-6054}
+    password_file: `+passwordFile+`
+    keepalive: 5s
+    log_level: debug
+  - address: "[fe80::1]:6053"
+    password: pa$$word$
+`), map[string]string{"lounge": "secret"})
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	want := []Device{
+		{Address: "lounge.local:6053", Password: "secret", ClientInfo: "test", Keepalive: 20 * time.Second},
+		{Address: "10.0.0.5:6054", Password: "hunter2", PasswordFile: passwordFile, ClientInfo: "test", Keepalive: 5 * time.Second, LogLevel: "debug"},
+		{Address: "[fe80::1]:6053", Password: "pa$word$", ClientInfo: "test", Keepalive: 20 * time.Second},
+	}
+	if len(c.Devices) != len(want) {
+		t.Fatalf("unexpected devices %+v", c.Devices)
+	}
+	for i, d := range c.Devices {
+		if d != want[i] {
+			t.Errorf("got %+v, want %+v", d, want[i])
+		}
+	}
+	if cfg := c.Devices[1].DeviceConfig(); cfg.PingInterval != 5*time.Second || cfg.Logger == nil || !cfg.Logger.Enabled(espgohome.LevelDebug) {
+		t.Errorf("unexpected device config %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		"devices:\n  - address: a.local\n    password: !secret missing\n",
+		"devices:\n  - address: ${CONFIG_TEST_UNSET}\n",
+		"devices:\n  - address: a.local:http\n",
+		"devices:\n  - address: a.local\n  - address: a.local:6053\n",
+		"devices:\n  - address: a.local\n    log_level: loud\n",
+		"devices:\n  - address: a.local\n    keepalive: -1s\n",
+		"devices:\n  - address: a.local\n    pasword: x\n",
+		"devices:\n  - address: a.local\n    password: x\n    password_file: " + passwordFile + "\n",
+		"devices:\n  - password: x\n",
+		"devices: []\n",
+		"",
+	} {
+		if _, err := Load(strings.NewReader(bad), nil); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func startDevice(t *testing.T, name string) string {
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: name}}
+	return espgohometest.Serve(t, s)
+}
+
+func waitConnected(t *testing.T, m *manager.Manager, names ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var connected []string
+		for _, d := range m.Devices() {
+			if d.Connected() {
+				connected = append(connected, d.Name())
+			}
+		}
+		if strings.Join(connected, ",") == strings.Join(names, ",") && len(m.Devices()) == len(names) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got devices %v, want %v", connected, names)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "espgohome.yaml")
+	write := func(addresses ...string) {
+		s := "devices:\n"
+		for _, a := range addresses {
+			s += "  - address: " + a + "\n"
+		}
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kitchen, garage := startDevice(t, "kitchen"), startDevice(t, "garage")
+
+	m := manager.New("test-client")
+	defer m.Close()
+	write(kitchen)
+	reloads := make(chan *Config, 4)
+	w := &Watcher{Manager: m, Path: path, Interval: 10 * time.Millisecond}
+	w.OnReload = func(c *Config) {
+		if w.Config() != c {
+			t.Errorf("Config doesn't return the reloaded configuration")
+		}
+		reloads <- c
+	}
+	if err := w.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer w.Close()
+	<-reloads
+	waitConnected(t, m, "kitchen")
+
+	// an invalid file keeps the devices
+	if err := ioutil.WriteFile(path, []byte("devices: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err == nil {
+		t.Errorf("no error for an invalid file")
+	}
+	waitConnected(t, m, "kitchen")
+
+	write(garage)
+	select {
+	case c := <-reloads:
+		if len(c.Devices) != 1 || c.Devices[0].Address != garage {
+			t.Errorf("unexpected config %+v", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the file wasn't reloaded")
+	}
+	waitConnected(t, m, "garage")
+
+	write(garage, kitchen)
+	<-reloads
+	waitConnected(t, m, "garage", "kitchen")
+}
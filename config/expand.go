@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// variable matches $$ and ${NAME} or ${NAME:-default}, a $ on its own is
+// left alone so that passwords can contain one
+var variable = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// substitute replaces the !secret scalars of n by their values and expands
+// the environment variables in the other scalars
+func substitute(n *yaml.Node, secrets map[string]string) error {
+	for _, c := range n.Content {
+		if err := substitute(c, secrets); err != nil {
+			return err
+		}
+	}
+	if n.Kind != yaml.ScalarNode {
+		return nil
+	}
+
+	if n.Tag == "!secret" {
+		v, ok := secrets[n.Value]
+		if !ok {
+			return fmt.Errorf("config: line %d: unknown secret %q", n.Line, n.Value)
+		}
+		n.Tag, n.Value, n.Style = "!!str", v, yaml.DoubleQuotedStyle
+		return nil
+	}
+
+	v, err := expand(n.Value)
+	if err != nil {
+		return fmt.Errorf("config: line %d: %v", n.Line, err)
+	}
+	if v != n.Value {
+		n.Value = v
+		if n.Style == 0 && n.Tag == "!!str" {
+			// resolve the type of the new value, so that "${PORT}" can
+			// be a number
+			n.Tag = ""
+		}
+	}
+	return nil
+}
+
+// expand replaces the variables of s with their values in the environment
+func expand(s string) (string, error) {
+	var err error
+	v := variable.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		sub := variable.FindStringSubmatch(m)
+		if v, ok := os.LookupEnv(sub[1]); ok && v != "" {
+			return v
+		}
+		if len(sub[0]) > len(sub[1])+3 {
+			return sub[2]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", sub[1])
+		}
+		return ""
+	})
+	return v, err
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// ErrorWatcherClosed is returned by Reload once the Watcher is closed
+var ErrorWatcherClosed = errors.New("config: watcher closed")
+
+// DefaultInterval is how often the file is checked when Watcher.Interval is zero
+const DefaultInterval = 2 * time.Second
+
+// Watcher keeps the devices of a Manager in line with a configuration file
+type Watcher struct {
+	Manager *manager.Manager
+	Path    string
+	// Interval is how often the file is read again, a negative Interval only
+	// reloads it when Reload is called
+	Interval time.Duration
+	// OnReload is called with every new configuration once it is applied
+	OnReload func(*Config)
+	// Logger receives the changes and the errors of the reloads
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	// reload serializes the reloads and guards lastErr, mu guards config
+	// and closed so that Config can be called while reloading
+	reload  sync.Mutex
+	lastErr string
+	mu      sync.Mutex
+	config  *Config
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Start loads the file, adds its devices to the Manager and starts watching
+// the file. An invalid file is an error here, later it is logged and the
+// previous configuration kept.
+func (w *Watcher) Start() error {
+	if err := w.Reload(); err != nil {
+		return err
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run()
+	return nil
+}
+
+// Close stops watching the file, the devices are left to the Manager
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
+
+// Config returns the configuration in use
+func (w *Watcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.config
+}
+
+// Reload reads the file again and applies it if it changed: the devices no
+// longer listed or whose settings changed are removed from the Manager and
+// the new ones added. OnReload is called once the reload is done, it may
+// call the methods of the Watcher.
+func (w *Watcher) Reload() error {
+	w.reload.Lock()
+	c, err := w.apply()
+	w.reload.Unlock()
+
+	if c != nil && w.OnReload != nil {
+		w.OnReload(c)
+	}
+	return err
+}
+
+// apply reads the file and applies it, it returns the new configuration or
+// nil if it didn't change
+func (w *Watcher) apply() (*Config, error) {
+	c, err := LoadFile(w.Path)
+
+	w.mu.Lock()
+	closed, current := w.closed, w.config
+	w.mu.Unlock()
+	if closed {
+		return nil, ErrorWatcherClosed
+	}
+	if err != nil {
+		if err.Error() != w.lastErr {
+			w.log(espgohome.LevelError, "config: reload failed", "path", w.Path, "error", err)
+		}
+		w.lastErr = err.Error()
+		return nil, err
+	}
+	w.lastErr = ""
+
+	old := make(map[string]Device)
+	if current != nil {
+		for _, d := range current.Devices {
+			old[d.Address] = d
+		}
+	}
+	changed := current == nil
+	for _, d := range c.Devices {
+		if prev, ok := old[d.Address]; ok && prev == d {
+			delete(old, d.Address)
+			continue
+		}
+		changed = true
+	}
+	for address := range old {
+		changed = true
+		w.log(espgohome.LevelInfo, "config: removing device", "address", address)
+		if err := w.Manager.Remove(address); err != nil {
+			w.log(espgohome.LevelWarn, "config: remove failed", "address", address, "error", err)
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	for _, d := range c.Devices {
+		if _, err := w.Manager.Device(d.Address); err == nil {
+			continue
+		}
+		w.log(espgohome.LevelInfo, "config: adding device", "address", d.Address)
+		if _, err := w.Manager.Add(d.DeviceConfig()); err != nil {
+			w.log(espgohome.LevelError, "config: add failed", "address", d.Address, "error", err)
+		}
+	}
+	w.mu.Lock()
+	w.config = c
+	w.mu.Unlock()
+	return c, nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	if w.interval() < 0 {
+		<-w.stop
+		return
+	}
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Reload()
+		}
+	}
+}
+
+func (w *Watcher) interval() time.Duration {
+	if w.Interval != 0 {
+		return w.Interval
+	}
+	return DefaultInterval
+}
+
+func (w *Watcher) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(w.Logger, w.Debug).Log(level, msg, keyvals...)
+}
@@ -0,0 +1,198 @@
+// Package daemon runs the long-lived side of a process holding the
+// connections to the devices of a manager.Manager.
+//
+// A Daemon reports the state changes of every device, subscribes to the logs
+// of each device as it connects and serves health and readiness endpoints
+// for process supervisors. Shutting down closes the Manager, which sends a
+// DisconnectRequest to every connected device before closing its connection.
+package daemon
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrorDaemonClosed is returned by Start once the Daemon is closed
+var ErrorDaemonClosed = errors.New("daemon: closed")
+
+// Daemon follows the devices of a Manager
+type Daemon struct {
+	Manager *manager.Manager
+	// Logs selects the device logs to subscribe to, nil subscribes to none
+	Logs *logs.Filter
+	// OnState is called with every StateChanged event, the states are
+	// logged at LevelInfo if it is nil
+	OnState func(manager.Event)
+	// OnLog is called with the device log records, they are logged at the
+	// level matching theirs if it is nil
+	OnLog func(device string, r logs.Record)
+	// Logger receives the connection changes and, without OnState and
+	// OnLog, the states and device logs
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu         sync.Mutex
+	subscribed map[*manager.Device]*espgohome.ESPHomeConnection
+	started    bool
+	closed     bool
+	events     chan manager.Event
+	stop       chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Start starts following the devices
+func (d *Daemon) Start() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrorDaemonClosed
+	}
+	if d.started {
+		d.mu.Unlock()
+		return nil
+	}
+	d.started = true
+	d.subscribed = make(map[*manager.Device]*espgohome.ESPHomeConnection)
+	d.events = make(chan manager.Event, 64)
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	d.mu.Unlock()
+
+	d.Manager.AddListener(d.events)
+	for _, dev := range d.Manager.Devices() {
+		if dev.Connected() {
+			d.subscribeLogs(dev)
+		}
+	}
+	go d.run()
+
+	return nil
+}
+
+// Close stops following the devices, after which the readiness endpoint
+// fails. The Manager is left open for the caller to close, which
+// disconnects the devices.
+func (d *Daemon) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	started := d.started
+	d.mu.Unlock()
+
+	if !started {
+		return
+	}
+	d.Manager.RemoveListener(d.events)
+	close(d.stop)
+	<-d.done
+}
+
+// Shutdown closes the Daemon and then the Manager, sending a
+// DisconnectRequest to every connected device, and waits for the device
+// logs to end
+func (d *Daemon) Shutdown() {
+	d.Close()
+	n := 0
+	for _, dev := range d.Manager.Devices() {
+		if dev.Connected() {
+			n++
+		}
+	}
+	d.Manager.Close()
+	d.wg.Wait()
+	d.log(espgohome.LevelInfo, "daemon: shut down", "disconnected", n)
+}
+
+func (d *Daemon) run() {
+	defer close(d.done)
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case e := <-d.events:
+			d.handle(e)
+		}
+	}
+}
+
+func (d *Daemon) handle(e manager.Event) {
+	switch e.Type {
+	case manager.Connected:
+		d.log(espgohome.LevelInfo, "daemon: connected", "device", e.Device)
+		if dev, err := d.Manager.Device(e.Device); err == nil {
+			d.subscribeLogs(dev)
+		}
+	case manager.Disconnected:
+		d.log(espgohome.LevelWarn, "daemon: disconnected", "device", e.Device, "error", e.Err)
+	case manager.ConnectFailed:
+		d.log(espgohome.LevelDebug, "daemon: connect failed", "device", e.Device, "error", e.Err)
+	case manager.StateChanged:
+		if d.OnState != nil {
+			d.OnState(e)
+			return
+		}
+		b, _ := protojson.Marshal(e.State.State)
+		d.log(espgohome.LevelInfo, "daemon: state", "entity", e.EntityID(), "state", string(b))
+	}
+}
+
+// subscribeLogs delivers the logs of dev until its connection closes
+func (d *Daemon) subscribeLogs(dev *manager.Device) {
+	c := dev.Conn()
+	if c == nil || d.Logs == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.closed || d.subscribed[dev] == c {
+		d.mu.Unlock()
+		return
+	}
+	d.subscribed[dev] = c
+	d.mu.Unlock()
+
+	records, err := logs.Subscribe(c, logs.Options{Filter: d.Logs})
+	if err != nil {
+		d.log(espgohome.LevelWarn, "daemon: log subscription failed", "device", dev.Name(), "error", err)
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		name := dev.Name()
+		for r := range records {
+			if d.OnLog != nil {
+				d.OnLog(name, r)
+				continue
+			}
+			d.log(logLevel(r.Level), "daemon: log", "device", name, "tag", r.Tag, "message", r.Message)
+		}
+	}()
+}
+
+// logLevel returns the Level matching a device log level
+func logLevel(level espgohome.LogLevel) espgohome.Level {
+	switch level {
+	case espgohome.LogLevel_LOG_LEVEL_ERROR:
+		return espgohome.LevelError
+	case espgohome.LogLevel_LOG_LEVEL_WARN:
+		return espgohome.LevelWarn
+	case espgohome.LogLevel_LOG_LEVEL_INFO:
+		return espgohome.LevelInfo
+	}
+	return espgohome.LevelDebug
+}
+
+func (d *Daemon) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(d.Logger, d.Debug).Log(level, msg, keyvals...)
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+// sentLogger records the types of the messages sent by the connections
+type sentLogger struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (l *sentLogger) Enabled(espgohome.Level) bool { return true }
+
+func (l *sentLogger) Log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "type" && msg == "send" {
+			l.sent = append(l.sent, fmt.Sprint(keyvals[i+1]))
+		}
+	}
+}
+
+func startDevice(t *testing.T) (*server.Server, string) {
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "lounge"}}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: false})
+
+	return s, espgohometest.Serve(t, s)
+}
+
+func status(t *testing.T, h http.Handler, path string) (int, Status) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var s Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, s
+}
+
+func TestDaemon(t *testing.T) {
+	s, addr := startDevice(t)
+
+	m := manager.New("test-client")
+	sent := &sentLogger{}
+	m.Logger = sent
+	states := make(chan manager.Event, 16)
+	records := make(chan logs.Record, 16)
+	d := &Daemon{
+		Manager: m,
+		Logs:    &logs.Filter{Level: espgohome.LogLevel_LOG_LEVEL_INFO},
+		OnState: func(e manager.Event) { states <- e },
+		OnLog:   func(device string, r logs.Record) { records <- r },
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	h := d.Handler()
+
+	if _, err := m.Add(manager.DeviceConfig{Address: addr}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	select {
+	case e := <-states:
+		if e.EntityID() != "lounge/relay" {
+			t.Errorf("unexpected state %v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no initial state")
+	}
+	if code, st := status(t, h, "/readyz"); code != http.StatusOK || !st.Ready || len(st.Devices) != 1 || st.Devices[0].Name != "lounge" {
+		t.Errorf("unexpected readiness %d %+v", code, st)
+	}
+
+	// the log subscription is sent after the Connected event
+	deadline := time.Now().Add(2 * time.Second)
+	for len(records) == 0 && time.Now().Before(deadline) {
+		s.Log(espgohome.LogLevel_LOG_LEVEL_DEBUG, "wifi", "filtered")
+		s.Log(espgohome.LogLevel_LOG_LEVEL_INFO, "switch", "relay on")
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case r := <-records:
+		if r.Tag != "switch" || r.Message != "relay on" {
+			t.Errorf("unexpected record %+v", r)
+		}
+	default:
+		t.Fatal("no device logs")
+	}
+
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: true})
+	select {
+	case e := <-states:
+		if st, ok := e.State.State.(*espgohome.SwitchStateResponse); !ok || !st.State {
+			t.Errorf("unexpected state %v", e.State.State)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no state change")
+	}
+
+	d.Shutdown()
+	sent.mu.Lock()
+	if n := len(sent.sent); n == 0 || sent.sent[n-1] != espgohome.DisconnectRequestID.String() {
+		t.Errorf("no DisconnectRequest at the end of %v", sent.sent)
+	}
+	sent.mu.Unlock()
+	if code, st := status(t, h, "/readyz"); code != http.StatusServiceUnavailable || st.Ready {
+		t.Errorf("ready after shutdown: %d %+v", code, st)
+	}
+	if code, _ := status(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("unexpected health %d", code)
+	}
+}
+
+func TestNotReady(t *testing.T) {
+	m := manager.New("test-client")
+	m.MinBackoff = 10 * time.Millisecond
+	defer m.Close()
+	// nothing listens on the address of a closed listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if _, err := m.Add(manager.DeviceConfig{Address: l.Addr().String()}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	d := &Daemon{Manager: m}
+	if err := d.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer d.Close()
+	if code, st := status(t, d.Handler(), "/readyz"); code != http.StatusServiceUnavailable || st.Ready || st.Devices[0].Connected {
+		t.Errorf("unexpected readiness %d %+v", code, st)
+	}
+}
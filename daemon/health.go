@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DeviceStatus is the connection state of a device in the health reports
+type DeviceStatus struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	Connected  bool   `json:"connected"`
+	Reconnects int    `json:"reconnects"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Status is the body of the health and readiness responses
+type Status struct {
+	// Ready is set when the Daemon is running and every device is connected
+	Ready   bool           `json:"ready"`
+	Devices []DeviceStatus `json:"devices"`
+}
+
+// Status returns the state of the devices
+func (d *Daemon) Status() Status {
+	d.mu.Lock()
+	running := d.started && !d.closed
+	d.mu.Unlock()
+
+	s := Status{Ready: running, Devices: []DeviceStatus{}}
+	for _, dev := range d.Manager.Devices() {
+		ds := DeviceStatus{
+			Name:       dev.Name(),
+			Address:    dev.Config().Address,
+			Connected:  dev.Connected(),
+			Reconnects: dev.Reconnects(),
+		}
+		if err := dev.LastError(); err != nil {
+			ds.Error = err.Error()
+		}
+		if !ds.Connected {
+			s.Ready = false
+		}
+		s.Devices = append(s.Devices, ds)
+	}
+	return s
+}
+
+// Handler serves the health endpoints: /healthz answers 200 as long as the
+// process serves requests, /readyz answers 200 when every device is
+// connected and 503 otherwise or once the Daemon is closed. Both write the
+// Status as JSON.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, r, d.Status(), http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s := d.Status()
+		code := http.StatusOK
+		if !s.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeStatus(w, r, s, code)
+	})
+	return mux
+}
+
+func writeStatus(w http.ResponseWriter, r *http.Request, s Status, code int) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(s)
+	}
+}
@@ -0,0 +1,25 @@
+// Code generated by "stringer -type=Direction -trimprefix=Direction"; DO NOT EDIT.
+
+package espgohome
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[DirectionSent-1]
+	_ = x[DirectionReceived-2]
+}
+
+const _Direction_name = "SentReceived"
+
+var _Direction_index = [...]uint8{0, 4, 12}
+
+func (i Direction) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_Direction_index)-1 {
+		return "Direction(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _Direction_name[_Direction_index[idx]:_Direction_index[idx+1]]
+}
@@ -0,0 +1,414 @@
+package discovery
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// DefaultQueryInterval is the longest time between queries when
+// Browser.QueryInterval is zero
+const DefaultQueryInterval = time.Minute
+
+// Browser keeps track of the ESPHome devices advertised on the network
+type Browser struct {
+	// Interface to browse on, nil for the system default
+	Interface *net.Interface
+	// Group is the multicast address, DefaultGroup if empty
+	Group string
+	// QueryInterval is the longest time between queries, queries are sent
+	// more often right after Start
+	QueryInterval time.Duration
+	// Logger receives the diagnostic messages of the browser
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu        sync.Mutex
+	conn      *conn
+	instances map[string]*instance
+	hosts     map[string][]host
+	// listeners maps each listener to a channel closed when it is removed,
+	// which aborts a send in progress
+	listeners map[chan Event]chan struct{}
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// instance is what is known about a service instance
+type instance struct {
+	device   Device
+	hasSRV   bool
+	reported bool
+	queried  bool
+	expires  time.Time
+}
+
+// host is an address record
+type host struct {
+	ip      net.IP
+	expires time.Time
+}
+
+// Lookup browses the default interface for timeout and returns the devices
+// that were found
+func Lookup(timeout time.Duration) ([]Device, error) {
+	b := &Browser{}
+	return b.Lookup(timeout)
+}
+
+// Lookup starts the browser, waits for timeout and returns the devices that
+// were found. The browser is closed afterwards.
+func (b *Browser) Lookup(timeout time.Duration) ([]Device, error) {
+	if err := b.Start(); err != nil {
+		return nil, err
+	}
+	time.Sleep(timeout)
+	devices := b.Devices()
+	b.Close()
+
+	return devices, nil
+}
+
+// Start joins the multicast group and starts querying for devices
+func (b *Browser) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn != nil {
+		return errors.New("browser already started")
+	}
+	c, err := listen(b.Interface, b.Group)
+	if err != nil {
+		return err
+	}
+	b.conn = c
+	b.instances = make(map[string]*instance)
+	b.hosts = make(map[string][]host)
+	b.stopCh = make(chan struct{})
+	b.done = make(chan struct{})
+
+	c.run(b.handle)
+	go b.loop()
+
+	return nil
+}
+
+// Close stops browsing, listener channels are not closed
+func (b *Browser) Close() error {
+	b.mu.Lock()
+	c := b.conn
+	b.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	close(b.stopCh)
+	<-b.done
+	c.close()
+
+	b.mu.Lock()
+	b.conn = nil
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Devices returns the devices currently advertised, sorted by name
+func (b *Browser) Devices() []Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var devices []Device
+	for _, inst := range b.instances {
+		if inst.reported {
+			devices = append(devices, inst.device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+
+	return devices
+}
+
+// AddListener registers a channel to receive events. Sending blocks, so
+// listeners should be read promptly or removed.
+func (b *Browser) AddListener(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.listeners == nil {
+		b.listeners = make(map[chan Event]chan struct{})
+	}
+	if _, ok := b.listeners[ch]; !ok {
+		b.listeners[ch] = make(chan struct{})
+	}
+}
+
+// RemoveListener unregisters a channel, a send to it in progress is
+// abandoned so the channel doesn't need to be drained
+func (b *Browser) RemoveListener(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if removed, ok := b.listeners[ch]; ok {
+		close(removed)
+		delete(b.listeners, ch)
+	}
+}
+
+func (b *Browser) emit(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	type listener struct {
+		ch      chan Event
+		removed chan struct{}
+	}
+	b.mu.Lock()
+	listeners := make([]listener, 0, len(b.listeners))
+	for ch, removed := range b.listeners {
+		listeners = append(listeners, listener{ch, removed})
+	}
+	b.mu.Unlock()
+
+	for _, e := range events {
+		for _, l := range listeners {
+			select {
+			case l.ch <- e:
+			case <-l.removed:
+			}
+		}
+	}
+}
+
+func (b *Browser) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(b.Logger, b.Debug).Log(level, "discovery: "+msg, keyvals...)
+}
+
+func (b *Browser) queryInterval() time.Duration {
+	if b.QueryInterval > 0 {
+		return b.QueryInterval
+	}
+	return DefaultQueryInterval
+}
+
+// loop sends queries, starting at one second apart and doubling up to
+// QueryInterval, and expires records
+func (b *Browser) loop() {
+	defer close(b.done)
+
+	interval := time.Second
+	query := time.NewTimer(0)
+	defer query.Stop()
+	expire := time.NewTicker(time.Second)
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-query.C:
+			b.query()
+			query.Reset(interval)
+			interval *= 2
+			if interval > b.queryInterval() {
+				interval = b.queryInterval()
+			}
+		case now := <-expire.C:
+			b.emit(b.expire(now))
+		}
+	}
+}
+
+func (b *Browser) query() {
+	m := &message{Questions: []question{{Name: Service, Type: typePTR, Class: classIN}}}
+	if err := b.conn.send(m, nil); err != nil {
+		b.log(espgohome.LevelWarn, "query failed", "error", err)
+	}
+}
+
+// resolve asks for the records of an instance that only has a PTR record
+func (b *Browser) resolve(name string, hostName string) {
+	m := &message{Questions: []question{
+		{Name: instanceName(name), Type: typeSRV, Class: classIN},
+		{Name: instanceName(name), Type: typeTXT, Class: classIN},
+	}}
+	if hostName != "" {
+		m.Questions = append(m.Questions, question{Name: hostName, Type: typeA, Class: classIN})
+	}
+	if err := b.conn.send(m, nil); err != nil {
+		b.log(espgohome.LevelWarn, "resolve failed", "instance", name, "error", err)
+	}
+}
+
+// handle processes a message from either socket
+func (b *Browser) handle(m *message, from *net.UDPAddr) {
+	if !m.response() {
+		return
+	}
+
+	now := time.Now()
+	var toResolve []*instance
+
+	b.mu.Lock()
+	if b.conn == nil {
+		b.mu.Unlock()
+		return
+	}
+
+	flushed := map[string]bool{}
+	for _, rr := range m.records() {
+		switch rr.Type {
+		case typePTR:
+			if !sameName(rr.Name, Service) {
+				continue
+			}
+			name, ok := splitInstance(rr.Target)
+			if !ok {
+				continue
+			}
+			inst := b.instance(name)
+			inst.expires = now.Add(ttl(rr.TTL))
+		case typeSRV, typeTXT:
+			name, ok := splitInstance(rr.Name)
+			if !ok {
+				continue
+			}
+			inst := b.instance(name)
+			if rr.TTL == 0 {
+				inst.expires = now
+				continue
+			}
+			if inst.expires.Before(now.Add(ttl(rr.TTL))) {
+				inst.expires = now.Add(ttl(rr.TTL))
+			}
+			if rr.Type == typeSRV {
+				inst.device.Host = strings.ToLower(rr.Target)
+				inst.device.Port = int(rr.Port)
+				inst.hasSRV = true
+			} else {
+				inst.device.setTXT(rr.Text)
+			}
+		case typeA, typeAAAA:
+			key := strings.ToLower(rr.Name)
+			if rr.Class&classTopBit != 0 && !flushed[key] {
+				// cache flush, this message has the complete set of addresses
+				flushed[key] = true
+				b.hosts[key] = nil
+			}
+			b.addHost(key, rr.IP, now.Add(ttl(rr.TTL)))
+		}
+	}
+
+	var events []Event
+	for key, inst := range b.instances {
+		if !inst.expires.After(now) {
+			// goodbye packet
+			delete(b.instances, key)
+			if inst.reported {
+				events = append(events, Event{Type: Removed, Device: inst.device})
+			}
+			continue
+		}
+		if !inst.hasSRV || len(b.hosts[inst.device.Host]) == 0 {
+			if !inst.queried {
+				inst.queried = true
+				toResolve = append(toResolve, inst)
+			}
+			continue
+		}
+		if e, ok := b.update(inst); ok {
+			events = append(events, e)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, inst := range toResolve {
+		b.log(espgohome.LevelDebug, "resolving", "instance", inst.device.Name)
+		b.resolve(inst.device.Name, inst.device.Host)
+	}
+	b.emit(events)
+}
+
+// instance returns the named instance, creating it if needed
+func (b *Browser) instance(name string) *instance {
+	key := strings.ToLower(name)
+	inst, ok := b.instances[key]
+	if !ok {
+		inst = &instance{device: Device{Name: name}}
+		b.instances[key] = inst
+	}
+	return inst
+}
+
+func (b *Browser) addHost(key string, ip net.IP, expires time.Time) {
+	hosts := b.hosts[key]
+	for i := range hosts {
+		if hosts[i].ip.Equal(ip) {
+			hosts[i].expires = expires
+			return
+		}
+	}
+	b.hosts[key] = append(hosts, host{ip: ip, expires: expires})
+}
+
+// update refreshes the addresses of a resolved instance and returns the
+// event to send, if any
+func (b *Browser) update(inst *instance) (Event, bool) {
+	prev := inst.device
+	var ips []net.IP
+	for _, h := range b.hosts[inst.device.Host] {
+		ips = append(ips, h.ip)
+	}
+	inst.device.IPs = ips
+
+	switch {
+	case !inst.reported:
+		inst.reported = true
+		return Event{Type: Added, Device: inst.device}, true
+	case !prev.equal(inst.device):
+		return Event{Type: Updated, Device: inst.device}, true
+	}
+	return Event{}, false
+}
+
+// expire removes records whose TTL has passed and returns the events to send
+func (b *Browser) expire(now time.Time) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, hosts := range b.hosts {
+		var live []host
+		for _, h := range hosts {
+			if h.expires.After(now) {
+				live = append(live, h)
+			}
+		}
+		b.hosts[key] = live
+	}
+
+	var events []Event
+	for key, inst := range b.instances {
+		if !inst.expires.After(now) {
+			delete(b.instances, key)
+			if inst.reported {
+				events = append(events, Event{Type: Removed, Device: inst.device})
+			}
+			continue
+		}
+		if inst.reported {
+			if e, ok := b.update(inst); ok {
+				events = append(events, e)
+			}
+		}
+	}
+
+	return events
+}
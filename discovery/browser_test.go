@@ -0,0 +1,137 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// testGroup returns a multicast address with an unused port so tests don't
+// see real devices
+func testGroup(t *testing.T) (*net.Interface, string) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	port := l.LocalAddr().(*net.UDPAddr).Port
+	l.Close()
+
+	return lo, fmt.Sprintf("224.0.0.251:%d", port)
+}
+
+func startResponder(t *testing.T, iface *net.Interface, group string, name string) *Responder {
+	r := &Responder{
+		Interface: iface,
+		Group:     group,
+		Device: Device{
+			Name:     name,
+			Port:     6053,
+			IPs:      []net.IP{net.IPv4(127, 0, 0, 1)},
+			Version:  "1.15.0",
+			MAC:      "aabbccddeeff",
+			Platform: "ESP32",
+			Network:  "wifi",
+		},
+	}
+	if err := r.Start(); err != nil {
+		t.Skipf("multicast not available: %v", err)
+	}
+	return r
+}
+
+func waitFor(t *testing.T, events chan Event, typ EventType) Event {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		if e.Type != typ {
+			t.Fatalf("expected %s, got %s", typ, e.Type)
+		}
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for %s", typ)
+	}
+	return Event{}
+}
+
+func TestBrowse(t *testing.T) {
+	iface, group := testGroup(t)
+	r := startResponder(t, iface, group, "kitchen")
+
+	b := &Browser{Interface: iface, Group: group}
+	events := make(chan Event, 16)
+	b.AddListener(events)
+	if err := b.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer b.Close()
+
+	e := waitFor(t, events, Added)
+	d := e.Device
+	if d.Name != "kitchen" || d.Host != "kitchen.local." {
+		t.Errorf("unexpected device %+v", d)
+	}
+	if d.Address() != "127.0.0.1:6053" {
+		t.Errorf("expected 127.0.0.1:6053, got %s", d.Address())
+	}
+	if d.Version != "1.15.0" || d.MAC != "aabbccddeeff" || d.Platform != "ESP32" || d.Network != "wifi" {
+		t.Errorf("unexpected TXT fields %+v", d)
+	}
+	if len(b.Devices()) != 1 {
+		t.Errorf("expected 1 device, got %d", len(b.Devices()))
+	}
+
+	r.Close()
+	e = waitFor(t, events, Removed)
+	if e.Device.Name != "kitchen" {
+		t.Errorf("expected kitchen to be removed, got %s", e.Device.Name)
+	}
+	if len(b.Devices()) != 0 {
+		t.Errorf("expected no devices, got %d", len(b.Devices()))
+	}
+}
+
+func TestLookup(t *testing.T) {
+	iface, group := testGroup(t)
+	r1 := startResponder(t, iface, group, "kitchen")
+	defer r1.Close()
+	r2 := startResponder(t, iface, group, "garage")
+	defer r2.Close()
+
+	b := &Browser{Interface: iface, Group: group}
+	devices, err := b.Lookup(500 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+	if devices[0].Name != "garage" || devices[1].Name != "kitchen" {
+		t.Errorf("unexpected devices %v", devices)
+	}
+}
+
+func TestRemoveBlockedListener(t *testing.T) {
+	b := &Browser{}
+	stuck := make(chan Event)
+	b.AddListener(stuck)
+
+	done := make(chan struct{})
+	go func() {
+		b.emit([]Event{{Type: Added, Device: Device{Name: "kitchen"}}})
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	b.RemoveListener(stuck)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("emit still blocked on a removed listener")
+	}
+}
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"net"
+	"sync"
+)
+
+// conn is the pair of sockets used by Browsers and Responders. group is joined
+// to the multicast group to see queries and announcements from everyone,
+// unicast sends our own packets and receives replies to legacy queries.
+type conn struct {
+	group   *net.UDPAddr
+	mc      *net.UDPConn
+	unicast *net.UDPConn
+
+	wg sync.WaitGroup
+}
+
+// listen joins the multicast group on iface, or the system default
+// interface if iface is nil
+func listen(iface *net.Interface, group string) (*conn, error) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+
+	mc, err := net.ListenMulticastUDP("udp4", iface, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// binding to an address of the interface makes multicast packets leave
+	// through it rather than through the default route
+	local := &net.UDPAddr{IP: net.IPv4zero}
+	if ip := interfaceIPv4(iface); ip != nil {
+		local.IP = ip
+	}
+	unicast, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		mc.Close()
+		return nil, err
+	}
+
+	return &conn{group: addr, mc: mc, unicast: unicast}, nil
+}
+
+// interfaceIPv4 returns the first IPv4 address of iface, or nil
+func interfaceIPv4(iface *net.Interface) net.IP {
+	for _, ip := range interfaceIPs(iface) {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// interfaceIPs returns the addresses of iface
+func interfaceIPs(iface *net.Interface) []net.IP {
+	if iface == nil {
+		return nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips
+}
+
+// run calls handler with every valid message received on either socket until
+// the conn is closed
+func (c *conn) run(handler func(m *message, from *net.UDPAddr)) {
+	for _, s := range []*net.UDPConn{c.mc, c.unicast} {
+		c.wg.Add(1)
+		go func(s *net.UDPConn) {
+			defer c.wg.Done()
+
+			buf := make([]byte, 9000)
+			for {
+				n, from, err := s.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				m, err := unpack(buf[:n])
+				if err != nil {
+					continue
+				}
+				handler(m, from)
+			}
+		}(s)
+	}
+}
+
+// send sends m to the multicast group, or to a specific address
+func (c *conn) send(m *message, to *net.UDPAddr) error {
+	b, err := m.pack()
+	if err != nil {
+		return err
+	}
+	if to == nil {
+		to = c.group
+	}
+	_, err = c.unicast.WriteToUDP(b, to)
+
+	return err
+}
+
+// close closes both sockets and waits for run to return
+func (c *conn) close() {
+	c.mc.Close()
+	c.unicast.Close()
+	c.wg.Wait()
+}
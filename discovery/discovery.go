@@ -0,0 +1,148 @@
+// Package discovery finds ESPHome devices on the local network with mDNS /
+// DNS-SD.
+//
+// ESPHome nodes advertise the native API as the _esphomelib._tcp service with
+// TXT records describing the firmware. A Browser keeps track of the devices
+// that are currently advertised and notifies listeners as they come and go,
+// Lookup does a one-shot query. A Responder advertises a device and is mostly
+// useful for tests and for the server package.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service is the DNS-SD service type advertised by ESPHome devices
+const Service = "_esphomelib._tcp.local."
+
+// DefaultGroup is the IPv4 mDNS multicast address
+const DefaultGroup = "224.0.0.251:5353"
+
+// Device is an ESPHome device found on the network
+type Device struct {
+	// Name is the service instance name, which is the ESPHome node name
+	Name string
+	// Host is the host name from the SRV record, e.g. "kitchen.local."
+	Host string
+	Port int
+	IPs  []net.IP
+	// Version, MAC, Platform, Board and Network are taken from the TXT record
+	Version  string
+	MAC      string
+	Platform string
+	Board    string
+	Network  string
+	// TXT holds every key=value pair from the TXT record
+	TXT map[string]string
+}
+
+// Address returns the host:port of the native API, preferring an IPv4 address
+func (d Device) Address() string {
+	host := strings.TrimSuffix(d.Host, ".")
+	if len(d.IPs) > 0 {
+		host = d.IPs[0].String()
+	}
+	for _, ip := range d.IPs {
+		if ip.To4() != nil {
+			host = ip.String()
+			break
+		}
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(d.Port))
+}
+
+func (d Device) String() string {
+	return fmt.Sprintf("%s (%s)", d.Name, d.Address())
+}
+
+func (d Device) equal(o Device) bool {
+	if d.Name != o.Name || d.Host != o.Host || d.Port != o.Port || len(d.IPs) != len(o.IPs) || len(d.TXT) != len(o.TXT) {
+		return false
+	}
+	for i := range d.IPs {
+		if !d.IPs[i].Equal(o.IPs[i]) {
+			return false
+		}
+	}
+	for k, v := range d.TXT {
+		if o.TXT[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// setTXT fills in TXT and the well known fields from the strings of a TXT record
+func (d *Device) setTXT(text []string) {
+	d.TXT = make(map[string]string, len(text))
+	for _, s := range text {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) == 2 {
+			d.TXT[kv[0]] = kv[1]
+		} else {
+			d.TXT[kv[0]] = ""
+		}
+	}
+	d.Version = d.TXT["version"]
+	d.MAC = d.TXT["mac"]
+	d.Platform = d.TXT["platform"]
+	d.Board = d.TXT["board"]
+	d.Network = d.TXT["network"]
+}
+
+// text returns the TXT record strings for the device, sorted by key
+func (d Device) text() []string {
+	txt := map[string]string{}
+	for k, v := range d.TXT {
+		txt[k] = v
+	}
+	for k, v := range map[string]string{
+		"version":  d.Version,
+		"mac":      d.MAC,
+		"platform": d.Platform,
+		"board":    d.Board,
+		"network":  d.Network,
+	} {
+		if v != "" {
+			txt[k] = v
+		}
+	}
+
+	text := make([]string, 0, len(txt))
+	for k, v := range txt {
+		text = append(text, k+"="+v)
+	}
+	sort.Strings(text)
+
+	return text
+}
+
+// instanceName returns the name of the service instance, e.g.
+// "kitchen._esphomelib._tcp.local."
+func instanceName(name string) string {
+	return name + "." + Service
+}
+
+// splitInstance returns the instance part of a service instance name, or
+// false if the name is not an instance of Service
+func splitInstance(name string) (string, bool) {
+	if len(name) <= len(Service)+1 || !sameName(name[len(name)-len(Service):], Service) {
+		return "", false
+	}
+	instance := name[:len(name)-len(Service)-1]
+	if instance == "" || strings.Contains(instance, ".") {
+		return "", false
+	}
+	return instance, true
+}
+
+// ttl converts a record TTL to a duration
+func ttl(seconds uint32) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
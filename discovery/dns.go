@@ -0,0 +1,352 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// The subset of DNS (RFC 1035) needed for mDNS service discovery
+
+const (
+	typeA    uint16 = 1
+	typePTR  uint16 = 12
+	typeTXT  uint16 = 16
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+	typeANY  uint16 = 255
+
+	classIN uint16 = 1
+	// in questions the top bit of the class asks for a unicast response, in
+	// answers it tells caches to replace earlier records (RFC 6762 10.2)
+	classTopBit uint16 = 1 << 15
+
+	flagResponse      uint16 = 1 << 15
+	flagAuthoritative uint16 = 1 << 10
+)
+
+var errorMalformed = errors.New("malformed DNS message")
+
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type record struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	// Target is set for PTR and SRV records
+	Target string
+	// Priority, Weight and Port are set for SRV records
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	// Text is set for TXT records
+	Text []string
+	// IP is set for A and AAAA records
+	IP net.IP
+}
+
+type message struct {
+	ID          uint16
+	Flags       uint16
+	Questions   []question
+	Answers     []record
+	Authorities []record
+	Additionals []record
+}
+
+func (m *message) response() bool {
+	return m.Flags&flagResponse != 0
+}
+
+// records returns the answers, authorities and additionals
+func (m *message) records() []record {
+	var rrs []record
+	rrs = append(rrs, m.Answers...)
+	rrs = append(rrs, m.Authorities...)
+	return append(rrs, m.Additionals...)
+}
+
+// sameName compares domain names case insensitively
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+func (m *message) pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], m.Flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authorities)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additionals)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = packName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+	for _, section := range [][]record{m.Answers, m.Authorities, m.Additionals} {
+		for _, rr := range section {
+			if b, err = packRecord(b, rr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// packName appends name without compression, labels may not contain dots
+func packName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, errors.New("invalid label in " + name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+func packRecord(b []byte, rr record) ([]byte, error) {
+	var err error
+	if b, err = packName(b, rr.Name); err != nil {
+		return nil, err
+	}
+	b = appendUint16(b, rr.Type)
+	b = appendUint16(b, rr.Class)
+	b = appendUint32(b, rr.TTL)
+
+	// reserve the length and fill it in once the data is written
+	lenAt := len(b)
+	b = append(b, 0, 0)
+
+	switch rr.Type {
+	case typePTR:
+		b, err = packName(b, rr.Target)
+	case typeSRV:
+		b = appendUint16(b, rr.Priority)
+		b = appendUint16(b, rr.Weight)
+		b = appendUint16(b, rr.Port)
+		b, err = packName(b, rr.Target)
+	case typeTXT:
+		if len(rr.Text) == 0 {
+			// a TXT record must contain at least one string
+			b = append(b, 0)
+		}
+		for _, s := range rr.Text {
+			if len(s) > 255 {
+				return nil, errors.New("TXT string too long")
+			}
+			b = append(b, byte(len(s)))
+			b = append(b, s...)
+		}
+	case typeA:
+		ip := rr.IP.To4()
+		if ip == nil {
+			return nil, errors.New("A record without an IPv4 address")
+		}
+		b = append(b, ip...)
+	case typeAAAA:
+		ip := rr.IP.To16()
+		if ip == nil {
+			return nil, errors.New("AAAA record without an IPv6 address")
+		}
+		b = append(b, ip...)
+	default:
+		return nil, errors.New("unsupported record type")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	binary.BigEndian.PutUint16(b[lenAt:], uint16(len(b)-lenAt-2))
+
+	return b, nil
+}
+
+func unpack(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errorMalformed
+	}
+
+	m := &message{
+		ID:    binary.BigEndian.Uint16(b[0:]),
+		Flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	qdcount := int(binary.BigEndian.Uint16(b[4:]))
+	counts := []int{
+		int(binary.BigEndian.Uint16(b[6:])),
+		int(binary.BigEndian.Uint16(b[8:])),
+		int(binary.BigEndian.Uint16(b[10:])),
+	}
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		name, n, err := unpackName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, errorMalformed
+		}
+		m.Questions = append(m.Questions, question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[off:]),
+			Class: binary.BigEndian.Uint16(b[off+2:]),
+		})
+		off += 4
+	}
+
+	sections := []*[]record{&m.Answers, &m.Authorities, &m.Additionals}
+	for i, count := range counts {
+		for j := 0; j < count; j++ {
+			rr, n, err := unpackRecord(b, off)
+			if err != nil {
+				return nil, err
+			}
+			off = n
+			if rr != nil {
+				*sections[i] = append(*sections[i], *rr)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// unpackName reads a possibly compressed name at off and returns it with a
+// trailing dot along with the offset following it
+func unpackName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	// every pointer must point backwards, which also prevents loops
+	limit := off
+
+	for {
+		if off >= len(b) {
+			return "", 0, errorMalformed
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			off++
+			if end < 0 {
+				end = off
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errorMalformed
+			}
+			ptr := int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			if ptr >= limit {
+				return "", 0, errorMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = ptr
+			limit = ptr
+		case l&0xc0 != 0:
+			return "", 0, errorMalformed
+		default:
+			off++
+			if off+l > len(b) {
+				return "", 0, errorMalformed
+			}
+			labels = append(labels, string(b[off:off+l]))
+			off += l
+		}
+	}
+}
+
+// unpackRecord reads the record at off, records of unsupported types are
+// skipped and returned as nil
+func unpackRecord(b []byte, off int) (*record, int, error) {
+	name, off, err := unpackName(b, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if off+10 > len(b) {
+		return nil, 0, errorMalformed
+	}
+	rr := &record{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(b[off:]),
+		Class: binary.BigEndian.Uint16(b[off+2:]),
+		TTL:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+	end := off + length
+	if end > len(b) {
+		return nil, 0, errorMalformed
+	}
+	data := b[off:end]
+
+	switch rr.Type {
+	case typePTR:
+		if rr.Target, _, err = unpackName(b, off); err != nil {
+			return nil, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return nil, 0, errorMalformed
+		}
+		rr.Priority = binary.BigEndian.Uint16(data[0:])
+		rr.Weight = binary.BigEndian.Uint16(data[2:])
+		rr.Port = binary.BigEndian.Uint16(data[4:])
+		if rr.Target, _, err = unpackName(b, off+6); err != nil {
+			return nil, 0, err
+		}
+	case typeTXT:
+		for i := 0; i < len(data); {
+			l := int(data[i])
+			i++
+			if i+l > len(data) {
+				return nil, 0, errorMalformed
+			}
+			if l > 0 {
+				rr.Text = append(rr.Text, string(data[i:i+l]))
+			}
+			i += l
+		}
+	case typeA:
+		if length != net.IPv4len {
+			return nil, 0, errorMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), data...))
+	case typeAAAA:
+		if length != net.IPv6len {
+			return nil, 0, errorMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), data...))
+	default:
+		return nil, end, nil
+	}
+
+	return rr, end, nil
+}
@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	m := &message{
+		ID:        7,
+		Flags:     flagResponse | flagAuthoritative,
+		Questions: []question{{Name: Service, Type: typePTR, Class: classIN}},
+		Answers: []record{
+			{Name: Service, Type: typePTR, Class: classIN, TTL: 4500, Target: "kitchen." + Service},
+			{Name: "kitchen." + Service, Type: typeSRV, Class: classIN | classTopBit, TTL: 120, Port: 6053, Target: "kitchen.local."},
+			{Name: "kitchen." + Service, Type: typeTXT, Class: classIN, TTL: 120, Text: []string{"version=1.15.0", "mac=aabbccddeeff"}},
+		},
+		Additionals: []record{
+			{Name: "kitchen.local.", Type: typeA, Class: classIN, TTL: 120, IP: net.IPv4(192, 168, 1, 20).To4()},
+			{Name: "kitchen.local.", Type: typeAAAA, Class: classIN, TTL: 120, IP: net.ParseIP("fe80::1")},
+		},
+	}
+
+	b, err := m.pack()
+	if err != nil {
+		t.Fatalf("pack failed: %v", err)
+	}
+	got, err := unpack(b)
+	if err != nil {
+		t.Fatalf("unpack failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, m)
+	}
+}
+
+func TestUnpackCompressed(t *testing.T) {
+	b := []byte{
+		0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0,
+		// offset 12: _esphomelib._tcp.local.
+		11, '_', 'e', 's', 'p', 'h', 'o', 'm', 'e', 'l', 'i', 'b',
+		4, '_', 't', 'c', 'p',
+		5, 'l', 'o', 'c', 'a', 'l', 0,
+		0, 12, 0, 1, 0, 0, 0x11, 0x94,
+		0, 10,
+		// kitchen + pointer to offset 12
+		7, 'k', 'i', 't', 'c', 'h', 'e', 'n', 0xc0, 12,
+	}
+
+	m, err := unpack(b)
+	if err != nil {
+		t.Fatalf("unpack failed: %v", err)
+	}
+	if len(m.Answers) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(m.Answers))
+	}
+	rr := m.Answers[0]
+	if rr.Name != Service || rr.Target != "kitchen."+Service || rr.TTL != 4500 {
+		t.Errorf("unexpected record %+v", rr)
+	}
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"short":     {0, 0, 0},
+		"loop":      {0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12, 0, 1, 0, 1},
+		"truncated": {0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 9, 'a'},
+	} {
+		if _, err := unpack(b); err == nil {
+			t.Errorf("%s: unpacked a malformed message", name)
+		}
+	}
+}
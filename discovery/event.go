@@ -0,0 +1,21 @@
+package discovery
+
+// EventType identifies the kind of an Event
+type EventType int
+
+//go:generate stringer -type=EventType
+
+const (
+	// Added is sent once a device has been resolved to an address
+	Added EventType = 1
+	// Updated is sent when the address or TXT record of a device changes
+	Updated EventType = 2
+	// Removed is sent when a device says goodbye or its records expire
+	Removed EventType = 3
+)
+
+// Event is sent to Browser listeners
+type Event struct {
+	Type   EventType
+	Device Device
+}
@@ -0,0 +1,26 @@
+// Code generated by "stringer -type=EventType"; DO NOT EDIT.
+
+package discovery
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[Added-1]
+	_ = x[Updated-2]
+	_ = x[Removed-3]
+}
+
+const _EventType_name = "AddedUpdatedRemoved"
+
+var _EventType_index = [...]uint8{0, 5, 12, 19}
+
+func (i EventType) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_EventType_index)-1 {
+		return "EventType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _EventType_name[_EventType_index[idx]:_EventType_index[idx+1]]
+}
@@ -0,0 +1,240 @@
+package discovery
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// DefaultTTL is the TTL of advertised records when Responder.TTL is zero
+const DefaultTTL = 120 * time.Second
+
+// legacyTTL caps the TTL of answers to legacy unicast queries (RFC 6762 6.7)
+const legacyTTL = 10
+
+// Responder advertises a device as an _esphomelib._tcp service
+type Responder struct {
+	// Interface to advertise on, nil for the system default
+	Interface *net.Interface
+	// Group is the multicast address, DefaultGroup if empty
+	Group string
+	// Device is the device to advertise. Name and Port are required, Host
+	// defaults to Name.local. and IPs to the addresses of Interface.
+	Device Device
+	TTL    time.Duration
+	// Logger receives the diagnostic messages of the responder
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// Start joins the multicast group, announces the device and answers queries
+// for it until Close is called
+func (r *Responder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn != nil {
+		return errors.New("responder already started")
+	}
+	if r.Device.Name == "" || r.Device.Port == 0 {
+		return errors.New("responder needs a device name and port")
+	}
+	if r.Device.Host == "" {
+		r.Device.Host = r.Device.Name + ".local."
+	}
+	if !strings.HasSuffix(r.Device.Host, ".") {
+		r.Device.Host += "."
+	}
+	if len(r.Device.IPs) == 0 {
+		r.Device.IPs = interfaceIPs(r.Interface)
+	}
+	if len(r.Device.IPs) == 0 {
+		return errors.New("responder needs an address to advertise")
+	}
+
+	c, err := listen(r.Interface, r.Group)
+	if err != nil {
+		return err
+	}
+	r.conn = c
+	c.run(r.handle)
+
+	return r.announce(r.ttl())
+}
+
+// Close sends a goodbye packet and stops answering queries
+func (r *Responder) Close() error {
+	r.mu.Lock()
+	c := r.conn
+	r.conn = nil
+	r.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	err := c.send(r.response(0, nil, r.all(0)), nil)
+	c.close()
+
+	return err
+}
+
+func (r *Responder) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(r.Logger, r.Debug).Log(level, "discovery: "+msg, keyvals...)
+}
+
+func (r *Responder) ttl() uint32 {
+	if r.TTL > 0 {
+		return uint32(r.TTL / time.Second)
+	}
+	return uint32(DefaultTTL / time.Second)
+}
+
+func (r *Responder) announce(ttl uint32) error {
+	return r.conn.send(r.response(0, nil, r.all(ttl)), nil)
+}
+
+// handle answers the questions in a query
+func (r *Responder) handle(m *message, from *net.UDPAddr) {
+	if m.response() {
+		return
+	}
+
+	r.mu.Lock()
+	c := r.conn
+	r.mu.Unlock()
+	if c == nil {
+		return
+	}
+
+	// queries not sent from the mDNS port come from simple resolvers that
+	// expect a unicast reply, like normal DNS
+	legacy := from.Port != c.group.Port
+
+	ttl := r.ttl()
+	if legacy && ttl > legacyTTL {
+		ttl = legacyTTL
+	}
+
+	var answers []record
+	unicast := legacy
+	for _, q := range m.Questions {
+		rrs := r.answer(q, ttl)
+		if len(rrs) > 0 && q.Class&classTopBit != 0 {
+			unicast = true
+		}
+		answers = append(answers, rrs...)
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	var resp *message
+	if legacy {
+		resp = r.response(m.ID, m.Questions, answers)
+	} else {
+		resp = r.response(0, nil, answers)
+	}
+
+	to := c.group
+	if unicast {
+		to = from
+	}
+	r.log(espgohome.LevelDebug, "answering", "questions", len(m.Questions), "from", from)
+	if err := c.send(resp, to); err != nil {
+		r.log(espgohome.LevelWarn, "answer failed", "to", to, "error", err)
+	}
+}
+
+// answer returns the records answering q
+func (r *Responder) answer(q question, ttl uint32) []record {
+	anyType := q.Type == typeANY
+	d := r.Device
+	name := instanceName(d.Name)
+
+	switch {
+	case sameName(q.Name, Service) && (q.Type == typePTR || anyType):
+		return r.all(ttl)
+	case sameName(q.Name, name):
+		var rrs []record
+		if q.Type == typeSRV || anyType {
+			rrs = append(rrs, r.srv(ttl))
+		}
+		if q.Type == typeTXT || anyType {
+			rrs = append(rrs, r.txt(ttl))
+		}
+		return rrs
+	case sameName(q.Name, d.Host):
+		var rrs []record
+		for _, rr := range r.addresses(ttl) {
+			if rr.Type == q.Type || anyType {
+				rrs = append(rrs, rr)
+			}
+		}
+		return rrs
+	}
+
+	return nil
+}
+
+// response wraps records in an authoritative response
+func (r *Responder) response(id uint16, questions []question, answers []record) *message {
+	return &message{
+		ID:        id,
+		Flags:     flagResponse | flagAuthoritative,
+		Questions: questions,
+		Answers:   answers,
+	}
+}
+
+// all returns every record for the device
+func (r *Responder) all(ttl uint32) []record {
+	rrs := []record{
+		{Name: Service, Type: typePTR, Class: classIN, TTL: ttl, Target: instanceName(r.Device.Name)},
+		r.srv(ttl),
+		r.txt(ttl),
+	}
+	return append(rrs, r.addresses(ttl)...)
+}
+
+func (r *Responder) srv(ttl uint32) record {
+	return record{
+		Name:   instanceName(r.Device.Name),
+		Type:   typeSRV,
+		Class:  classIN | classTopBit,
+		TTL:    ttl,
+		Port:   uint16(r.Device.Port),
+		Target: r.Device.Host,
+	}
+}
+
+func (r *Responder) txt(ttl uint32) record {
+	return record{
+		Name:  instanceName(r.Device.Name),
+		Type:  typeTXT,
+		Class: classIN | classTopBit,
+		TTL:   ttl,
+		Text:  r.Device.text(),
+	}
+}
+
+func (r *Responder) addresses(ttl uint32) []record {
+	var rrs []record
+	for _, ip := range r.Device.IPs {
+		rr := record{Name: r.Device.Host, Class: classIN | classTopBit, TTL: ttl, IP: ip}
+		if ip.To4() != nil {
+			rr.Type = typeA
+		} else {
+			rr.Type = typeAAAA
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
@@ -0,0 +1,131 @@
+// Package dissect recovers native API frames from sniffed traffic.
+//
+// ReadPcap reassembles the TCP streams to and from the API port in a libpcap
+// file, as written by tcpdump -w, and ReadHex reads a hex dump of a stream.
+// Both split the bytes into frames with the preamble, size and type framing
+// of the native API. Bytes that can't be framed are returned as frames with
+// Err set, so that a malformed stream can be inspected rather than rejected.
+package dissect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxPayload is the largest plausible frame, anything larger is treated as
+// garbage
+const maxPayload = 1 << 20
+
+// Frame is a frame found in the traffic
+type Frame struct {
+	// Time is when the last byte of the frame was seen, zero for hex dumps
+	Time time.Time
+	// Direction is zero if it is unknown
+	Direction espgohome.Direction
+	// Stream identifies the TCP connection as "client > device"
+	Stream  string
+	Type    espgohome.MessageID
+	Payload []byte
+	// Err is set for bytes that couldn't be framed, Payload holds them
+	Err error
+}
+
+// Message decodes the payload of a well formed frame
+func (f Frame) Message() (proto.Message, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return espgohome.DecodeMessage(f.Type, f.Payload)
+}
+
+// splitter splits a byte stream into frames
+type splitter struct {
+	direction espgohome.Direction
+	stream    string
+	buf       []byte
+}
+
+// write adds b to the stream and returns the frames completed by it
+func (s *splitter) write(b []byte, t time.Time) []Frame {
+	s.buf = append(s.buf, b...)
+
+	var frames []Frame
+	for len(s.buf) > 0 {
+		f, n := s.next()
+		if n == 0 {
+			break
+		}
+		f.Time = t
+		frames = append(frames, f)
+		s.buf = s.buf[n:]
+	}
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+	return frames
+}
+
+// next returns the frame at the start of the buffer and its length, or 0 if
+// more bytes are needed
+func (s *splitter) next() (Frame, int) {
+	f := Frame{Direction: s.direction, Stream: s.stream}
+
+	if s.buf[0] != 0 {
+		// resynchronize at the next byte that could be a preamble
+		n := 1
+		for n < len(s.buf) && s.buf[n] != 0 {
+			n++
+		}
+		f.Payload = append([]byte(nil), s.buf[:n]...)
+		f.Err = fmt.Errorf("invalid preamble 0x%02x, skipped %d bytes", s.buf[0], n)
+		return f, n
+	}
+
+	size, n1 := binary.Uvarint(s.buf[1:])
+	if n1 == 0 {
+		return f, 0
+	}
+	if n1 < 0 || size > maxPayload {
+		f.Payload = s.buf[:1]
+		f.Err = fmt.Errorf("invalid frame size, skipped 1 byte")
+		return f, 1
+	}
+	msgType, n2 := binary.Uvarint(s.buf[1+n1:])
+	if n2 == 0 {
+		return f, 0
+	}
+	if n2 < 0 {
+		f.Payload = s.buf[:1]
+		f.Err = fmt.Errorf("invalid frame type, skipped 1 byte")
+		return f, 1
+	}
+
+	start := 1 + n1 + n2
+	end := start + int(size)
+	if len(s.buf) < end {
+		return f, 0
+	}
+	f.Type = espgohome.MessageID(msgType)
+	f.Payload = append([]byte(nil), s.buf[start:end]...)
+	return f, end
+}
+
+// flush returns any bytes left at the end of the stream as a malformed frame
+func (s *splitter) flush(t time.Time) []Frame {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	f := Frame{
+		Time:      t,
+		Direction: s.direction,
+		Stream:    s.stream,
+		Payload:   s.buf,
+		Err:       fmt.Errorf("truncated frame, %d bytes left at the end of the stream", len(s.buf)),
+	}
+	s.buf = nil
+	return []Frame{f}
+}
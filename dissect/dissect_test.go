@@ -0,0 +1,202 @@
+package dissect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// frame encodes m as it is sent on the wire
+func frame(t *testing.T, m proto.Message) []byte {
+	var b bytes.Buffer
+	if err := espgohome.WriteMessage(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// pcapWriter builds a pcap file of Ethernet frames
+type pcapWriter struct {
+	bytes.Buffer
+	start time.Time
+}
+
+func newPcap() *pcapWriter {
+	w := &pcapWriter{start: time.Unix(1588334400, 0)}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkEthernet)
+	w.Write(header)
+	return w
+}
+
+// segment adds a TCP segment from the client to the device if sent is set,
+// or from the device to the client, at ms milliseconds after the start
+func (w *pcapWriter) segment(ms int, sent bool, seq uint32, flags byte, payload []byte) {
+	client, device := []byte{10, 0, 0, 2}, []byte{10, 0, 0, 5}
+	clientPort, devicePort := uint16(51234), uint16(6053)
+	if !sent {
+		client, device = device, client
+		clientPort, devicePort = devicePort, clientPort
+	}
+
+	pkt := make([]byte, 14+20+20)
+	binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+	ip := pkt[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(40+len(payload)))
+	ip[8], ip[9] = 64, 6
+	copy(ip[12:], client)
+	copy(ip[16:], device)
+	tcp := ip[20:]
+	binary.BigEndian.PutUint16(tcp, clientPort)
+	binary.BigEndian.PutUint16(tcp[2:], devicePort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12], tcp[13] = 5<<4, flags
+	pkt = append(pkt, payload...)
+
+	t := w.start.Add(time.Duration(ms) * time.Millisecond)
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec, uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+	w.Write(rec)
+	w.Write(pkt)
+}
+
+func describe(frames []Frame) string {
+	var lines []string
+	for _, f := range frames {
+		if f.Err != nil {
+			lines = append(lines, fmt.Sprintf("%s error: %v", f.Direction, f.Err))
+			continue
+		}
+		m, err := f.Message()
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s %s: %v", f.Direction, f.Type, err))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", f.Direction, m.ProtoReflect().Descriptor().Name()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestReadPcap(t *testing.T) {
+	hello := frame(t, &espgohome.HelloRequest{ClientInfo: "sniffed"})
+	helloResp := frame(t, &espgohome.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "device"})
+	ping := frame(t, &espgohome.PingRequest{})
+	info := frame(t, &espgohome.DeviceInfoRequest{})
+
+	w := newPcap()
+	w.segment(0, true, 1000, 0x02, nil)
+	w.segment(1, false, 5000, 0x12, nil)
+	// the hello is split over two segments
+	w.segment(2, true, 1001, 0x18, hello[:4])
+	w.segment(3, true, 1005, 0x18, hello[4:])
+	w.segment(4, false, 5001, 0x18, helloResp)
+	// the info request arrives before the ping and the ping is retransmitted
+	second := uint32(1001 + len(hello))
+	w.segment(5, true, second+uint32(len(ping)), 0x18, info)
+	w.segment(6, true, second, 0x18, ping)
+	w.segment(7, true, second, 0x18, ping)
+	// garbage from the device followed by a truncated frame
+	w.segment(8, false, 5001+uint32(len(helloResp)), 0x18, append([]byte{0xff, 0xfe}, helloResp[:5]...))
+
+	frames, err := ReadPcap(&w.Buffer, 6053)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"Sent HelloRequest",
+		"Received HelloResponse",
+		"Sent PingRequest",
+		"Sent DeviceInfoRequest",
+		"Received error: invalid preamble 0xff, skipped 2 bytes",
+		"Received error: truncated frame, 5 bytes left at the end of the stream",
+	}, "\n")
+	if got := describe(frames); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if frames[0].Stream != "10.0.0.2:51234 > 10.0.0.5:6053" || frames[1].Stream != frames[0].Stream {
+		t.Errorf("unexpected streams %q %q", frames[0].Stream, frames[1].Stream)
+	}
+	if d := frames[0].Time.Sub(w.start); d != 3*time.Millisecond {
+		t.Errorf("expected the hello at the time of its last segment, got %v", d)
+	}
+
+	if _, err := ReadPcap(strings.NewReader("\x0a\x0d\x0d\x0a"+strings.Repeat("\x00", 20)), 6053); err != ErrorPcapNG {
+		t.Errorf("expected ErrorPcapNG, got %v", err)
+	}
+	if _, err := ReadPcap(strings.NewReader(strings.Repeat("x", 30)), 6053); err != ErrorNotPcap {
+		t.Errorf("expected ErrorNotPcap, got %v", err)
+	}
+}
+
+func TestReadHex(t *testing.T) {
+	hello := frame(t, &espgohome.HelloRequest{ClientInfo: "hex"})
+	ping := frame(t, &espgohome.PingResponse{})
+
+	plain := "> " + hex.EncodeToString(hello) + "\n< 0x" + hex.EncodeToString(ping)
+	got := describe(mustReadHex(t, plain))
+	if got != "Sent HelloRequest\nReceived PingResponse" {
+		t.Errorf("plain: got %q", got)
+	}
+
+	// xxd and hexdump -C of the hello followed by a ping
+	data := append(append([]byte{}, hello...), ping...)
+	var xxd, hexdump strings.Builder
+	for off := 0; off < len(data); off += 16 {
+		line := data[off:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+		var groups, pairs []string
+		for i := 0; i < len(line); i += 2 {
+			groups = append(groups, hex.EncodeToString(line[i:min(i+2, len(line))]))
+		}
+		for _, b := range line {
+			pairs = append(pairs, fmt.Sprintf("%02x", b))
+		}
+		fmt.Fprintf(&xxd, "%08x: %-40s  %s\n", off, strings.Join(groups, " "), "..  text  ..")
+		fmt.Fprintf(&hexdump, "%08x  %-48s |%s|\n", off, strings.Join(pairs, " "), "..  text  ..")
+	}
+	fmt.Fprintf(&hexdump, "%08x\n", len(data))
+
+	for name, dump := range map[string]string{"xxd": xxd.String(), "hexdump": hexdump.String()} {
+		if got := describe(mustReadHex(t, dump)); got != "Direction(0) HelloRequest\nDirection(0) PingResponse" {
+			t.Errorf("%s: got %q from\n%s", name, got, dump)
+		}
+	}
+
+	if _, err := ReadHex(strings.NewReader("# comment\n00 0g")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func mustReadHex(t *testing.T, s string) []Frame {
+	frames, err := ReadHex(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return frames
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,120 @@
+package dissect
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// ReadHex reads a hex dump of a stream and returns its frames. The bytes may
+// be written as plain hex, with or without spaces, "0x" prefixes or commas,
+// or in the format of xxd or hexdump -C. A line starting with ">" holds bytes
+// sent to the device and one starting with "<" bytes received from it, lines
+// without either continue the direction of the previous line, which is
+// unknown at the start. Lines starting with "#" are ignored.
+func ReadHex(r io.Reader) ([]Frame, error) {
+	streams := map[espgohome.Direction]*splitter{}
+	var order []espgohome.Direction
+	var frames []Frame
+	var dir espgohome.Direction
+	hexdump := false
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, ">"):
+			dir, line = espgohome.DirectionSent, line[1:]
+		case strings.HasPrefix(line, "<"):
+			dir, line = espgohome.DirectionReceived, line[1:]
+		}
+
+		b, err := hexLine(line, &hexdump)
+		if err != nil {
+			return frames, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		s := streams[dir]
+		if s == nil {
+			s = &splitter{direction: dir}
+			streams[dir] = s
+			order = append(order, dir)
+		}
+		frames = append(frames, s.write(b, time.Time{})...)
+	}
+	if err := scanner.Err(); err != nil {
+		return frames, err
+	}
+
+	for _, dir := range order {
+		frames = append(frames, streams[dir].flush(time.Time{})...)
+	}
+	return frames, nil
+}
+
+// hexLine decodes the bytes on a line of a hex dump, hexdump is set once a
+// line in the format of hexdump -C has been seen
+func hexLine(line string, hexdump *bool) ([]byte, error) {
+	// hexdump -C ends lines with the text in |...|
+	if i := strings.IndexByte(line, '|'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) > 1 && isOffset(fields[0]) && strings.HasSuffix(fields[0], ":"):
+		// xxd separates the text with two spaces
+		line = strings.TrimSpace(line[len(fields[0]):])
+		if i := strings.Index(line, "  "); i >= 0 {
+			line = line[:i]
+		}
+		fields = strings.Fields(line)
+	case len(fields) > 1 && isOffset(fields[0]) && allBytes(fields[1:]):
+		*hexdump = true
+		fields = fields[1:]
+	case len(fields) == 1 && *hexdump && isOffset(fields[0]):
+		// hexdump -C ends with the total length
+		return nil, nil
+	}
+
+	var digits strings.Builder
+	for _, f := range fields {
+		for _, word := range strings.FieldsFunc(f, func(r rune) bool { return r == ',' || r == ':' }) {
+			word = strings.TrimPrefix(strings.TrimPrefix(word, "0x"), "0X")
+			digits.WriteString(word)
+		}
+	}
+	return hex.DecodeString(digits.String())
+}
+
+// isOffset reports whether s could be the offset at the start of an xxd line,
+// which ends with a colon, or a hexdump -C line, which has 8 digits
+func isOffset(s string) bool {
+	digits := strings.TrimSuffix(s, ":")
+	if digits == s && len(digits) != 8 || len(digits) < 4 {
+		return false
+	}
+	for _, r := range digits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// allBytes reports whether every field is a single byte in hex
+func allBytes(fields []string) bool {
+	for _, f := range fields {
+		if len(f) != 2 {
+			return false
+		}
+	}
+	return true
+}
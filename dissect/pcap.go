@@ -0,0 +1,281 @@
+package dissect
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// ErrorPcapNG is returned by ReadPcap for files in the pcapng format
+var ErrorPcapNG = errors.New("pcapng files are not supported, convert with: editcap -F pcap in.pcapng out.pcap")
+
+// ErrorNotPcap is returned by ReadPcap for files that aren't pcap files
+var ErrorNotPcap = errors.New("not a pcap file")
+
+// Link types
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkLinuxSLL = 113
+	linkRawIPv4  = 228
+	linkRawIPv6  = 229
+	linkSLL2     = 276
+)
+
+// IsPcap reports whether header, the first bytes of a file, is the start of
+// a pcap or pcapng file
+func IsPcap(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1, 0x0a0d0d0a:
+		return true
+	}
+	return false
+}
+
+// ReadPcap reads a libpcap file and returns the frames of the TCP streams
+// with port at one end, in the order they were completed. Frames sent to
+// port are DirectionSent.
+func ReadPcap(r io.Reader, port int) ([]Frame, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, ErrorNotPcap
+	}
+
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(header[:]) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case 0x4d3cb2a1:
+		order, nano = binary.BigEndian, true
+	case 0x0a0d0d0a:
+		return nil, ErrorPcapNG
+	default:
+		return nil, ErrorNotPcap
+	}
+	link := order.Uint32(header[20:]) & 0xffff
+
+	a := &assembler{port: uint16(port), flows: make(map[string]*flow)}
+	var last time.Time
+	for {
+		var rec [16]byte
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return a.finish(last), fmt.Errorf("truncated pcap record: %v", err)
+		}
+		sec, frac := order.Uint32(rec[:]), order.Uint32(rec[4:])
+		if !nano {
+			frac *= 1000
+		}
+		last = time.Unix(int64(sec), int64(frac))
+
+		size := order.Uint32(rec[8:])
+		if size > 1<<24 {
+			return a.finish(last), fmt.Errorf("pcap record of %d bytes is too large", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return a.finish(last), fmt.Errorf("truncated pcap record: %v", err)
+		}
+
+		if ip := linkPayload(link, data); ip != nil {
+			a.packet(ip, last)
+		}
+	}
+
+	return a.finish(last), nil
+}
+
+// linkPayload strips the link layer header, returning nil for anything that
+// isn't IP
+func linkPayload(link uint32, data []byte) []byte {
+	var ethertype uint16
+	switch link {
+	case linkEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		ethertype, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for ethertype == 0x8100 && len(data) >= 4 {
+			ethertype, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		ethertype, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		ethertype, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkNull, linkLoop:
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	case linkRaw, linkRawIPv4, linkRawIPv6:
+	default:
+		return nil
+	}
+
+	if ethertype != 0 && ethertype != 0x0800 && ethertype != 0x86dd {
+		return nil
+	}
+	return data
+}
+
+// flow is one direction of a TCP connection
+type flow struct {
+	splitter
+	started bool
+	next    uint32
+	pending map[uint32][]byte
+}
+
+// assembler reassembles the TCP streams of the API
+type assembler struct {
+	port   uint16
+	flows  map[string]*flow
+	order  []string
+	frames []Frame
+}
+
+// packet processes an IP packet
+func (a *assembler) packet(ip []byte, t time.Time) {
+	if len(ip) == 0 {
+		return
+	}
+
+	var src, dst net.IP
+	var tcp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return
+		}
+		ihl := int(ip[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		fragment := binary.BigEndian.Uint16(ip[6:]) & 0x3fff
+		if ip[9] != 6 || fragment != 0 || ihl < 20 || total < ihl || total > len(ip) {
+			return
+		}
+		src, dst, tcp = net.IP(ip[12:16]), net.IP(ip[16:20]), ip[ihl:total]
+	case 6:
+		if len(ip) < 40 {
+			return
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ip[4:]))
+		if ip[6] != 6 || total > len(ip) {
+			return
+		}
+		src, dst, tcp = net.IP(ip[8:24]), net.IP(ip[24:40]), ip[40:total]
+	default:
+		return
+	}
+
+	if len(tcp) < 20 {
+		return
+	}
+	srcPort, dstPort := binary.BigEndian.Uint16(tcp), binary.BigEndian.Uint16(tcp[2:])
+	var dir espgohome.Direction
+	var stream string
+	from := net.JoinHostPort(src.String(), strconv.Itoa(int(srcPort)))
+	to := net.JoinHostPort(dst.String(), strconv.Itoa(int(dstPort)))
+	switch a.port {
+	case dstPort:
+		dir, stream = espgohome.DirectionSent, from+" > "+to
+	case srcPort:
+		dir, stream = espgohome.DirectionReceived, to+" > "+from
+	default:
+		return
+	}
+
+	offset := int(tcp[12]>>4) * 4
+	if offset < 20 || offset > len(tcp) {
+		return
+	}
+	seq := binary.BigEndian.Uint32(tcp[4:])
+	syn := tcp[13]&0x02 != 0
+
+	key := from + " " + to
+	f := a.flows[key]
+	if f == nil {
+		f = &flow{splitter: splitter{direction: dir, stream: stream}, pending: make(map[uint32][]byte)}
+		a.flows[key] = f
+		a.order = append(a.order, key)
+	}
+	if syn {
+		// a new connection reusing the ports starts a new stream
+		a.frames = append(a.frames, f.flush(t)...)
+		f.started, f.next, f.pending = true, seq+1, make(map[uint32][]byte)
+		seq++
+	}
+	a.frames = append(a.frames, f.add(seq, tcp[offset:], t)...)
+}
+
+// add queues a segment and returns the frames completed by the bytes that
+// are now in order
+func (f *flow) add(seq uint32, data []byte, t time.Time) []Frame {
+	if !f.started {
+		f.started, f.next = true, seq
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	f.pending[seq] = append([]byte(nil), data...)
+
+	var frames []Frame
+	for progress := true; progress; {
+		progress = false
+		for s, d := range f.pending {
+			ahead := int32(s - f.next)
+			if ahead > 0 {
+				continue
+			}
+			delete(f.pending, s)
+			if int(-ahead) >= len(d) {
+				// retransmitted data that has already been seen
+				continue
+			}
+			frames = append(frames, f.write(d[-ahead:], t)...)
+			f.next = s + uint32(len(d))
+			progress = true
+		}
+	}
+	return frames
+}
+
+// finish flushes the partial frames left in every stream
+func (a *assembler) finish(t time.Time) []Frame {
+	for _, key := range a.order {
+		f := a.flows[key]
+		if len(f.pending) > 0 {
+			a.frames = append(a.frames, Frame{
+				Time:      t,
+				Direction: f.direction,
+				Stream:    f.stream,
+				Err:       fmt.Errorf("missing TCP data at sequence %d, dropped %d later segments", f.next, len(f.pending)),
+			})
+		}
+		a.frames = append(a.frames, f.flush(t)...)
+	}
+	return a.frames
+}
@@ -0,0 +1,123 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Climate is a thermostat or air conditioner
+type Climate struct {
+	base
+	SupportsCurrentTemperature        bool
+	SupportsTwoPointTargetTemperature bool
+	SupportedModes                    []espgohome.ClimateMode
+	VisualMinTemperature              float32
+	VisualMaxTemperature              float32
+	VisualTemperatureStep             float32
+	SupportsAway                      bool
+	SupportsAction                    bool
+	SupportedFanModes                 []espgohome.ClimateFanMode
+	SupportedSwingModes               []espgohome.ClimateSwingMode
+
+	state ClimateState
+}
+
+// ClimateState is the state of a Climate entity
+type ClimateState struct {
+	Mode                  espgohome.ClimateMode
+	CurrentTemperature    float32
+	TargetTemperature     float32
+	TargetTemperatureLow  float32
+	TargetTemperatureHigh float32
+	Away                  bool
+	Action                espgohome.ClimateAction
+	FanMode               espgohome.ClimateFanMode
+	SwingMode             espgohome.ClimateSwingMode
+}
+
+func newClimate(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesClimateResponse) *Climate {
+	c := &Climate{
+		SupportsCurrentTemperature:        m.SupportsCurrentTemperature,
+		SupportsTwoPointTargetTemperature: m.SupportsTwoPointTargetTemperature,
+		SupportedModes:                    m.SupportedModes,
+		VisualMinTemperature:              m.VisualMinTemperature,
+		VisualMaxTemperature:              m.VisualMaxTemperature,
+		VisualTemperatureStep:             m.VisualTemperatureStep,
+		SupportsAway:                      m.SupportsAway,
+		SupportsAction:                    m.SupportsAction,
+		SupportedFanModes:                 m.SupportedFanModes,
+		SupportedSwingModes:               m.SupportedSwingModes,
+	}
+	c.init(conn, m)
+
+	return c
+}
+
+// State returns the current state
+func (c *Climate) State() ClimateState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.state
+}
+
+// SetMode changes the mode, for example heat or cool
+func (c *Climate) SetMode(mode espgohome.ClimateMode) error {
+	return c.conn.ClimateCommand(&espgohome.ClimateCommandRequest{Key: c.key, HasMode: true, Mode: mode})
+}
+
+// SetTargetTemperature sets a single target temperature
+func (c *Climate) SetTargetTemperature(t float32) error {
+	req := &espgohome.ClimateCommandRequest{Key: c.key, HasTargetTemperature: true, TargetTemperature: t}
+	return c.conn.ClimateCommand(req)
+}
+
+// SetTargetTemperatureRange sets the low and high targets of a two point climate
+func (c *Climate) SetTargetTemperatureRange(low, high float32) error {
+	req := &espgohome.ClimateCommandRequest{
+		Key:                      c.key,
+		HasTargetTemperatureLow:  true,
+		TargetTemperatureLow:     low,
+		HasTargetTemperatureHigh: true,
+		TargetTemperatureHigh:    high,
+	}
+	return c.conn.ClimateCommand(req)
+}
+
+// SetAway turns away mode on or off
+func (c *Climate) SetAway(away bool) error {
+	return c.conn.ClimateCommand(&espgohome.ClimateCommandRequest{Key: c.key, HasAway: true, Away: away})
+}
+
+// SetFanMode changes the fan mode
+func (c *Climate) SetFanMode(mode espgohome.ClimateFanMode) error {
+	return c.conn.ClimateCommand(&espgohome.ClimateCommandRequest{Key: c.key, HasFanMode: true, FanMode: mode})
+}
+
+// SetSwingMode changes the swing mode
+func (c *Climate) SetSwingMode(mode espgohome.ClimateSwingMode) error {
+	return c.conn.ClimateCommand(&espgohome.ClimateCommandRequest{Key: c.key, HasSwingMode: true, SwingMode: mode})
+}
+
+func (c *Climate) update(state proto.Message) {
+	m, ok := state.(*espgohome.ClimateStateResponse)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = ClimateState{
+		Mode:                  m.Mode,
+		CurrentTemperature:    m.CurrentTemperature,
+		TargetTemperature:     m.TargetTemperature,
+		TargetTemperatureLow:  m.TargetTemperatureLow,
+		TargetTemperatureHigh: m.TargetTemperatureHigh,
+		Away:                  m.Away,
+		Action:                m.Action,
+		FanMode:               m.FanMode,
+		SwingMode:             m.SwingMode,
+	}
+	c.setState(true)
+}
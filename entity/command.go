@@ -0,0 +1,99 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CommandTypes are the entity types that accept commands
+var CommandTypes = []espgohome.EntityID{espgohome.Switch, espgohome.Light, espgohome.Cover, espgohome.Fan, espgohome.Climate}
+
+// NewCommand returns an empty command request for entities of type t
+func NewCommand(t espgohome.EntityID) (proto.Message, error) {
+	switch t {
+	case espgohome.Switch:
+		return &espgohome.SwitchCommandRequest{}, nil
+	case espgohome.Light:
+		return &espgohome.LightCommandRequest{}, nil
+	case espgohome.Cover:
+		return &espgohome.CoverCommandRequest{}, nil
+	case espgohome.Fan:
+		return &espgohome.FanCommandRequest{}, nil
+	case espgohome.Climate:
+		return &espgohome.ClimateCommandRequest{}, nil
+	}
+	return nil, fmt.Errorf("%s entities don't accept commands", t)
+}
+
+// CommandType returns the type of the entities req is sent to, or
+// UndefinedEntity if req isn't a command request
+func CommandType(req proto.Message) espgohome.EntityID {
+	switch req.(type) {
+	case *espgohome.SwitchCommandRequest:
+		return espgohome.Switch
+	case *espgohome.LightCommandRequest:
+		return espgohome.Light
+	case *espgohome.CoverCommandRequest:
+		return espgohome.Cover
+	case *espgohome.FanCommandRequest:
+		return espgohome.Fan
+	case *espgohome.ClimateCommandRequest:
+		return espgohome.Climate
+	}
+	return espgohome.UndefinedEntity
+}
+
+// DecodeCommand unmarshals the JSON object in body into req and sets the
+// has_* flag of every field that is present
+func DecodeCommand(body []byte, req proto.Message) error {
+	if err := protojson.Unmarshal(body, req); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	m := req.ProtoReflect()
+	descriptors := m.Descriptor().Fields()
+	for name := range fields {
+		fd := descriptors.ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = descriptors.ByJSONName(name)
+		}
+		if fd == nil {
+			continue
+		}
+		if has := descriptors.ByName("has_" + fd.Name()); has != nil && has.Kind() == protoreflect.BoolKind {
+			m.Set(has, protoreflect.ValueOfBool(true))
+		}
+	}
+	return nil
+}
+
+// SendCommand sets the key of req and sends it with the command method of c
+// matching its type
+func SendCommand(c *espgohome.ESPHomeConnection, key uint32, req proto.Message) error {
+	switch req := req.(type) {
+	case *espgohome.SwitchCommandRequest:
+		return c.SwitchCommand(key, req.State)
+	case *espgohome.LightCommandRequest:
+		req.Key = key
+		return c.LightCommand(req)
+	case *espgohome.CoverCommandRequest:
+		req.Key = key
+		return c.CoverCommand(req)
+	case *espgohome.FanCommandRequest:
+		req.Key = key
+		return c.FanCommand(req)
+	case *espgohome.ClimateCommandRequest:
+		req.Key = key
+		return c.ClimateCommand(req)
+	}
+	return fmt.Errorf("%T is not a command request", req)
+}
@@ -0,0 +1,93 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Cover is a blind, garage door or anything else that opens and closes
+type Cover struct {
+	base
+	AssumedState     bool
+	SupportsPosition bool
+	SupportsTilt     bool
+	DeviceClass      string
+
+	state CoverState
+}
+
+// CoverState is the state of a Cover, Position and Tilt are 0.0 (closed) to 1.0 (open)
+type CoverState struct {
+	Position  float32
+	Tilt      float32
+	Operation espgohome.CoverOperation
+}
+
+// Closed reports whether the cover is fully closed
+func (s CoverState) Closed() bool {
+	return s.Position == 0.0
+}
+
+func newCover(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesCoverResponse) *Cover {
+	c := &Cover{
+		AssumedState:     m.AssumedState,
+		SupportsPosition: m.SupportsPosition,
+		SupportsTilt:     m.SupportsTilt,
+		DeviceClass:      m.DeviceClass,
+	}
+	c.init(conn, m)
+
+	return c
+}
+
+// State returns the current state
+func (c *Cover) State() CoverState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.state
+}
+
+// Open fully opens the cover
+func (c *Cover) Open() error {
+	return c.SetPosition(1.0)
+}
+
+// Close fully closes the cover
+func (c *Cover) Close() error {
+	return c.SetPosition(0.0)
+}
+
+// Stop stops the cover
+func (c *Cover) Stop() error {
+	return c.conn.CoverCommand(&espgohome.CoverCommandRequest{Key: c.key, Stop: true})
+}
+
+// SetPosition moves the cover to position, 0.0 (closed) to 1.0 (open)
+func (c *Cover) SetPosition(position float32) error {
+	req := &espgohome.CoverCommandRequest{Key: c.key, HasPosition: true, Position: position}
+	return c.conn.CoverCommand(req)
+}
+
+// SetTilt tilts the cover, 0.0 (closed) to 1.0 (open)
+func (c *Cover) SetTilt(tilt float32) error {
+	req := &espgohome.CoverCommandRequest{Key: c.key, HasTilt: true, Tilt: tilt}
+	return c.conn.CoverCommand(req)
+}
+
+func (c *Cover) update(state proto.Message) {
+	m, ok := state.(*espgohome.CoverStateResponse)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = CoverState{
+		Position:  m.Position,
+		Tilt:      m.Tilt,
+		Operation: m.CurrentOperation,
+	}
+	c.setState(true)
+}
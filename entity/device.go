@@ -0,0 +1,180 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// objectKey identifies an entity by its type and object id, entities of
+// different types can have the same object id
+type objectKey struct {
+	t  espgohome.EntityID
+	id string
+}
+
+// Device holds the typed entities and services of a single connection
+type Device struct {
+	conn       *espgohome.ESPHomeConnection
+	store      *espgohome.StateStore
+	entities   []Entity
+	byKey      map[uint32]Entity
+	byObjectID map[objectKey]Entity
+	services   []*Service
+}
+
+// Load lists the entities and services of the device connected to conn.
+// Call Subscribe to keep the entity states up to date.
+func Load(conn *espgohome.ESPHomeConnection) (*Device, error) {
+	entities, services, err := conn.ListEntitiesAndServices()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Device{
+		conn:       conn,
+		store:      espgohome.NewStateStore(entities),
+		byKey:      make(map[uint32]Entity),
+		byObjectID: make(map[objectKey]Entity),
+	}
+	for _, e := range entities {
+		typed := New(conn, e)
+		if typed == nil {
+			continue
+		}
+		d.entities = append(d.entities, typed)
+		d.byKey[typed.Key()] = typed
+		d.byObjectID[objectKey{typed.Type(), typed.ObjectID()}] = typed
+	}
+	for _, svc := range services {
+		d.services = append(d.services, newService(conn, svc))
+	}
+	d.store.AddCallback(d.apply)
+
+	return d, nil
+}
+
+// Subscribe subscribes to state updates, the entities are updated until the
+// connection is closed
+func (d *Device) Subscribe() error {
+	states, err := d.conn.SubscribeStates()
+	if err != nil {
+		return err
+	}
+	go d.store.Run(states)
+
+	return nil
+}
+
+// Store returns the StateStore the entities are updated from, it can be used
+// to register for change notifications
+func (d *Device) Store() *espgohome.StateStore {
+	return d.store
+}
+
+func (d *Device) apply(st espgohome.EntityState, previous proto.Message) {
+	if e, ok := d.byKey[st.Entity.GetKey()]; ok {
+		e.update(st.State)
+	}
+}
+
+// Entities returns all of the entities in the order the device listed them
+func (d *Device) Entities() []Entity {
+	entities := make([]Entity, len(d.entities))
+	copy(entities, d.entities)
+
+	return entities
+}
+
+// Get returns the entity with the given object id, or nil. If entities of
+// different types have the id, the first one the device listed is returned.
+func (d *Device) Get(objectID string) Entity {
+	for _, e := range d.entities {
+		if e.ObjectID() == objectID {
+			return e
+		}
+	}
+	return nil
+}
+
+// GetByType returns the entity of type t with the given object id, or nil
+func (d *Device) GetByType(t espgohome.EntityID, objectID string) Entity {
+	return d.byObjectID[objectKey{t, objectID}]
+}
+
+// GetByKey returns the entity with the given key, or nil
+func (d *Device) GetByKey(key uint32) Entity {
+	return d.byKey[key]
+}
+
+// Services returns the user defined services
+func (d *Device) Services() []*Service {
+	services := make([]*Service, len(d.services))
+	copy(services, d.services)
+
+	return services
+}
+
+// Service returns the user defined service with the given name, or nil
+func (d *Device) Service(name string) *Service {
+	for _, s := range d.services {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// BinarySensor returns the binary sensor with the given object id, or nil
+func (d *Device) BinarySensor(objectID string) *BinarySensor {
+	e, _ := d.GetByType(espgohome.BinarySensor, objectID).(*BinarySensor)
+	return e
+}
+
+// Sensor returns the sensor with the given object id, or nil
+func (d *Device) Sensor(objectID string) *Sensor {
+	e, _ := d.GetByType(espgohome.Sensor, objectID).(*Sensor)
+	return e
+}
+
+// TextSensor returns the text sensor with the given object id, or nil
+func (d *Device) TextSensor(objectID string) *TextSensor {
+	e, _ := d.GetByType(espgohome.TextSensor, objectID).(*TextSensor)
+	return e
+}
+
+// Switch returns the switch with the given object id, or nil
+func (d *Device) Switch(objectID string) *Switch {
+	e, _ := d.GetByType(espgohome.Switch, objectID).(*Switch)
+	return e
+}
+
+// Light returns the light with the given object id, or nil
+func (d *Device) Light(objectID string) *Light {
+	e, _ := d.GetByType(espgohome.Light, objectID).(*Light)
+	return e
+}
+
+// Cover returns the cover with the given object id, or nil
+func (d *Device) Cover(objectID string) *Cover {
+	e, _ := d.GetByType(espgohome.Cover, objectID).(*Cover)
+	return e
+}
+
+// Fan returns the fan with the given object id, or nil
+func (d *Device) Fan(objectID string) *Fan {
+	e, _ := d.GetByType(espgohome.Fan, objectID).(*Fan)
+	return e
+}
+
+// Climate returns the climate with the given object id, or nil
+func (d *Device) Climate(objectID string) *Climate {
+	e, _ := d.GetByType(espgohome.Climate, objectID).(*Climate)
+	return e
+}
+
+// Camera returns the camera with the given object id, or nil
+func (d *Device) Camera(objectID string) *Camera {
+	e, _ := d.GetByType(espgohome.Camera, objectID).(*Camera)
+	return e
+}
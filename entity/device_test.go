@@ -0,0 +1,185 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+func newTestDevice(t *testing.T, s *server.Server) *Device {
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 2, UnitOfMeasurement: "°C"})
+	s.AddEntity(&espgohome.ListEntitiesLightResponse{ObjectId: "lamp", Key: 3, SupportsBrightness: true})
+	s.AddEntity(&espgohome.ListEntitiesCameraResponse{ObjectId: "cam", Key: 4})
+	s.AddService(&espgohome.ListEntitiesServicesResponse{
+		Name: "beep",
+		Key:  10,
+		Args: []*espgohome.ListEntitiesServicesArgument{
+			{Name: "times", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT},
+		},
+	})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: true})
+	s.SetState(&espgohome.SensorStateResponse{Key: 2, MissingState: true})
+
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client"}
+	go s.ServeConn(c.Pipe())
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	d, err := Load(c)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	return d
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s := &server.Server{}
+	s.AddEntity(&espgohome.ListEntitiesBinarySensorResponse{ObjectId: "relay", Key: 5})
+	d := newTestDevice(t, s)
+
+	if n := len(d.Entities()); n != 5 {
+		t.Errorf("expected 5 entities, got %d", n)
+	}
+	if d.Switch("relay") == nil || d.BinarySensor("relay") == nil {
+		t.Error("relay is not a switch and a binary sensor")
+	}
+	if d.Light("relay") != nil {
+		t.Error("relay should not be a light")
+	}
+	if e := d.Get("relay"); e == nil || e.Type() != espgohome.BinarySensor {
+		t.Errorf("expected the first relay, got %v", e)
+	}
+	if sensor := d.Sensor("temperature"); sensor == nil || sensor.Unit != "°C" {
+		t.Errorf("unexpected sensor: %v", sensor)
+	}
+	if d.Service("beep") == nil {
+		t.Error("service beep not found")
+	}
+}
+
+func TestStates(t *testing.T) {
+	s := &server.Server{}
+	d := newTestDevice(t, s)
+	if err := d.Subscribe(); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	relay := d.Switch("relay")
+	waitFor(t, "switch state", relay.HasState)
+	if !relay.State() {
+		t.Error("expected the relay to be on")
+	}
+
+	temperature := d.Sensor("temperature")
+	waitFor(t, "sensor update", func() bool { return !temperature.Updated().IsZero() })
+	if temperature.HasState() {
+		t.Error("expected the temperature to be missing")
+	}
+
+	s.SetState(&espgohome.SensorStateResponse{Key: 2, State: 19.5})
+	waitFor(t, "sensor state", temperature.HasState)
+	if v := temperature.Value(); v != 19.5 {
+		t.Errorf("expected 19.5, got %v", v)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	s := &server.Server{}
+	lights := make(chan *espgohome.LightCommandRequest, 1)
+	s.OnLightCommand = func(req *espgohome.LightCommandRequest) {
+		lights <- req
+	}
+	services := make(chan *espgohome.ExecuteServiceRequest, 1)
+	s.OnExecuteService = func(req *espgohome.ExecuteServiceRequest) {
+		services <- req
+	}
+	d := newTestDevice(t, s)
+
+	err := d.Light("lamp").TurnOn(WithBrightness(0.25), WithTransition(2*time.Second))
+	if err != nil {
+		t.Fatalf("light command failed: %v", err)
+	}
+	req := <-lights
+	if !req.HasState || !req.State || !req.HasBrightness || req.Brightness != 0.25 {
+		t.Errorf("unexpected light command: %v", req)
+	}
+	if !req.HasTransitionLength || req.TransitionLength != 2000 {
+		t.Errorf("unexpected transition: %v", req)
+	}
+	if req.HasRgb || req.HasEffect {
+		t.Errorf("unexpected fields set: %v", req)
+	}
+
+	if err := d.Service("beep").Execute("three"); err == nil {
+		t.Error("expected an error for a string argument")
+	}
+	if err := d.Service("beep").Execute(3); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	svc := <-services
+	if svc.Key != 10 || len(svc.Args) != 1 || svc.Args[0].Int_ != 3 {
+		t.Errorf("unexpected service request: %v", svc)
+	}
+}
+
+func TestCamera(t *testing.T) {
+	s := &server.Server{}
+	image := make([]byte, 3000)
+	for i := range image {
+		image[i] = byte(i)
+	}
+	s.OnCameraImage = func(req *espgohome.CameraImageRequest) {
+		go s.SendCameraImage(4, image)
+	}
+	d := newTestDevice(t, s)
+
+	got, err := d.Camera("cam").Image()
+	if err != nil {
+		t.Fatalf("image failed: %v", err)
+	}
+	if len(got) != len(image) || got[2999] != image[2999] {
+		t.Errorf("image corrupted, got %d bytes", len(got))
+	}
+}
+
+func TestDecodeCommand(t *testing.T) {
+	req, err := NewCommand(espgohome.Light)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeCommand([]byte(`{"state": true, "color_temperature": 370, "transitionLength": 500}`), req); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	l := req.(*espgohome.LightCommandRequest)
+	if !l.HasState || !l.State || !l.HasColorTemperature || l.ColorTemperature != 370 || !l.HasTransitionLength || l.HasBrightness {
+		t.Errorf("unexpected request %v", l)
+	}
+	if CommandType(req) != espgohome.Light {
+		t.Errorf("unexpected type %s", CommandType(req))
+	}
+
+	if err := DecodeCommand([]byte(`{"position": 1}`), &espgohome.SwitchCommandRequest{}); err == nil {
+		t.Error("no error for an unknown field")
+	}
+	if _, err := NewCommand(espgohome.Sensor); err == nil {
+		t.Error("no error for a sensor")
+	}
+}
@@ -0,0 +1,125 @@
+// Package entity provides typed wrappers for the entities of an ESPHome
+// device.
+//
+// Each entity type combines the metadata from the ListEntities*Response, the
+// most recent state from the *StateResponse and methods that send commands to
+// the device, so application code doesn't need to deal with MessageIDs or the
+// has_* flags of the command messages.
+package entity
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Entity is implemented by all of the entity types in this package
+type Entity interface {
+	Key() uint32
+	ObjectID() string
+	Name() string
+	UniqueID() string
+	Type() espgohome.EntityID
+	// HasState reports whether a valid state has been received
+	HasState() bool
+	// Updated is the time the last state was received
+	Updated() time.Time
+
+	update(state proto.Message)
+}
+
+// base holds the fields common to every entity
+type base struct {
+	conn     *espgohome.ESPHomeConnection
+	key      uint32
+	objectID string
+	name     string
+	uniqueID string
+	typ      espgohome.EntityID
+
+	mu       sync.RWMutex
+	hasState bool
+	updated  time.Time
+}
+
+// uniqueIDer is implemented by every ListEntities*Response
+type uniqueIDer interface {
+	GetUniqueId() string
+}
+
+func (b *base) init(conn *espgohome.ESPHomeConnection, e espgohome.Entity) {
+	b.conn = conn
+	b.key = e.GetKey()
+	b.objectID = e.GetObjectId()
+	b.name = e.GetName()
+	b.typ = espgohome.GetEntityType(e)
+	if u, ok := e.(uniqueIDer); ok {
+		b.uniqueID = u.GetUniqueId()
+	}
+}
+
+// Key returns the key used to identify the entity in messages
+func (b *base) Key() uint32 { return b.key }
+
+// ObjectID returns the object id, for example "living_room_light"
+func (b *base) ObjectID() string { return b.objectID }
+
+// Name returns the friendly name
+func (b *base) Name() string { return b.name }
+
+// UniqueID returns the unique id
+func (b *base) UniqueID() string { return b.uniqueID }
+
+// Type returns the type of the entity
+func (b *base) Type() espgohome.EntityID { return b.typ }
+
+// HasState reports whether a valid state has been received
+func (b *base) HasState() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.hasState
+}
+
+// Updated is the time the last state was received
+func (b *base) Updated() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.updated
+}
+
+// setState must be called with mu held
+func (b *base) setState(valid bool) {
+	b.hasState = valid
+	b.updated = time.Now()
+}
+
+// New creates the typed entity for e, the entity sends its commands using conn.
+// It returns nil if e is of an unknown type.
+func New(conn *espgohome.ESPHomeConnection, e espgohome.Entity) Entity {
+	switch m := e.(type) {
+	case *espgohome.ListEntitiesBinarySensorResponse:
+		return newBinarySensor(conn, m)
+	case *espgohome.ListEntitiesSensorResponse:
+		return newSensor(conn, m)
+	case *espgohome.ListEntitiesTextSensorResponse:
+		return newTextSensor(conn, m)
+	case *espgohome.ListEntitiesSwitchResponse:
+		return newSwitch(conn, m)
+	case *espgohome.ListEntitiesLightResponse:
+		return newLight(conn, m)
+	case *espgohome.ListEntitiesCoverResponse:
+		return newCover(conn, m)
+	case *espgohome.ListEntitiesFanResponse:
+		return newFan(conn, m)
+	case *espgohome.ListEntitiesClimateResponse:
+		return newClimate(conn, m)
+	case *espgohome.ListEntitiesCameraResponse:
+		return newCamera(conn, m)
+	default:
+		return nil
+	}
+}
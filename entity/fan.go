@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Fan is a fan with optional speed, oscillation and direction control
+type Fan struct {
+	base
+	SupportsOscillation bool
+	SupportsSpeed       bool
+	SupportsDirection   bool
+
+	state FanState
+}
+
+// FanState is the state of a Fan
+type FanState struct {
+	On          bool
+	Oscillating bool
+	Speed       espgohome.FanSpeed
+	Direction   espgohome.FanDirection
+}
+
+func newFan(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesFanResponse) *Fan {
+	f := &Fan{
+		SupportsOscillation: m.SupportsOscillation,
+		SupportsSpeed:       m.SupportsSpeed,
+		SupportsDirection:   m.SupportsDirection,
+	}
+	f.init(conn, m)
+
+	return f
+}
+
+// State returns the current state
+func (f *Fan) State() FanState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.state
+}
+
+// TurnOn turns the fan on
+func (f *Fan) TurnOn() error {
+	return f.conn.FanCommand(&espgohome.FanCommandRequest{Key: f.key, HasState: true, State: true})
+}
+
+// TurnOff turns the fan off
+func (f *Fan) TurnOff() error {
+	return f.conn.FanCommand(&espgohome.FanCommandRequest{Key: f.key, HasState: true, State: false})
+}
+
+// SetSpeed changes the speed of the fan
+func (f *Fan) SetSpeed(speed espgohome.FanSpeed) error {
+	return f.conn.FanCommand(&espgohome.FanCommandRequest{Key: f.key, HasSpeed: true, Speed: speed})
+}
+
+// SetOscillating turns oscillation on or off
+func (f *Fan) SetOscillating(oscillating bool) error {
+	return f.conn.FanCommand(&espgohome.FanCommandRequest{Key: f.key, HasOscillating: true, Oscillating: oscillating})
+}
+
+// SetDirection changes the direction of the fan
+func (f *Fan) SetDirection(direction espgohome.FanDirection) error {
+	return f.conn.FanCommand(&espgohome.FanCommandRequest{Key: f.key, HasDirection: true, Direction: direction})
+}
+
+func (f *Fan) update(state proto.Message) {
+	m, ok := state.(*espgohome.FanStateResponse)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.state = FanState{
+		On:          m.State,
+		Oscillating: m.Oscillating,
+		Speed:       m.Speed,
+		Direction:   m.Direction,
+	}
+	f.setState(true)
+}
@@ -0,0 +1,169 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Light is a dimmable and/or coloured light
+type Light struct {
+	base
+	SupportsBrightness       bool
+	SupportsRGB              bool
+	SupportsWhiteValue       bool
+	SupportsColorTemperature bool
+	MinMireds                float32
+	MaxMireds                float32
+	Effects                  []string
+
+	state LightState
+}
+
+// LightState is the state of a Light, colour values are in the range 0.0 - 1.0
+type LightState struct {
+	On               bool
+	Brightness       float32
+	Red              float32
+	Green            float32
+	Blue             float32
+	White            float32
+	ColorTemperature float32
+	Effect           string
+}
+
+// LightOption modifies a light command
+type LightOption func(req *espgohome.LightCommandRequest)
+
+// WithBrightness sets the brightness, 0.0 - 1.0
+func WithBrightness(brightness float32) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasBrightness = true
+		req.Brightness = brightness
+	}
+}
+
+// WithRGB sets the colour, each component is 0.0 - 1.0
+func WithRGB(red, green, blue float32) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasRgb = true
+		req.Red = red
+		req.Green = green
+		req.Blue = blue
+	}
+}
+
+// WithWhite sets the white value, 0.0 - 1.0
+func WithWhite(white float32) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasWhite = true
+		req.White = white
+	}
+}
+
+// WithColorTemperature sets the colour temperature in mireds
+func WithColorTemperature(mireds float32) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasColorTemperature = true
+		req.ColorTemperature = mireds
+	}
+}
+
+// WithTransition sets how long the light takes to reach the new state
+func WithTransition(d time.Duration) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasTransitionLength = true
+		req.TransitionLength = uint32(d / time.Millisecond)
+	}
+}
+
+// WithFlash flashes the light for d before returning to the previous state
+func WithFlash(d time.Duration) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasFlashLength = true
+		req.FlashLength = uint32(d / time.Millisecond)
+	}
+}
+
+// WithEffect starts one of the light's Effects
+func WithEffect(effect string) LightOption {
+	return func(req *espgohome.LightCommandRequest) {
+		req.HasEffect = true
+		req.Effect = effect
+	}
+}
+
+func newLight(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesLightResponse) *Light {
+	l := &Light{
+		SupportsBrightness:       m.SupportsBrightness,
+		SupportsRGB:              m.SupportsRgb,
+		SupportsWhiteValue:       m.SupportsWhiteValue,
+		SupportsColorTemperature: m.SupportsColorTemperature,
+		MinMireds:                m.MinMireds,
+		MaxMireds:                m.MaxMireds,
+		Effects:                  m.Effects,
+	}
+	l.init(conn, m)
+
+	return l
+}
+
+// State returns the current state
+func (l *Light) State() LightState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.state
+}
+
+// TurnOn turns the light on, applying any options
+func (l *Light) TurnOn(opts ...LightOption) error {
+	return l.command(true, opts...)
+}
+
+// TurnOff turns the light off, only WithTransition and WithFlash are useful options
+func (l *Light) TurnOff(opts ...LightOption) error {
+	return l.command(false, opts...)
+}
+
+// Set changes the light without changing whether it is on or off
+func (l *Light) Set(opts ...LightOption) error {
+	req := &espgohome.LightCommandRequest{Key: l.key}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	return l.conn.LightCommand(req)
+}
+
+func (l *Light) command(on bool, opts ...LightOption) error {
+	req := &espgohome.LightCommandRequest{Key: l.key, HasState: true, State: on}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	return l.conn.LightCommand(req)
+}
+
+func (l *Light) update(state proto.Message) {
+	m, ok := state.(*espgohome.LightStateResponse)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = LightState{
+		On:               m.State,
+		Brightness:       m.Brightness,
+		Red:              m.Red,
+		Green:            m.Green,
+		Blue:             m.Blue,
+		White:            m.White,
+		ColorTemperature: m.ColorTemperature,
+		Effect:           m.Effect,
+	}
+	l.setState(true)
+}
@@ -0,0 +1,147 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// BinarySensor is an on/off sensor such as a door contact or motion detector
+type BinarySensor struct {
+	base
+	DeviceClass    string
+	IsStatusSensor bool
+
+	state bool
+}
+
+func newBinarySensor(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesBinarySensorResponse) *BinarySensor {
+	b := &BinarySensor{
+		DeviceClass:    m.DeviceClass,
+		IsStatusSensor: m.IsStatusBinarySensor,
+	}
+	b.init(conn, m)
+
+	return b
+}
+
+// State returns the current state
+func (s *BinarySensor) State() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+func (s *BinarySensor) update(state proto.Message) {
+	m, ok := state.(*espgohome.BinarySensorStateResponse)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = m.State
+	s.setState(!m.MissingState)
+}
+
+// Sensor is a numeric sensor
+type Sensor struct {
+	base
+	Icon             string
+	Unit             string
+	AccuracyDecimals int32
+	ForceUpdate      bool
+
+	value float32
+}
+
+func newSensor(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesSensorResponse) *Sensor {
+	s := &Sensor{
+		Icon:             m.Icon,
+		Unit:             m.UnitOfMeasurement,
+		AccuracyDecimals: m.AccuracyDecimals,
+		ForceUpdate:      m.ForceUpdate,
+	}
+	s.init(conn, m)
+
+	return s
+}
+
+// Value returns the current reading, check HasState to see if it is valid
+func (s *Sensor) Value() float32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.value
+}
+
+func (s *Sensor) update(state proto.Message) {
+	m, ok := state.(*espgohome.SensorStateResponse)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.value = m.State
+	s.setState(!m.MissingState)
+}
+
+// TextSensor is a sensor with a string value
+type TextSensor struct {
+	base
+	Icon string
+
+	value string
+}
+
+func newTextSensor(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesTextSensorResponse) *TextSensor {
+	t := &TextSensor{
+		Icon: m.Icon,
+	}
+	t.init(conn, m)
+
+	return t
+}
+
+// Value returns the current value, check HasState to see if it is valid
+func (s *TextSensor) Value() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.value
+}
+
+func (s *TextSensor) update(state proto.Message) {
+	m, ok := state.(*espgohome.TextSensorStateResponse)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.value = m.State
+	s.setState(!m.MissingState)
+}
+
+// Camera is an ESP32 camera
+type Camera struct {
+	base
+}
+
+func newCamera(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesCameraResponse) *Camera {
+	c := &Camera{}
+	c.init(conn, m)
+
+	return c
+}
+
+// Image requests a single JPEG image from the camera
+func (c *Camera) Image() ([]byte, error) {
+	return c.conn.CameraImage(c.key)
+}
+
+func (c *Camera) update(state proto.Message) {}
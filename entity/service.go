@@ -0,0 +1,130 @@
+package entity
+
+import (
+	"fmt"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// ServiceArg describes an argument of a user defined service
+type ServiceArg struct {
+	Name string
+	Type espgohome.ServiceArgType
+}
+
+// Service is a user defined service declared in the device configuration
+type Service struct {
+	conn *espgohome.ESPHomeConnection
+	Key  uint32
+	Name string
+	Args []ServiceArg
+}
+
+func newService(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesServicesResponse) *Service {
+	s := &Service{conn: conn, Key: m.Key, Name: m.Name}
+	for _, a := range m.Args {
+		s.Args = append(s.Args, ServiceArg{Name: a.Name, Type: a.Type})
+	}
+
+	return s
+}
+
+// Execute calls the service, args must match the declared Args in order. The
+// accepted Go types are bool, int, int32, float32, float64 and string and
+// slices of them for the array argument types.
+func (s *Service) Execute(args ...interface{}) error {
+	if len(args) != len(s.Args) {
+		return fmt.Errorf("service %s takes %d arguments, got %d", s.Name, len(s.Args), len(args))
+	}
+
+	converted := make([]*espgohome.ExecuteServiceArgument, len(args))
+	for i, arg := range args {
+		a, err := ServiceArgument(s.Args[i].Type, arg)
+		if err != nil {
+			return fmt.Errorf("service %s argument %s: %v", s.Name, s.Args[i].Name, err)
+		}
+		converted[i] = a
+	}
+
+	return s.conn.ExecuteService(s.Key, converted...)
+}
+
+// ServiceArgument converts a Go value to an ExecuteServiceArgument of the given type
+func ServiceArgument(t espgohome.ServiceArgType, v interface{}) (*espgohome.ExecuteServiceArgument, error) {
+	a := &espgohome.ExecuteServiceArgument{}
+	ok := true
+
+	switch t {
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL:
+		a.Bool_, ok = v.(bool)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT:
+		var i int32
+		i, ok = toInt(v)
+		a.Int_ = i
+		a.LegacyInt = i
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT:
+		a.Float_, ok = toFloat(v)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING:
+		a.String_, ok = v.(string)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL_ARRAY:
+		a.BoolArray, ok = v.([]bool)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT_ARRAY:
+		switch vs := v.(type) {
+		case []int32:
+			a.IntArray = vs
+		case []int:
+			for _, i := range vs {
+				a.IntArray = append(a.IntArray, int32(i))
+			}
+		default:
+			ok = false
+		}
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY:
+		switch vs := v.(type) {
+		case []float32:
+			a.FloatArray = vs
+		case []float64:
+			for _, f := range vs {
+				a.FloatArray = append(a.FloatArray, float32(f))
+			}
+		default:
+			ok = false
+		}
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING_ARRAY:
+		a.StringArray, ok = v.([]string)
+	default:
+		return nil, fmt.Errorf("unknown argument type %s", t)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("%T is not valid for %s", v, t)
+	}
+
+	return a, nil
+}
+
+func toInt(v interface{}) (int32, bool) {
+	switch i := v.(type) {
+	case int:
+		return int32(i), true
+	case int32:
+		return i, true
+	case int64:
+		return int32(i), true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(v interface{}) (float32, bool) {
+	switch f := v.(type) {
+	case float32:
+		return f, true
+	case float64:
+		return float32(f), true
+	case int:
+		return float32(f), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Switch is an entity that can be turned on and off
+type Switch struct {
+	base
+	Icon         string
+	AssumedState bool
+
+	state bool
+}
+
+func newSwitch(conn *espgohome.ESPHomeConnection, m *espgohome.ListEntitiesSwitchResponse) *Switch {
+	s := &Switch{
+		Icon:         m.Icon,
+		AssumedState: m.AssumedState,
+	}
+	s.init(conn, m)
+
+	return s
+}
+
+// State returns true if the switch is on
+func (s *Switch) State() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+// Set turns the switch on or off
+func (s *Switch) Set(on bool) error {
+	return s.conn.SwitchCommand(s.key, on)
+}
+
+// TurnOn turns the switch on
+func (s *Switch) TurnOn() error {
+	return s.Set(true)
+}
+
+// TurnOff turns the switch off
+func (s *Switch) TurnOff() error {
+	return s.Set(false)
+}
+
+// Toggle inverts the last known state of the switch
+func (s *Switch) Toggle() error {
+	return s.Set(!s.State())
+}
+
+func (s *Switch) update(state proto.Message) {
+	m, ok := state.(*espgohome.SwitchStateResponse)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = m.State
+	s.setState(true)
+}
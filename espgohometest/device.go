@@ -0,0 +1,242 @@
+// Package espgohometest provides a scriptable fake ESPHome device for testing
+// code that uses an espgohome.ESPHomeConnection.
+//
+// A Device plays a Script for every connection it receives: each Step either
+// waits for the client to send a message, sends something to the client or
+// manipulates the connection. Everything the client sends is recorded so that
+// tests can make assertions about it afterwards.
+//
+//	d := espgohometest.NewDevice(espgohometest.Script{
+//		espgohometest.Expect(espgohome.HelloRequestID),
+//		espgohometest.Reply(&espgohome.HelloResponse{}),
+//		espgohometest.Drop(),
+//	})
+//	c := &espgohome.ESPHomeConnection{}
+//	d.Attach(c)
+//	...
+//	if err := d.Wait(); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Tests of code built on a manager.Manager can use a server.Server instead:
+// Connect serves it and waits for the Manager to connect to it, Commands and
+// NextCommand collect the commands it receives. StartDevice does all of this
+// for a device described by its entities and initial states.
+//
+//	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "kitchen"}}
+//	commands := espgohometest.Commands(s)
+//	d := espgohometest.Connect(t, m, s)
+//	...
+//	req := espgohometest.NextCommand(t, commands)
+package espgohometest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultTimeout is how long an Expect step waits for a message
+const DefaultTimeout = time.Second
+
+// Script is the sequence of steps played for a single connection
+type Script []Step
+
+// Device is a fake ESPHome device
+type Device struct {
+	// Timeout overrides DefaultTimeout for Expect steps
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	scripts  []Script
+	next     int
+	received []proto.Message
+	errs     []error
+	wg       sync.WaitGroup
+	listener net.Listener
+}
+
+// NewDevice creates a Device, each connection to the device plays the next
+// script in order
+func NewDevice(scripts ...Script) *Device {
+	return &Device{scripts: scripts}
+}
+
+// Attach connects c to the device using ESPHomeConnection.Pipe()
+func (d *Device) Attach(c *espgohome.ESPHomeConnection) {
+	d.Serve(c.Pipe())
+}
+
+// Serve plays the next script on conn in a new goroutine
+func (d *Device) Serve(conn net.Conn) {
+	d.mu.Lock()
+	if d.next >= len(d.scripts) {
+		d.mu.Unlock()
+		d.fail(fmt.Errorf("connection %d has no script", d.next+1))
+		conn.Close()
+		return
+	}
+	script := d.scripts[d.next]
+	d.next++
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go d.play(script, conn)
+}
+
+// Listen accepts TCP connections on a loopback address so the device can be
+// used with ESPHomeConnection.Dial. It returns the address to dial.
+func (d *Device) Listen() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	d.listener = l
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			d.Serve(conn)
+		}
+	}()
+
+	return l.Addr().String(), nil
+}
+
+// Wait waits for all scripts that have started to finish and returns the
+// first failure, if any. Connections are left open once their script
+// completes, messages sent after that are still recorded.
+func (d *Device) Wait() error {
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.listener != nil {
+		d.listener.Close()
+	}
+	if d.next < len(d.scripts) {
+		return fmt.Errorf("only %d of %d scripts were played", d.next, len(d.scripts))
+	}
+	if len(d.errs) > 0 {
+		return d.errs[0]
+	}
+
+	return nil
+}
+
+// Received returns every message the device has received, across all connections
+func (d *Device) Received() []proto.Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	received := make([]proto.Message, len(d.received))
+	copy(received, d.received)
+
+	return received
+}
+
+// ReceivedIDs returns the MessageIDs of every message the device has received
+func (d *Device) ReceivedIDs() []espgohome.MessageID {
+	ids := []espgohome.MessageID{}
+	for _, m := range d.Received() {
+		ids = append(ids, espgohome.GetMessageID(m))
+	}
+
+	return ids
+}
+
+// AssertReceived checks that the device received exactly the given message types in order
+func (d *Device) AssertReceived(ids ...espgohome.MessageID) error {
+	got := d.ReceivedIDs()
+	if len(got) != len(ids) {
+		return fmt.Errorf("expected %v, received %v", ids, got)
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			return fmt.Errorf("expected %v, received %v", ids, got)
+		}
+	}
+
+	return nil
+}
+
+func (d *Device) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (d *Device) record(m proto.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.received = append(d.received, m)
+}
+
+func (d *Device) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.errs = append(d.errs, err)
+}
+
+func (d *Device) play(script Script, conn net.Conn) {
+	s := &session{
+		device:   d,
+		conn:     conn,
+		incoming: make(chan proto.Message),
+	}
+	go s.readLoop()
+
+	for i, step := range script {
+		if err := step.run(s); err != nil {
+			d.fail(fmt.Errorf("step %d (%s): %v", i+1, step, err))
+			conn.Close()
+			break
+		}
+	}
+	d.wg.Done()
+
+	// keep draining so that a client writing to a net.Pipe doesn't block
+	for range s.incoming {
+	}
+}
+
+// session is the state of a single connection while a script is played
+type session struct {
+	device   *Device
+	conn     net.Conn
+	incoming chan proto.Message
+}
+
+func (s *session) readLoop() {
+	defer close(s.incoming)
+
+	r := bufio.NewReader(s.conn)
+	for {
+		msgType, m, err := espgohome.ReadMessage(r)
+		if err != nil {
+			if msgType == 0 {
+				return
+			}
+			s.device.fail(fmt.Errorf("unable to decode %s: %v", msgType, err))
+			continue
+		}
+
+		s.device.record(m)
+		s.incoming <- m
+	}
+}
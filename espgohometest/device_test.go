@@ -0,0 +1,177 @@
+package espgohometest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandshakeAndState(t *testing.T) {
+	d := NewDevice(Steps(
+		Handshake(),
+		Expect(espgohome.SubscribeStatesRequestID),
+		Push(&espgohome.SwitchStateResponse{Key: 7, State: true}, 10*time.Millisecond),
+		ExpectFunc(espgohome.SwitchCommandRequestID, func(m proto.Message) error {
+			if m.(*espgohome.SwitchCommandRequest).State {
+				t.Error("expected the switch to be turned off")
+			}
+			return nil
+		}),
+	))
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client"}
+	d.Attach(c)
+
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	states, err := c.SubscribeStates()
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	state := (<-states).(*espgohome.SwitchStateResponse)
+	if state.Key != 7 || !state.State {
+		t.Errorf("unexpected state: %v", state)
+	}
+	c.SwitchCommand(7, false)
+
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	err = d.AssertReceived(
+		espgohome.HelloRequestID,
+		espgohome.ConnectRequestID,
+		espgohome.SubscribeStatesRequestID,
+		espgohome.SwitchCommandRequestID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDroppedConnection(t *testing.T) {
+	d := NewDevice(Script{
+		Expect(espgohome.HelloRequestID),
+		Drop(),
+	})
+	c := &espgohome.ESPHomeConnection{}
+	d.Attach(c)
+
+	if err := c.Hello(); err != espgohome.ErrorClosed {
+		t.Errorf("expected ErrorClosed, got %v", err)
+	}
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGarbagePreamble(t *testing.T) {
+	d := NewDevice(Script{
+		Expect(espgohome.HelloRequestID),
+		SendGarbage(),
+	})
+	c := &espgohome.ESPHomeConnection{}
+	d.Attach(c)
+
+	if err := c.Hello(); err != espgohome.ErrorClosed {
+		t.Errorf("expected ErrorClosed, got %v", err)
+	}
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpectTimeout(t *testing.T) {
+	d := NewDevice(Script{
+		Expect(espgohome.PingRequestID),
+	})
+	d.Timeout = 10 * time.Millisecond
+	c := &espgohome.ESPHomeConnection{}
+	d.Attach(c)
+
+	if err := d.Wait(); err == nil {
+		t.Error("expected the script to time out")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	d := NewDevice(
+		Script{Expect(espgohome.HelloRequestID), Drop()},
+		Steps(Handshake()),
+	)
+	address, err := d.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &espgohome.ESPHomeConnection{}
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	if err := c.Hello(); err != espgohome.ErrorClosed {
+		t.Fatalf("expected ErrorClosed, got %v", err)
+	}
+
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("redial failed: %v", err)
+	}
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "kitchen"}, Password: "secret"}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	commands := Commands(s)
+
+	m := manager.New("test-client")
+	defer m.Close()
+	d := Connect(t, m, s)
+	if d.Name() != "kitchen" || d.Entities().Switch("relay") == nil {
+		t.Fatalf("unexpected device %s", d.Name())
+	}
+
+	if err := d.Conn().SwitchCommand(1, true); err != nil {
+		t.Fatalf("switch command failed: %v", err)
+	}
+	if c, ok := NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 1 || !c.State {
+		t.Errorf("unexpected command %v", c)
+	}
+}
+
+func TestStartDevice(t *testing.T) {
+	m := manager.New("test-client")
+	defer m.Close()
+	_, commands := StartDevice(t, m, "kitchen",
+		&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"},
+		&espgohome.SwitchStateResponse{Key: 1, State: true},
+	)
+
+	d, err := m.Device("kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw := d.Entities().Switch("relay"); sw == nil || !sw.State() {
+		t.Fatalf("unexpected state of relay")
+	}
+	if err := d.Conn().SwitchCommand(1, false); err != nil {
+		t.Fatalf("switch command failed: %v", err)
+	}
+	if c, ok := NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 1 || c.State {
+		t.Errorf("unexpected command %v", c)
+	}
+}
@@ -0,0 +1,121 @@
+package espgohometest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// ConnectTimeout is how long Connect and NextCommand wait
+const ConnectTimeout = 2 * time.Second
+
+// Listen listens on a loopback address, failing the test if it can't
+func Listen(t testing.TB) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	return l
+}
+
+// Serve serves s on a loopback address until the test ends and returns the
+// address to dial
+func Serve(t testing.TB, s *server.Server) string {
+	t.Helper()
+
+	l := Listen(t)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	return l.Addr().String()
+}
+
+// Connect serves s as in Serve, adds it to m with the password of s and
+// waits until it is connected and its entities are loaded
+func Connect(t testing.TB, m *manager.Manager, s *server.Server) *manager.Device {
+	t.Helper()
+
+	d, err := m.Add(manager.DeviceConfig{Address: Serve(t, s), Password: s.Password})
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	deadline := time.Now().Add(ConnectTimeout)
+	for !d.Connected() || d.Entities() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s didn't connect", d.Config().Address)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return d
+}
+
+// Commands sets the command and service callbacks of s to send the requests
+// s receives to the returned channel
+func Commands(s *server.Server) chan proto.Message {
+	commands := make(chan proto.Message, 16)
+	s.OnSwitchCommand = func(m *espgohome.SwitchCommandRequest) { commands <- m }
+	s.OnLightCommand = func(m *espgohome.LightCommandRequest) { commands <- m }
+	s.OnCoverCommand = func(m *espgohome.CoverCommandRequest) { commands <- m }
+	s.OnFanCommand = func(m *espgohome.FanCommandRequest) { commands <- m }
+	s.OnClimateCommand = func(m *espgohome.ClimateCommandRequest) { commands <- m }
+	s.OnExecuteService = func(m *espgohome.ExecuteServiceRequest) { commands <- m }
+	return commands
+}
+
+// NextCommand returns the next request of commands, failing the test if
+// none arrives within ConnectTimeout
+func NextCommand(t testing.TB, commands chan proto.Message) proto.Message {
+	t.Helper()
+
+	select {
+	case m := <-commands:
+		return m
+	case <-time.After(ConnectTimeout):
+		t.Fatal("no command received")
+	}
+	return nil
+}
+
+// StartDevice serves a device called name with the entities, services and
+// states in messages, connects m to it as in Connect and waits for the
+// states to reach m. The requests the device receives are sent to the
+// returned channel, as with Commands.
+func StartDevice(t testing.TB, m *manager.Manager, name string, messages ...proto.Message) (*server.Server, chan proto.Message) {
+	t.Helper()
+
+	s := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: name}}
+	commands := Commands(s)
+	var keys []uint32
+	for _, msg := range messages {
+		switch msg := msg.(type) {
+		case *espgohome.ListEntitiesServicesResponse:
+			s.AddService(msg)
+		case espgohome.Entity:
+			s.AddEntity(msg)
+		default:
+			s.SetState(msg)
+			if st, ok := msg.(interface{ GetKey() uint32 }); ok {
+				keys = append(keys, st.GetKey())
+			}
+		}
+	}
+
+	d := Connect(t, m, s)
+	deadline := time.Now().Add(ConnectTimeout)
+	for _, key := range keys {
+		for e := d.Entities().GetByKey(key); e == nil || !e.HasState(); e = d.Entities().GetByKey(key) {
+			if time.Now().After(deadline) {
+				t.Fatalf("no state for key %d", key)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	return s, commands
+}
@@ -0,0 +1,167 @@
+package espgohometest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Step is a single action in a Script
+type Step interface {
+	run(s *session) error
+	String() string
+}
+
+type stepFunc struct {
+	name string
+	fn   func(s *session) error
+}
+
+func (f stepFunc) run(s *session) error {
+	return f.fn(s)
+}
+
+func (f stepFunc) String() string {
+	return f.name
+}
+
+// Expect waits for the client to send a message of type msgType. Any other
+// message, a closed connection or a timeout fails the script.
+func Expect(msgType espgohome.MessageID) Step {
+	return ExpectFunc(msgType, nil)
+}
+
+// ExpectFunc is like Expect but also calls check with the received message,
+// a non-nil error from check fails the script
+func ExpectFunc(msgType espgohome.MessageID, check func(proto.Message) error) Step {
+	return stepFunc{
+		name: fmt.Sprintf("expect %s", msgType),
+		fn: func(s *session) error {
+			select {
+			case m, ok := <-s.incoming:
+				if !ok {
+					return fmt.Errorf("connection closed")
+				}
+				got := espgohome.GetMessageID(m)
+				if got != msgType {
+					return fmt.Errorf("received %s", got)
+				}
+				if check != nil {
+					return check(m)
+				}
+				return nil
+			case <-time.After(s.device.timeout()):
+				return fmt.Errorf("timed out")
+			}
+		},
+	}
+}
+
+// ExpectClose waits for the client to close the connection, any message
+// received first fails the script
+func ExpectClose() Step {
+	return stepFunc{
+		name: "expect close",
+		fn: func(s *session) error {
+			select {
+			case m, ok := <-s.incoming:
+				if ok {
+					return fmt.Errorf("received %s", espgohome.GetMessageID(m))
+				}
+				return nil
+			case <-time.After(s.device.timeout()):
+				return fmt.Errorf("timed out")
+			}
+		},
+	}
+}
+
+// Reply sends m to the client
+func Reply(m proto.Message) Step {
+	return stepFunc{
+		name: fmt.Sprintf("reply %s", espgohome.GetMessageID(m)),
+		fn: func(s *session) error {
+			return espgohome.WriteMessage(s.conn, m)
+		},
+	}
+}
+
+// Push sends m to the client after delay, as a device does for state changes
+func Push(m proto.Message, delay time.Duration) Step {
+	return stepFunc{
+		name: fmt.Sprintf("push %s after %s", espgohome.GetMessageID(m), delay),
+		fn: func(s *session) error {
+			time.Sleep(delay)
+			return espgohome.WriteMessage(s.conn, m)
+		},
+	}
+}
+
+// Sleep pauses the script
+func Sleep(d time.Duration) Step {
+	return stepFunc{
+		name: fmt.Sprintf("sleep %s", d),
+		fn: func(s *session) error {
+			time.Sleep(d)
+			return nil
+		},
+	}
+}
+
+// SendRaw writes b to the client without any framing
+func SendRaw(b []byte) Step {
+	return stepFunc{
+		name: fmt.Sprintf("send raw %x", b),
+		fn: func(s *session) error {
+			_, err := s.conn.Write(b)
+			return err
+		},
+	}
+}
+
+// SendGarbage sends a frame with an invalid preamble
+func SendGarbage() Step {
+	return SendRaw([]byte{0xff, 0x00, 0x07})
+}
+
+// Drop closes the connection without sending a DisconnectRequest
+func Drop() Step {
+	return stepFunc{
+		name: "drop",
+		fn: func(s *session) error {
+			return s.conn.Close()
+		},
+	}
+}
+
+// Handshake returns the steps for a successful Hello and Connect exchange
+func Handshake() []Step {
+	return []Step{
+		Expect(espgohome.HelloRequestID),
+		Reply(&espgohome.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "espgohometest"}),
+		Expect(espgohome.ConnectRequestID),
+		Reply(&espgohome.ConnectResponse{}),
+	}
+}
+
+// Steps concatenates steps and slices of steps into a Script, it accepts
+// values of type Step and []Step
+func Steps(steps ...interface{}) Script {
+	script := Script{}
+	for _, s := range steps {
+		switch v := s.(type) {
+		case Step:
+			script = append(script, v)
+		case []Step:
+			script = append(script, v...)
+		case Script:
+			script = append(script, v...)
+		default:
+			panic(fmt.Sprintf("espgohometest: %T is not a Step", s))
+		}
+	}
+
+	return script
+}
@@ -0,0 +1,240 @@
+// Package exporter serves the devices of a manager.Manager as Prometheus
+// metrics.
+//
+// Sensors are exported as gauges labelled with the device, object_id and
+// unit of measurement, binary sensors and switches as 0 or 1 and climate
+// devices as their current and target temperatures. The health of every
+// connection is exported alongside: whether it is up, the number of
+// reconnects, the last ping round trip time and the frames sent and received.
+//
+// The metrics are written in the Prometheus text exposition format, so the
+// package has no dependency on the Prometheus client libraries.
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// DefaultNamespace prefixes the metric names when Exporter.Namespace is empty
+const DefaultNamespace = "esphome"
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter writes the metrics of the devices of a Manager, it is an
+// http.Handler for the /metrics endpoint
+type Exporter struct {
+	Manager *manager.Manager
+	// Namespace prefixes every metric name, DefaultNamespace if empty
+	Namespace string
+}
+
+// New creates an Exporter for the devices of m
+func New(m *manager.Manager) *Exporter {
+	return &Exporter{Manager: m}
+}
+
+// ServeHTTP writes the metrics
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := e.WriteMetrics(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	if r.Method == http.MethodGet {
+		w.Write(b.Bytes())
+	}
+}
+
+// WriteMetrics writes the metrics of every device in the text exposition
+// format
+func (e *Exporter) WriteMetrics(w io.Writer) error {
+	s := newScrape(e.namespace())
+	for _, d := range e.Manager.Devices() {
+		s.device(d)
+	}
+	return s.write(w)
+}
+
+func (e *Exporter) namespace() string {
+	if e.Namespace == "" {
+		return DefaultNamespace
+	}
+	return e.Namespace
+}
+
+// scrape collects the samples of one set of metrics
+type scrape struct {
+	namespace string
+	families  map[string]*family
+	order     []*family
+}
+
+// family is a metric and its samples
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+func newScrape(namespace string) *scrape {
+	return &scrape{namespace: namespace, families: make(map[string]*family)}
+}
+
+// add adds a sample to the metric name, labels are name, value pairs
+func (s *scrape) add(name, typ, help string, value float64, labels ...string) {
+	name = s.namespace + "_" + name
+	f := s.families[name]
+	if f == nil {
+		f = &family{name: name, help: help, typ: typ}
+		s.families[name] = f
+		s.order = append(s.order, f)
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (s *scrape) gauge(name, help string, value float64, labels ...string) {
+	s.add(name, "gauge", help, value, labels...)
+}
+
+func (s *scrape) counter(name, help string, value float64, labels ...string) {
+	s.add(name, "counter", help, value, labels...)
+}
+
+// device adds the metrics of d
+func (s *scrape) device(d *manager.Device) {
+	name := d.Name()
+	st := d.Stats()
+	connected := d.Connected()
+
+	s.gauge("up", "Whether the connection to the device is up.", value.Bool(connected), "device", name)
+	if info := d.Info(); info != nil {
+		s.gauge("device_info", "Information about the device, the value is always 1.", 1,
+			"device", name, "mac", info.MacAddress, "model", info.Model, "version", info.EsphomeVersion)
+	}
+	s.counter("reconnects_total", "Number of times the device has been reconnected.", float64(st.Reconnects), "device", name)
+	if st.PingRTT > 0 {
+		s.gauge("ping_rtt_seconds", "Round trip time of the last ping.", st.PingRTT.Seconds(), "device", name)
+	}
+	s.counter("frames_sent_total", "Number of frames sent to the device.", float64(st.FramesSent), "device", name)
+	s.counter("frames_received_total", "Number of frames received from the device.", float64(st.FramesReceived), "device", name)
+
+	dev := d.Entities()
+	if !connected || dev == nil {
+		// the states of a disconnected device are stale
+		return
+	}
+	for _, e := range dev.Entities() {
+		if !e.HasState() {
+			continue
+		}
+		s.entity(name, e)
+	}
+}
+
+// entity adds the metrics of e
+func (s *scrape) entity(device string, e entity.Entity) {
+	id := e.ObjectID()
+
+	switch e := e.(type) {
+	case *entity.Sensor:
+		s.gauge("sensor_value", "Value of a sensor.", value.Float32(e.Value()),
+			"device", device, "object_id", id, "unit", e.Unit)
+	case *entity.BinarySensor:
+		s.gauge("binary_sensor_state", "State of a binary sensor, 1 for on.", value.Bool(e.State()),
+			"device", device, "object_id", id)
+	case *entity.Switch:
+		s.gauge("switch_state", "State of a switch, 1 for on.", value.Bool(e.State()),
+			"device", device, "object_id", id)
+	case *entity.Climate:
+		st := e.State()
+		if e.SupportsCurrentTemperature {
+			s.gauge("climate_current_temperature", "Current temperature of a climate device.", value.Float32(st.CurrentTemperature),
+				"device", device, "object_id", id)
+		}
+		if e.SupportsTwoPointTargetTemperature {
+			s.gauge("climate_target_temperature_low", "Lower target temperature of a climate device.", value.Float32(st.TargetTemperatureLow),
+				"device", device, "object_id", id)
+			s.gauge("climate_target_temperature_high", "Upper target temperature of a climate device.", value.Float32(st.TargetTemperatureHigh),
+				"device", device, "object_id", id)
+		} else {
+			s.gauge("climate_target_temperature", "Target temperature of a climate device.", value.Float32(st.TargetTemperature),
+				"device", device, "object_id", id)
+		}
+	}
+}
+
+// write writes the metrics in the text exposition format
+func (s *scrape) write(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range s.order {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+		for _, smp := range f.samples {
+			b.WriteString(f.name)
+			if len(smp.labels) > 0 {
+				b.WriteByte('{')
+				for i := 0; i+1 < len(smp.labels); i += 2 {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", smp.labels[i], escapeLabel(smp.labels[i+1]))
+				}
+				b.WriteByte('}')
+			}
+			b.WriteByte(' ')
+			b.WriteString(formatValue(smp.value))
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
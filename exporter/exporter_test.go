@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+func startDevice(t *testing.T) string {
+	s := &server.Server{
+		Info: &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01", Model: "nodemcuv2", EsphomeVersion: "1.15.0"},
+	}
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, UnitOfMeasurement: "°C"})
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "odd", Key: 2, UnitOfMeasurement: "\"x\"\\"})
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "missing", Key: 3})
+	s.AddEntity(&espgohome.ListEntitiesBinarySensorResponse{ObjectId: "door", Key: 4})
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 5})
+	s.AddEntity(&espgohome.ListEntitiesClimateResponse{ObjectId: "thermostat", Key: 6, SupportsCurrentTemperature: true})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.3})
+	s.SetState(&espgohome.SensorStateResponse{Key: 2, State: -1.5})
+	s.SetState(&espgohome.SensorStateResponse{Key: 3, MissingState: true})
+	s.SetState(&espgohome.BinarySensorStateResponse{Key: 4, State: true})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 5, State: false})
+	s.SetState(&espgohome.ClimateStateResponse{Key: 6, CurrentTemperature: 19.5, TargetTemperature: 21})
+
+	return espgohometest.Serve(t, s)
+}
+
+func TestExporter(t *testing.T) {
+	address := startDevice(t)
+
+	m := manager.New("test-client")
+	m.MinBackoff = time.Minute
+	defer m.Close()
+	if _, err := m.Add(manager.DeviceConfig{Address: address}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	// nothing listens on the closed port
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := l.Addr().String()
+	l.Close()
+	if _, err := m.Add(manager.DeviceConfig{Address: closed}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	ts := httptest.NewServer(New(m))
+	defer ts.Close()
+
+	want := []string{
+		"# TYPE esphome_up gauge",
+		`esphome_up{device="kitchen"} 1`,
+		`esphome_up{device="` + closed + `"} 0`,
+		`esphome_device_info{device="kitchen",mac="AA:AA:AA:AA:AA:01",model="nodemcuv2",version="1.15.0"} 1`,
+		"# TYPE esphome_reconnects_total counter",
+		`esphome_reconnects_total{device="kitchen"} 0`,
+		`esphome_sensor_value{device="kitchen",object_id="temperature",unit="°C"} 21.3`,
+		`esphome_sensor_value{device="kitchen",object_id="odd",unit="\"x\"\\"} -1.5`,
+		`esphome_binary_sensor_state{device="kitchen",object_id="door"} 1`,
+		`esphome_switch_state{device="kitchen",object_id="relay"} 0`,
+		`esphome_climate_current_temperature{device="kitchen",object_id="thermostat"} 19.5`,
+		`esphome_climate_target_temperature{device="kitchen",object_id="thermostat"} 21`,
+	}
+
+	// the states arrive after the connection is up
+	var body string
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != ContentType {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		body = string(b)
+		if containsAll(body, want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lines := strings.Split(body, "\n")
+	for _, w := range want {
+		if !contains(lines, w) {
+			t.Errorf("missing %q in\n%s", w, body)
+		}
+	}
+	for _, l := range lines {
+		if strings.Contains(l, `"missing"`) {
+			t.Errorf("exported a sensor without a state: %s", l)
+		}
+		if strings.HasPrefix(l, "esphome_frames_received_total{") && strings.HasSuffix(l, " 0") && strings.Contains(l, "kitchen") {
+			t.Errorf("no frames counted: %s", l)
+		}
+	}
+
+	e := &Exporter{Manager: m, Namespace: "home"}
+	var b strings.Builder
+	if err := e.WriteMetrics(&b); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if !strings.Contains(b.String(), `home_up{device="kitchen"} 1`) {
+		t.Errorf("namespace not used:\n%s", b.String())
+	}
+
+	resp, err := http.Post(ts.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func contains(lines []string, s string) bool {
+	for _, l := range lines {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(body string, want []string) bool {
+	lines := strings.Split(body, "\n")
+	for _, w := range want {
+		if !contains(lines, w) {
+			return false
+		}
+	}
+	return true
+}
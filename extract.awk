@@ -29,4 +29,15 @@ END {
 	printf("\t\treturn nil, err\n");
     printf("\t}\n");
     printf("}\n")
-}
\ No newline at end of file
+
+    printf("func GetMessageID(m proto.Message) MessageID {\n");
+    printf("\tswitch m.(type) {\n");
+    for (m in messages) {
+	    printf("\tcase *%s:\n", m);
+		printf("\t\treturn %sID\n", m);
+    }
+	printf("\tdefault:\n");
+    printf("\t\treturn 0\n");
+    printf("\t}\n");
+    printf("}\n")
+}
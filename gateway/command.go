@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// maxBody limits the size of request bodies
+const maxBody = 64 << 10
+
+// command sends the command in the body of r to e
+func (g *Gateway) command(d *manager.Device, e entity.Entity, r *http.Request) error {
+	req, err := entity.NewCommand(e.Type())
+	if err != nil {
+		return newError(http.StatusMethodNotAllowed, "%v", err)
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := entity.DecodeCommand(body, req); err != nil {
+		return newError(http.StatusBadRequest, "invalid command: %v", err)
+	}
+
+	c := d.Conn()
+	if c == nil {
+		return newError(http.StatusServiceUnavailable, "%s is not connected", d.Name())
+	}
+	if err := entity.SendCommand(c, e.Key(), req); err != nil {
+		return newError(http.StatusBadGateway, "%v", err)
+	}
+
+	g.log(espgohome.LevelDebug, "gateway: command", "device", d.Name(), "entity", e.ObjectID(), "command", string(body))
+	return nil
+}
+
+// execute calls svc with the arguments in the body of r, a JSON object of
+// argument names and values
+func (g *Gateway) execute(d *manager.Device, svc *entity.Service, r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var values map[string]json.RawMessage
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &values); err != nil {
+			return newError(http.StatusBadRequest, "invalid arguments: %v", err)
+		}
+	}
+
+	args := make([]interface{}, len(svc.Args))
+	for i, a := range svc.Args {
+		raw, ok := values[a.Name]
+		if !ok {
+			return newError(http.StatusBadRequest, "missing argument %s", a.Name)
+		}
+		v, err := serviceValue(a.Type, raw)
+		if err != nil {
+			return newError(http.StatusBadRequest, "argument %s: %v", a.Name, err)
+		}
+		args[i] = v
+	}
+	for name := range values {
+		if !hasArg(svc, name) {
+			return newError(http.StatusBadRequest, "unknown argument %s", name)
+		}
+	}
+
+	if !d.Connected() {
+		return newError(http.StatusServiceUnavailable, "%s is not connected", d.Name())
+	}
+	if err := svc.Execute(args...); err != nil {
+		return newError(http.StatusBadGateway, "%v", err)
+	}
+
+	g.log(espgohome.LevelDebug, "gateway: service", "device", d.Name(), "service", svc.Name, "args", string(body))
+	return nil
+}
+
+// serviceValue decodes raw into the Go type entity.ServiceArgument expects for t
+func serviceValue(t espgohome.ServiceArgType, raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	switch t {
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL:
+		v = new(bool)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT:
+		v = new(int32)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT:
+		v = new(float32)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING:
+		v = new(string)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL_ARRAY:
+		v = new([]bool)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT_ARRAY:
+		v = new([]int32)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY:
+		v = new([]float32)
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING_ARRAY:
+		v = new([]string)
+	default:
+		return nil, newError(http.StatusBadRequest, "unknown argument type %s", t)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case *bool:
+		return *v, nil
+	case *int32:
+		return *v, nil
+	case *float32:
+		return *v, nil
+	case *string:
+		return *v, nil
+	case *[]bool:
+		return *v, nil
+	case *[]int32:
+		return *v, nil
+	case *[]float32:
+		return *v, nil
+	default:
+		return *v.(*[]string), nil
+	}
+}
+
+func hasArg(svc *entity.Service, name string) bool {
+	for _, a := range svc.Args {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody reads the body of r, up to maxBody bytes
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "%v", err)
+	}
+	if len(body) > maxBody {
+		return nil, newError(http.StatusRequestEntityTooLarge, "body too large")
+	}
+	return body, nil
+}
@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+const (
+	// pingInterval is how often a comment is sent to keep event streams open
+	pingInterval = 30 * time.Second
+	// clientBuffer is the number of events queued for a slow client before
+	// events are dropped
+	clientBuffer = 64
+)
+
+// Event types of the /events stream
+const (
+	StateEvent        = "state"
+	ConnectedEvent    = "connected"
+	DisconnectedEvent = "disconnected"
+	LogEvent          = "log"
+)
+
+// event is an event of the /events stream
+type event struct {
+	typ string
+	// device is nil if the device was removed from the Manager
+	device *manager.Device
+	data   []byte
+}
+
+// eventClient is a connected /events stream
+type eventClient struct {
+	// device restricts the stream to a device, which is matched rather than
+	// its name since the name changes when the device connects
+	device *manager.Device
+	types  map[string]bool
+	ch     chan event
+	closed chan struct{}
+}
+
+func (c *eventClient) wants(e event) bool {
+	return (c.device == nil || c.device == e.device) && (c.types == nil || c.types[e.typ])
+}
+
+// stateJSON is the data of a state event
+type stateJSON struct {
+	Device   string          `json:"device"`
+	Type     string          `json:"type"`
+	Key      uint32          `json:"key"`
+	ObjectID string          `json:"object_id"`
+	State    json.RawMessage `json:"state"`
+	Missing  bool            `json:"missing,omitempty"`
+	Time     time.Time       `json:"time"`
+}
+
+// connectionJSON is the data of a connected or disconnected event
+type connectionJSON struct {
+	Device string    `json:"device"`
+	MAC    string    `json:"mac,omitempty"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// logJSON is the data of a log event
+type logJSON struct {
+	Device  string    `json:"device"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Tag     string    `json:"tag"`
+	Line    int       `json:"line,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Start listens to the events of the Manager for /events and subscribes to
+// the logs of the connected devices if Logs is set. Without Start /events
+// answers 503.
+func (g *Gateway) Start() error {
+	var filter *logs.Filter
+	if g.Logs != "" {
+		var err error
+		if filter, err = logs.ParseFilter(g.Logs); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return ErrorGatewayClosed
+	}
+	if g.events != nil {
+		g.mu.Unlock()
+		return nil
+	}
+	g.filter = filter
+	g.clients = make(map[*eventClient]bool)
+	g.subscribed = make(map[*manager.Device]*espgohome.ESPHomeConnection)
+	g.events = make(chan manager.Event, 64)
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	g.mu.Unlock()
+
+	g.Manager.AddListener(g.events)
+	for _, d := range g.Manager.Devices() {
+		if d.Connected() {
+			g.subscribeLogs(d)
+		}
+	}
+	go g.run()
+
+	return nil
+}
+
+// Close ends the event streams and stops listening to the Manager
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	started := g.events != nil
+	clients := g.clients
+	g.clients = nil
+	g.mu.Unlock()
+
+	if started {
+		g.Manager.RemoveListener(g.events)
+		close(g.stop)
+		<-g.done
+	}
+	for c := range clients {
+		close(c.closed)
+	}
+
+	return nil
+}
+
+func (g *Gateway) run() {
+	defer close(g.done)
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case e := <-g.events:
+			switch e.Type {
+			case manager.StateChanged:
+				if e.State.State == nil {
+					continue
+				}
+				g.broadcast(StateEvent, g.device(e), stateJSON{
+					Device:   e.Device,
+					Type:     espgohome.GetEntityType(e.State.Entity).String(),
+					Key:      e.State.Entity.GetKey(),
+					ObjectID: e.State.Entity.GetObjectId(),
+					State:    protoJSON(e.State.State),
+					Missing:  e.State.Missing,
+					Time:     e.Time,
+				})
+			case manager.Connected, manager.Disconnected:
+				typ := ConnectedEvent
+				if e.Type == manager.Disconnected {
+					typ = DisconnectedEvent
+				}
+				cj := connectionJSON{Device: e.Device, MAC: e.MAC, Time: e.Time}
+				if e.Err != nil {
+					cj.Error = e.Err.Error()
+				}
+				d := g.device(e)
+				g.broadcast(typ, d, cj)
+
+				if e.Type == manager.Connected && d != nil {
+					g.subscribeLogs(d)
+				}
+			}
+		}
+	}
+}
+
+// device returns the device an event of the Manager comes from, or nil if it
+// was removed
+func (g *Gateway) device(e manager.Event) *manager.Device {
+	id := e.MAC
+	if id == "" {
+		id = e.Device
+	}
+	d, err := g.Manager.Device(id)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+// subscribeLogs forwards the logs of d as log events until its connection
+// closes
+func (g *Gateway) subscribeLogs(d *manager.Device) {
+	c := d.Conn()
+	if c == nil {
+		return
+	}
+	g.mu.Lock()
+	if g.filter == nil || g.closed || g.subscribed[d] == c {
+		g.mu.Unlock()
+		return
+	}
+	g.subscribed[d] = c
+	filter := g.filter
+	g.mu.Unlock()
+
+	records, err := logs.Subscribe(c, logs.Options{Filter: filter})
+	if err != nil {
+		g.log(espgohome.LevelWarn, "gateway: log subscription failed", "device", d.Name(), "error", err)
+		return
+	}
+	go func() {
+		name := d.Name()
+		for r := range records {
+			g.broadcast(LogEvent, d, logJSON{
+				Device:  name,
+				Time:    r.Time,
+				Level:   logs.LevelName(r.Level),
+				Tag:     r.Tag,
+				Line:    r.Line,
+				Message: r.Message,
+			})
+		}
+	}()
+}
+
+// broadcast queues an event for the clients that want it, dropping it for
+// the clients that are too slow
+func (g *Gateway) broadcast(typ string, device *manager.Device, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	e := event{typ: typ, device: device, data: data}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for c := range g.clients {
+		if !c.wants(e) {
+			continue
+		}
+		select {
+		case c.ch <- e:
+		default:
+			g.log(espgohome.LevelDebug, "gateway: event dropped", "type", typ)
+		}
+	}
+}
+
+// serveEvents streams events with Server-Sent Events until the client goes
+// away or the gateway is closed
+func (g *Gateway) serveEvents(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return newError(http.StatusInternalServerError, "streaming not supported")
+	}
+
+	c := &eventClient{ch: make(chan event, clientBuffer), closed: make(chan struct{})}
+	if device := r.URL.Query().Get("device"); device != "" {
+		d, err := g.Manager.Device(device)
+		if err != nil {
+			return newError(http.StatusNotFound, "%v %q", err, device)
+		}
+		c.device = d
+	}
+	if types := r.URL.Query().Get("types"); types != "" {
+		c.types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			switch t {
+			case StateEvent, ConnectedEvent, DisconnectedEvent, LogEvent:
+				c.types[t] = true
+			default:
+				return newError(http.StatusBadRequest, "unknown event type %q", t)
+			}
+		}
+	}
+
+	g.mu.Lock()
+	if g.clients == nil {
+		g.mu.Unlock()
+		return newError(http.StatusServiceUnavailable, "events are not available")
+	}
+	g.clients[c] = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.clients, c)
+		g.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case e := <-c.ch:
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.typ, e.data)
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-c.closed:
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,414 @@
+// Package gateway exposes the devices of a manager.Manager over HTTP.
+//
+// The REST endpoints are:
+//
+//	GET  /devices                                  list the devices
+//	GET  /devices/{device}                         describe a device
+//	GET  /devices/{device}/entities                list the entities and their states
+//	GET  /devices/{device}/entities/{object_id}    describe an entity
+//	POST /devices/{device}/entities/{object_id}    command an entity
+//	GET  /devices/{device}/services                list the user defined services
+//	POST /devices/{device}/services/{name}         call a service
+//	GET  /devices/{device}/camera/{object_id}.jpg  take an image with a camera
+//	GET  /events                                   stream events with Server-Sent Events
+//
+// Devices are addressed by name or MAC address. States and entities are
+// encoded with protojson using the field names of api.proto, as printed by
+// espgohome -json. The body of an entity command is the JSON form of the
+// entity's *CommandRequest without the key, the has_* flags are set for the
+// fields that are present, so {"state": true, "brightness": 0.5} turns a light
+// on at half brightness. The body of a service call is an object of the
+// argument values.
+//
+// The POST endpoints change the devices, they are authenticated with the
+// Gateway's token as "Authorization: Bearer <token>". The GET endpoints are
+// not authenticated.
+//
+// /events sends "state", "connected" and "disconnected" events, and "log"
+// events if Gateway.Logs is set. The device and types query parameters
+// restrict the stream, for example /events?device=kitchen&types=state,log.
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/logs"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultCameraTimeout is used when Gateway.CameraTimeout is zero
+const DefaultCameraTimeout = 10 * time.Second
+
+// ErrorGatewayClosed is returned by Start after Close has been called
+var ErrorGatewayClosed = errors.New("gateway: gateway closed")
+
+// Gateway is an http.Handler serving the devices of a Manager
+type Gateway struct {
+	Manager *manager.Manager
+	// Token authenticates the POST requests, every POST is refused if it is
+	// empty
+	Token string
+	// Logs subscribes to the logs of the devices with this filter, in the
+	// syntax of logs.ParseFilter, for the log events. Logs aren't subscribed
+	// to if it is empty.
+	Logs string
+	// CameraTimeout bounds the wait for a camera image, DefaultCameraTimeout
+	// if zero
+	CameraTimeout time.Duration
+	// Logger receives the diagnostic messages of the gateway
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu         sync.Mutex
+	clients    map[*eventClient]bool
+	filter     *logs.Filter
+	subscribed map[*manager.Device]*espgohome.ESPHomeConnection
+	events     chan manager.Event
+	stop       chan struct{}
+	done       chan struct{}
+	closed     bool
+}
+
+// httpError is an error with an HTTP status
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func newError(status int, format string, v ...interface{}) error {
+	return &httpError{status: status, err: fmt.Errorf(format, v...)}
+}
+
+// ServeHTTP routes the request to the handler of its endpoint
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	var err error
+	switch {
+	case r.Method == http.MethodPost && !g.authorized(r):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gateway"`)
+		err = newError(http.StatusUnauthorized, "unauthorized")
+	case path == "events":
+		err = allow(r, http.MethodGet)
+		if err == nil {
+			err = g.serveEvents(w, r)
+		}
+	case parts[0] != "devices":
+		err = newError(http.StatusNotFound, "not found")
+	case len(parts) == 1:
+		err = allow(r, http.MethodGet)
+		if err == nil {
+			err = g.listDevices(w)
+		}
+	default:
+		err = g.serveDevice(w, r, parts[1:])
+	}
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		var he *httpError
+		if errors.As(err, &he) {
+			status = he.status
+		}
+		writeJSON(w, status, struct {
+			Error string `json:"error"`
+		}{err.Error()})
+	}
+}
+
+// serveDevice serves the endpoints under /devices/{device}
+func (g *Gateway) serveDevice(w http.ResponseWriter, r *http.Request, parts []string) error {
+	d, err := g.Manager.Device(parts[0])
+	if err != nil {
+		return newError(http.StatusNotFound, "%v %q", err, parts[0])
+	}
+	if len(parts) == 1 {
+		if err := allow(r, http.MethodGet); err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, newDeviceJSON(d))
+		return nil
+	}
+
+	if len(parts) > 3 {
+		return newError(http.StatusNotFound, "not found")
+	}
+	entities := d.Entities()
+	if entities == nil {
+		return newError(http.StatusServiceUnavailable, "%s has not connected", d.Name())
+	}
+
+	switch parts[1] {
+	case "entities":
+		if len(parts) == 2 {
+			if err := allow(r, http.MethodGet); err != nil {
+				return err
+			}
+			list := []entityJSON{}
+			for _, e := range entities.Store().Entities() {
+				list = append(list, newEntityJSON(entities.Store(), e))
+			}
+			writeJSON(w, http.StatusOK, list)
+			return nil
+		}
+		e := entities.Get(parts[2])
+		if e == nil {
+			return newError(http.StatusNotFound, "%v %q", manager.ErrorUnknownEntity, parts[2])
+		}
+		if err := allow(r, http.MethodGet, http.MethodPost); err != nil {
+			return err
+		}
+		if r.Method == http.MethodPost {
+			if err := g.command(d, e, r); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		st, _ := entities.Store().Get(e.Key())
+		writeJSON(w, http.StatusOK, newEntityJSON(entities.Store(), st.Entity))
+		return nil
+	case "services":
+		if len(parts) == 2 {
+			if err := allow(r, http.MethodGet); err != nil {
+				return err
+			}
+			list := []serviceJSON{}
+			for _, svc := range entities.Services() {
+				list = append(list, newServiceJSON(svc))
+			}
+			writeJSON(w, http.StatusOK, list)
+			return nil
+		}
+		svc := entities.Service(parts[2])
+		if svc == nil {
+			return newError(http.StatusNotFound, "unknown service %q", parts[2])
+		}
+		if err := allow(r, http.MethodPost); err != nil {
+			return err
+		}
+		if err := g.execute(d, svc, r); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case "camera":
+		if len(parts) != 3 || !strings.HasSuffix(parts[2], ".jpg") {
+			return newError(http.StatusNotFound, "not found")
+		}
+		if err := allow(r, http.MethodGet); err != nil {
+			return err
+		}
+		e, ok := entities.Get(strings.TrimSuffix(parts[2], ".jpg")).(*entity.Camera)
+		if !ok {
+			return newError(http.StatusNotFound, "unknown camera %q", strings.TrimSuffix(parts[2], ".jpg"))
+		}
+		return g.camera(w, r, d, e)
+	}
+
+	return newError(http.StatusNotFound, "not found")
+}
+
+// authorized checks the token of r
+func (g *Gateway) authorized(r *http.Request) bool {
+	if g.Token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(g.Token)) == 1
+}
+
+func (g *Gateway) listDevices(w http.ResponseWriter) error {
+	list := []deviceJSON{}
+	for _, d := range g.Manager.Devices() {
+		list = append(list, newDeviceJSON(d))
+	}
+	writeJSON(w, http.StatusOK, list)
+	return nil
+}
+
+// camera writes an image from c
+func (g *Gateway) camera(w http.ResponseWriter, r *http.Request, d *manager.Device, c *entity.Camera) error {
+	if !d.Connected() {
+		return newError(http.StatusServiceUnavailable, "%s is not connected", d.Name())
+	}
+
+	type result struct {
+		image []byte
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		image, err := c.Image()
+		ch <- result{image, err}
+	}()
+
+	timeout := g.CameraTimeout
+	if timeout <= 0 {
+		timeout = DefaultCameraTimeout
+	}
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return newError(http.StatusBadGateway, "%v", res.err)
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(res.image)
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	case <-time.After(timeout):
+		return newError(http.StatusGatewayTimeout, "no image from %s", c.ObjectID())
+	}
+}
+
+func (g *Gateway) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(g.Logger, g.Debug).Log(level, msg, keyvals...)
+}
+
+// allow returns a 405 error unless the method of r is one of methods
+func allow(r *http.Request, methods ...string) error {
+	for _, m := range methods {
+		if r.Method == m {
+			return nil
+		}
+	}
+	return newError(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
+
+// protoJSON encodes m with the proto field names, as espgohome -json does
+func protoJSON(m proto.Message) json.RawMessage {
+	if m == nil {
+		return nil
+	}
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return nil
+	}
+
+	// protojson randomizes its whitespace
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// deviceJSON describes a device
+type deviceJSON struct {
+	Name       string          `json:"name"`
+	MAC        string          `json:"mac,omitempty"`
+	Address    string          `json:"address"`
+	Connected  bool            `json:"connected"`
+	Reconnects int             `json:"reconnects"`
+	LastError  string          `json:"last_error,omitempty"`
+	Info       json.RawMessage `json:"info,omitempty"`
+}
+
+func newDeviceJSON(d *manager.Device) deviceJSON {
+	dj := deviceJSON{
+		Name:       d.Name(),
+		MAC:        d.MAC(),
+		Address:    d.Config().Address,
+		Connected:  d.Connected(),
+		Reconnects: d.Reconnects(),
+	}
+	if err := d.LastError(); err != nil {
+		dj.LastError = err.Error()
+	}
+	if info := d.Info(); info != nil {
+		dj.Info = protoJSON(info)
+	}
+	return dj
+}
+
+// entityJSON describes an entity and its state
+type entityJSON struct {
+	Type     string          `json:"type"`
+	Key      uint32          `json:"key"`
+	ObjectID string          `json:"object_id"`
+	Name     string          `json:"name"`
+	UniqueID string          `json:"unique_id,omitempty"`
+	Entity   json.RawMessage `json:"entity,omitempty"`
+	State    json.RawMessage `json:"state,omitempty"`
+	Missing  bool            `json:"missing,omitempty"`
+	Updated  *time.Time      `json:"updated,omitempty"`
+}
+
+func newEntityJSON(store *espgohome.StateStore, e espgohome.Entity) entityJSON {
+	ej := entityJSON{
+		Type:     espgohome.GetEntityType(e).String(),
+		Key:      e.GetKey(),
+		ObjectID: e.GetObjectId(),
+		Name:     e.GetName(),
+	}
+	if m, ok := e.(proto.Message); ok {
+		ej.Entity = protoJSON(m)
+	}
+	if u, ok := e.(interface{ GetUniqueId() string }); ok {
+		ej.UniqueID = u.GetUniqueId()
+	}
+	if st, ok := store.Get(e.GetKey()); ok && st.State != nil {
+		ej.State = protoJSON(st.State)
+		ej.Missing = st.Missing
+		ej.Updated = &st.Updated
+	}
+	return ej
+}
+
+// serviceJSON describes a user defined service
+type serviceJSON struct {
+	Key  uint32           `json:"key"`
+	Name string           `json:"name"`
+	Args []serviceArgJSON `json:"args"`
+}
+
+type serviceArgJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func newServiceJSON(svc *entity.Service) serviceJSON {
+	sj := serviceJSON{Key: svc.Key, Name: svc.Name, Args: []serviceArgJSON{}}
+	for _, a := range svc.Args {
+		sj.Args = append(sj.Args, serviceArgJSON{Name: a.Name, Type: argTypeName(a.Type)})
+	}
+	return sj
+}
+
+// argTypeName shortens SERVICE_ARG_TYPE_INT to int
+func argTypeName(t espgohome.ServiceArgType) string {
+	return strings.ToLower(strings.TrimPrefix(t.String(), "SERVICE_ARG_TYPE_"))
+}
@@ -0,0 +1,290 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+var image = []byte("\xff\xd8 not really a jpeg \xff\xd9")
+
+const token = "secret"
+
+// newDevice returns a device whose commands are sent to the returned channel
+func newDevice() (*server.Server, chan proto.Message) {
+	s := &server.Server{
+		Info: &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01", EsphomeVersion: "1.15.0"},
+	}
+	commands := espgohometest.Commands(s)
+	s.OnCameraImage = func(m *espgohome.CameraImageRequest) { go s.SendCameraImage(4, image) }
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature", UnitOfMeasurement: "°C"})
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesLightResponse{ObjectId: "lamp", Key: 3, Name: "Lamp", SupportsBrightness: true})
+	s.AddEntity(&espgohome.ListEntitiesCameraResponse{ObjectId: "door", Key: 4, Name: "Door"})
+	s.AddService(&espgohome.ListEntitiesServicesResponse{
+		Name: "beep",
+		Key:  10,
+		Args: []*espgohome.ListEntitiesServicesArgument{
+			{Name: "times", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT},
+			{Name: "tones", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY},
+		},
+	})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.5})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: true})
+	s.SetState(&espgohome.LightStateResponse{Key: 3, State: true, Brightness: 0.5})
+
+	return s, commands
+}
+
+// startGateway starts a gateway for a manager connected to s
+func startGateway(t *testing.T, s *server.Server) (*manager.Device, *httptest.Server) {
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	d := espgohometest.Connect(t, m, s)
+
+	g := &Gateway{Manager: m, Token: token, Logs: "debug"}
+	if err := g.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	ts := httptest.NewServer(g)
+	t.Cleanup(func() {
+		g.Close()
+		ts.Close()
+	})
+
+	return d, ts
+}
+
+func get(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s: invalid response: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func post(t *testing.T, url, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestREST(t *testing.T) {
+	s, commands := newDevice()
+	d, ts := startGateway(t, s)
+
+	var devices []deviceJSON
+	if status := get(t, ts.URL+"/devices", &devices); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if len(devices) != 1 || devices[0].Name != "kitchen" || !devices[0].Connected || devices[0].Address != d.Config().Address {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+
+	var entities []entityJSON
+	get(t, ts.URL+"/devices/kitchen/entities", &entities)
+	if len(entities) != 4 || entities[1].ObjectID != "relay" || entities[1].Type != "Switch" {
+		t.Fatalf("unexpected entities %+v", entities)
+	}
+	if string(entities[1].State) != `{"key":2,"state":true}` {
+		t.Errorf("unexpected switch state %s", entities[1].State)
+	}
+
+	var lamp entityJSON
+	if status := get(t, ts.URL+"/devices/AA:AA:AA:AA:AA:01/entities/lamp", &lamp); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	var state map[string]interface{}
+	if err := json.Unmarshal(lamp.State, &state); err != nil || state["brightness"] != 0.5 {
+		t.Errorf("unexpected light state %s", lamp.State)
+	}
+
+	for _, path := range []string{"/devices/attic", "/devices/kitchen/entities/oven", "/devices/kitchen/camera/relay.jpg", "/nothing"} {
+		if status := get(t, ts.URL+path, nil); status != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", path, status)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/devices/kitchen/entities/relay", "application/json", strings.NewReader(`{"state": false}`))
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: got status %d, want 401", resp.StatusCode)
+	}
+	if status := post(t, ts.URL+"/devices/kitchen/entities/relay", `{"state": false}`); status != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 2 || c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+	post(t, ts.URL+"/devices/kitchen/entities/lamp", `{"state": true, "brightness": 0.25, "transition_length": 500}`)
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.LightCommandRequest); !ok || c.Key != 3 || !c.HasState || !c.HasBrightness || c.Brightness != 0.25 || !c.HasTransitionLength || c.HasRgb {
+		t.Errorf("unexpected light command %v", c)
+	}
+	if status := post(t, ts.URL+"/devices/kitchen/entities/lamp", `{"brightness": "bright"}`); status != http.StatusBadRequest {
+		t.Errorf("invalid command: got status %d, want 400", status)
+	}
+	if status := post(t, ts.URL+"/devices/kitchen/entities/temperature", `{}`); status != http.StatusMethodNotAllowed {
+		t.Errorf("sensor command: got status %d, want 405", status)
+	}
+
+	post(t, ts.URL+"/devices/kitchen/services/beep", `{"times": 3, "tones": [440, 880.5]}`)
+	c, ok := espgohometest.NextCommand(t, commands).(*espgohome.ExecuteServiceRequest)
+	if !ok || c.Key != 10 || len(c.Args) != 2 || c.Args[0].Int_ != 3 || len(c.Args[1].FloatArray) != 2 || c.Args[1].FloatArray[1] != 880.5 {
+		t.Errorf("unexpected service call %v", c)
+	}
+	if status := post(t, ts.URL+"/devices/kitchen/services/beep", `{"times": 3}`); status != http.StatusBadRequest {
+		t.Errorf("missing argument: got status %d, want 400", status)
+	}
+
+	resp, err = http.Get(ts.URL + "/devices/kitchen/camera/door.jpg")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/jpeg" || string(b) != string(image) {
+		t.Errorf("unexpected image %d %q", resp.StatusCode, b)
+	}
+}
+
+// stream opens the /events stream at url and returns a function that skips
+// events until one contains every string in want, the initial states may
+// arrive after the stream has started
+func stream(t *testing.T, url string) func(want ...string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan string, 16)
+	go func() {
+		defer close(events)
+		r := bufio.NewReader(resp.Body)
+		var e string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "\n" {
+				events <- e
+				e = ""
+				continue
+			}
+			e += line
+		}
+	}()
+	return func(want ...string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				match := true
+				for _, w := range want {
+					match = match && strings.Contains(e, w)
+				}
+				if match {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no event with %q", want)
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, _ := newDevice()
+	_, ts := startGateway(t, s)
+
+	waitFor := stream(t, ts.URL+"/events?device=kitchen&types=state,log,disconnected")
+
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+	waitFor("event: state\ndata: ", `"object_id":"relay"`, `"state":{"key":2,"state":false}`)
+
+	s.Log(espgohome.LogLevel_LOG_LEVEL_INFO, "main", "[I][main:12]: hello")
+	waitFor("event: log\ndata: ", `"message":"hello"`, `"tag":"main"`, `"line":12`)
+
+	s.Close()
+	waitFor("event: disconnected\ndata: ", `"device":"kitchen"`)
+
+	if status := get(t, ts.URL+"/events?types=weather", nil); status != http.StatusBadRequest {
+		t.Errorf("unknown type: got status %d, want 400", status)
+	}
+}
+
+func TestEventsBeforeConnect(t *testing.T) {
+	// the device is selected by its address before it has a name
+	l := espgohometest.Listen(t)
+	address := l.Addr().String()
+	l.Close()
+
+	m := manager.New("test-client")
+	m.MinBackoff = 10 * time.Millisecond
+	m.MaxBackoff = 20 * time.Millisecond
+	t.Cleanup(func() { m.Close() })
+	if _, err := m.Add(manager.DeviceConfig{Address: address}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	g := &Gateway{Manager: m}
+	if err := g.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	ts := httptest.NewServer(g)
+	t.Cleanup(func() {
+		g.Close()
+		ts.Close()
+	})
+	waitFor := stream(t, ts.URL+"/events?device="+address)
+
+	s, _ := newDevice()
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	waitFor("event: connected\ndata: ", `"device":"kitchen"`)
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+	waitFor("event: state\ndata: ", `"object_id":"relay"`, `"state":{"key":2,"state":false}`)
+}
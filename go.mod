@@ -1,13 +1,19 @@
 module github.com/jdugan1024/espgohome
 
-go 1.14
+go 1.17
 
 require (
-	github.com/go-delve/delve v1.5.0 // indirect
-	github.com/golang/protobuf v1.4.1
-	github.com/mattn/go-colorable v0.1.7 // indirect
-	github.com/rakyll/gotest v0.0.5 // indirect
-	golang.org/x/sys v0.0.0-20200926100807-9d91bd62050c // indirect
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	google.golang.org/protobuf v1.25.0
+	github.com/golang/protobuf v1.5.3
+	github.com/peterh/liner v1.2.1
+	golang.org/x/net v0.17.0
+	google.golang.org/grpc v1.54.0
+	google.golang.org/protobuf v1.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 )
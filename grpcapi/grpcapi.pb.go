@@ -0,0 +1,676 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: grpcapi/grpcapi.proto
+
+package grpcapi
+
+import (
+	espgohome "github.com/jdugan1024/espgohome"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ListEntitiesResponse is one of the ListEntities*Response messages
+type ListEntitiesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Entity:
+	//	*ListEntitiesResponse_BinarySensor
+	//	*ListEntitiesResponse_Cover
+	//	*ListEntitiesResponse_Fan
+	//	*ListEntitiesResponse_Light
+	//	*ListEntitiesResponse_Sensor
+	//	*ListEntitiesResponse_Switch
+	//	*ListEntitiesResponse_TextSensor
+	//	*ListEntitiesResponse_Services
+	//	*ListEntitiesResponse_Camera
+	//	*ListEntitiesResponse_Climate
+	Entity isListEntitiesResponse_Entity `protobuf_oneof:"entity"`
+}
+
+func (x *ListEntitiesResponse) Reset() {
+	*x = ListEntitiesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_grpcapi_grpcapi_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListEntitiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEntitiesResponse) ProtoMessage() {}
+
+func (x *ListEntitiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_grpcapi_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEntitiesResponse.ProtoReflect.Descriptor instead.
+func (*ListEntitiesResponse) Descriptor() ([]byte, []int) {
+	return file_grpcapi_grpcapi_proto_rawDescGZIP(), []int{0}
+}
+
+func (m *ListEntitiesResponse) GetEntity() isListEntitiesResponse_Entity {
+	if m != nil {
+		return m.Entity
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetBinarySensor() *espgohome.ListEntitiesBinarySensorResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_BinarySensor); ok {
+		return x.BinarySensor
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetCover() *espgohome.ListEntitiesCoverResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Cover); ok {
+		return x.Cover
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetFan() *espgohome.ListEntitiesFanResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Fan); ok {
+		return x.Fan
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetLight() *espgohome.ListEntitiesLightResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Light); ok {
+		return x.Light
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetSensor() *espgohome.ListEntitiesSensorResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Sensor); ok {
+		return x.Sensor
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetSwitch() *espgohome.ListEntitiesSwitchResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Switch); ok {
+		return x.Switch
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetTextSensor() *espgohome.ListEntitiesTextSensorResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_TextSensor); ok {
+		return x.TextSensor
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetServices() *espgohome.ListEntitiesServicesResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Services); ok {
+		return x.Services
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetCamera() *espgohome.ListEntitiesCameraResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Camera); ok {
+		return x.Camera
+	}
+	return nil
+}
+
+func (x *ListEntitiesResponse) GetClimate() *espgohome.ListEntitiesClimateResponse {
+	if x, ok := x.GetEntity().(*ListEntitiesResponse_Climate); ok {
+		return x.Climate
+	}
+	return nil
+}
+
+type isListEntitiesResponse_Entity interface {
+	isListEntitiesResponse_Entity()
+}
+
+type ListEntitiesResponse_BinarySensor struct {
+	BinarySensor *espgohome.ListEntitiesBinarySensorResponse `protobuf:"bytes,1,opt,name=binary_sensor,json=binarySensor,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Cover struct {
+	Cover *espgohome.ListEntitiesCoverResponse `protobuf:"bytes,2,opt,name=cover,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Fan struct {
+	Fan *espgohome.ListEntitiesFanResponse `protobuf:"bytes,3,opt,name=fan,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Light struct {
+	Light *espgohome.ListEntitiesLightResponse `protobuf:"bytes,4,opt,name=light,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Sensor struct {
+	Sensor *espgohome.ListEntitiesSensorResponse `protobuf:"bytes,5,opt,name=sensor,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Switch struct {
+	Switch *espgohome.ListEntitiesSwitchResponse `protobuf:"bytes,6,opt,name=switch,proto3,oneof"`
+}
+
+type ListEntitiesResponse_TextSensor struct {
+	TextSensor *espgohome.ListEntitiesTextSensorResponse `protobuf:"bytes,7,opt,name=text_sensor,json=textSensor,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Services struct {
+	Services *espgohome.ListEntitiesServicesResponse `protobuf:"bytes,8,opt,name=services,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Camera struct {
+	Camera *espgohome.ListEntitiesCameraResponse `protobuf:"bytes,9,opt,name=camera,proto3,oneof"`
+}
+
+type ListEntitiesResponse_Climate struct {
+	Climate *espgohome.ListEntitiesClimateResponse `protobuf:"bytes,10,opt,name=climate,proto3,oneof"`
+}
+
+func (*ListEntitiesResponse_BinarySensor) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Cover) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Fan) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Light) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Sensor) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Switch) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_TextSensor) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Services) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Camera) isListEntitiesResponse_Entity() {}
+
+func (*ListEntitiesResponse_Climate) isListEntitiesResponse_Entity() {}
+
+// StateResponse is one of the *StateResponse messages
+type StateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to State:
+	//	*StateResponse_BinarySensor
+	//	*StateResponse_Cover
+	//	*StateResponse_Fan
+	//	*StateResponse_Light
+	//	*StateResponse_Sensor
+	//	*StateResponse_Switch
+	//	*StateResponse_TextSensor
+	//	*StateResponse_Climate
+	State isStateResponse_State `protobuf_oneof:"state"`
+}
+
+func (x *StateResponse) Reset() {
+	*x = StateResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_grpcapi_grpcapi_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateResponse) ProtoMessage() {}
+
+func (x *StateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_grpcapi_grpcapi_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateResponse.ProtoReflect.Descriptor instead.
+func (*StateResponse) Descriptor() ([]byte, []int) {
+	return file_grpcapi_grpcapi_proto_rawDescGZIP(), []int{1}
+}
+
+func (m *StateResponse) GetState() isStateResponse_State {
+	if m != nil {
+		return m.State
+	}
+	return nil
+}
+
+func (x *StateResponse) GetBinarySensor() *espgohome.BinarySensorStateResponse {
+	if x, ok := x.GetState().(*StateResponse_BinarySensor); ok {
+		return x.BinarySensor
+	}
+	return nil
+}
+
+func (x *StateResponse) GetCover() *espgohome.CoverStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Cover); ok {
+		return x.Cover
+	}
+	return nil
+}
+
+func (x *StateResponse) GetFan() *espgohome.FanStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Fan); ok {
+		return x.Fan
+	}
+	return nil
+}
+
+func (x *StateResponse) GetLight() *espgohome.LightStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Light); ok {
+		return x.Light
+	}
+	return nil
+}
+
+func (x *StateResponse) GetSensor() *espgohome.SensorStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Sensor); ok {
+		return x.Sensor
+	}
+	return nil
+}
+
+func (x *StateResponse) GetSwitch() *espgohome.SwitchStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Switch); ok {
+		return x.Switch
+	}
+	return nil
+}
+
+func (x *StateResponse) GetTextSensor() *espgohome.TextSensorStateResponse {
+	if x, ok := x.GetState().(*StateResponse_TextSensor); ok {
+		return x.TextSensor
+	}
+	return nil
+}
+
+func (x *StateResponse) GetClimate() *espgohome.ClimateStateResponse {
+	if x, ok := x.GetState().(*StateResponse_Climate); ok {
+		return x.Climate
+	}
+	return nil
+}
+
+type isStateResponse_State interface {
+	isStateResponse_State()
+}
+
+type StateResponse_BinarySensor struct {
+	BinarySensor *espgohome.BinarySensorStateResponse `protobuf:"bytes,1,opt,name=binary_sensor,json=binarySensor,proto3,oneof"`
+}
+
+type StateResponse_Cover struct {
+	Cover *espgohome.CoverStateResponse `protobuf:"bytes,2,opt,name=cover,proto3,oneof"`
+}
+
+type StateResponse_Fan struct {
+	Fan *espgohome.FanStateResponse `protobuf:"bytes,3,opt,name=fan,proto3,oneof"`
+}
+
+type StateResponse_Light struct {
+	Light *espgohome.LightStateResponse `protobuf:"bytes,4,opt,name=light,proto3,oneof"`
+}
+
+type StateResponse_Sensor struct {
+	Sensor *espgohome.SensorStateResponse `protobuf:"bytes,5,opt,name=sensor,proto3,oneof"`
+}
+
+type StateResponse_Switch struct {
+	Switch *espgohome.SwitchStateResponse `protobuf:"bytes,6,opt,name=switch,proto3,oneof"`
+}
+
+type StateResponse_TextSensor struct {
+	TextSensor *espgohome.TextSensorStateResponse `protobuf:"bytes,7,opt,name=text_sensor,json=textSensor,proto3,oneof"`
+}
+
+type StateResponse_Climate struct {
+	Climate *espgohome.ClimateStateResponse `protobuf:"bytes,8,opt,name=climate,proto3,oneof"`
+}
+
+func (*StateResponse_BinarySensor) isStateResponse_State() {}
+
+func (*StateResponse_Cover) isStateResponse_State() {}
+
+func (*StateResponse_Fan) isStateResponse_State() {}
+
+func (*StateResponse_Light) isStateResponse_State() {}
+
+func (*StateResponse_Sensor) isStateResponse_State() {}
+
+func (*StateResponse_Switch) isStateResponse_State() {}
+
+func (*StateResponse_TextSensor) isStateResponse_State() {}
+
+func (*StateResponse_Climate) isStateResponse_State() {}
+
+var File_grpcapi_grpcapi_proto protoreflect.FileDescriptor
+
+var file_grpcapi_grpcapi_proto_rawDesc = []byte{
+	0x0a, 0x15, 0x67, 0x72, 0x70, 0x63, 0x61, 0x70, 0x69, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x61, 0x70,
+	0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x65, 0x73, 0x70, 0x67, 0x6f, 0x68, 0x6f,
+	0x6d, 0x65, 0x1a, 0x09, 0x61, 0x70, 0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x11, 0x61,
+	0x70, 0x69, 0x5f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0xe0, 0x04, 0x0a, 0x14, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65,
+	0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x48, 0x0a, 0x0d, 0x62, 0x69, 0x6e,
+	0x61, 0x72, 0x79, 0x5f, 0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x21, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x42,
+	0x69, 0x6e, 0x61, 0x72, 0x79, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0c, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x53, 0x65, 0x6e,
+	0x73, 0x6f, 0x72, 0x12, 0x32, 0x0a, 0x05, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65,
+	0x73, 0x43, 0x6f, 0x76, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00,
+	0x52, 0x05, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x12, 0x2c, 0x0a, 0x03, 0x66, 0x61, 0x6e, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74,
+	0x69, 0x65, 0x73, 0x46, 0x61, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00,
+	0x52, 0x03, 0x66, 0x61, 0x6e, 0x12, 0x32, 0x0a, 0x05, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74,
+	0x69, 0x65, 0x73, 0x4c, 0x69, 0x67, 0x68, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x48, 0x00, 0x52, 0x05, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x12, 0x35, 0x0a, 0x06, 0x73, 0x65, 0x6e,
+	0x73, 0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x4c, 0x69, 0x73, 0x74,
+	0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72,
+	0x12, 0x35, 0x0a, 0x06, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1b, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x53,
+	0x77, 0x69, 0x74, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52,
+	0x06, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x12, 0x42, 0x0a, 0x0b, 0x74, 0x65, 0x78, 0x74, 0x5f,
+	0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x4c,
+	0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x54, 0x65, 0x78, 0x74, 0x53,
+	0x65, 0x6e, 0x73, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52,
+	0x0a, 0x74, 0x65, 0x78, 0x74, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12, 0x3b, 0x0a, 0x08, 0x73,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e,
+	0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x08,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x73, 0x12, 0x35, 0x0a, 0x06, 0x63, 0x61, 0x6d, 0x65,
+	0x72, 0x61, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45,
+	0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x43, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x06, 0x63, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x12,
+	0x38, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1c, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x43,
+	0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00,
+	0x52, 0x07, 0x63, 0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x42, 0x08, 0x0a, 0x06, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x22, 0xac, 0x03, 0x0a, 0x0d, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x41, 0x0a, 0x0d, 0x62, 0x69, 0x6e, 0x61, 0x72, 0x79, 0x5f,
+	0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x42,
+	0x69, 0x6e, 0x61, 0x72, 0x79, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0c, 0x62, 0x69, 0x6e, 0x61,
+	0x72, 0x79, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12, 0x2b, 0x0a, 0x05, 0x63, 0x6f, 0x76, 0x65,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x43, 0x6f, 0x76, 0x65, 0x72, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x05,
+	0x63, 0x6f, 0x76, 0x65, 0x72, 0x12, 0x25, 0x0a, 0x03, 0x66, 0x61, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x11, 0x2e, 0x46, 0x61, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x03, 0x66, 0x61, 0x6e, 0x12, 0x2b, 0x0a, 0x05,
+	0x6c, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x4c, 0x69,
+	0x67, 0x68, 0x74, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x48, 0x00, 0x52, 0x05, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x12, 0x2e, 0x0a, 0x06, 0x73, 0x65, 0x6e,
+	0x73, 0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x53, 0x65, 0x6e, 0x73,
+	0x6f, 0x72, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48,
+	0x00, 0x52, 0x06, 0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12, 0x2e, 0x0a, 0x06, 0x73, 0x77, 0x69,
+	0x74, 0x63, 0x68, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x53, 0x77, 0x69, 0x74,
+	0x63, 0x68, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48,
+	0x00, 0x52, 0x06, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x12, 0x3b, 0x0a, 0x0b, 0x74, 0x65, 0x78,
+	0x74, 0x5f, 0x73, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18,
+	0x2e, 0x54, 0x65, 0x78, 0x74, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0a, 0x74, 0x65, 0x78, 0x74,
+	0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12, 0x31, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x6d, 0x61, 0x74,
+	0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x43, 0x6c, 0x69, 0x6d, 0x61, 0x74,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00,
+	0x52, 0x07, 0x63, 0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x42, 0x07, 0x0a, 0x05, 0x73, 0x74, 0x61,
+	0x74, 0x65, 0x32, 0xb1, 0x05, 0x0a, 0x0d, 0x41, 0x50, 0x49, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x25, 0x0a, 0x04, 0x70, 0x69, 0x6e, 0x67, 0x12, 0x0c, 0x2e, 0x50,
+	0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x50, 0x69, 0x6e,
+	0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x38, 0x0a, 0x0b, 0x64,
+	0x65, 0x76, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x12, 0x2e, 0x44, 0x65, 0x76,
+	0x69, 0x63, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13,
+	0x2e, 0x44, 0x65, 0x76, 0x69, 0x63, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x4a, 0x0a, 0x0d, 0x6c, 0x69, 0x73, 0x74, 0x5f, 0x65, 0x6e,
+	0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x14, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x65,
+	0x73, 0x70, 0x67, 0x6f, 0x68, 0x6f, 0x6d, 0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x45, 0x6e, 0x74,
+	0x69, 0x74, 0x69, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x49, 0x0a, 0x10, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x5f, 0x73,
+	0x74, 0x61, 0x74, 0x65, 0x73, 0x12, 0x17, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18,
+	0x2e, 0x65, 0x73, 0x70, 0x67, 0x6f, 0x68, 0x6f, 0x6d, 0x65, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x30, 0x01, 0x12, 0x43, 0x0a, 0x0e,
+	0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x5f, 0x6c, 0x6f, 0x67, 0x73, 0x12, 0x15,
+	0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x4c, 0x6f, 0x67, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62,
+	0x65, 0x4c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x32, 0x0a, 0x0f, 0x65, 0x78, 0x65, 0x63, 0x75, 0x74, 0x65, 0x5f, 0x73, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x12, 0x16, 0x2e, 0x45, 0x78, 0x65, 0x63, 0x75, 0x74, 0x65, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e, 0x76,
+	0x6f, 0x69, 0x64, 0x22, 0x00, 0x12, 0x2e, 0x0a, 0x0d, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x5f, 0x63,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x14, 0x2e, 0x43, 0x6f, 0x76, 0x65, 0x72, 0x43, 0x6f,
+	0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e, 0x76,
+	0x6f, 0x69, 0x64, 0x22, 0x00, 0x12, 0x2a, 0x0a, 0x0b, 0x66, 0x61, 0x6e, 0x5f, 0x63, 0x6f, 0x6d,
+	0x6d, 0x61, 0x6e, 0x64, 0x12, 0x12, 0x2e, 0x46, 0x61, 0x6e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e, 0x76, 0x6f, 0x69, 0x64, 0x22,
+	0x00, 0x12, 0x2e, 0x0a, 0x0d, 0x6c, 0x69, 0x67, 0x68, 0x74, 0x5f, 0x63, 0x6f, 0x6d, 0x6d, 0x61,
+	0x6e, 0x64, 0x12, 0x14, 0x2e, 0x4c, 0x69, 0x67, 0x68, 0x74, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e, 0x76, 0x6f, 0x69, 0x64, 0x22,
+	0x00, 0x12, 0x30, 0x0a, 0x0e, 0x73, 0x77, 0x69, 0x74, 0x63, 0x68, 0x5f, 0x63, 0x6f, 0x6d, 0x6d,
+	0x61, 0x6e, 0x64, 0x12, 0x15, 0x2e, 0x53, 0x77, 0x69, 0x74, 0x63, 0x68, 0x43, 0x6f, 0x6d, 0x6d,
+	0x61, 0x6e, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e, 0x76, 0x6f, 0x69,
+	0x64, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x0c, 0x63, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x5f, 0x69, 0x6d,
+	0x61, 0x67, 0x65, 0x12, 0x13, 0x2e, 0x43, 0x61, 0x6d, 0x65, 0x72, 0x61, 0x49, 0x6d, 0x61, 0x67,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x43, 0x61, 0x6d, 0x65, 0x72,
+	0x61, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00,
+	0x30, 0x01, 0x12, 0x32, 0x0a, 0x0f, 0x63, 0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x5f, 0x63, 0x6f,
+	0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x16, 0x2e, 0x43, 0x6c, 0x69, 0x6d, 0x61, 0x74, 0x65, 0x43,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x05, 0x2e,
+	0x76, 0x6f, 0x69, 0x64, 0x22, 0x00, 0x42, 0x29, 0x5a, 0x27, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
+	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6a, 0x64, 0x75, 0x67, 0x61, 0x6e, 0x31, 0x30, 0x32, 0x34, 0x2f,
+	0x65, 0x73, 0x70, 0x67, 0x6f, 0x68, 0x6f, 0x6d, 0x65, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x61, 0x70,
+	0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_grpcapi_grpcapi_proto_rawDescOnce sync.Once
+	file_grpcapi_grpcapi_proto_rawDescData = file_grpcapi_grpcapi_proto_rawDesc
+)
+
+func file_grpcapi_grpcapi_proto_rawDescGZIP() []byte {
+	file_grpcapi_grpcapi_proto_rawDescOnce.Do(func() {
+		file_grpcapi_grpcapi_proto_rawDescData = protoimpl.X.CompressGZIP(file_grpcapi_grpcapi_proto_rawDescData)
+	})
+	return file_grpcapi_grpcapi_proto_rawDescData
+}
+
+var file_grpcapi_grpcapi_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_grpcapi_grpcapi_proto_goTypes = []interface{}{
+	(*ListEntitiesResponse)(nil),                       // 0: espgohome.ListEntitiesResponse
+	(*StateResponse)(nil),                              // 1: espgohome.StateResponse
+	(*espgohome.ListEntitiesBinarySensorResponse)(nil), // 2: ListEntitiesBinarySensorResponse
+	(*espgohome.ListEntitiesCoverResponse)(nil),        // 3: ListEntitiesCoverResponse
+	(*espgohome.ListEntitiesFanResponse)(nil),          // 4: ListEntitiesFanResponse
+	(*espgohome.ListEntitiesLightResponse)(nil),        // 5: ListEntitiesLightResponse
+	(*espgohome.ListEntitiesSensorResponse)(nil),       // 6: ListEntitiesSensorResponse
+	(*espgohome.ListEntitiesSwitchResponse)(nil),       // 7: ListEntitiesSwitchResponse
+	(*espgohome.ListEntitiesTextSensorResponse)(nil),   // 8: ListEntitiesTextSensorResponse
+	(*espgohome.ListEntitiesServicesResponse)(nil),     // 9: ListEntitiesServicesResponse
+	(*espgohome.ListEntitiesCameraResponse)(nil),       // 10: ListEntitiesCameraResponse
+	(*espgohome.ListEntitiesClimateResponse)(nil),      // 11: ListEntitiesClimateResponse
+	(*espgohome.BinarySensorStateResponse)(nil),        // 12: BinarySensorStateResponse
+	(*espgohome.CoverStateResponse)(nil),               // 13: CoverStateResponse
+	(*espgohome.FanStateResponse)(nil),                 // 14: FanStateResponse
+	(*espgohome.LightStateResponse)(nil),               // 15: LightStateResponse
+	(*espgohome.SensorStateResponse)(nil),              // 16: SensorStateResponse
+	(*espgohome.SwitchStateResponse)(nil),              // 17: SwitchStateResponse
+	(*espgohome.TextSensorStateResponse)(nil),          // 18: TextSensorStateResponse
+	(*espgohome.ClimateStateResponse)(nil),             // 19: ClimateStateResponse
+	(*espgohome.PingRequest)(nil),                      // 20: PingRequest
+	(*espgohome.DeviceInfoRequest)(nil),                // 21: DeviceInfoRequest
+	(*espgohome.ListEntitiesRequest)(nil),              // 22: ListEntitiesRequest
+	(*espgohome.SubscribeStatesRequest)(nil),           // 23: SubscribeStatesRequest
+	(*espgohome.SubscribeLogsRequest)(nil),             // 24: SubscribeLogsRequest
+	(*espgohome.ExecuteServiceRequest)(nil),            // 25: ExecuteServiceRequest
+	(*espgohome.CoverCommandRequest)(nil),              // 26: CoverCommandRequest
+	(*espgohome.FanCommandRequest)(nil),                // 27: FanCommandRequest
+	(*espgohome.LightCommandRequest)(nil),              // 28: LightCommandRequest
+	(*espgohome.SwitchCommandRequest)(nil),             // 29: SwitchCommandRequest
+	(*espgohome.CameraImageRequest)(nil),               // 30: CameraImageRequest
+	(*espgohome.ClimateCommandRequest)(nil),            // 31: ClimateCommandRequest
+	(*espgohome.PingResponse)(nil),                     // 32: PingResponse
+	(*espgohome.DeviceInfoResponse)(nil),               // 33: DeviceInfoResponse
+	(*espgohome.SubscribeLogsResponse)(nil),            // 34: SubscribeLogsResponse
+	(*espgohome.Void)(nil),                             // 35: void
+	(*espgohome.CameraImageResponse)(nil),              // 36: CameraImageResponse
+}
+var file_grpcapi_grpcapi_proto_depIdxs = []int32{
+	2,  // 0: espgohome.ListEntitiesResponse.binary_sensor:type_name -> ListEntitiesBinarySensorResponse
+	3,  // 1: espgohome.ListEntitiesResponse.cover:type_name -> ListEntitiesCoverResponse
+	4,  // 2: espgohome.ListEntitiesResponse.fan:type_name -> ListEntitiesFanResponse
+	5,  // 3: espgohome.ListEntitiesResponse.light:type_name -> ListEntitiesLightResponse
+	6,  // 4: espgohome.ListEntitiesResponse.sensor:type_name -> ListEntitiesSensorResponse
+	7,  // 5: espgohome.ListEntitiesResponse.switch:type_name -> ListEntitiesSwitchResponse
+	8,  // 6: espgohome.ListEntitiesResponse.text_sensor:type_name -> ListEntitiesTextSensorResponse
+	9,  // 7: espgohome.ListEntitiesResponse.services:type_name -> ListEntitiesServicesResponse
+	10, // 8: espgohome.ListEntitiesResponse.camera:type_name -> ListEntitiesCameraResponse
+	11, // 9: espgohome.ListEntitiesResponse.climate:type_name -> ListEntitiesClimateResponse
+	12, // 10: espgohome.StateResponse.binary_sensor:type_name -> BinarySensorStateResponse
+	13, // 11: espgohome.StateResponse.cover:type_name -> CoverStateResponse
+	14, // 12: espgohome.StateResponse.fan:type_name -> FanStateResponse
+	15, // 13: espgohome.StateResponse.light:type_name -> LightStateResponse
+	16, // 14: espgohome.StateResponse.sensor:type_name -> SensorStateResponse
+	17, // 15: espgohome.StateResponse.switch:type_name -> SwitchStateResponse
+	18, // 16: espgohome.StateResponse.text_sensor:type_name -> TextSensorStateResponse
+	19, // 17: espgohome.StateResponse.climate:type_name -> ClimateStateResponse
+	20, // 18: espgohome.APIConnection.ping:input_type -> PingRequest
+	21, // 19: espgohome.APIConnection.device_info:input_type -> DeviceInfoRequest
+	22, // 20: espgohome.APIConnection.list_entities:input_type -> ListEntitiesRequest
+	23, // 21: espgohome.APIConnection.subscribe_states:input_type -> SubscribeStatesRequest
+	24, // 22: espgohome.APIConnection.subscribe_logs:input_type -> SubscribeLogsRequest
+	25, // 23: espgohome.APIConnection.execute_service:input_type -> ExecuteServiceRequest
+	26, // 24: espgohome.APIConnection.cover_command:input_type -> CoverCommandRequest
+	27, // 25: espgohome.APIConnection.fan_command:input_type -> FanCommandRequest
+	28, // 26: espgohome.APIConnection.light_command:input_type -> LightCommandRequest
+	29, // 27: espgohome.APIConnection.switch_command:input_type -> SwitchCommandRequest
+	30, // 28: espgohome.APIConnection.camera_image:input_type -> CameraImageRequest
+	31, // 29: espgohome.APIConnection.climate_command:input_type -> ClimateCommandRequest
+	32, // 30: espgohome.APIConnection.ping:output_type -> PingResponse
+	33, // 31: espgohome.APIConnection.device_info:output_type -> DeviceInfoResponse
+	0,  // 32: espgohome.APIConnection.list_entities:output_type -> espgohome.ListEntitiesResponse
+	1,  // 33: espgohome.APIConnection.subscribe_states:output_type -> espgohome.StateResponse
+	34, // 34: espgohome.APIConnection.subscribe_logs:output_type -> SubscribeLogsResponse
+	35, // 35: espgohome.APIConnection.execute_service:output_type -> void
+	35, // 36: espgohome.APIConnection.cover_command:output_type -> void
+	35, // 37: espgohome.APIConnection.fan_command:output_type -> void
+	35, // 38: espgohome.APIConnection.light_command:output_type -> void
+	35, // 39: espgohome.APIConnection.switch_command:output_type -> void
+	36, // 40: espgohome.APIConnection.camera_image:output_type -> CameraImageResponse
+	35, // 41: espgohome.APIConnection.climate_command:output_type -> void
+	30, // [30:42] is the sub-list for method output_type
+	18, // [18:30] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
+}
+
+func init() { file_grpcapi_grpcapi_proto_init() }
+func file_grpcapi_grpcapi_proto_init() {
+	if File_grpcapi_grpcapi_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_grpcapi_grpcapi_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListEntitiesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_grpcapi_grpcapi_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StateResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_grpcapi_grpcapi_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*ListEntitiesResponse_BinarySensor)(nil),
+		(*ListEntitiesResponse_Cover)(nil),
+		(*ListEntitiesResponse_Fan)(nil),
+		(*ListEntitiesResponse_Light)(nil),
+		(*ListEntitiesResponse_Sensor)(nil),
+		(*ListEntitiesResponse_Switch)(nil),
+		(*ListEntitiesResponse_TextSensor)(nil),
+		(*ListEntitiesResponse_Services)(nil),
+		(*ListEntitiesResponse_Camera)(nil),
+		(*ListEntitiesResponse_Climate)(nil),
+	}
+	file_grpcapi_grpcapi_proto_msgTypes[1].OneofWrappers = []interface{}{
+		(*StateResponse_BinarySensor)(nil),
+		(*StateResponse_Cover)(nil),
+		(*StateResponse_Fan)(nil),
+		(*StateResponse_Light)(nil),
+		(*StateResponse_Sensor)(nil),
+		(*StateResponse_Switch)(nil),
+		(*StateResponse_TextSensor)(nil),
+		(*StateResponse_Climate)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_grpcapi_grpcapi_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_grpcapi_grpcapi_proto_goTypes,
+		DependencyIndexes: file_grpcapi_grpcapi_proto_depIdxs,
+		MessageInfos:      file_grpcapi_grpcapi_proto_msgTypes,
+	}.Build()
+	File_grpcapi_grpcapi_proto = out.File
+	file_grpcapi_grpcapi_proto_rawDesc = nil
+	file_grpcapi_grpcapi_proto_goTypes = nil
+	file_grpcapi_grpcapi_proto_depIdxs = nil
+}
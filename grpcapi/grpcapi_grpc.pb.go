@@ -0,0 +1,626 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: grpcapi/grpcapi.proto
+
+package grpcapi
+
+import (
+	context "context"
+	espgohome "github.com/jdugan1024/espgohome"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	APIConnection_Ping_FullMethodName            = "/espgohome.APIConnection/ping"
+	APIConnection_DeviceInfo_FullMethodName      = "/espgohome.APIConnection/device_info"
+	APIConnection_ListEntities_FullMethodName    = "/espgohome.APIConnection/list_entities"
+	APIConnection_SubscribeStates_FullMethodName = "/espgohome.APIConnection/subscribe_states"
+	APIConnection_SubscribeLogs_FullMethodName   = "/espgohome.APIConnection/subscribe_logs"
+	APIConnection_ExecuteService_FullMethodName  = "/espgohome.APIConnection/execute_service"
+	APIConnection_CoverCommand_FullMethodName    = "/espgohome.APIConnection/cover_command"
+	APIConnection_FanCommand_FullMethodName      = "/espgohome.APIConnection/fan_command"
+	APIConnection_LightCommand_FullMethodName    = "/espgohome.APIConnection/light_command"
+	APIConnection_SwitchCommand_FullMethodName   = "/espgohome.APIConnection/switch_command"
+	APIConnection_CameraImage_FullMethodName     = "/espgohome.APIConnection/camera_image"
+	APIConnection_ClimateCommand_FullMethodName  = "/espgohome.APIConnection/climate_command"
+)
+
+// APIConnectionClient is the client API for APIConnection service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type APIConnectionClient interface {
+	Ping(ctx context.Context, in *espgohome.PingRequest, opts ...grpc.CallOption) (*espgohome.PingResponse, error)
+	DeviceInfo(ctx context.Context, in *espgohome.DeviceInfoRequest, opts ...grpc.CallOption) (*espgohome.DeviceInfoResponse, error)
+	ListEntities(ctx context.Context, in *espgohome.ListEntitiesRequest, opts ...grpc.CallOption) (APIConnection_ListEntitiesClient, error)
+	SubscribeStates(ctx context.Context, in *espgohome.SubscribeStatesRequest, opts ...grpc.CallOption) (APIConnection_SubscribeStatesClient, error)
+	SubscribeLogs(ctx context.Context, in *espgohome.SubscribeLogsRequest, opts ...grpc.CallOption) (APIConnection_SubscribeLogsClient, error)
+	ExecuteService(ctx context.Context, in *espgohome.ExecuteServiceRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+	CoverCommand(ctx context.Context, in *espgohome.CoverCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+	FanCommand(ctx context.Context, in *espgohome.FanCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+	LightCommand(ctx context.Context, in *espgohome.LightCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+	SwitchCommand(ctx context.Context, in *espgohome.SwitchCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+	CameraImage(ctx context.Context, in *espgohome.CameraImageRequest, opts ...grpc.CallOption) (APIConnection_CameraImageClient, error)
+	ClimateCommand(ctx context.Context, in *espgohome.ClimateCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error)
+}
+
+type aPIConnectionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAPIConnectionClient(cc grpc.ClientConnInterface) APIConnectionClient {
+	return &aPIConnectionClient{cc}
+}
+
+func (c *aPIConnectionClient) Ping(ctx context.Context, in *espgohome.PingRequest, opts ...grpc.CallOption) (*espgohome.PingResponse, error) {
+	out := new(espgohome.PingResponse)
+	err := c.cc.Invoke(ctx, APIConnection_Ping_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) DeviceInfo(ctx context.Context, in *espgohome.DeviceInfoRequest, opts ...grpc.CallOption) (*espgohome.DeviceInfoResponse, error) {
+	out := new(espgohome.DeviceInfoResponse)
+	err := c.cc.Invoke(ctx, APIConnection_DeviceInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) ListEntities(ctx context.Context, in *espgohome.ListEntitiesRequest, opts ...grpc.CallOption) (APIConnection_ListEntitiesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &APIConnection_ServiceDesc.Streams[0], APIConnection_ListEntities_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIConnectionListEntitiesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type APIConnection_ListEntitiesClient interface {
+	Recv() (*ListEntitiesResponse, error)
+	grpc.ClientStream
+}
+
+type aPIConnectionListEntitiesClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIConnectionListEntitiesClient) Recv() (*ListEntitiesResponse, error) {
+	m := new(ListEntitiesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *aPIConnectionClient) SubscribeStates(ctx context.Context, in *espgohome.SubscribeStatesRequest, opts ...grpc.CallOption) (APIConnection_SubscribeStatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &APIConnection_ServiceDesc.Streams[1], APIConnection_SubscribeStates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIConnectionSubscribeStatesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type APIConnection_SubscribeStatesClient interface {
+	Recv() (*StateResponse, error)
+	grpc.ClientStream
+}
+
+type aPIConnectionSubscribeStatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIConnectionSubscribeStatesClient) Recv() (*StateResponse, error) {
+	m := new(StateResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *aPIConnectionClient) SubscribeLogs(ctx context.Context, in *espgohome.SubscribeLogsRequest, opts ...grpc.CallOption) (APIConnection_SubscribeLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &APIConnection_ServiceDesc.Streams[2], APIConnection_SubscribeLogs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIConnectionSubscribeLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type APIConnection_SubscribeLogsClient interface {
+	Recv() (*espgohome.SubscribeLogsResponse, error)
+	grpc.ClientStream
+}
+
+type aPIConnectionSubscribeLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIConnectionSubscribeLogsClient) Recv() (*espgohome.SubscribeLogsResponse, error) {
+	m := new(espgohome.SubscribeLogsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *aPIConnectionClient) ExecuteService(ctx context.Context, in *espgohome.ExecuteServiceRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_ExecuteService_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) CoverCommand(ctx context.Context, in *espgohome.CoverCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_CoverCommand_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) FanCommand(ctx context.Context, in *espgohome.FanCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_FanCommand_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) LightCommand(ctx context.Context, in *espgohome.LightCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_LightCommand_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) SwitchCommand(ctx context.Context, in *espgohome.SwitchCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_SwitchCommand_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *aPIConnectionClient) CameraImage(ctx context.Context, in *espgohome.CameraImageRequest, opts ...grpc.CallOption) (APIConnection_CameraImageClient, error) {
+	stream, err := c.cc.NewStream(ctx, &APIConnection_ServiceDesc.Streams[3], APIConnection_CameraImage_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &aPIConnectionCameraImageClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type APIConnection_CameraImageClient interface {
+	Recv() (*espgohome.CameraImageResponse, error)
+	grpc.ClientStream
+}
+
+type aPIConnectionCameraImageClient struct {
+	grpc.ClientStream
+}
+
+func (x *aPIConnectionCameraImageClient) Recv() (*espgohome.CameraImageResponse, error) {
+	m := new(espgohome.CameraImageResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *aPIConnectionClient) ClimateCommand(ctx context.Context, in *espgohome.ClimateCommandRequest, opts ...grpc.CallOption) (*espgohome.Void, error) {
+	out := new(espgohome.Void)
+	err := c.cc.Invoke(ctx, APIConnection_ClimateCommand_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// APIConnectionServer is the server API for APIConnection service.
+// All implementations must embed UnimplementedAPIConnectionServer
+// for forward compatibility
+type APIConnectionServer interface {
+	Ping(context.Context, *espgohome.PingRequest) (*espgohome.PingResponse, error)
+	DeviceInfo(context.Context, *espgohome.DeviceInfoRequest) (*espgohome.DeviceInfoResponse, error)
+	ListEntities(*espgohome.ListEntitiesRequest, APIConnection_ListEntitiesServer) error
+	SubscribeStates(*espgohome.SubscribeStatesRequest, APIConnection_SubscribeStatesServer) error
+	SubscribeLogs(*espgohome.SubscribeLogsRequest, APIConnection_SubscribeLogsServer) error
+	ExecuteService(context.Context, *espgohome.ExecuteServiceRequest) (*espgohome.Void, error)
+	CoverCommand(context.Context, *espgohome.CoverCommandRequest) (*espgohome.Void, error)
+	FanCommand(context.Context, *espgohome.FanCommandRequest) (*espgohome.Void, error)
+	LightCommand(context.Context, *espgohome.LightCommandRequest) (*espgohome.Void, error)
+	SwitchCommand(context.Context, *espgohome.SwitchCommandRequest) (*espgohome.Void, error)
+	CameraImage(*espgohome.CameraImageRequest, APIConnection_CameraImageServer) error
+	ClimateCommand(context.Context, *espgohome.ClimateCommandRequest) (*espgohome.Void, error)
+	mustEmbedUnimplementedAPIConnectionServer()
+}
+
+// UnimplementedAPIConnectionServer must be embedded to have forward compatible implementations.
+type UnimplementedAPIConnectionServer struct {
+}
+
+func (UnimplementedAPIConnectionServer) Ping(context.Context, *espgohome.PingRequest) (*espgohome.PingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedAPIConnectionServer) DeviceInfo(context.Context, *espgohome.DeviceInfoRequest) (*espgohome.DeviceInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeviceInfo not implemented")
+}
+func (UnimplementedAPIConnectionServer) ListEntities(*espgohome.ListEntitiesRequest, APIConnection_ListEntitiesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListEntities not implemented")
+}
+func (UnimplementedAPIConnectionServer) SubscribeStates(*espgohome.SubscribeStatesRequest, APIConnection_SubscribeStatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeStates not implemented")
+}
+func (UnimplementedAPIConnectionServer) SubscribeLogs(*espgohome.SubscribeLogsRequest, APIConnection_SubscribeLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeLogs not implemented")
+}
+func (UnimplementedAPIConnectionServer) ExecuteService(context.Context, *espgohome.ExecuteServiceRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteService not implemented")
+}
+func (UnimplementedAPIConnectionServer) CoverCommand(context.Context, *espgohome.CoverCommandRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CoverCommand not implemented")
+}
+func (UnimplementedAPIConnectionServer) FanCommand(context.Context, *espgohome.FanCommandRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FanCommand not implemented")
+}
+func (UnimplementedAPIConnectionServer) LightCommand(context.Context, *espgohome.LightCommandRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LightCommand not implemented")
+}
+func (UnimplementedAPIConnectionServer) SwitchCommand(context.Context, *espgohome.SwitchCommandRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SwitchCommand not implemented")
+}
+func (UnimplementedAPIConnectionServer) CameraImage(*espgohome.CameraImageRequest, APIConnection_CameraImageServer) error {
+	return status.Errorf(codes.Unimplemented, "method CameraImage not implemented")
+}
+func (UnimplementedAPIConnectionServer) ClimateCommand(context.Context, *espgohome.ClimateCommandRequest) (*espgohome.Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClimateCommand not implemented")
+}
+func (UnimplementedAPIConnectionServer) mustEmbedUnimplementedAPIConnectionServer() {}
+
+// UnsafeAPIConnectionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to APIConnectionServer will
+// result in compilation errors.
+type UnsafeAPIConnectionServer interface {
+	mustEmbedUnimplementedAPIConnectionServer()
+}
+
+func RegisterAPIConnectionServer(s grpc.ServiceRegistrar, srv APIConnectionServer) {
+	s.RegisterService(&APIConnection_ServiceDesc, srv)
+}
+
+func _APIConnection_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_Ping_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).Ping(ctx, req.(*espgohome.PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_DeviceInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.DeviceInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).DeviceInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_DeviceInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).DeviceInfo(ctx, req.(*espgohome.DeviceInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_ListEntities_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(espgohome.ListEntitiesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIConnectionServer).ListEntities(m, &aPIConnectionListEntitiesServer{stream})
+}
+
+type APIConnection_ListEntitiesServer interface {
+	Send(*ListEntitiesResponse) error
+	grpc.ServerStream
+}
+
+type aPIConnectionListEntitiesServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIConnectionListEntitiesServer) Send(m *ListEntitiesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _APIConnection_SubscribeStates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(espgohome.SubscribeStatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIConnectionServer).SubscribeStates(m, &aPIConnectionSubscribeStatesServer{stream})
+}
+
+type APIConnection_SubscribeStatesServer interface {
+	Send(*StateResponse) error
+	grpc.ServerStream
+}
+
+type aPIConnectionSubscribeStatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIConnectionSubscribeStatesServer) Send(m *StateResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _APIConnection_SubscribeLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(espgohome.SubscribeLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIConnectionServer).SubscribeLogs(m, &aPIConnectionSubscribeLogsServer{stream})
+}
+
+type APIConnection_SubscribeLogsServer interface {
+	Send(*espgohome.SubscribeLogsResponse) error
+	grpc.ServerStream
+}
+
+type aPIConnectionSubscribeLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIConnectionSubscribeLogsServer) Send(m *espgohome.SubscribeLogsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _APIConnection_ExecuteService_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.ExecuteServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).ExecuteService(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_ExecuteService_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).ExecuteService(ctx, req.(*espgohome.ExecuteServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_CoverCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.CoverCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).CoverCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_CoverCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).CoverCommand(ctx, req.(*espgohome.CoverCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_FanCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.FanCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).FanCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_FanCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).FanCommand(ctx, req.(*espgohome.FanCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_LightCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.LightCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).LightCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_LightCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).LightCommand(ctx, req.(*espgohome.LightCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_SwitchCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.SwitchCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).SwitchCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_SwitchCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).SwitchCommand(ctx, req.(*espgohome.SwitchCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _APIConnection_CameraImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(espgohome.CameraImageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(APIConnectionServer).CameraImage(m, &aPIConnectionCameraImageServer{stream})
+}
+
+type APIConnection_CameraImageServer interface {
+	Send(*espgohome.CameraImageResponse) error
+	grpc.ServerStream
+}
+
+type aPIConnectionCameraImageServer struct {
+	grpc.ServerStream
+}
+
+func (x *aPIConnectionCameraImageServer) Send(m *espgohome.CameraImageResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _APIConnection_ClimateCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(espgohome.ClimateCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(APIConnectionServer).ClimateCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: APIConnection_ClimateCommand_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(APIConnectionServer).ClimateCommand(ctx, req.(*espgohome.ClimateCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// APIConnection_ServiceDesc is the grpc.ServiceDesc for APIConnection service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var APIConnection_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "espgohome.APIConnection",
+	HandlerType: (*APIConnectionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ping",
+			Handler:    _APIConnection_Ping_Handler,
+		},
+		{
+			MethodName: "device_info",
+			Handler:    _APIConnection_DeviceInfo_Handler,
+		},
+		{
+			MethodName: "execute_service",
+			Handler:    _APIConnection_ExecuteService_Handler,
+		},
+		{
+			MethodName: "cover_command",
+			Handler:    _APIConnection_CoverCommand_Handler,
+		},
+		{
+			MethodName: "fan_command",
+			Handler:    _APIConnection_FanCommand_Handler,
+		},
+		{
+			MethodName: "light_command",
+			Handler:    _APIConnection_LightCommand_Handler,
+		},
+		{
+			MethodName: "switch_command",
+			Handler:    _APIConnection_SwitchCommand_Handler,
+		},
+		{
+			MethodName: "climate_command",
+			Handler:    _APIConnection_ClimateCommand_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "list_entities",
+			Handler:       _APIConnection_ListEntities_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "subscribe_states",
+			Handler:       _APIConnection_SubscribeStates_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "subscribe_logs",
+			Handler:       _APIConnection_SubscribeLogs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "camera_image",
+			Handler:       _APIConnection_CameraImage_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "grpcapi/grpcapi.proto",
+}
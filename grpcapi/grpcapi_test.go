@@ -0,0 +1,176 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// start connects a Manager to a fake device and returns a client of a gRPC
+// server for it
+func start(t *testing.T) (*server.Server, APIConnectionClient, chan proto.Message) {
+	s := &server.Server{
+		Info: &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01", EsphomeVersion: "1.15.0"},
+	}
+	commands := espgohometest.Commands(s)
+	s.OnCameraImage = func(m *espgohome.CameraImageRequest) {
+		go s.SendCameraImage(4, make([]byte, 3000))
+	}
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"})
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesCameraResponse{ObjectId: "door", Key: 4, Name: "Door"})
+	s.AddService(&espgohome.ListEntitiesServicesResponse{Name: "beep", Key: 10})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.5})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: true})
+
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	espgohometest.Connect(t, m, s)
+
+	gs := grpc.NewServer()
+	RegisterAPIConnectionServer(gs, &Server{Manager: m})
+	gl := espgohometest.Listen(t)
+	go gs.Serve(gl)
+	t.Cleanup(gs.Stop)
+
+	cc, err := grpc.Dial(gl.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return s, NewAPIConnectionClient(cc), commands
+}
+
+func TestUnary(t *testing.T) {
+	_, client, commands := start(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), DeviceKey, "kitchen")
+
+	info, err := client.DeviceInfo(ctx, &espgohome.DeviceInfoRequest{})
+	if err != nil || info.MacAddress != "AA:AA:AA:AA:AA:01" {
+		t.Fatalf("unexpected device info %v %v", info, err)
+	}
+	if _, err := client.Ping(context.Background(), &espgohome.PingRequest{}); err != nil {
+		t.Errorf("ping failed: %v", err)
+	}
+
+	if _, err := client.SwitchCommand(ctx, &espgohome.SwitchCommandRequest{Key: 2, State: false}); err != nil {
+		t.Fatalf("switch command failed: %v", err)
+	}
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 2 || c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+	if _, err := client.ExecuteService(ctx, &espgohome.ExecuteServiceRequest{Key: 10}); err != nil {
+		t.Fatalf("execute service failed: %v", err)
+	}
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.ExecuteServiceRequest); !ok || c.Key != 10 {
+		t.Errorf("unexpected service call %v", c)
+	}
+
+	attic := metadata.AppendToOutgoingContext(context.Background(), DeviceKey, "attic")
+	if _, err := client.DeviceInfo(attic, &espgohome.DeviceInfoRequest{}); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown device: got %v, want NotFound", err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	s, client, _ := start(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	list, err := client.ListEntities(ctx, &espgohome.ListEntitiesRequest{})
+	if err != nil {
+		t.Fatalf("list entities failed: %v", err)
+	}
+	var names []string
+	for {
+		resp, err := list.Recv()
+		if err != nil {
+			break
+		}
+		switch e := Unwrap(resp).(type) {
+		case espgohome.Entity:
+			names = append(names, e.GetObjectId())
+		case *espgohome.ListEntitiesServicesResponse:
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) != 4 || names[1] != "relay" || names[3] != "beep" {
+		t.Errorf("unexpected entities %v", names)
+	}
+
+	states, err := client.SubscribeStates(ctx, &espgohome.SubscribeStatesRequest{})
+	if err != nil {
+		t.Fatalf("subscribe states failed: %v", err)
+	}
+	for _, want := range []bool{true, false} {
+		if !want {
+			s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+		}
+		for {
+			resp, err := states.Recv()
+			if err != nil {
+				t.Fatalf("receive failed: %v", err)
+			}
+			if st, ok := Unwrap(resp).(*espgohome.SwitchStateResponse); ok {
+				if st.State != want {
+					t.Errorf("got switch state %v, want %v", st.State, want)
+				}
+				break
+			}
+		}
+	}
+
+	logs, err := client.SubscribeLogs(ctx, &espgohome.SubscribeLogsRequest{Level: espgohome.LogLevel_LOG_LEVEL_DEBUG})
+	if err != nil {
+		t.Fatalf("subscribe logs failed: %v", err)
+	}
+	// the subscription reaches the device with the first message
+	deadline := time.Now().Add(2 * time.Second)
+	received := make(chan *espgohome.SubscribeLogsResponse)
+	go func() {
+		if resp, err := logs.Recv(); err == nil {
+			received <- resp
+		}
+	}()
+	for resp := (*espgohome.SubscribeLogsResponse)(nil); resp == nil; {
+		s.Log(espgohome.LogLevel_LOG_LEVEL_INFO, "main", "hello")
+		select {
+		case resp = <-received:
+			if resp.Message != "hello" {
+				t.Errorf("unexpected log message %v", resp)
+			}
+		case <-time.After(20 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("no log message received")
+			}
+		}
+	}
+
+	image, err := client.CameraImage(ctx, &espgohome.CameraImageRequest{Single: true})
+	if err != nil {
+		t.Fatalf("camera image failed: %v", err)
+	}
+	size := 0
+	for {
+		chunk, err := image.Recv()
+		if err != nil {
+			break
+		}
+		size += len(chunk.Data)
+	}
+	if size != 3000 {
+		t.Errorf("got %d bytes of image, want 3000", size)
+	}
+}
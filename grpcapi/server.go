@@ -0,0 +1,356 @@
+// Package grpcapi serves the APIConnection service of api.proto over gRPC,
+// proxying each call to a device of a manager.Manager.
+//
+// The service is declared in grpcapi.proto with the messages of api.proto.
+// The replies a device sends as a series of messages are server streams:
+// list_entities streams ListEntitiesResponse, subscribe_states streams
+// StateResponse, both wrapping the device's messages in a oneof, and
+// subscribe_logs and camera_image stream SubscribeLogsResponse and
+// CameraImageResponse. Calls pick the device with the "device" metadata key,
+// a name or MAC address, which can be left out when the Manager has a single
+// device.
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DeviceKey is the metadata key that selects the device of a call
+const DeviceKey = "device"
+
+// stateBuffer is how many state changes are queued for a subscribe_states
+// stream before they are dropped
+const stateBuffer = 256
+
+// Server implements APIConnectionServer for the devices of a Manager
+type Server struct {
+	UnimplementedAPIConnectionServer
+
+	Manager *manager.Manager
+	// Logger receives the diagnostic messages of the server
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+}
+
+// Ping pings the device, giving up after manager.DefaultPingTimeout or when
+// the call is cancelled
+func (s *Server) Ping(ctx context.Context, req *espgohome.PingRequest) (*espgohome.PingResponse, error) {
+	d, c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- c.Ping()
+	}()
+
+	timer := time.NewTimer(manager.DefaultPingTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		return &espgohome.PingResponse{}, nil
+	case <-timer.C:
+		return nil, status.Errorf(codes.DeadlineExceeded, "%s didn't answer the ping", d.Name())
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// DeviceInfo returns the information the device sent when it last connected
+func (s *Server) DeviceInfo(ctx context.Context, req *espgohome.DeviceInfoRequest) (*espgohome.DeviceInfoResponse, error) {
+	d, err := s.device(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := d.Info()
+	if info == nil {
+		return nil, status.Errorf(codes.Unavailable, "%s has not connected", d.Name())
+	}
+	return info, nil
+}
+
+// ListEntities streams the entities and user defined services of the device
+func (s *Server) ListEntities(req *espgohome.ListEntitiesRequest, stream APIConnection_ListEntitiesServer) error {
+	d, err := s.device(stream.Context())
+	if err != nil {
+		return err
+	}
+	entities := d.Entities()
+	if entities == nil {
+		return status.Errorf(codes.Unavailable, "%s has not connected", d.Name())
+	}
+
+	for _, e := range entities.Store().Entities() {
+		resp := &ListEntitiesResponse{}
+		if m, ok := e.(proto.Message); ok && wrap(resp, m) {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+	for _, svc := range entities.Services() {
+		m := &espgohome.ListEntitiesServicesResponse{Name: svc.Name, Key: svc.Key}
+		for _, a := range svc.Args {
+			m.Args = append(m.Args, &espgohome.ListEntitiesServicesArgument{Name: a.Name, Type: a.Type})
+		}
+		if err := stream.Send(&ListEntitiesResponse{Entity: &ListEntitiesResponse_Services{Services: m}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubscribeStates streams the current state of every entity and then each
+// change, across reconnections, until the call is cancelled
+func (s *Server) SubscribeStates(req *espgohome.SubscribeStatesRequest, stream APIConnection_SubscribeStatesServer) error {
+	d, err := s.device(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// the listener is drained at once and the states queued for the stream,
+	// dropping them when the client is too slow, so that the client never
+	// holds up the devices
+	states := make(chan proto.Message, stateBuffer)
+	events := make(chan manager.Event, 64)
+	stop := make(chan struct{})
+	s.Manager.AddListener(events)
+	defer func() {
+		s.Manager.RemoveListener(events)
+		close(stop)
+	}()
+	go func() {
+		for {
+			select {
+			case e := <-events:
+				if e.Type != manager.StateChanged || e.Device != d.Name() {
+					continue
+				}
+				select {
+				case states <- e.State.State:
+				default:
+					s.log(espgohome.LevelWarn, "grpcapi: dropped a state for a slow client", "device", d.Name())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	if entities := d.Entities(); entities != nil {
+		for _, st := range entities.Store().All() {
+			if err := sendState(stream, st.State); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		select {
+		case st := <-states:
+			if err := sendState(stream, st); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// SubscribeLogs streams the log messages of the device until the call is
+// cancelled or the connection is lost
+func (s *Server) SubscribeLogs(req *espgohome.SubscribeLogsRequest, stream APIConnection_SubscribeLogsServer) error {
+	d, c, err := s.conn(stream.Context())
+	if err != nil {
+		return err
+	}
+	messages, err := c.SubscribeLogsWith(req)
+	defer c.RemoveReceiver(messages)
+	if err != nil {
+		return unavailable(err)
+	}
+
+	for {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				return status.Errorf(codes.Unavailable, "lost the connection to %s", d.Name())
+			}
+			if err := stream.Send(m.(*espgohome.SubscribeLogsResponse)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// CameraImage streams the image chunks of the cameras of the device, until
+// the first image is complete for a single request or until the call is
+// cancelled for a stream
+func (s *Server) CameraImage(req *espgohome.CameraImageRequest, stream APIConnection_CameraImageServer) error {
+	if !req.Single && !req.Stream {
+		return status.Error(codes.InvalidArgument, "neither single nor stream is set")
+	}
+	d, c, err := s.conn(stream.Context())
+	if err != nil {
+		return err
+	}
+	chunks, err := c.CameraImageWith(req)
+	defer c.RemoveReceiver(chunks)
+	if err != nil {
+		return unavailable(err)
+	}
+
+	for {
+		select {
+		case m, ok := <-chunks:
+			if !ok {
+				return status.Errorf(codes.Unavailable, "lost the connection to %s", d.Name())
+			}
+			chunk := m.(*espgohome.CameraImageResponse)
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+			if chunk.Done && !req.Stream {
+				return nil
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// ExecuteService calls a user defined service
+func (s *Server) ExecuteService(ctx context.Context, req *espgohome.ExecuteServiceRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error {
+		return c.ExecuteService(req.Key, req.Args...)
+	})
+}
+
+// CoverCommand sends a cover command
+func (s *Server) CoverCommand(ctx context.Context, req *espgohome.CoverCommandRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error { return c.CoverCommand(req) })
+}
+
+// FanCommand sends a fan command
+func (s *Server) FanCommand(ctx context.Context, req *espgohome.FanCommandRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error { return c.FanCommand(req) })
+}
+
+// LightCommand sends a light command
+func (s *Server) LightCommand(ctx context.Context, req *espgohome.LightCommandRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error { return c.LightCommand(req) })
+}
+
+// SwitchCommand sends a switch command
+func (s *Server) SwitchCommand(ctx context.Context, req *espgohome.SwitchCommandRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error { return c.SwitchCommand(req.Key, req.State) })
+}
+
+// ClimateCommand sends a climate command
+func (s *Server) ClimateCommand(ctx context.Context, req *espgohome.ClimateCommandRequest) (*espgohome.Void, error) {
+	return s.command(ctx, req, func(c *espgohome.ESPHomeConnection) error { return c.ClimateCommand(req) })
+}
+
+// command sends req with fn to the device of ctx
+func (s *Server) command(ctx context.Context, req proto.Message, fn func(c *espgohome.ESPHomeConnection) error) (*espgohome.Void, error) {
+	d, c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(c); err != nil {
+		return nil, unavailable(err)
+	}
+	s.log(espgohome.LevelDebug, "grpcapi: command", "device", d.Name(), "request", req)
+	return &espgohome.Void{}, nil
+}
+
+// device returns the device selected by the metadata of ctx
+func (s *Server) device(ctx context.Context) (*manager.Device, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(DeviceKey)
+	if len(ids) == 0 {
+		devices := s.Manager.Devices()
+		if len(devices) != 1 {
+			return nil, status.Errorf(codes.InvalidArgument, "%d devices, select one with the %q metadata key", len(devices), DeviceKey)
+		}
+		return devices[0], nil
+	}
+
+	d, err := s.Manager.Device(ids[0])
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "%v %q", err, ids[0])
+	}
+	return d, nil
+}
+
+// conn returns the device selected by the metadata of ctx and its connection
+func (s *Server) conn(ctx context.Context) (*manager.Device, *espgohome.ESPHomeConnection, error) {
+	d, err := s.device(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := d.Conn()
+	if c == nil {
+		return nil, nil, status.Errorf(codes.Unavailable, "%s is not connected", d.Name())
+	}
+	return d, c, nil
+}
+
+func (s *Server) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(s.Logger, s.Debug).Log(level, msg, keyvals...)
+}
+
+func unavailable(err error) error {
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+func sendState(stream APIConnection_SubscribeStatesServer, m proto.Message) error {
+	resp := &StateResponse{}
+	if m == nil || !wrap(resp, m) {
+		return nil
+	}
+	return stream.Send(resp)
+}
+
+// wrap sets the field of the oneof in w with the type of m, it returns false
+// if there is no such field
+func wrap(w, m proto.Message) bool {
+	r := w.ProtoReflect()
+	fields := r.Descriptor().Fields()
+	name := m.ProtoReflect().Descriptor().FullName()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Message() != nil && fd.Message().FullName() == name {
+			r.Set(fd, protoreflect.ValueOfMessage(m.ProtoReflect()))
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the message in the oneof of a ListEntitiesResponse or a
+// StateResponse, or nil if it is empty
+func Unwrap(w proto.Message) proto.Message {
+	r := w.ProtoReflect()
+	oneofs := r.Descriptor().Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if fd := r.WhichOneof(oneofs.Get(i)); fd != nil && fd.Message() != nil {
+			return r.Get(fd).Message().Interface()
+		}
+	}
+	return nil
+}
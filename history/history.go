@@ -0,0 +1,433 @@
+// Package history stores the state changes of entities and answers queries
+// over them.
+//
+// A Store is a directory with a sub directory per device, named after the
+// device, holding one append-only file per UTC day. A file starts with a 20
+// byte header, the magic "ESPGOHST", the format version as a big endian
+// uint32, currently 1, and the resolution the file was downsampled to as a
+// big endian int64 of nanoseconds, 0 for the raw states. The header is
+// followed by one record per state:
+//
+//	time      int64, big endian, nanoseconds since the Unix epoch
+//	id size   uvarint, the length of object_id
+//	object_id the object_id of the entity
+//	flags     uint8, 1 if the device reported a missing state
+//	type      uvarint, the MessageID of the state
+//	size      uvarint, the length of payload
+//	payload   the encoded *StateResponse message
+//
+// A record cut short at the end of a file, as left by a crash, is ignored.
+//
+// A Recorder appends the state changes of the devices of a manager.Manager
+// to a Store and applies a Policy to it: files older than the retention are
+// removed, and the numeric sensor states of older files are downsampled to
+// their average over a fixed interval.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// Magic starts every history file
+const Magic = "ESPGOHST"
+
+// Version is the version of the format written by Store
+const Version = 1
+
+// headerSize is the size of the file header
+const headerSize = 20
+
+// fileSuffix ends the name of every history file
+const fileSuffix = ".hist"
+
+// dayLayout formats the UTC day of a file in its name
+const dayLayout = "2006-01-02"
+
+// maxPayload guards against reading garbage as a huge record
+const maxPayload = 1 << 16
+
+// flagMissing marks a record of a missing state
+const flagMissing = 1
+
+var (
+	// ErrorBadMagic is returned for files that aren't history files
+	ErrorBadMagic = errors.New("history: not a history file")
+	// ErrorStoreClosed is returned by Append after Close has been called
+	ErrorStoreClosed = errors.New("history: store closed")
+)
+
+// Point is a state of an entity at a point in time
+type Point struct {
+	Time     time.Time
+	ObjectID string
+	// State is one of the *StateResponse messages
+	State proto.Message
+	// Missing is true when the device reported that it has no valid state
+	Missing bool
+}
+
+// Store is a directory of history files
+type Store struct {
+	dir string
+
+	mu     sync.Mutex
+	files  map[string]*os.File
+	closed bool
+}
+
+// Open opens the Store in dir, creating the directory if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+// Dir returns the directory of the Store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Append adds a point to the history of device
+func (s *Store) Append(device string, p Point) error {
+	record, err := encodeRecord(p)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrorStoreClosed
+	}
+	path := s.path(device, p.Time)
+	f := s.files[path]
+	if f == nil {
+		if f, err = openAppend(path); err != nil {
+			return err
+		}
+		s.files[path] = f
+		// only the file of the current day is kept open per device
+		for other, of := range s.files {
+			if other != path && filepath.Dir(other) == filepath.Dir(path) {
+				of.Close()
+				delete(s.files, other)
+			}
+		}
+	}
+	_, err = f.Write(record)
+	return err
+}
+
+// Devices returns the names of the devices with a history
+func (s *Store) Devices() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			continue
+		}
+		if name, err := url.PathUnescape(fi.Name()); err == nil {
+			devices = append(devices, name)
+		}
+	}
+	return devices, nil
+}
+
+// Close closes the open files, the Store can still be queried
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var first error
+	for path, f := range s.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.files, path)
+	}
+	return first
+}
+
+// path returns the file holding the points of device at t
+func (s *Store) path(device string, t time.Time) string {
+	return filepath.Join(s.deviceDir(device), t.UTC().Format(dayLayout)+fileSuffix)
+}
+
+func (s *Store) deviceDir(device string) string {
+	return filepath.Join(s.dir, url.PathEscape(device))
+}
+
+// days returns the files of device with the UTC day they hold, oldest first
+func (s *Store) days(device string) ([]string, []time.Time, error) {
+	infos, err := ioutil.ReadDir(s.deviceDir(device))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var paths []string
+	var days []time.Time
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		day, err := time.Parse(dayLayout, strings.TrimSuffix(name, fileSuffix))
+		if err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.deviceDir(device), name))
+		days = append(days, day)
+	}
+	// ReadDir sorts by name, which is the order of the days
+	return paths, days, nil
+}
+
+// openAppend opens a history file for appending, writing the header of a
+// new file. A record cut short by a crash is truncated away, so that the
+// next records don't follow its torn bytes.
+func openAppend(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.Size() > 0 {
+		var end int64
+		if _, end, err = scan(f, nil); err == nil && end < fi.Size() {
+			err = f.Truncate(end)
+		}
+		if err == nil && end == 0 {
+			_, err = f.Write(header(0))
+		}
+	} else if err == nil {
+		_, err = f.Write(header(0))
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+func header(resolution time.Duration) []byte {
+	h := make([]byte, headerSize)
+	copy(h, Magic)
+	binary.BigEndian.PutUint32(h[8:], Version)
+	binary.BigEndian.PutUint64(h[12:], uint64(resolution))
+	return h
+}
+
+func encodeRecord(p Point) ([]byte, error) {
+	msgType := espgohome.GetMessageID(p.State)
+	if msgType == 0 {
+		return nil, fmt.Errorf("history: unknown state type %T", p.State)
+	}
+	payload, err := proto.Marshal(p.State)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(p.Time.UnixNano()))
+	buf.Write(b[:8])
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(p.ObjectID)))])
+	buf.WriteString(p.ObjectID)
+	var flags byte
+	if p.Missing {
+		flags |= flagMissing
+	}
+	buf.WriteByte(flags)
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(msgType))])
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(payload)))])
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+// readFile returns the points of a history file in the order they were
+// appended and the resolution it was downsampled to
+func readFile(path string) ([]Point, time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var points []Point
+	resolution, _, err := scan(f, func(p Point) { points = append(points, p) })
+	if err != nil {
+		return points, resolution, fmt.Errorf("%s: %v", path, err)
+	}
+	return points, resolution, nil
+}
+
+// scan reads a history file from the start, calling fn with every complete
+// record, and returns the resolution in the header and the offset of the end
+// of the last complete record. A torn header or record ends the file, the
+// offset is 0 when the header is incomplete.
+func scan(f *os.File, fn func(Point)) (resolution time.Duration, end int64, err error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	cr := &countingReader{r: f}
+	r := bufio.NewReader(cr)
+
+	h := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	if string(h[:8]) != Magic {
+		return 0, 0, ErrorBadMagic
+	}
+	if v := binary.BigEndian.Uint32(h[8:]); v != Version {
+		return 0, 0, fmt.Errorf("unsupported version %d", v)
+	}
+	resolution = time.Duration(binary.BigEndian.Uint64(h[12:]))
+	end = headerSize
+
+	for {
+		p, err := readRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return resolution, end, nil
+		}
+		if err != nil {
+			return resolution, end, err
+		}
+		end = cr.n - int64(r.Buffered())
+		if fn != nil {
+			fn(p)
+		}
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func readRecord(r *bufio.Reader) (Point, error) {
+	var t [8]byte
+	if _, err := io.ReadFull(r, t[:]); err != nil {
+		return Point{}, err
+	}
+	idSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Point{}, unexpected(err)
+	}
+	if idSize > maxPayload {
+		return Point{}, fmt.Errorf("object_id of %d bytes", idSize)
+	}
+	id := make([]byte, idSize)
+	if _, err := io.ReadFull(r, id); err != nil {
+		return Point{}, unexpected(err)
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return Point{}, unexpected(err)
+	}
+	msgType, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Point{}, unexpected(err)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Point{}, unexpected(err)
+	}
+	if size > maxPayload {
+		return Point{}, fmt.Errorf("state of %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Point{}, unexpected(err)
+	}
+	state, err := espgohome.DecodeMessage(espgohome.MessageID(msgType), payload)
+	if err != nil {
+		return Point{}, err
+	}
+
+	return Point{
+		Time:     time.Unix(0, int64(binary.BigEndian.Uint64(t[:]))),
+		ObjectID: string(id),
+		State:    state,
+		Missing:  flags&flagMissing != 0,
+	}, nil
+}
+
+// unexpected turns an EOF in the middle of a record into ErrUnexpectedEOF
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeFile replaces the file at path with points, through a temporary file
+// so that a crash leaves either version
+func writeFile(path string, points []Point, resolution time.Duration) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	w.Write(header(resolution))
+	for _, p := range points {
+		record, err := encodeRecord(p)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(record)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sortPoints sorts points by time, keeping the order of equal times
+func sortPoints(points []Point) {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+}
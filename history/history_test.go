@@ -0,0 +1,243 @@
+package history
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+func tempStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func sensor(t time.Time, value float32) Point {
+	return Point{Time: t, ObjectID: "temperature", State: &espgohome.SensorStateResponse{Key: 1, State: value}}
+}
+
+// day is a UTC midnight far enough in the past for the policies
+var day = time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestQuery(t *testing.T) {
+	s := tempStore(t)
+
+	// two days of a sensor every hour and a switch flipped every six hours
+	for h := 0; h < 48; h++ {
+		at := day.Add(time.Duration(h) * time.Hour)
+		if err := s.Append("kitchen", sensor(at, float32(h))); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+		if h%6 == 0 {
+			s.Append("kitchen", Point{Time: at, ObjectID: "relay", State: &espgohome.SwitchStateResponse{Key: 2, State: h%12 == 0}})
+		}
+	}
+	s.Append("garage", Point{Time: day, ObjectID: "door", Missing: true, State: &espgohome.BinarySensorStateResponse{Key: 3, MissingState: true}})
+
+	if devices, err := s.Devices(); err != nil || len(devices) != 2 {
+		t.Errorf("unexpected devices %v %v", devices, err)
+	}
+
+	points, err := s.Query("kitchen", "temperature", day.Add(20*time.Hour), day.Add(30*time.Hour))
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(points) != 10 || !points[0].Time.Equal(day.Add(20*time.Hour)) || points[9].State.(*espgohome.SensorStateResponse).State != 29 {
+		t.Errorf("unexpected points %v", points)
+	}
+	if all, _ := s.Query("kitchen", "", day, time.Time{}); len(all) != 56 {
+		t.Errorf("got %d points of every entity, want 56", len(all))
+	}
+
+	last, err := s.Last("kitchen", "relay", 3)
+	if err != nil || len(last) != 3 || !last[2].Time.Equal(day.Add(42*time.Hour)) {
+		t.Errorf("unexpected last points %v %v", last, err)
+	}
+	if v, ok := last[2].Value(); !ok || v != 0 {
+		t.Errorf("got value %v %v for an off switch, want 0", v, ok)
+	}
+
+	st, err := s.Stats("kitchen", "temperature", day, day.Add(24*time.Hour))
+	if err != nil || st.Count != 24 || st.Min != 0 || st.Max != 23 || st.Avg != 11.5 {
+		t.Errorf("unexpected stats %+v %v", st, err)
+	}
+	if st := Summarize([]Point{{Missing: true, State: &espgohome.SensorStateResponse{}}}); st.Count != 0 {
+		t.Errorf("a missing state was counted %+v", st)
+	}
+}
+
+func TestNaN(t *testing.T) {
+	nan := float32(math.NaN())
+	points := []Point{sensor(day, 1), sensor(day.Add(time.Minute), nan), sensor(day.Add(2*time.Minute), 3)}
+
+	if st := Summarize(points); st.Count != 2 || st.Min != 1 || st.Max != 3 || st.Avg != 2 || !st.Last.Equal(day.Add(2*time.Minute)) {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// the unavailable state is kept next to the average of the others
+	out := Downsample(points, time.Hour)
+	if len(out) != 2 {
+		t.Fatalf("got %d points, want 2: %v", len(out), out)
+	}
+	if v, ok := out[0].Value(); !ok || v != 2 {
+		t.Errorf("unexpected average %v", out[0])
+	}
+	if _, ok := out[1].Value(); ok || !out[1].Time.Equal(day.Add(time.Minute)) {
+		t.Errorf("unexpected unavailable state %v", out[1])
+	}
+}
+
+func TestDownsampleSharedObjectID(t *testing.T) {
+	other := sensor(day.Add(time.Minute), 10)
+	other.State.(*espgohome.SensorStateResponse).Key = 4
+	points := []Point{sensor(day, 1), other, sensor(day.Add(2*time.Minute), 3)}
+
+	out := Downsample(points, time.Hour)
+	if len(out) != 2 {
+		t.Fatalf("got %d points, want 2: %v", len(out), out)
+	}
+	for _, p := range out {
+		st := p.State.(*espgohome.SensorStateResponse)
+		if want := map[uint32]float32{1: 2, 4: 10}[st.Key]; st.State != want {
+			t.Errorf("unexpected average %v", st)
+		}
+	}
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	s := tempStore(t)
+	s.Append("kitchen", sensor(day, 1))
+	s.Append("kitchen", sensor(day.Add(time.Minute), 2))
+	s.Close()
+
+	path := s.path("kitchen", day)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Truncate(path, fi.Size()-2)
+
+	points, err := s.Query("kitchen", "temperature", day, time.Time{})
+	if err != nil || len(points) != 1 {
+		t.Errorf("unexpected points %v %v", points, err)
+	}
+
+	// after a restart the torn record is dropped before appending
+	s, err = Open(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Append("kitchen", sensor(day.Add(2*time.Minute), 3)); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	points, err = s.Query("kitchen", "temperature", day, time.Time{})
+	if err != nil || len(points) != 2 || !points[0].Time.Equal(day) || !points[1].Time.Equal(day.Add(2*time.Minute)) {
+		t.Errorf("unexpected points %v %v", points, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	s := tempStore(t)
+
+	for d := 0; d < 3; d++ {
+		for m := 0; m < 60; m += 10 {
+			s.Append("kitchen", sensor(day.Add(time.Duration(d)*24*time.Hour+time.Duration(m)*time.Minute), float32(m)))
+		}
+		s.Append("kitchen", Point{Time: day.Add(time.Duration(d) * 24 * time.Hour), ObjectID: "relay", State: &espgohome.SwitchStateResponse{Key: 2, State: true}})
+	}
+
+	// at the end of the third day, the first is removed and the second
+	// downsampled
+	now := day.Add(72 * time.Hour)
+	p := Policy{Retention: 48 * time.Hour, DownsampleAfter: 24 * time.Hour, Resolution: 30 * time.Minute}
+	if err := s.Apply(p, now); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if _, err := os.Stat(s.path("kitchen", day)); !os.IsNotExist(err) {
+		t.Errorf("the first day wasn't removed: %v", err)
+	}
+
+	points, err := s.Query("kitchen", "temperature", day, time.Time{})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	// the second day holds the averages of 0, 10, 20 and of 30, 40, 50, the
+	// third its six raw states
+	if len(points) != 8 {
+		t.Fatalf("got %d points, want 8: %v", len(points), points)
+	}
+	if v, _ := points[0].Value(); v != 10 || !points[0].Time.Equal(day.Add(24*time.Hour)) {
+		t.Errorf("unexpected first average %v", points[0])
+	}
+	if v, _ := points[1].Value(); v != 40 || !points[1].Time.Equal(day.Add(24*time.Hour+30*time.Minute)) {
+		t.Errorf("unexpected second average %v", points[1])
+	}
+	if relay, _ := s.Query("kitchen", "relay", day, time.Time{}); len(relay) != 2 {
+		t.Errorf("the switch states weren't kept: %v", relay)
+	}
+
+	// applying again leaves the downsampled day as is
+	before, _ := ioutil.ReadFile(s.path("kitchen", day.Add(24*time.Hour)))
+	s.Apply(p, now)
+	if after, _ := ioutil.ReadFile(s.path("kitchen", day.Add(24*time.Hour))); string(after) != string(before) {
+		t.Error("the downsampled day was rewritten")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(s.Dir(), "kitchen", ".tmp-*")); len(matches) != 0 {
+		t.Errorf("temporary files left %v", matches)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dev := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01"}}
+	dev.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"})
+	dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.5})
+
+	s := tempStore(t)
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	r := &Recorder{Manager: m, Store: s}
+	if err := r.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer r.Close()
+	espgohometest.Connect(t, m, dev)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sent := false; ; {
+		points, err := s.Last("kitchen", "temperature", 2)
+		if err != nil {
+			t.Fatalf("last failed: %v", err)
+		}
+		if len(points) == 1 && !sent {
+			dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: 22})
+			sent = true
+		}
+		if len(points) == 2 {
+			if v, _ := points[1].Value(); v != 22 {
+				t.Errorf("unexpected points %v", points)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("states not recorded: %v", points)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"math"
+	"os"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// Policy limits the size of a Store
+type Policy struct {
+	// Retention removes the days older than this, 0 keeps everything
+	Retention time.Duration
+	// DownsampleAfter downsamples the numeric sensor states of the days
+	// older than this to Resolution, 0 keeps the raw states
+	DownsampleAfter time.Duration
+	// Resolution is the interval the sensor states are averaged over
+	Resolution time.Duration
+}
+
+// Apply removes and downsamples the days that the policy covers at now. A
+// day is covered once all of it is older than the Retention or the
+// DownsampleAfter.
+func (s *Store) Apply(p Policy, now time.Time) error {
+	devices, err := s.Devices()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, device := range devices {
+		paths, days, err := s.days(device)
+		if err != nil {
+			return err
+		}
+		for i, path := range paths {
+			end := days[i].Add(24 * time.Hour)
+			switch {
+			case p.Retention > 0 && !end.After(now.Add(-p.Retention)):
+				s.closeFile(path)
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			case p.DownsampleAfter > 0 && p.Resolution > 0 && !end.After(now.Add(-p.DownsampleAfter)):
+				if err := s.downsampleFile(path, p.Resolution); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// downsampleFile replaces the sensor states of a file with their average
+// over each interval of resolution, unless it has already been downsampled
+// as much
+func (s *Store) downsampleFile(path string, resolution time.Duration) error {
+	points, current, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if current >= resolution {
+		return nil
+	}
+	s.closeFile(path)
+	return writeFile(path, Downsample(points, resolution), resolution)
+}
+
+// closeFile closes the file at path if it is open for appending
+func (s *Store) closeFile(path string) {
+	if f := s.files[path]; f != nil {
+		f.Close()
+		delete(s.files, path)
+	}
+}
+
+// Downsample replaces the sensor states in points with one state per entity
+// and interval of resolution, holding their average at the start of the
+// interval. Missing and unavailable (NaN) sensor states and the other states
+// are kept as they are.
+func Downsample(points []Point, resolution time.Duration) []Point {
+	// the key tells apart the entities of different types sharing an
+	// object id
+	type bucket struct {
+		objectID string
+		key      uint32
+		start    int64
+	}
+	type sum struct {
+		index int
+		total float64
+		count int
+	}
+	sums := make(map[bucket]*sum)
+	var out []Point
+	for _, p := range points {
+		st, ok := p.State.(*espgohome.SensorStateResponse)
+		if !ok || p.Missing || math.IsNaN(float64(st.State)) {
+			out = append(out, p)
+			continue
+		}
+		start := p.Time.Truncate(resolution)
+		b := bucket{p.ObjectID, st.Key, start.UnixNano()}
+		if sums[b] == nil {
+			sums[b] = &sum{index: len(out)}
+			out = append(out, Point{Time: start, ObjectID: p.ObjectID})
+		}
+		sums[b].total += value.Float32(st.State)
+		sums[b].count++
+	}
+	for b, sm := range sums {
+		out[sm.index].State = &espgohome.SensorStateResponse{Key: b.key, State: float32(sm.total / float64(sm.count))}
+	}
+	sortPoints(out)
+	return out
+}
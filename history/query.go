@@ -0,0 +1,142 @@
+package history
+
+import (
+	"math"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// Stats summarizes the numeric values of a range of points
+type Stats struct {
+	// Count is the number of points with a numeric value
+	Count int
+	Min   float64
+	Max   float64
+	Avg   float64
+	// First and Last are the times of the first and last points counted
+	First time.Time
+	Last  time.Time
+}
+
+// Query returns the points of device between from, included, and to,
+// excluded, oldest first. An empty objectID returns the points of every
+// entity and a zero to reads to the end of the history.
+func (s *Store) Query(device, objectID string, from, to time.Time) ([]Point, error) {
+	paths, days, err := s.days(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for i, path := range paths {
+		if days[i].Add(24*time.Hour).Before(from) || (!to.IsZero() && !days[i].Before(to)) {
+			continue
+		}
+		filePoints, _, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range filePoints {
+			if (objectID == "" || p.ObjectID == objectID) && !p.Time.Before(from) && (to.IsZero() || p.Time.Before(to)) {
+				points = append(points, p)
+			}
+		}
+	}
+	sortPoints(points)
+	return points, nil
+}
+
+// Last returns the last n points of device, oldest first. An empty objectID
+// returns the points of every entity.
+func (s *Store) Last(device, objectID string, n int) ([]Point, error) {
+	paths, _, err := s.days(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for i := len(paths) - 1; i >= 0 && len(points) < n; i-- {
+		filePoints, _, err := readFile(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		var matching []Point
+		for _, p := range filePoints {
+			if objectID == "" || p.ObjectID == objectID {
+				matching = append(matching, p)
+			}
+		}
+		points = append(matching, points...)
+	}
+	sortPoints(points)
+	if len(points) > n {
+		points = points[len(points)-n:]
+	}
+	return points, nil
+}
+
+// Stats returns the minimum, maximum and average of the numeric values of
+// an entity between from and to, as in Query
+func (s *Store) Stats(device, objectID string, from, to time.Time) (Stats, error) {
+	points, err := s.Query(device, objectID, from, to)
+	if err != nil {
+		return Stats{}, err
+	}
+	return Summarize(points), nil
+}
+
+// Summarize returns the statistics of the numeric values of points, which
+// are in time order
+func Summarize(points []Point) Stats {
+	st := Stats{Min: math.Inf(1), Max: math.Inf(-1)}
+	sum := 0.0
+	for _, p := range points {
+		v, ok := p.Value()
+		if !ok {
+			continue
+		}
+		if st.Count == 0 {
+			st.First = p.Time
+		}
+		st.Count++
+		st.Last = p.Time
+		sum += v
+		st.Min = math.Min(st.Min, v)
+		st.Max = math.Max(st.Max, v)
+	}
+	if st.Count == 0 {
+		return Stats{}
+	}
+	st.Avg = sum / float64(st.Count)
+	return st
+}
+
+// Value returns the numeric value of the state: the value of a sensor, 1 or
+// 0 for the on and off states of binary sensors, switches, lights and fans,
+// the position of a cover and the current temperature of a climate device.
+// It returns false for missing states, text sensors and the NaN values of
+// unavailable sensors.
+func (p Point) Value() (float64, bool) {
+	if p.Missing {
+		return 0, false
+	}
+	switch st := p.State.(type) {
+	case *espgohome.SensorStateResponse:
+		return value.Float32(st.State), !math.IsNaN(float64(st.State))
+	case *espgohome.BinarySensorStateResponse:
+		return value.Bool(st.State), true
+	case *espgohome.SwitchStateResponse:
+		return value.Bool(st.State), true
+	case *espgohome.LightStateResponse:
+		return value.Bool(st.State), true
+	case *espgohome.FanStateResponse:
+		return value.Bool(st.State), true
+	case *espgohome.CoverStateResponse:
+		return value.Float32(st.Position), true
+	case *espgohome.ClimateStateResponse:
+		return value.Float32(st.CurrentTemperature), !math.IsNaN(float64(st.CurrentTemperature))
+	}
+	return 0, false
+}
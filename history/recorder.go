@@ -0,0 +1,118 @@
+package history
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// DefaultApplyInterval is the default of Recorder.ApplyInterval
+const DefaultApplyInterval = time.Hour
+
+// ErrorRecorderClosed is returned by Start after Close has been called
+var ErrorRecorderClosed = errors.New("history: recorder closed")
+
+// Recorder appends the state changes of the devices of a Manager to a Store
+type Recorder struct {
+	Manager *manager.Manager
+	Store   *Store
+	// Policy is applied to the Store when the Recorder starts and then every
+	// ApplyInterval
+	Policy Policy
+	// ApplyInterval defaults to DefaultApplyInterval
+	ApplyInterval time.Duration
+	// Logger receives the diagnostic messages of the recorder
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu     sync.Mutex
+	events chan manager.Event
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// Start listens to the events of the Manager
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrorRecorderClosed
+	}
+	if r.events != nil {
+		r.mu.Unlock()
+		return nil
+	}
+	r.events = make(chan manager.Event, 64)
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	r.mu.Unlock()
+
+	r.Manager.AddListener(r.events)
+	go r.run()
+
+	return nil
+}
+
+// Close stops recording, the Store is left open
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	started := r.events != nil
+	r.mu.Unlock()
+
+	if started {
+		r.Manager.RemoveListener(r.events)
+		close(r.stop)
+		<-r.done
+	}
+
+	return nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	interval := r.ApplyInterval
+	if interval == 0 {
+		interval = DefaultApplyInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	r.apply()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.apply()
+		case e := <-r.events:
+			if e.Type != manager.StateChanged || e.State.State == nil {
+				continue
+			}
+			p := Point{Time: e.Time, ObjectID: e.State.Entity.GetObjectId(), State: e.State.State, Missing: e.State.Missing}
+			if err := r.Store.Append(e.Device, p); err != nil {
+				r.log(espgohome.LevelWarn, "history: append failed", "device", e.Device, "object_id", p.ObjectID, "error", err)
+			}
+		}
+	}
+}
+
+func (r *Recorder) apply() {
+	if err := r.Store.Apply(r.Policy, time.Now()); err != nil {
+		r.log(espgohome.LevelWarn, "history: policy not applied", "error", err)
+	}
+}
+
+func (r *Recorder) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(r.Logger, r.Debug).Log(level, msg, keyvals...)
+}
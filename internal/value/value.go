@@ -0,0 +1,96 @@
+// Package value converts between the values of the native API and the
+// strings and numbers used by the commands, bridges and rules.
+package value
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Enum prefixes, the second swing prefix is a typo in api.proto
+var (
+	LogLevelPrefixes       = []string{"LOG_LEVEL_"}
+	ServiceArgTypePrefixes = []string{"SERVICE_ARG_TYPE_"}
+	CoverOperationPrefixes = []string{"COVER_OPERATION_"}
+	FanSpeedPrefixes       = []string{"FAN_SPEED_"}
+	FanDirectionPrefixes   = []string{"FAN_DIRECTION_"}
+	ClimateModePrefixes    = []string{"CLIMATE_MODE_"}
+	ClimateFanPrefixes     = []string{"CLIMATE_FAN_"}
+	ClimateSwingPrefixes   = []string{"CLIMATE_SWING_", "CLIMATE_SWINT_"}
+	ClimateActionPrefixes  = []string{"CLIMATE_ACTION_"}
+)
+
+// EnumString returns the lower case name of an enum value without its
+// prefix, for example "fan_only" for CLIMATE_MODE_FAN_ONLY
+func EnumString(names map[int32]string, prefixes []string, v int32) string {
+	name, ok := names[v]
+	if !ok {
+		return strconv.Itoa(int(v))
+	}
+	for _, p := range prefixes {
+		name = strings.TrimPrefix(name, p)
+	}
+	return strings.ToLower(name)
+}
+
+// ParseEnum is the inverse of EnumString, it also accepts the full name of
+// the value in any case
+func ParseEnum(names map[int32]string, prefixes []string, s string) (int32, bool) {
+	for v, name := range names {
+		if EnumString(names, prefixes, v) == strings.ToLower(s) || strings.EqualFold(name, s) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// OnOff returns "on" or "off"
+func OnOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// ParseOnOff accepts on/off as well as anything strconv.ParseBool does
+func ParseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("expected on or off, got %q", s)
+	}
+	return b, nil
+}
+
+// ParseFloat parses the float32 values of the API
+func ParseFloat(s string) (float32, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return float32(f), nil
+}
+
+// Float32 converts the float32 values of the API without adding digits, so
+// that 21.3 is returned as 21.3 rather than 21.299999237060547
+func Float32(v float32) float64 {
+	f, err := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	if err != nil {
+		return float64(v)
+	}
+	return f
+}
+
+// Bool returns 1 for true and 0 for false
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
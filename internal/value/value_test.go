@@ -0,0 +1,61 @@
+package value
+
+import (
+	"testing"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+func TestEnum(t *testing.T) {
+	names := espgohome.ClimateSwingMode_name
+	for _, tc := range []struct {
+		s    string
+		want espgohome.ClimateSwingMode
+	}{
+		{"off", espgohome.ClimateSwingMode_CLIMATE_SWING_OFF},
+		{"Vertical", espgohome.ClimateSwingMode_CLIMATE_SWING_VERTICAL},
+		{"horizontal", espgohome.ClimateSwingMode_CLIMATE_SWINT_HORIZONTAL},
+		{"CLIMATE_SWING_BOTH", espgohome.ClimateSwingMode_CLIMATE_SWING_BOTH},
+	} {
+		v, ok := ParseEnum(names, ClimateSwingPrefixes, tc.s)
+		if !ok || espgohome.ClimateSwingMode(v) != tc.want {
+			t.Errorf("ParseEnum(%q) = %d, %t, expected %s", tc.s, v, ok, tc.want)
+		}
+	}
+
+	if s := EnumString(names, ClimateSwingPrefixes, int32(espgohome.ClimateSwingMode_CLIMATE_SWINT_HORIZONTAL)); s != "horizontal" {
+		t.Errorf("unexpected name %q", s)
+	}
+	if s := EnumString(names, ClimateSwingPrefixes, 42); s != "42" {
+		t.Errorf("unexpected name %q for an unknown value", s)
+	}
+	if _, ok := ParseEnum(names, ClimateSwingPrefixes, "diagonal"); ok {
+		t.Error("parsed an unknown value")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]bool{"on": true, "OFF": false, "true": true, "0": false} {
+		if b, err := ParseOnOff(s); err != nil || b != want {
+			t.Errorf("ParseOnOff(%q) = %t, %v", s, b, err)
+		}
+	}
+	if _, err := ParseOnOff("maybe"); err == nil {
+		t.Error("parsed maybe")
+	}
+	if f, err := ParseFloat("21.5"); err != nil || f != 21.5 {
+		t.Errorf("ParseFloat = %g, %v", f, err)
+	}
+	if _, err := ParseFloat("warm"); err == nil {
+		t.Error("parsed warm")
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	if f := Float32(21.3); f != 21.3 {
+		t.Errorf("Float32(21.3) = %v", f)
+	}
+	if Bool(true) != 1 || Bool(false) != 0 {
+		t.Error("unexpected Bool")
+	}
+}
@@ -0,0 +1,130 @@
+package espgohome
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the severity of a message logged by the library, the values are
+// the same as the ones used by log/slog
+type Level int
+
+// Log levels
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Logger receives the diagnostic messages of the library. keyvals holds
+// alternating keys and values, such as "device", "10.0.0.5:6053", "type",
+// HelloRequestID. Messages about traffic carry the "device", "direction",
+// "type" and "size" fields.
+type Logger interface {
+	// Enabled reports whether messages at level are wanted, so that
+	// expensive fields are only computed when they will be used
+	Enabled(level Level) bool
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// NopLogger discards everything, it is used when no Logger is configured
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(Level) bool                { return false }
+func (nopLogger) Log(Level, string, ...interface{}) {}
+
+// StdLogger returns a Logger that prints messages at level and above with
+// the standard log package as "LEVEL msg key=value ..."
+func StdLogger(level Level) Logger {
+	return stdLogger{level: level}
+}
+
+type stdLogger struct {
+	level Level
+}
+
+func (s stdLogger) Enabled(level Level) bool {
+	return level >= s.level
+}
+
+func (s stdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !s.Enabled(level) {
+		return
+	}
+	log.Print(formatLog(level, msg, keyvals))
+}
+
+// formatLog formats a message as "LEVEL msg key=value ...", quoting values
+// with spaces
+func formatLog(level Level, msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], s)
+	}
+	return b.String()
+}
+
+// WithFields returns a Logger that adds keyvals to every message logged to l
+func WithFields(l Logger, keyvals ...interface{}) Logger {
+	if len(keyvals) == 0 {
+		return l
+	}
+	if f, ok := l.(fieldLogger); ok {
+		return fieldLogger{l: f.l, fields: append(append([]interface{}{}, f.fields...), keyvals...)}
+	}
+	return fieldLogger{l: l, fields: keyvals}
+}
+
+type fieldLogger struct {
+	l      Logger
+	fields []interface{}
+}
+
+func (f fieldLogger) Enabled(level Level) bool {
+	return f.l.Enabled(level)
+}
+
+func (f fieldLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	f.l.Log(level, msg, append(append([]interface{}{}, f.fields...), keyvals...)...)
+}
+
+// ResolveLogger returns l, or for the Debug fields in this module a
+// StdLogger at LevelDebug if l is nil and debug is set, or NopLogger
+func ResolveLogger(l Logger, debug bool) Logger {
+	switch {
+	case l != nil:
+		return l
+	case debug:
+		return StdLogger(LevelDebug)
+	}
+	return NopLogger
+}
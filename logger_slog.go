@@ -0,0 +1,30 @@
+//go:build go1.21
+// +build go1.21
+
+package espgohome
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger returns a Logger that writes to l, or to slog.Default() if l
+// is nil
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Enabled(level Level) bool {
+	return s.l.Enabled(context.Background(), slog.Level(level))
+}
+
+func (s slogLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	s.l.Log(context.Background(), slog.Level(level), msg, keyvals...)
+}
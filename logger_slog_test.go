@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package espgohome
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := SlogLogger(slog.New(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelWarn) {
+		t.Error("levels not passed to the handler")
+	}
+	WithFields(l, "device", "10.0.0.5:6053").Log(LevelWarn, "unable to decode message", "type", PingRequestID, "size", 3)
+
+	want := `level=WARN msg="unable to decode message" device=10.0.0.5:6053 type=PingRequestID size=3`
+	if got := b.String(); !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
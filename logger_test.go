@@ -0,0 +1,98 @@
+package espgohome
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger keeps every message logged at level and above
+type recordingLogger struct {
+	level Level
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *recordingLogger) Enabled(level Level) bool {
+	return level >= r.level
+}
+
+func (r *recordingLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.messages = append(r.messages, formatLog(level, msg, keyvals))
+}
+
+func (r *recordingLogger) find(prefix string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.messages {
+		if strings.HasPrefix(m, prefix) {
+			return m
+		}
+	}
+	return ""
+}
+
+func TestConnectionLogger(t *testing.T) {
+	rec := &recordingLogger{level: LevelDebug}
+	c := ESPHomeConnection{ClientInfo: "test-client", Logger: WithFields(rec, "name", "gadget")}
+	server := c.Pipe()
+	defer c.Close()
+
+	go func() {
+		r := bufio.NewReader(server)
+		if _, _, err := ReadMessage(r); err != nil {
+			return
+		}
+		WriteMessage(server, &HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: "fake-server"})
+	}()
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+
+	want := `DEBUG send name=gadget device=pipe direction=send type=HelloRequestID size=13 message="{\"clientInfo\":\"test-client\"}"`
+	if got := rec.find("DEBUG send"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := rec.find("DEBUG receive"); !strings.Contains(got, "type=HelloResponseID") || !strings.Contains(got, "fake-server") {
+		t.Errorf("unexpected receive message %q", got)
+	}
+
+	// nothing is formatted for a logger that doesn't want debug messages
+	quiet := &recordingLogger{level: LevelInfo}
+	c.Logger = quiet
+	c.logMessage("send", PingRequestID, 0, &PingRequest{})
+	if len(quiet.messages) != 0 {
+		t.Errorf("unexpected messages %q", quiet.messages)
+	}
+}
+
+func TestFormatLog(t *testing.T) {
+	got := formatLog(LevelWarn, "unable to decode", []interface{}{"type", PingRequestID, "error", fmt.Errorf("bad data"), "empty", "", "odd"})
+	want := `WARN unable to decode type=PingRequestID error="bad data" empty="" odd=(missing)`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if s := Level(2).String(); s != "Level(2)" {
+		t.Errorf("unexpected level %q", s)
+	}
+}
+
+func TestResolveLogger(t *testing.T) {
+	if ResolveLogger(nil, false) != NopLogger {
+		t.Error("expected NopLogger")
+	}
+	if l := ResolveLogger(nil, true); !l.Enabled(LevelDebug) {
+		t.Error("expected a debug logger")
+	}
+	rec := &recordingLogger{}
+	if ResolveLogger(rec, true) != Logger(rec) {
+		t.Error("expected the configured logger")
+	}
+}
@@ -0,0 +1,99 @@
+package logs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// TagLevel sets the most verbose level shown for the tags matching Pattern,
+// a pattern as accepted by path.Match such as "sensor" or "wifi*"
+type TagLevel struct {
+	Pattern string
+	Level   espgohome.LogLevel
+}
+
+// Filter selects records by level, with a different level for some tags
+type Filter struct {
+	// Level is the most verbose level shown for tags without a TagLevel
+	Level espgohome.LogLevel
+	// Tags are checked in order and the last match wins
+	Tags []TagLevel
+}
+
+// ParseFilter parses a comma separated list of levels such as
+// "info,sensor=debug,wifi*=none". An entry without "=" sets the default
+// level, which is debug if none is given.
+func ParseFilter(s string) (*Filter, error) {
+	f := &Filter{Level: espgohome.LogLevel_LOG_LEVEL_DEBUG}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.IndexByte(entry, '=')
+		if i < 0 {
+			level, err := ParseLevel(entry)
+			if err != nil {
+				return nil, err
+			}
+			f.Level = level
+			continue
+		}
+
+		pattern := entry[:i]
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return nil, fmt.Errorf("invalid tag pattern %q", pattern)
+		}
+		level, err := ParseLevel(entry[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		f.Tags = append(f.Tags, TagLevel{Pattern: pattern, Level: level})
+	}
+	return f, nil
+}
+
+// TagLevel returns the most verbose level shown for tag
+func (f *Filter) TagLevel(tag string) espgohome.LogLevel {
+	level := f.Level
+	for _, t := range f.Tags {
+		if ok, _ := path.Match(t.Pattern, tag); ok {
+			level = t.Level
+		}
+	}
+	return level
+}
+
+// Match reports whether r should be shown
+func (f *Filter) Match(r Record) bool {
+	if f == nil {
+		return true
+	}
+	level := f.TagLevel(r.Tag)
+	return level != espgohome.LogLevel_LOG_LEVEL_NONE && r.Level <= level
+}
+
+// MaxLevel returns the most verbose level shown for any tag, which is the
+// level to subscribe at
+func (f *Filter) MaxLevel() espgohome.LogLevel {
+	level := f.Level
+	for _, t := range f.Tags {
+		if t.Level > level {
+			level = t.Level
+		}
+	}
+	return level
+}
+
+// String returns the filter in the format read by ParseFilter
+func (f *Filter) String() string {
+	entries := []string{LevelName(f.Level)}
+	for _, t := range f.Tags {
+		entries = append(entries, t.Pattern+"="+LevelName(t.Level))
+	}
+	return strings.Join(entries, ",")
+}
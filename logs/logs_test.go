@@ -0,0 +1,173 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want Record
+	}{
+		{
+			"\x1b[0;36m[D][sensor:092]: 'Temperature': Sending state 21.50000 °C\x1b[0m",
+			Record{Level: espgohome.LogLevel_LOG_LEVEL_DEBUG, Tag: "sensor", Line: 92, Message: "'Temperature': Sending state 21.50000 °C"},
+		},
+		{
+			"\x1b[0;35m[C][wifi:443]:   SSID: 'home'\x1b[0m",
+			Record{Level: espgohome.LogLevel_LOG_LEVEL_INFO, Config: true, Tag: "wifi", Line: 443, Message: "  SSID: 'home'"},
+		},
+		{
+			"[VV][api.service]: frame\nsecond line",
+			Record{Level: espgohome.LogLevel_LOG_LEVEL_VERY_VERBOSE, Tag: "api.service", Message: "frame\nsecond line"},
+		},
+		{
+			"\x1b[1;31mno prefix\x1b[0m\r\n",
+			Record{Message: "no prefix"},
+		},
+	} {
+		if got := ParseLine(tc.line); got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	r := Parse(&espgohome.SubscribeLogsResponse{
+		Level:      espgohome.LogLevel_LOG_LEVEL_WARN,
+		Tag:        "dallas",
+		Message:    "[D][sensor:092]: text",
+		SendFailed: true,
+	})
+	if r.Level != espgohome.LogLevel_LOG_LEVEL_WARN || r.Tag != "dallas" || r.Line != 92 || !r.SendFailed || r.Time.IsZero() {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f, err := ParseFilter("info, sensor=verbose, wifi*=none, api=w")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if s := f.String(); s != "info,sensor=verbose,wifi*=none,api=warn" {
+		t.Errorf("unexpected filter %q", s)
+	}
+	if f.MaxLevel() != espgohome.LogLevel_LOG_LEVEL_VERBOSE {
+		t.Errorf("unexpected max level %v", f.MaxLevel())
+	}
+
+	for _, tc := range []struct {
+		level espgohome.LogLevel
+		tag   string
+		want  bool
+	}{
+		{espgohome.LogLevel_LOG_LEVEL_INFO, "main", true},
+		{espgohome.LogLevel_LOG_LEVEL_DEBUG, "main", false},
+		{espgohome.LogLevel_LOG_LEVEL_VERBOSE, "sensor", true},
+		{espgohome.LogLevel_LOG_LEVEL_ERROR, "wifi.component", false},
+		{espgohome.LogLevel_LOG_LEVEL_WARN, "api", true},
+		{espgohome.LogLevel_LOG_LEVEL_INFO, "api", false},
+	} {
+		if got := f.Match(Record{Level: tc.level, Tag: tc.tag}); got != tc.want {
+			t.Errorf("%v %s: got %t, want %t", tc.level, tc.tag, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{"loud", "sensor=loud", "[=debug", "=debug"} {
+		if _, err := ParseFilter(s); err == nil {
+			t.Errorf("accepted %q", s)
+		}
+	}
+}
+
+func TestWriters(t *testing.T) {
+	r := Record{
+		Time:    time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+		Level:   espgohome.LogLevel_LOG_LEVEL_DEBUG,
+		Tag:     "sensor",
+		Line:    92,
+		Message: "hello",
+	}
+
+	var b bytes.Buffer
+	(&TextWriter{Out: &b}).WriteRecord(r)
+	(&TextWriter{Out: &b, TimeFormat: "-"}).WriteRecord(Record{Level: espgohome.LogLevel_LOG_LEVEL_INFO, Message: "plain"})
+	if want := "12:30:00.000 [D][sensor:92]: hello\n[I]: plain\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	(&ColorWriter{Out: &b, TimeFormat: "-"}).WriteRecord(r)
+	if want := "\x1b[0;36m[D][sensor:92]:\x1b[0m \x1b[0;36mhello\x1b[0m\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	(&JSONWriter{Out: &b}).WriteRecord(r)
+	var got map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", b.String(), err)
+	}
+	if got["level"] != "debug" || got["tag"] != "sensor" || got["line"] != 92.0 || got["message"] != "hello" {
+		t.Errorf("unexpected JSON %q", b.String())
+	}
+	if _, ok := got["config"]; ok {
+		t.Errorf("unexpected config in %q", b.String())
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := &server.Server{Config: []string{"[C][logger:185]: Logger:", "[C][logger:186]:   Level: DEBUG"}}
+	address := espgohometest.Serve(t, s)
+
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client"}
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	f, _ := ParseFilter("info,sensor=debug")
+	records, err := Subscribe(c, Options{Filter: f, DumpConfig: true})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	next := func() string {
+		select {
+		case r := <-records:
+			return r.String()
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a record")
+		}
+		return ""
+	}
+
+	got := []string{next(), next()}
+	// the subscription has been processed once the config has been dumped
+	s.Log(espgohome.LogLevel_LOG_LEVEL_DEBUG, "", "[D][wifi:100]: hidden")
+	s.Log(espgohome.LogLevel_LOG_LEVEL_DEBUG, "", "\x1b[0;36m[D][sensor:92]: shown\x1b[0m")
+	got = append(got, next())
+
+	want := []string{"[C][logger:185]: Logger:", "[C][logger:186]:   Level: DEBUG", "[D][sensor:92]: shown"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	c.Close()
+	for range records {
+	}
+}
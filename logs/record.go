@@ -0,0 +1,159 @@
+// Package logs streams the log output of an ESPHome device.
+//
+// ESPHome formats every log message as "[L][tag:line]: text", wrapped in
+// ANSI colour codes. Parse turns a SubscribeLogsResponse into a Record with
+// the level, tag, source line and text separated, a Filter selects records by
+// level per tag, and the writers print records as plain text, JSON lines or
+// with colours for a terminal.
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// Record is a parsed log message
+type Record struct {
+	Time  time.Time
+	Level espgohome.LogLevel
+	// Config is set for the "[C]" messages a device logs while dumping its
+	// configuration, they are reported at LOG_LEVEL_INFO
+	Config bool
+	// Tag is the component that logged the message
+	Tag string
+	// Line is the line in the source of the component, or 0 if unknown
+	Line int
+	// Message is the text with the prefix and colour codes removed
+	Message string
+	// SendFailed is set when the device dropped earlier messages
+	SendFailed bool
+}
+
+// letters are the level letters used in the message prefix
+var letters = map[string]espgohome.LogLevel{
+	"E":  espgohome.LogLevel_LOG_LEVEL_ERROR,
+	"W":  espgohome.LogLevel_LOG_LEVEL_WARN,
+	"I":  espgohome.LogLevel_LOG_LEVEL_INFO,
+	"C":  espgohome.LogLevel_LOG_LEVEL_INFO,
+	"D":  espgohome.LogLevel_LOG_LEVEL_DEBUG,
+	"V":  espgohome.LogLevel_LOG_LEVEL_VERBOSE,
+	"VV": espgohome.LogLevel_LOG_LEVEL_VERY_VERBOSE,
+}
+
+var (
+	ansiPattern   = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	prefixPattern = regexp.MustCompile(`(?s)^\[(VV|[EWICDV])\]\[([^\]:]+)(?::(\d+))?\]:? ?(.*)$`)
+)
+
+// StripANSI removes ANSI escape sequences from s
+func StripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// ParseLine parses a message in the "[L][tag:line]: text" format. Messages
+// without the prefix are returned as the text of a record with no level.
+func ParseLine(s string) Record {
+	s = strings.TrimRight(StripANSI(s), "\r\n")
+
+	m := prefixPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Record{Message: s}
+	}
+
+	r := Record{
+		Level:   letters[m[1]],
+		Config:  m[1] == "C",
+		Tag:     m[2],
+		Message: m[4],
+	}
+	if m[3] != "" {
+		r.Line, _ = strconv.Atoi(m[3])
+	}
+	return r
+}
+
+// Parse converts a log message received from a device into a Record stamped
+// with the current time. The level and tag of the response take precedence
+// over the ones in the text.
+func Parse(resp *espgohome.SubscribeLogsResponse) Record {
+	r := ParseLine(resp.Message)
+	r.Time = time.Now()
+	r.SendFailed = resp.SendFailed
+	if resp.Level != espgohome.LogLevel_LOG_LEVEL_NONE {
+		r.Level = resp.Level
+	}
+	if resp.Tag != "" {
+		r.Tag = resp.Tag
+	}
+	return r
+}
+
+// Letter returns the letter ESPHome uses for the level of the record
+func (r Record) Letter() string {
+	if r.Config {
+		return "C"
+	}
+	return LevelLetter(r.Level)
+}
+
+// String formats the record as the device would
+func (r Record) String() string {
+	return r.prefix() + ": " + r.Message
+}
+
+// prefix returns "[L][tag:line]", leaving out what is unknown
+func (r Record) prefix() string {
+	switch {
+	case r.Tag == "":
+		return "[" + r.Letter() + "]"
+	case r.Line == 0:
+		return fmt.Sprintf("[%s][%s]", r.Letter(), r.Tag)
+	}
+	return fmt.Sprintf("[%s][%s:%d]", r.Letter(), r.Tag, r.Line)
+}
+
+// LevelLetter returns the letter ESPHome uses for level
+func LevelLetter(level espgohome.LogLevel) string {
+	switch level {
+	case espgohome.LogLevel_LOG_LEVEL_ERROR:
+		return "E"
+	case espgohome.LogLevel_LOG_LEVEL_WARN:
+		return "W"
+	case espgohome.LogLevel_LOG_LEVEL_INFO:
+		return "I"
+	case espgohome.LogLevel_LOG_LEVEL_DEBUG:
+		return "D"
+	case espgohome.LogLevel_LOG_LEVEL_VERBOSE:
+		return "V"
+	case espgohome.LogLevel_LOG_LEVEL_VERY_VERBOSE:
+		return "VV"
+	}
+	return "?"
+}
+
+// LevelName returns the lower case name of level, such as "debug"
+func LevelName(level espgohome.LogLevel) string {
+	return value.EnumString(espgohome.LogLevel_name, value.LogLevelPrefixes, int32(level))
+}
+
+// ParseLevel parses a level name as returned by LevelName or a level letter
+func ParseLevel(s string) (espgohome.LogLevel, error) {
+	if v, ok := value.ParseEnum(espgohome.LogLevel_name, value.LogLevelPrefixes, s); ok {
+		return espgohome.LogLevel(v), nil
+	}
+	if upper := strings.ToUpper(s); upper != "C" {
+		if level, ok := letters[upper]; ok {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q, expected none, error, warn, info, debug, verbose or very_verbose", s)
+}
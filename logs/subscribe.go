@@ -0,0 +1,60 @@
+package logs
+
+import (
+	"github.com/jdugan1024/espgohome"
+)
+
+// Options configures Subscribe
+type Options struct {
+	// Filter selects the records to deliver, nil delivers everything at
+	// debug level and above
+	Filter *Filter
+	// DumpConfig asks the device to log its configuration first
+	DumpConfig bool
+}
+
+// subscribeLevel returns the level to request from the device
+func (o Options) subscribeLevel() espgohome.LogLevel {
+	if o.Filter == nil {
+		return espgohome.LogLevel_LOG_LEVEL_DEBUG
+	}
+	return o.Filter.MaxLevel()
+}
+
+// Subscribe subscribes to the logs of the device on conn and returns a
+// channel of the records that pass the filter. The channel is closed when
+// the connection is. As with the other subscriptions the channel must be
+// drained until it is closed.
+func Subscribe(conn *espgohome.ESPHomeConnection, opts Options) (<-chan Record, error) {
+	req := &espgohome.SubscribeLogsRequest{Level: opts.subscribeLevel(), DumpConfig: opts.DumpConfig}
+	messages, err := conn.SubscribeLogsWith(req)
+	if err != nil {
+		conn.RemoveReceiver(messages)
+		return nil, err
+	}
+
+	records := make(chan Record)
+	go func() {
+		defer close(records)
+		for m := range messages {
+			r := Parse(m.(*espgohome.SubscribeLogsResponse))
+			if opts.Filter.Match(r) {
+				records <- r
+			}
+		}
+	}()
+
+	return records, nil
+}
+
+// Copy writes the records from ch to w until ch is closed, it stops at the
+// first error from w but keeps draining ch
+func Copy(w Writer, ch <-chan Record) error {
+	var err error
+	for r := range ch {
+		if err == nil {
+			err = w.WriteRecord(r)
+		}
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package logs
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultTimeFormat is used by TextWriter and ColorWriter if TimeFormat is empty
+const DefaultTimeFormat = "15:04:05.000"
+
+// Writer prints records
+type Writer interface {
+	WriteRecord(r Record) error
+}
+
+// TextWriter prints records as "time [L][tag:line]: text"
+type TextWriter struct {
+	Out io.Writer
+	// TimeFormat is passed to time.Format, "-" leaves the time out
+	TimeFormat string
+}
+
+// WriteRecord implements Writer
+func (w *TextWriter) WriteRecord(r Record) error {
+	line := prefixTime(r, w.TimeFormat) + r.String()
+	if r.SendFailed {
+		line += lostMessages
+	}
+	_, err := io.WriteString(w.Out, line+"\n")
+	return err
+}
+
+// lostMessages is appended to records with SendFailed set
+const lostMessages = " (messages lost)"
+
+// prefixTime returns the time of r followed by a space, formatted with layout
+func prefixTime(r Record, layout string) string {
+	if layout == "-" || r.Time.IsZero() {
+		return ""
+	}
+	if layout == "" {
+		layout = DefaultTimeFormat
+	}
+	return r.Time.Format(layout) + " "
+}
+
+// Colours used by ColorWriter, the same as the ones ESPHome uses
+var colors = map[string]string{
+	"E":  "\x1b[1;31m",
+	"W":  "\x1b[0;33m",
+	"I":  "\x1b[0;32m",
+	"C":  "\x1b[0;35m",
+	"D":  "\x1b[0;36m",
+	"V":  "\x1b[0;37m",
+	"VV": "\x1b[0;38m",
+}
+
+const (
+	colorDim   = "\x1b[2m"
+	colorReset = "\x1b[0m"
+)
+
+// ColorWriter prints records like TextWriter, coloured by level for a terminal
+type ColorWriter struct {
+	Out io.Writer
+	// TimeFormat is passed to time.Format, "-" leaves the time out
+	TimeFormat string
+}
+
+// WriteRecord implements Writer
+func (w *ColorWriter) WriteRecord(r Record) error {
+	var b strings.Builder
+	if t := prefixTime(r, w.TimeFormat); t != "" {
+		b.WriteString(colorDim + t + colorReset)
+	}
+	color := colors[r.Letter()]
+	b.WriteString(color + r.prefix() + ":" + colorReset + " " + color + r.Message + colorReset)
+	if r.SendFailed {
+		b.WriteString(colors["W"] + lostMessages + colorReset)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w.Out, b.String())
+	return err
+}
+
+// recordJSON is how JSONWriter prints a record
+type recordJSON struct {
+	Time       time.Time `json:"time"`
+	Level      string    `json:"level"`
+	Config     bool      `json:"config,omitempty"`
+	Tag        string    `json:"tag"`
+	Line       int       `json:"line,omitempty"`
+	Message    string    `json:"message"`
+	SendFailed bool      `json:"send_failed,omitempty"`
+}
+
+// JSONWriter prints each record as a JSON object on its own line
+type JSONWriter struct {
+	Out io.Writer
+}
+
+// WriteRecord implements Writer
+func (w *JSONWriter) WriteRecord(r Record) error {
+	b, err := json.Marshal(recordJSON{
+		Time:       r.Time,
+		Level:      LevelName(r.Level),
+		Config:     r.Config,
+		Tag:        r.Tag,
+		Line:       r.Line,
+		Message:    r.Message,
+		SendFailed: r.SendFailed,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Out.Write(append(b, '\n'))
+	return err
+}
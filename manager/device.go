@@ -0,0 +1,364 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"google.golang.org/protobuf/proto"
+)
+
+// errorPingTimeout is the reason given when a device stops answering pings
+var errorPingTimeout = errors.New("ping timed out")
+
+// DeviceConfig describes how to connect to a device
+type DeviceConfig struct {
+	// Address is the host:port of the device's native API
+	Address  string
+	Password string
+	// ClientInfo overrides Manager.ClientInfo
+	ClientInfo string
+	// PingInterval overrides Manager.PingInterval
+	PingInterval time.Duration
+	// Logger overrides Manager.Logger
+	Logger espgohome.Logger
+}
+
+// Device is a single device owned by a Manager
+type Device struct {
+	manager *Manager
+	config  DeviceConfig
+
+	mu         sync.Mutex
+	conn       *espgohome.ESPHomeConnection
+	info       *espgohome.DeviceInfoResponse
+	entities   *entity.Device
+	connected  bool
+	reconnects int
+	lastErr    error
+	pingRTT    time.Duration
+
+	frames frameCounter
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func newDevice(m *Manager, cfg DeviceConfig) *Device {
+	return &Device{
+		manager: m,
+		config:  cfg,
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Config returns the configuration the device was added with
+func (d *Device) Config() DeviceConfig {
+	return d.config
+}
+
+// Name returns the device name from DeviceInfo, or its address until it has connected
+func (d *Device) Name() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.name()
+}
+
+func (d *Device) name() string {
+	if d.info != nil && d.info.Name != "" {
+		return d.info.Name
+	}
+	return d.config.Address
+}
+
+// MAC returns the MAC address from DeviceInfo, or "" until it has connected
+func (d *Device) MAC() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.info == nil {
+		return ""
+	}
+	return d.info.MacAddress
+}
+
+// Info returns the DeviceInfoResponse from the most recent connection, or nil
+func (d *Device) Info() *espgohome.DeviceInfoResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.info
+}
+
+// Connected reports whether the device is currently connected
+func (d *Device) Connected() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.connected
+}
+
+// Reconnects returns the number of times the device has reconnected after
+// the first successful connection
+func (d *Device) Reconnects() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.reconnects
+}
+
+// LastError returns the reason the last connection attempt failed or was lost
+func (d *Device) LastError() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.lastErr
+}
+
+// Conn returns the current connection, or nil if the device is not connected
+func (d *Device) Conn() *espgohome.ESPHomeConnection {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.connected {
+		return nil
+	}
+	return d.conn
+}
+
+// Entities returns the typed entities from the most recent connection, or nil
+// if the device has never connected
+func (d *Device) Entities() *entity.Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.entities
+}
+
+func (d *Device) matches(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if id == d.config.Address {
+		return true
+	}
+	if d.info == nil {
+		return false
+	}
+	return id == d.info.Name || (d.info.MacAddress != "" && id == d.info.MacAddress)
+}
+
+func (d *Device) stop() {
+	close(d.stopCh)
+	<-d.done
+}
+
+func (d *Device) stopped() bool {
+	select {
+	case <-d.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// logger returns the Logger of the device or of the manager with the device
+// name added
+func (d *Device) logger() espgohome.Logger {
+	l := d.config.Logger
+	if l == nil {
+		l = d.manager.Logger
+	}
+	return espgohome.WithFields(espgohome.ResolveLogger(l, d.manager.Debug), "name", d.Name())
+}
+
+func (d *Device) pingInterval() time.Duration {
+	if d.config.PingInterval > 0 {
+		return d.config.PingInterval
+	}
+	return d.manager.pingInterval()
+}
+
+func (d *Device) event(t EventType, err error) Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := Event{Type: t, Time: time.Now(), Device: d.name(), Err: err}
+	if d.info != nil {
+		e.MAC = d.info.MacAddress
+	}
+	return e
+}
+
+// run connects to the device and reconnects whenever the connection is lost
+// until stop is called, or until the device turns out to be managed already
+func (d *Device) run() {
+	defer close(d.done)
+
+	backoff := d.manager.minBackoff()
+	everConnected := false
+
+	for !d.stopped() {
+		c, err := d.connect(everConnected)
+		if err != nil {
+			d.logger().Log(espgohome.LevelWarn, "manager: connect failed", "error", err)
+			d.mu.Lock()
+			d.lastErr = err
+			d.mu.Unlock()
+			d.manager.emit(d.event(ConnectFailed, err))
+			if err == ErrorDuplicateDevice {
+				// the device stays in the manager, with the error, until it
+				// is removed
+				return
+			}
+
+			select {
+			case <-d.stopCh:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > d.manager.maxBackoff() {
+				backoff = d.manager.maxBackoff()
+			}
+			continue
+		}
+
+		everConnected = true
+		backoff = d.manager.minBackoff()
+
+		err = d.watch(c)
+
+		d.mu.Lock()
+		d.connected = false
+		d.lastErr = err
+		d.mu.Unlock()
+		d.manager.emit(d.event(Disconnected, err))
+	}
+}
+
+// connect performs the handshake, loads the entities and subscribes to states
+func (d *Device) connect(reconnect bool) (*espgohome.ESPHomeConnection, error) {
+	clientInfo := d.config.ClientInfo
+	if clientInfo == "" {
+		clientInfo = d.manager.ClientInfo
+	}
+	c := &espgohome.ESPHomeConnection{
+		ClientInfo: clientInfo,
+		Password:   d.config.Password,
+		Logger:     d.logger(),
+		Tap:        &d.frames,
+	}
+
+	if err := c.DialTimeout(d.config.Address, d.manager.dialTimeout()); err != nil {
+		return nil, err
+	}
+
+	// none of the handshake has a timeout of its own, close the connection if
+	// it takes too long so that the calls below fail with ErrorClosed
+	timer := time.AfterFunc(d.manager.dialTimeout(), func() { c.Close() })
+	defer timer.Stop()
+
+	if err := c.Hello(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Connect(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	info, err := c.DeviceInfo()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	entities, err := entity.Load(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// the check and the update of info are done under the manager lock so
+	// that two devices with the same MAC can't both connect
+	d.manager.mu.Lock()
+	if d.manager.hasMAC(d, info.MacAddress) {
+		d.manager.mu.Unlock()
+		c.Close()
+		return nil, ErrorDuplicateDevice
+	}
+	d.mu.Lock()
+	d.conn = c
+	d.info = info
+	d.entities = entities
+	d.connected = true
+	d.lastErr = nil
+	if reconnect {
+		d.reconnects++
+	}
+	d.mu.Unlock()
+	d.manager.mu.Unlock()
+
+	// Connected has to be sent before the initial states
+	d.manager.emit(d.event(Connected, nil))
+
+	entities.Store().AddCallback(func(st espgohome.EntityState, previous proto.Message) {
+		e := d.event(StateChanged, nil)
+		e.State = st
+		e.Previous = previous
+		d.manager.emit(e)
+	})
+	if err := entities.Subscribe(); err != nil {
+		// the connection is already closed, watch will notice
+		d.logger().Log(espgohome.LevelWarn, "manager: subscribe failed", "error", err)
+	}
+
+	return c, nil
+}
+
+// watch pings the device until the connection is lost or the device is
+// stopped, returning the reason the connection ended
+func (d *Device) watch(c *espgohome.ESPHomeConnection) error {
+	ticker := time.NewTicker(d.pingInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			timer := time.AfterFunc(d.manager.pingTimeout(), func() { c.Close() })
+			c.Disconnect()
+			timer.Stop()
+			c.Close()
+			return nil
+		case <-c.Done():
+			return espgohome.ErrorClosed
+		case <-ticker.C:
+			if err := d.ping(c); err != nil {
+				c.Close()
+				return err
+			}
+		}
+	}
+}
+
+func (d *Device) ping(c *espgohome.ESPHomeConnection) error {
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- c.Ping()
+	}()
+
+	select {
+	case err := <-result:
+		if err == nil {
+			d.mu.Lock()
+			d.pingRTT = time.Since(start)
+			d.mu.Unlock()
+		}
+		return err
+	case <-time.After(d.manager.pingTimeout()):
+		return errorPingTimeout
+	}
+}
@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// EventType identifies the kind of an Event
+type EventType int
+
+//go:generate stringer -type=EventType
+
+const (
+	// Connected is sent once a device has connected and its entities are loaded
+	Connected EventType = 1
+	// Disconnected is sent when the connection to a device is lost, Err
+	// holds the reason if known
+	Disconnected EventType = 2
+	// StateChanged is sent when the state of an entity changes
+	StateChanged EventType = 3
+	// ConnectFailed is sent when a connection attempt fails
+	ConnectFailed EventType = 4
+)
+
+// Event is sent to Manager listeners
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Device is the name of the device, or its address if it has never connected
+	Device string
+	// MAC is the MAC address of the device, if known
+	MAC string
+	// State and Previous are set for StateChanged events
+	State    espgohome.EntityState
+	Previous proto.Message
+	Err      error
+}
+
+// EntityID returns the global "device/object_id" id of the entity in a StateChanged event
+func (e Event) EntityID() string {
+	if e.State.Entity == nil {
+		return ""
+	}
+	return e.Device + "/" + e.State.Entity.GetObjectId()
+}
@@ -0,0 +1,27 @@
+// Code generated by "stringer -type=EventType"; DO NOT EDIT.
+
+package manager
+
+import "strconv"
+
+func _() {
+	// An "invalid array index" compiler error signifies that the constant values have changed.
+	// Re-run the stringer command to generate them again.
+	var x [1]struct{}
+	_ = x[Connected-1]
+	_ = x[Disconnected-2]
+	_ = x[StateChanged-3]
+	_ = x[ConnectFailed-4]
+}
+
+const _EventType_name = "ConnectedDisconnectedStateChangedConnectFailed"
+
+var _EventType_index = [...]uint8{0, 9, 21, 33, 46}
+
+func (i EventType) String() string {
+	idx := int(i) - 1
+	if i < 1 || idx >= len(_EventType_index)-1 {
+		return "EventType(" + strconv.FormatInt(int64(i), 10) + ")"
+	}
+	return _EventType_name[_EventType_index[idx]:_EventType_index[idx+1]]
+}
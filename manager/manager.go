@@ -0,0 +1,272 @@
+// Package manager maintains connections to many ESPHome devices.
+//
+// Each device is connected and reconnected independently. State changes from
+// every device are merged into a single stream of Events tagged with the
+// device they came from, and entities can be addressed globally as
+// "device/object_id" where device is the device name or MAC address.
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+)
+
+// ErrorUnknownDevice is returned when a device can't be found
+var ErrorUnknownDevice = errors.New("unknown device")
+
+// ErrorDuplicateDevice is returned when a device has the MAC address of
+// another device of the manager, reached at a different address
+var ErrorDuplicateDevice = errors.New("device already added")
+
+// ErrorUnknownEntity is returned when an entity can't be found on a device
+var ErrorUnknownEntity = errors.New("unknown entity")
+
+// Default timings used when the Manager fields are zero
+const (
+	DefaultMinBackoff   = time.Second
+	DefaultMaxBackoff   = time.Minute
+	DefaultPingInterval = 20 * time.Second
+	DefaultPingTimeout  = 10 * time.Second
+	DefaultDialTimeout  = 10 * time.Second
+)
+
+// Manager owns the connections to a set of devices
+type Manager struct {
+	// ClientInfo is sent in the HelloRequest unless the DeviceConfig overrides it
+	ClientInfo string
+	// MinBackoff and MaxBackoff bound the delay between reconnection attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PingInterval is how often idle connections are checked, PingTimeout is
+	// how long to wait for the PingResponse before reconnecting
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	DialTimeout  time.Duration
+	// Logger receives the diagnostic messages of the manager and of the
+	// connections, with the device name added
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu      sync.Mutex
+	devices []*Device
+	// listeners maps each listener to a channel closed when it is removed,
+	// which aborts a send in progress
+	listeners map[chan Event]chan struct{}
+	closed    bool
+}
+
+// New creates a Manager
+func New(clientInfo string) *Manager {
+	return &Manager{ClientInfo: clientInfo}
+}
+
+// Add starts connecting to a device, the returned Device can be used
+// immediately but has no entities until it connects. A device that turns out
+// to have the MAC address of another device stops connecting with
+// ErrorDuplicateDevice.
+func (m *Manager) Add(cfg DeviceConfig) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, errors.New("manager closed")
+	}
+	for _, d := range m.devices {
+		if d.config.Address == cfg.Address {
+			return nil, fmt.Errorf("device %s already added", cfg.Address)
+		}
+	}
+
+	d := newDevice(m, cfg)
+	m.devices = append(m.devices, d)
+	go d.run()
+
+	return d, nil
+}
+
+// Remove disconnects a device and stops reconnecting to it, id is the
+// address, name or MAC of the device
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	var found *Device
+	for i, d := range m.devices {
+		if d.matches(id) {
+			found = d
+			m.devices = append(m.devices[:i], m.devices[i+1:]...)
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if found == nil {
+		return ErrorUnknownDevice
+	}
+	found.stop()
+
+	return nil
+}
+
+// Close disconnects every device, listener channels are not closed
+func (m *Manager) Close() {
+	m.mu.Lock()
+	devices := m.devices
+	m.devices = nil
+	m.closed = true
+	m.mu.Unlock()
+
+	for _, d := range devices {
+		d.stop()
+	}
+}
+
+// Devices returns every device in the order they were added
+func (m *Manager) Devices() []*Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	devices := make([]*Device, len(m.devices))
+	copy(devices, m.devices)
+
+	return devices
+}
+
+// Device returns the device with the given name, MAC or address
+func (m *Manager) Device(id string) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.devices {
+		if d.matches(id) {
+			return d, nil
+		}
+	}
+
+	return nil, ErrorUnknownDevice
+}
+
+// Entity looks up an entity by its global id "device/object_id"
+func (m *Manager) Entity(id string) (*Device, entity.Entity, error) {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("entity id %q is not of the form device/object_id", id)
+	}
+
+	d, err := m.Device(id[:i])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entities := d.Entities()
+	if entities == nil {
+		return d, nil, ErrorUnknownEntity
+	}
+	e := entities.Get(id[i+1:])
+	if e == nil {
+		return d, nil, ErrorUnknownEntity
+	}
+
+	return d, e, nil
+}
+
+// hasMAC reports whether a device other than d has the MAC address mac, m.mu
+// must be held
+func (m *Manager) hasMAC(d *Device, mac string) bool {
+	if mac == "" {
+		return false
+	}
+	for _, other := range m.devices {
+		if other != d && other.MAC() == mac {
+			return true
+		}
+	}
+	return false
+}
+
+// AddListener registers a channel to receive events from every device. Events
+// are delivered in order and sending blocks, so listeners should be read
+// promptly or removed.
+func (m *Manager) AddListener(ch chan Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.listeners == nil {
+		m.listeners = make(map[chan Event]chan struct{})
+	}
+	if _, ok := m.listeners[ch]; !ok {
+		m.listeners[ch] = make(chan struct{})
+	}
+}
+
+// RemoveListener unregisters a channel, a send to it in progress is
+// abandoned so the channel doesn't need to be drained
+func (m *Manager) RemoveListener(ch chan Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if removed, ok := m.listeners[ch]; ok {
+		close(removed)
+		delete(m.listeners, ch)
+	}
+}
+
+func (m *Manager) emit(e Event) {
+	type listener struct {
+		ch      chan Event
+		removed chan struct{}
+	}
+	m.mu.Lock()
+	listeners := make([]listener, 0, len(m.listeners))
+	for ch, removed := range m.listeners {
+		listeners = append(listeners, listener{ch, removed})
+	}
+	m.mu.Unlock()
+
+	for _, l := range listeners {
+		select {
+		case l.ch <- e:
+		case <-l.removed:
+		}
+	}
+}
+
+func (m *Manager) minBackoff() time.Duration {
+	if m.MinBackoff > 0 {
+		return m.MinBackoff
+	}
+	return DefaultMinBackoff
+}
+
+func (m *Manager) maxBackoff() time.Duration {
+	if m.MaxBackoff > 0 {
+		return m.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
+
+func (m *Manager) pingInterval() time.Duration {
+	if m.PingInterval > 0 {
+		return m.PingInterval
+	}
+	return DefaultPingInterval
+}
+
+func (m *Manager) pingTimeout() time.Duration {
+	if m.PingTimeout > 0 {
+		return m.PingTimeout
+	}
+	return DefaultPingTimeout
+}
+
+func (m *Manager) dialTimeout() time.Duration {
+	if m.DialTimeout > 0 {
+		return m.DialTimeout
+	}
+	return DefaultDialTimeout
+}
@@ -0,0 +1,293 @@
+package manager
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+// recordingListener remembers accepted connections so tests can drop them
+type recordingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *recordingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, c)
+		l.mu.Unlock()
+	}
+	return c, err
+}
+
+func (l *recordingListener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range l.conns {
+		c.Close()
+	}
+	l.conns = nil
+}
+
+func startDevice(t *testing.T, name, mac, password string) (*server.Server, *recordingListener) {
+	s := &server.Server{
+		Password:   password,
+		ServerInfo: "test-server",
+		Info:       &espgohome.DeviceInfoResponse{Name: name, MacAddress: mac},
+	}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: true})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	rl := &recordingListener{Listener: l}
+	go s.Serve(rl)
+	t.Cleanup(func() { s.Close() })
+
+	return s, rl
+}
+
+func newTestManager() *Manager {
+	m := New("test-client")
+	m.MinBackoff = 10 * time.Millisecond
+	m.MaxBackoff = 50 * time.Millisecond
+	m.PingInterval = 50 * time.Millisecond
+	m.PingTimeout = 200 * time.Millisecond
+	m.DialTimeout = time.Second
+
+	return m
+}
+
+func waitFor(t *testing.T, events chan Event, match func(Event) bool) Event {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if match(e) {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func drain(events chan Event, done chan struct{}) {
+	for {
+		select {
+		case <-events:
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestMultipleDevices(t *testing.T) {
+	_, l1 := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "")
+	s2, l2 := startDevice(t, "garage", "AA:AA:AA:AA:AA:02", "secret")
+
+	m := newTestManager()
+	events := make(chan Event, 64)
+	m.AddListener(events)
+
+	if _, err := m.Add(DeviceConfig{Address: l1.Addr().String()}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if _, err := m.Add(DeviceConfig{Address: l2.Addr().String(), Password: "secret"}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if _, err := m.Add(DeviceConfig{Address: l2.Addr().String()}); err == nil {
+		t.Error("added the same device twice")
+	}
+
+	connected := map[string]bool{}
+	states := map[string]bool{}
+	for len(connected) < 2 || len(states) < 2 {
+		e := waitFor(t, events, func(Event) bool { return true })
+		switch e.Type {
+		case Connected:
+			connected[e.Device] = true
+		case StateChanged:
+			if !connected[e.Device] {
+				t.Errorf("state from %s before Connected", e.Device)
+			}
+			states[e.EntityID()] = true
+		}
+	}
+	if !states["kitchen/relay"] || !states["garage/relay"] {
+		t.Errorf("unexpected states: %v", states)
+	}
+
+	d, err := m.Device("AA:AA:AA:AA:AA:02")
+	if err != nil || d.Name() != "garage" {
+		t.Fatalf("lookup by MAC failed: %v", err)
+	}
+	_, e, err := m.Entity("kitchen/relay")
+	if err != nil {
+		t.Fatalf("entity lookup failed: %v", err)
+	}
+	if e.Name() != "Relay" {
+		t.Errorf("expected Relay, got %q", e.Name())
+	}
+	if _, _, err := m.Entity("kitchen/missing"); err != ErrorUnknownEntity {
+		t.Errorf("expected ErrorUnknownEntity, got %v", err)
+	}
+	if _, _, err := m.Entity("attic/relay"); err != ErrorUnknownDevice {
+		t.Errorf("expected ErrorUnknownDevice, got %v", err)
+	}
+
+	s2.SetState(&espgohome.SwitchStateResponse{Key: 1, State: false})
+	e2 := waitFor(t, events, func(e Event) bool { return e.Type == StateChanged })
+	if e2.EntityID() != "garage/relay" {
+		t.Errorf("expected garage/relay, got %s", e2.EntityID())
+	}
+	if st := e2.State.State.(*espgohome.SwitchStateResponse); st.State {
+		t.Error("expected the relay to be off")
+	}
+
+	done := make(chan struct{})
+	go drain(events, done)
+	m.Close()
+	close(done)
+}
+
+func TestReconnect(t *testing.T) {
+	_, l := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "")
+
+	m := newTestManager()
+	events := make(chan Event, 64)
+	m.AddListener(events)
+
+	d, err := m.Add(DeviceConfig{Address: l.Addr().String()})
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	waitFor(t, events, func(e Event) bool { return e.Type == Connected })
+
+	l.drop()
+	waitFor(t, events, func(e Event) bool { return e.Type == Disconnected })
+	waitFor(t, events, func(e Event) bool { return e.Type == Connected })
+
+	if d.Reconnects() != 1 {
+		t.Errorf("expected 1 reconnect, got %d", d.Reconnects())
+	}
+	if !d.Connected() || d.Conn() == nil {
+		t.Error("device not connected after reconnecting")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for d.Stats().PingRTT == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	st := d.Stats()
+	if st.Reconnects != 1 || st.FramesSent == 0 || st.FramesReceived == 0 || st.PingRTT == 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	done := make(chan struct{})
+	go drain(events, done)
+	if err := m.Remove("kitchen"); err != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+	close(done)
+
+	if len(m.Devices()) != 0 {
+		t.Errorf("expected no devices, got %d", len(m.Devices()))
+	}
+}
+
+func TestConnectFailed(t *testing.T) {
+	_, l := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "secret")
+
+	m := newTestManager()
+	events := make(chan Event, 64)
+	m.AddListener(events)
+
+	d, err := m.Add(DeviceConfig{Address: l.Addr().String(), Password: "wrong"})
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	e := waitFor(t, events, func(e Event) bool { return e.Type == ConnectFailed })
+	if e.Err != espgohome.ErrorInvalidPassword {
+		t.Errorf("expected ErrorInvalidPassword, got %v", e.Err)
+	}
+	if d.Connected() {
+		t.Error("connected with the wrong password!")
+	}
+
+	done := make(chan struct{})
+	go drain(events, done)
+	m.Close()
+	close(done)
+}
+
+func TestRemoveBlockedListener(t *testing.T) {
+	_, l := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "")
+
+	m := newTestManager()
+	defer m.Close()
+	stuck := make(chan Event)
+	m.AddListener(stuck)
+	events := make(chan Event, 64)
+	m.AddListener(events)
+
+	d, err := m.Add(DeviceConfig{Address: l.Addr().String()})
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	// the Connected event is stuck on the listener nobody reads
+	time.Sleep(50 * time.Millisecond)
+	m.RemoveListener(stuck)
+
+	waitFor(t, events, func(e Event) bool { return e.Type == StateChanged && e.EntityID() == "kitchen/relay" })
+	if !d.Connected() {
+		t.Errorf("device not connected")
+	}
+}
+
+func TestDuplicateMAC(t *testing.T) {
+	_, l1 := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "")
+	_, l2 := startDevice(t, "kitchen", "AA:AA:AA:AA:AA:01", "")
+
+	m := newTestManager()
+	events := make(chan Event, 64)
+	m.AddListener(events)
+
+	if _, err := m.Add(DeviceConfig{Address: l1.Addr().String()}); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	waitFor(t, events, func(e Event) bool { return e.Type == Connected })
+
+	d, err := m.Add(DeviceConfig{Address: l2.Addr().String()})
+	if err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	e := waitFor(t, events, func(e Event) bool { return e.Type == ConnectFailed })
+	if e.Err != ErrorDuplicateDevice {
+		t.Errorf("expected ErrorDuplicateDevice, got %v", e.Err)
+	}
+	if d.Connected() || d.LastError() != ErrorDuplicateDevice {
+		t.Errorf("the duplicate connected, last error %v", d.LastError())
+	}
+	if err := m.Remove(l2.Addr().String()); err != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go drain(events, done)
+	m.Close()
+	close(done)
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// Stats holds the health counters of a device, they are kept across
+// reconnects
+type Stats struct {
+	Reconnects     int
+	FramesSent     uint64
+	FramesReceived uint64
+	// PingRTT is the round trip time of the last successful ping, zero until
+	// the first one
+	PingRTT time.Duration
+}
+
+// frameCounter counts the frames of every connection to a device, it is the
+// Tap of the connections
+type frameCounter struct {
+	mu       sync.Mutex
+	sent     uint64
+	received uint64
+}
+
+func (f *frameCounter) Frame(t time.Time, dir espgohome.Direction, msgType espgohome.MessageID, payload []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if dir == espgohome.DirectionSent {
+		f.sent++
+	} else {
+		f.received++
+	}
+}
+
+func (f *frameCounter) counts() (sent, received uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sent, f.received
+}
+
+// Stats returns the health counters of the device
+func (d *Device) Stats() Stats {
+	sent, received := d.frames.counts()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return Stats{
+		Reconnects:     d.reconnects,
+		FramesSent:     sent,
+		FramesReceived: received,
+		PingRTT:        d.pingRTT,
+	}
+}
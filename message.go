@@ -261,3 +261,107 @@ func decodeMessage(raw []byte, msgType MessageID) (proto.Message, error) {
 		return nil, err
 	}
 }
+
+// GetMessageID returns the MessageID used to frame m, or 0 if m is not a known message
+func GetMessageID(m proto.Message) MessageID {
+	switch m.(type) {
+	case *HelloRequest:
+		return HelloRequestID
+	case *HelloResponse:
+		return HelloResponseID
+	case *ConnectRequest:
+		return ConnectRequestID
+	case *ConnectResponse:
+		return ConnectResponseID
+	case *DisconnectRequest:
+		return DisconnectRequestID
+	case *DisconnectResponse:
+		return DisconnectResponseID
+	case *PingRequest:
+		return PingRequestID
+	case *PingResponse:
+		return PingResponseID
+	case *DeviceInfoRequest:
+		return DeviceInfoRequestID
+	case *DeviceInfoResponse:
+		return DeviceInfoResponseID
+	case *ListEntitiesRequest:
+		return ListEntitiesRequestID
+	case *ListEntitiesDoneResponse:
+		return ListEntitiesDoneResponseID
+	case *SubscribeStatesRequest:
+		return SubscribeStatesRequestID
+	case *ListEntitiesBinarySensorResponse:
+		return ListEntitiesBinarySensorResponseID
+	case *BinarySensorStateResponse:
+		return BinarySensorStateResponseID
+	case *ListEntitiesCoverResponse:
+		return ListEntitiesCoverResponseID
+	case *CoverStateResponse:
+		return CoverStateResponseID
+	case *CoverCommandRequest:
+		return CoverCommandRequestID
+	case *ListEntitiesFanResponse:
+		return ListEntitiesFanResponseID
+	case *FanStateResponse:
+		return FanStateResponseID
+	case *FanCommandRequest:
+		return FanCommandRequestID
+	case *ListEntitiesLightResponse:
+		return ListEntitiesLightResponseID
+	case *LightStateResponse:
+		return LightStateResponseID
+	case *LightCommandRequest:
+		return LightCommandRequestID
+	case *ListEntitiesSensorResponse:
+		return ListEntitiesSensorResponseID
+	case *SensorStateResponse:
+		return SensorStateResponseID
+	case *ListEntitiesSwitchResponse:
+		return ListEntitiesSwitchResponseID
+	case *SwitchStateResponse:
+		return SwitchStateResponseID
+	case *SwitchCommandRequest:
+		return SwitchCommandRequestID
+	case *ListEntitiesTextSensorResponse:
+		return ListEntitiesTextSensorResponseID
+	case *TextSensorStateResponse:
+		return TextSensorStateResponseID
+	case *SubscribeLogsRequest:
+		return SubscribeLogsRequestID
+	case *SubscribeLogsResponse:
+		return SubscribeLogsResponseID
+	case *SubscribeHomeassistantServicesRequest:
+		return SubscribeHomeassistantServicesRequestID
+	case *HomeassistantServiceResponse:
+		return HomeassistantServiceResponseID
+	case *SubscribeHomeAssistantStatesRequest:
+		return SubscribeHomeAssistantStatesRequestID
+	case *SubscribeHomeAssistantStateResponse:
+		return SubscribeHomeAssistantStateResponseID
+	case *HomeAssistantStateResponse:
+		return HomeAssistantStateResponseID
+	case *GetTimeRequest:
+		return GetTimeRequestID
+	case *GetTimeResponse:
+		return GetTimeResponseID
+	case *ListEntitiesServicesResponse:
+		return ListEntitiesServicesResponseID
+	case *ExecuteServiceRequest:
+		return ExecuteServiceRequestID
+	case *ListEntitiesCameraResponse:
+		return ListEntitiesCameraResponseID
+	case *CameraImageResponse:
+		return CameraImageResponseID
+	case *CameraImageRequest:
+		return CameraImageRequestID
+	case *ListEntitiesClimateResponse:
+		return ListEntitiesClimateResponseID
+	case *ClimateStateResponse:
+		return ClimateStateResponseID
+	case *ClimateCommandRequest:
+		return ClimateCommandRequestID
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,390 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// ErrorBrokerClosed is returned by Serve after Close has been called
+var ErrorBrokerClosed = errors.New("mqtt: broker closed")
+
+// Broker is an MQTT broker
+type Broker struct {
+	// Username and Password are required from clients if Username is set
+	Username string
+	Password string
+	// Logger receives the diagnostic messages of the broker
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu        sync.Mutex
+	clients   map[*brokerConn]bool
+	ids       map[string]*brokerConn
+	retained  map[string]Message
+	listeners map[net.Listener]bool
+	closed    bool
+}
+
+// brokerConn is a client connected to a Broker
+type brokerConn struct {
+	broker *Broker
+	conn   net.Conn
+	id     string
+	wmu    sync.Mutex
+
+	mu      sync.Mutex
+	filters map[string]bool
+	will    *Message
+}
+
+// ListenAndServe listens on the TCP address and serves clients
+func (b *Broker) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return b.Serve(l)
+}
+
+// Serve accepts connections on l until l fails or the Broker is closed
+func (b *Broker) Serve(l net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		l.Close()
+		return ErrorBrokerClosed
+	}
+	if b.listeners == nil {
+		b.listeners = make(map[net.Listener]bool)
+	}
+	b.listeners[l] = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.listeners, l)
+		b.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if b.isClosed() {
+				return ErrorBrokerClosed
+			}
+			return err
+		}
+
+		go b.ServeConn(nc)
+	}
+}
+
+// ServeConn serves a single client until it disconnects
+func (b *Broker) ServeConn(nc net.Conn) {
+	c := &brokerConn{broker: b, conn: nc, filters: make(map[string]bool)}
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	keepAlive, ok := c.handshake(r)
+	if !ok {
+		return
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	if b.clients == nil {
+		b.clients = make(map[*brokerConn]bool)
+		b.ids = make(map[string]*brokerConn)
+	}
+	// a new connection with the same client identifier takes over
+	previous := b.ids[c.id]
+	if c.id != "" {
+		b.ids[c.id] = c
+	}
+	b.clients[c] = true
+	b.mu.Unlock()
+	if previous != nil {
+		previous.conn.Close()
+	}
+	b.log(espgohome.LevelDebug, "mqtt: client connected", "client", c.id, "address", nc.RemoteAddr())
+
+	clean := c.serve(r, keepAlive)
+
+	b.mu.Lock()
+	delete(b.clients, c)
+	if b.ids[c.id] == c {
+		delete(b.ids, c.id)
+	}
+	b.mu.Unlock()
+
+	c.mu.Lock()
+	will := c.will
+	c.mu.Unlock()
+	if !clean && will != nil {
+		b.Publish(*will)
+	}
+	b.log(espgohome.LevelDebug, "mqtt: client disconnected", "client", c.id, "clean", clean)
+}
+
+// Publish delivers m to the subscribed clients, retaining it if m.Retain is
+// set. A retained message with an empty payload removes the retained message.
+func (b *Broker) Publish(m Message) {
+	b.mu.Lock()
+	if m.Retain {
+		if b.retained == nil {
+			b.retained = make(map[string]Message)
+		}
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+	clients := make([]*brokerConn, 0, len(b.clients))
+	for c := range b.clients {
+		clients = append(clients, c)
+	}
+	b.mu.Unlock()
+
+	// retained is only set for messages sent because of a new subscription
+	live := Message{Topic: m.Topic, Payload: m.Payload}
+	for _, c := range clients {
+		if c.subscribed(m.Topic) {
+			c.write(publishPacket(live))
+		}
+	}
+}
+
+// Retained returns the retained message of topic
+func (b *Broker) Retained(topic string) (Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.retained[topic]
+	return m, ok
+}
+
+// Close stops all listeners and disconnects all clients, wills are not
+// published
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	listeners := b.listeners
+	b.listeners = nil
+	clients := b.clients
+	b.clients = nil
+	b.mu.Unlock()
+
+	for l := range listeners {
+		l.Close()
+	}
+	for c := range clients {
+		c.mu.Lock()
+		c.will = nil
+		c.mu.Unlock()
+		c.conn.Close()
+	}
+
+	return nil
+}
+
+func (b *Broker) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+// retainedFor returns the retained messages matching filter, in topic order
+func (b *Broker) retainedFor(filter string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []Message
+	for topic, m := range b.retained {
+		if Match(filter, topic) {
+			messages = append(messages, m)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Topic < messages[j].Topic })
+	return messages
+}
+
+func (b *Broker) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(b.Logger, b.Debug).Log(level, msg, keyvals...)
+}
+
+// handshake reads the CONNECT packet and answers it, returning the keep
+// alive interval requested by the client
+func (c *brokerConn) handshake(r *bufio.Reader) (time.Duration, bool) {
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := readPacket(r)
+	if err != nil || p.typ != packetConnect {
+		return 0, false
+	}
+	c.conn.SetReadDeadline(time.Time{})
+
+	d := &decoder{b: p.body}
+	protocol := d.string()
+	level := d.byte()
+	flags := d.byte()
+	keepAlive := time.Duration(d.uint16()) * time.Second
+	c.id = d.string()
+	var will *Message
+	if flags&flagWill != 0 {
+		will = &Message{Topic: d.string(), Payload: append([]byte(nil), d.bytes()...), Retain: flags&flagWillRetain != 0}
+	}
+	var username, password string
+	if flags&flagUsername != 0 {
+		username = d.string()
+	}
+	if flags&flagPassword != 0 {
+		password = d.string()
+	}
+	if d.err != nil || protocol != "MQTT" {
+		return 0, false
+	}
+
+	code := byte(0)
+	switch {
+	case level != protocolLevel:
+		code = 1
+	case will != nil && !ValidTopic(will.Topic):
+		code = 2
+	case c.broker.Username != "" && (username != c.broker.Username || password != c.broker.Password):
+		code = 4
+	}
+	if err := c.write(packet{typ: packetConnack, body: []byte{0, code}}); err != nil || code != 0 {
+		if code != 0 {
+			c.broker.log(espgohome.LevelInfo, "mqtt: connection refused", "client", c.id, "code", code)
+		}
+		return 0, false
+	}
+
+	c.will = will
+	return keepAlive, true
+}
+
+// serve handles the packets of the client, it returns true if the client
+// disconnected cleanly
+func (c *brokerConn) serve(r *bufio.Reader, keepAlive time.Duration) bool {
+	for {
+		if keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+		p, err := readPacket(r)
+		if err != nil {
+			return false
+		}
+
+		switch p.typ {
+		case packetPublish:
+			m, qos, id, err := parsePublish(p)
+			if err != nil {
+				return false
+			}
+			if qos > 0 {
+				c.write(packet{typ: packetPuback, body: appendUint16(nil, id)})
+			}
+			c.broker.Publish(m)
+		case packetSubscribe:
+			if !c.subscribe(p) {
+				return false
+			}
+		case packetUnsubscribe:
+			d := &decoder{b: p.body}
+			id := d.uint16()
+			var filters []string
+			for d.err == nil && len(d.b) > 0 {
+				filters = append(filters, d.string())
+			}
+			if d.err != nil {
+				return false
+			}
+			c.mu.Lock()
+			for _, f := range filters {
+				delete(c.filters, f)
+			}
+			c.mu.Unlock()
+			c.write(packet{typ: packetUnsuback, body: appendUint16(nil, id)})
+		case packetPingreq:
+			c.write(packet{typ: packetPingresp})
+		case packetDisconnect:
+			return true
+		case packetPuback:
+		default:
+			return false
+		}
+	}
+}
+
+// subscribe handles a SUBSCRIBE, granting QoS 0 and sending the retained
+// messages of each filter
+func (c *brokerConn) subscribe(p packet) bool {
+	d := &decoder{b: p.body}
+	id := d.uint16()
+	var filters []string
+	for d.err == nil && len(d.b) > 0 {
+		filters = append(filters, d.string())
+		d.byte()
+	}
+	if d.err != nil || len(filters) == 0 {
+		return false
+	}
+
+	codes := make([]byte, len(filters))
+	c.mu.Lock()
+	for i, f := range filters {
+		if ValidFilter(f) {
+			c.filters[f] = true
+		} else {
+			codes[i] = 0x80
+		}
+	}
+	c.mu.Unlock()
+	c.write(packet{typ: packetSuback, body: append(appendUint16(nil, id), codes...)})
+
+	for i, f := range filters {
+		if codes[i] != 0 {
+			continue
+		}
+		for _, m := range c.broker.retainedFor(f) {
+			c.write(publishPacket(m))
+		}
+	}
+	return true
+}
+
+// subscribed reports whether any filter of the client matches topic
+func (c *brokerConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for f := range c.filters {
+		if Match(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *brokerConn) write(p packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p.encode())
+	return err
+}
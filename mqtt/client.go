@@ -0,0 +1,355 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+)
+
+// DefaultKeepAlive is used when Client.KeepAlive is zero
+const DefaultKeepAlive = 30 * time.Second
+
+// ErrorClosed is returned when using a Client whose connection has ended
+var ErrorClosed = errors.New("mqtt: connection closed")
+
+// errorKeepAlive is the reason given when the broker stops answering pings
+var errorKeepAlive = errors.New("mqtt: keep alive timed out")
+
+// Client is a connection to a broker. A Client is used for one connection,
+// create a new one to reconnect.
+type Client struct {
+	// ClientID identifies the client to the broker, it may be empty
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is how often the connection is checked, DefaultKeepAlive if zero
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection is lost without a
+	// Disconnect
+	Will *Message
+	// Logger receives the diagnostic messages of the client
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	conn     net.Conn
+	wmu      sync.Mutex
+	messages chan Message
+	done     chan struct{}
+
+	mu       sync.Mutex
+	nextID   uint16
+	pending  map[uint16]chan packet
+	received time.Time
+	err      error
+	// closing is set by Disconnect, the connection ending isn't an error
+	closing bool
+}
+
+// Dial connects to the broker at the TCP address
+func (c *Client) Dial(address string) error {
+	conn, err := net.DialTimeout("tcp", address, c.keepAlive())
+	if err != nil {
+		return err
+	}
+	if err := c.Connect(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Connect sends the CONNECT packet over conn and waits for the broker to
+// accept it
+func (c *Client) Connect(conn net.Conn) error {
+	flags := byte(flagClean)
+	if c.Username != "" {
+		flags |= flagUsername
+	}
+	if c.Password != "" {
+		flags |= flagPassword
+	}
+	if c.Will != nil {
+		flags |= flagWill
+		if c.Will.Retain {
+			flags |= flagWillRetain
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags)
+	body = appendUint16(body, uint16(c.keepAlive()/time.Second))
+	body = appendString(body, c.ClientID)
+	if c.Will != nil {
+		body = appendString(body, c.Will.Topic)
+		body = appendString(body, string(c.Will.Payload))
+	}
+	if c.Username != "" {
+		body = appendString(body, c.Username)
+	}
+	if c.Password != "" {
+		body = appendString(body, c.Password)
+	}
+
+	conn.SetDeadline(time.Now().Add(c.keepAlive()))
+	if _, err := conn.Write(packet{typ: packetConnect, body: body}.encode()); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	p, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if p.typ != packetConnack || len(p.body) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", p.typ)
+	}
+	if code := p.body[1]; code != 0 {
+		if err := connackErrors[code]; err != nil {
+			return err
+		}
+		return fmt.Errorf("mqtt: connection refused with code %d", code)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.conn = conn
+	c.messages = make(chan Message)
+	c.done = make(chan struct{})
+	c.pending = make(map[uint16]chan packet)
+	c.received = time.Now()
+	c.log(espgohome.LevelDebug, "mqtt: connected", "broker", conn.RemoteAddr())
+
+	go c.receiveLoop(r)
+	go c.keepAliveLoop()
+
+	return nil
+}
+
+// Messages returns the messages received for the subscriptions of the
+// client. The channel is closed when the connection ends and must be read
+// until then, from a different goroutine than the one calling Subscribe.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done returns a channel that is closed once the connection has ended
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection ended, nil after Disconnect
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Publish publishes m at QoS 0
+func (c *Client) Publish(m Message) error {
+	if !ValidTopic(m.Topic) {
+		return fmt.Errorf("mqtt: invalid topic %q", m.Topic)
+	}
+	return c.write(publishPacket(m))
+}
+
+// Subscribe subscribes to the topic filters at QoS 0 and waits for the broker
+// to acknowledge them
+func (c *Client) Subscribe(filters ...string) error {
+	var body []byte
+	for _, f := range filters {
+		if !ValidFilter(f) {
+			return fmt.Errorf("mqtt: invalid topic filter %q", f)
+		}
+		body = append(appendString(body, f), 0)
+	}
+
+	p, err := c.request(packetSubscribe, body)
+	if err != nil {
+		return err
+	}
+	for i, code := range p.body[2:] {
+		if code == 0x80 && i < len(filters) {
+			return fmt.Errorf("mqtt: subscription to %q refused", filters[i])
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes subscriptions and waits for the broker to acknowledge
+// the removal
+func (c *Client) Unsubscribe(filters ...string) error {
+	var body []byte
+	for _, f := range filters {
+		body = appendString(body, f)
+	}
+	_, err := c.request(packetUnsubscribe, body)
+	return err
+}
+
+// Disconnect closes the connection cleanly, the broker discards the Will
+func (c *Client) Disconnect() error {
+	err := c.write(packet{typ: packetDisconnect})
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+	c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Close closes the connection without a DISCONNECT, the broker publishes the
+// Will
+func (c *Client) Close() error {
+	c.fail(ErrorClosed)
+	return c.conn.Close()
+}
+
+// request sends a packet with a packet identifier and waits for its
+// acknowledgement
+func (c *Client) request(typ byte, body []byte) (packet, error) {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	ack := make(chan packet, 1)
+	c.pending[id] = ack
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(packet{typ: typ, flags: 0x02, body: append(appendUint16(nil, id), body...)}); err != nil {
+		return packet{}, err
+	}
+
+	select {
+	case p := <-ack:
+		return p, nil
+	case <-c.done:
+		return packet{}, ErrorClosed
+	case <-time.After(c.keepAlive()):
+		return packet{}, fmt.Errorf("mqtt: no acknowledgement from the broker")
+	}
+}
+
+func (c *Client) write(p packet) error {
+	select {
+	case <-c.done:
+		return ErrorClosed
+	default:
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive()))
+	_, err := c.conn.Write(p.encode())
+	return err
+}
+
+func (c *Client) receiveLoop(r *bufio.Reader) {
+	defer func() {
+		close(c.messages)
+		c.conn.Close()
+	}()
+	defer close(c.done)
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			c.log(espgohome.LevelDebug, "mqtt: connection lost", "error", c.Err())
+			return
+		}
+		c.mu.Lock()
+		c.received = time.Now()
+		c.mu.Unlock()
+
+		switch p.typ {
+		case packetPublish:
+			m, qos, id, err := parsePublish(p)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if qos > 0 {
+				c.write(packet{typ: packetPuback, body: appendUint16(nil, id)})
+			}
+			c.messages <- m
+		case packetSuback, packetUnsuback:
+			if len(p.body) < 2 {
+				c.fail(ErrorMalformedPacket)
+				return
+			}
+			id := uint16(p.body[0])<<8 | uint16(p.body[1])
+			c.mu.Lock()
+			ack := c.pending[id]
+			c.mu.Unlock()
+			if ack != nil {
+				ack <- p
+			}
+		case packetPingresp:
+		default:
+			c.log(espgohome.LevelWarn, "mqtt: unexpected packet", "type", p.typ)
+		}
+	}
+}
+
+// keepAliveLoop pings the broker and closes the connection if nothing has
+// been received for one and a half keep alive periods
+func (c *Client) keepAliveLoop() {
+	interval := c.keepAlive()
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		idle := time.Since(c.received)
+		c.mu.Unlock()
+		if idle > interval*3/2 {
+			c.fail(errorKeepAlive)
+			c.conn.Close()
+			return
+		}
+		if idle >= interval/2 {
+			c.write(packet{typ: packetPingreq})
+		}
+	}
+}
+
+// fail records the first reason for the connection ending
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil && !c.closing {
+		c.err = err
+	}
+}
+
+func (c *Client) keepAlive() time.Duration {
+	if c.KeepAlive > 0 {
+		return c.KeepAlive
+	}
+	return DefaultKeepAlive
+}
+
+func (c *Client) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(c.Logger, c.Debug).Log(level, msg, keyvals...)
+}
@@ -0,0 +1,186 @@
+package mqtt
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"a/b", "a/b/c", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.match {
+			t.Errorf("Match(%q, %q) = %v", tt.filter, tt.topic, got)
+		}
+	}
+
+	for _, f := range []string{"a/#/b", "a/b#", "a+/b", ""} {
+		if ValidFilter(f) {
+			t.Errorf("accepted filter %q", f)
+		}
+	}
+	for _, topic := range []string{"a/+", "a/#", ""} {
+		if ValidTopic(topic) {
+			t.Errorf("accepted topic %q", topic)
+		}
+	}
+}
+
+func startBroker(t *testing.T, b *Broker) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go b.Serve(l)
+	t.Cleanup(func() { b.Close() })
+
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, address string, c *Client) *Client {
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return c
+}
+
+func receive(t *testing.T, c *Client) Message {
+	t.Helper()
+
+	select {
+	case m := <-c.Messages():
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+	}
+	return Message{}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := &Broker{}
+	address := startBroker(t, b)
+
+	pub := dial(t, address, &Client{ClientID: "pub"})
+	defer pub.Disconnect()
+	if err := pub.Publish(Message{Topic: "home/kitchen/state", Payload: []byte("retained"), Retain: true}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	sub := dial(t, address, &Client{ClientID: "sub"})
+	defer sub.Disconnect()
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- sub.Subscribe("home/+/state", "other/#") }()
+
+	// the retained message is delivered on subscribing
+	m := receive(t, sub)
+	if m.Topic != "home/kitchen/state" || string(m.Payload) != "retained" || !m.Retain {
+		t.Errorf("unexpected retained message %+v", m)
+	}
+	if err := <-subscribed; err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	pub.Publish(Message{Topic: "home/garage/state", Payload: []byte("live")})
+	pub.Publish(Message{Topic: "home/garage/other", Payload: []byte("ignored")})
+	pub.Publish(Message{Topic: "other/a/b", Payload: []byte("deep")})
+	if m := receive(t, sub); m.Topic != "home/garage/state" || string(m.Payload) != "live" || m.Retain {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if m := receive(t, sub); m.Topic != "other/a/b" {
+		t.Errorf("unexpected message %+v", m)
+	}
+
+	// an empty retained message clears the retained message
+	pub.Publish(Message{Topic: "home/kitchen/state", Retain: true})
+	receive(t, sub)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := b.Retained("home/kitchen/state"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("retained message not cleared")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := sub.Unsubscribe("other/#"); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	pub.Publish(Message{Topic: "other/x", Payload: []byte("ignored")})
+	b.Publish(Message{Topic: "home/broker/state", Payload: []byte("local")})
+	if m := receive(t, sub); m.Topic != "home/broker/state" {
+		t.Errorf("unexpected message %+v", m)
+	}
+}
+
+func TestWill(t *testing.T) {
+	b := &Broker{}
+	address := startBroker(t, b)
+
+	watcher := dial(t, address, &Client{ClientID: "watcher"})
+	defer watcher.Disconnect()
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- watcher.Subscribe("status/#") }()
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			t.Fatalf("subscribe failed: %v", err)
+		}
+	case m := <-watcher.Messages():
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	will := &Message{Topic: "status/clean", Payload: []byte("offline"), Retain: true}
+	clean := dial(t, address, &Client{ClientID: "clean", Will: will})
+	if err := clean.Disconnect(); err != nil {
+		t.Errorf("disconnect failed: %v", err)
+	}
+	if clean.Err() != nil {
+		t.Errorf("unexpected error after disconnect: %v", clean.Err())
+	}
+
+	will = &Message{Topic: "status/lost", Payload: []byte("offline"), Retain: true}
+	lost := dial(t, address, &Client{ClientID: "lost", Will: will})
+	lost.Close()
+	<-lost.Done()
+	if lost.Err() != ErrorClosed {
+		t.Errorf("expected ErrorClosed, got %v", lost.Err())
+	}
+
+	if m := receive(t, watcher); m.Topic != "status/lost" || string(m.Payload) != "offline" {
+		t.Errorf("unexpected will %+v", m)
+	}
+	if m, ok := b.Retained("status/lost"); !ok || string(m.Payload) != "offline" {
+		t.Error("will not retained")
+	}
+	if _, ok := b.Retained("status/clean"); ok {
+		t.Error("will published after a clean disconnect")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	address := startBroker(t, &Broker{Username: "bridge", Password: "secret"})
+
+	if err := (&Client{Username: "bridge", Password: "wrong"}).Dial(address); err != ErrorBadCredentials {
+		t.Errorf("expected ErrorBadCredentials, got %v", err)
+	}
+	c := dial(t, address, &Client{Username: "bridge", Password: "secret"})
+	c.Disconnect()
+}
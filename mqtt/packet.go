@@ -0,0 +1,210 @@
+// Package mqtt is a small MQTT 3.1.1 client and broker.
+//
+// Only what is needed to bridge devices to MQTT is implemented: messages are
+// published at QoS 0, subscriptions are granted at QoS 0, and retained
+// messages, wills and keep alives are supported. QoS 1 messages from other
+// clients are acknowledged and delivered at QoS 0. The Broker is meant for
+// tests and for embedding in small installations, it keeps no sessions.
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// Connect flags
+const (
+	flagUsername   = 0x80
+	flagPassword   = 0x40
+	flagWillRetain = 0x20
+	flagWill       = 0x04
+	flagClean      = 0x02
+)
+
+// protocolLevel is the protocol level of MQTT 3.1.1
+const protocolLevel = 4
+
+// maxPacket is the largest packet accepted, MQTT allows up to 256MB
+const maxPacket = 1 << 20
+
+// Errors returned when the broker refuses a connection
+var (
+	ErrorUnacceptableVersion = errors.New("mqtt: unacceptable protocol version")
+	ErrorIdentifierRejected  = errors.New("mqtt: client identifier rejected")
+	ErrorServerUnavailable   = errors.New("mqtt: server unavailable")
+	ErrorBadCredentials      = errors.New("mqtt: bad user name or password")
+	ErrorNotAuthorized       = errors.New("mqtt: not authorized")
+)
+
+// ErrorMalformedPacket is returned for packets that can't be decoded
+var ErrorMalformedPacket = errors.New("mqtt: malformed packet")
+
+// connackErrors maps CONNACK return codes to errors
+var connackErrors = map[byte]error{
+	1: ErrorUnacceptableVersion,
+	2: ErrorIdentifierRejected,
+	3: ErrorServerUnavailable,
+	4: ErrorBadCredentials,
+	5: ErrorNotAuthorized,
+}
+
+// Message is an application message
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Retain asks the broker to keep the message for future subscribers, it
+	// is set on received messages that were retained
+	Retain bool
+}
+
+// packet is a control packet without its fixed header
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads a control packet
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	size, shift := 0, uint(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		size |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return packet{}, ErrorMalformedPacket
+		}
+	}
+	if size > maxPacket {
+		return packet{}, fmt.Errorf("mqtt: packet of %d bytes is too large", size)
+	}
+
+	p := packet{typ: header >> 4, flags: header & 0x0f, body: make([]byte, size)}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return packet{}, err
+	}
+	return p, nil
+}
+
+// encode returns the packet with its fixed header
+func (p packet) encode() []byte {
+	b := make([]byte, 0, len(p.body)+5)
+	b = append(b, p.typ<<4|p.flags)
+	size := len(p.body)
+	for {
+		digit := byte(size & 0x7f)
+		size >>= 7
+		if size > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if size == 0 {
+			break
+		}
+	}
+	return append(b, p.body...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads the fields of a packet body, the first error sticks
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) < 1 {
+		d.err = ErrorMalformedPacket
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.b) < 2 {
+		d.err = ErrorMalformedPacket
+		return 0
+	}
+	v := uint16(d.b[0])<<8 | uint16(d.b[1])
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := int(d.uint16())
+	if d.err != nil || len(d.b) < n {
+		d.err = ErrorMalformedPacket
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// publishPacket encodes m as a QoS 0 PUBLISH
+func publishPacket(m Message) packet {
+	p := packet{typ: packetPublish}
+	if m.Retain {
+		p.flags = 0x01
+	}
+	p.body = append(appendString(nil, m.Topic), m.Payload...)
+	return p
+}
+
+// parsePublish decodes a PUBLISH, id is zero for QoS 0
+func parsePublish(p packet) (m Message, qos byte, id uint16, err error) {
+	d := &decoder{b: p.body}
+	m.Topic = d.string()
+	qos = (p.flags >> 1) & 0x03
+	if qos > 0 {
+		id = d.uint16()
+	}
+	if d.err != nil || qos > 2 || !ValidTopic(m.Topic) {
+		return Message{}, 0, 0, ErrorMalformedPacket
+	}
+	m.Payload = append([]byte(nil), d.b...)
+	m.Retain = p.flags&0x01 != 0
+	return m, qos, id, nil
+}
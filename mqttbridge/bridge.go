@@ -0,0 +1,333 @@
+// Package mqttbridge mirrors the devices of a manager.Manager to MQTT.
+//
+// Every entity is published to <prefix>/<device>/<domain>/<object_id>/state,
+// where domain is the entity type in Home Assistant's naming, for example
+// binary_sensor. Simple states are published as plain values such as ON or
+// 21.5, lights, covers, fans and climate devices as JSON objects. Messages
+// sent to the .../set topic next to a state topic are turned into commands.
+//
+// The bridge publishes "online" and "offline" to <prefix>/bridge/availability
+// and <prefix>/<device>/availability, retained, with the broker publishing
+// "offline" for the bridge if its connection is lost. With Discovery set, a
+// Home Assistant MQTT discovery config is published for every entity.
+package mqttbridge
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/mqtt"
+)
+
+// Defaults used when the Bridge fields are empty
+const (
+	DefaultPrefix          = "esphome"
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultClientID        = "espgohome"
+	DefaultRetryInterval   = 5 * time.Second
+)
+
+// Availability payloads
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// ErrorBridgeClosed is returned by Start after Close has been called
+var ErrorBridgeClosed = errors.New("mqttbridge: bridge closed")
+
+// Bridge publishes the devices of a Manager to an MQTT broker
+type Bridge struct {
+	Manager *manager.Manager
+	// Broker is the host:port of the MQTT broker
+	Broker string
+	// ClientID identifies the bridge to the broker, DefaultClientID if empty
+	ClientID string
+	Username string
+	Password string
+	// Prefix is the first level of every topic, DefaultPrefix if empty
+	Prefix string
+	// Discovery publishes Home Assistant discovery configs under
+	// DiscoveryPrefix, DefaultDiscoveryPrefix if empty
+	Discovery       bool
+	DiscoveryPrefix string
+	// RetryInterval is the delay between attempts to reconnect to the broker,
+	// DefaultRetryInterval if zero
+	RetryInterval time.Duration
+	// KeepAlive of the connection to the broker, mqtt.DefaultKeepAlive if zero
+	KeepAlive time.Duration
+	// Logger receives the diagnostic messages of the bridge
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu     sync.Mutex
+	events chan manager.Event
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// Start connects to the broker and starts mirroring the devices, it returns
+// an error if the first connection fails. The bridge reconnects to the broker
+// on its own until Close is called.
+func (b *Bridge) Start() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrorBridgeClosed
+	}
+	b.mu.Unlock()
+
+	c, err := b.connect()
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.events = make(chan manager.Event, 64)
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	b.mu.Unlock()
+
+	b.Manager.AddListener(b.events)
+	go b.run(c)
+
+	return nil
+}
+
+// Close publishes the bridge as offline and disconnects from the broker
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	stop := b.stop
+	b.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	b.Manager.RemoveListener(b.events)
+	close(stop)
+	<-b.done
+
+	return nil
+}
+
+// run handles the events of the Manager and reconnects to the broker
+func (b *Bridge) run(c *mqtt.Client) {
+	defer close(b.done)
+
+	var retry <-chan time.Time
+	for {
+		var lost <-chan struct{}
+		if c != nil {
+			lost = c.Done()
+		}
+
+		select {
+		case <-b.stop:
+			if c != nil {
+				c.Publish(mqtt.Message{Topic: b.topic("bridge", "availability"), Payload: []byte(Offline), Retain: true})
+				c.Disconnect()
+			}
+			return
+		case e := <-b.events:
+			if c != nil {
+				b.event(c, e)
+			}
+		case <-lost:
+			b.log(espgohome.LevelWarn, "mqttbridge: connection to the broker lost", "error", c.Err())
+			c = nil
+			retry = time.After(b.retryInterval())
+		case <-retry:
+			var err error
+			if c, err = b.connect(); err != nil {
+				b.log(espgohome.LevelWarn, "mqttbridge: connecting to the broker failed", "error", err)
+				retry = time.After(b.retryInterval())
+			}
+		}
+	}
+}
+
+// connect connects to the broker, subscribes to the command topics and
+// publishes every device
+func (b *Bridge) connect() (*mqtt.Client, error) {
+	c := &mqtt.Client{
+		ClientID:  b.clientID(),
+		Username:  b.Username,
+		Password:  b.Password,
+		KeepAlive: b.KeepAlive,
+		Will:      &mqtt.Message{Topic: b.topic("bridge", "availability"), Payload: []byte(Offline), Retain: true},
+		Logger:    b.Logger,
+		Debug:     b.Debug,
+	}
+	if err := c.Dial(b.Broker); err != nil {
+		return nil, err
+	}
+
+	// commands are handled on their own goroutine, so that Subscribe isn't
+	// blocked by a retained command
+	go func() {
+		for m := range c.Messages() {
+			b.command(m)
+		}
+	}()
+	if err := c.Subscribe(b.topic("+", "+", "+", "set")); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	b.publish(c, b.topic("bridge", "availability"), Online, true)
+	for _, d := range b.Manager.Devices() {
+		if d.Info() == nil {
+			continue
+		}
+		b.device(c, d)
+		if entities := d.Entities(); d.Connected() && entities != nil {
+			for _, st := range entities.Store().All() {
+				b.state(c, d.Name(), st)
+			}
+		}
+	}
+	b.log(espgohome.LevelInfo, "mqttbridge: connected to the broker", "broker", b.Broker)
+
+	return c, nil
+}
+
+// event publishes the change described by e
+func (b *Bridge) event(c *mqtt.Client, e manager.Event) {
+	switch e.Type {
+	case manager.Connected:
+		if d, err := b.Manager.Device(e.Device); err == nil {
+			b.device(c, d)
+		}
+	case manager.Disconnected:
+		b.publish(c, b.topic(topicLevel(e.Device), "availability"), Offline, true)
+	case manager.StateChanged:
+		b.state(c, e.Device, e.State)
+	}
+}
+
+// device publishes the availability and discovery configs of d
+func (b *Bridge) device(c *mqtt.Client, d *manager.Device) {
+	availability := Offline
+	if d.Connected() {
+		availability = Online
+	}
+	b.publish(c, b.topic(topicLevel(d.Name()), "availability"), availability, true)
+
+	entities := d.Entities()
+	if !b.Discovery || entities == nil {
+		return
+	}
+	for _, e := range entities.Store().Entities() {
+		topic, config := b.discovery(d, e)
+		if topic != "" {
+			b.publish(c, topic, string(config), true)
+		}
+	}
+}
+
+// state publishes the state of an entity
+func (b *Bridge) state(c *mqtt.Client, device string, st espgohome.EntityState) {
+	domain := Domain(st.Type)
+	if domain == "" {
+		return
+	}
+	payload, ok := statePayload(st)
+	if !ok {
+		return
+	}
+	b.publish(c, b.entityTopic(device, domain, st.Entity.GetObjectId(), "state"), payload, true)
+}
+
+func (b *Bridge) publish(c *mqtt.Client, topic, payload string, retain bool) {
+	if err := c.Publish(mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: retain}); err != nil {
+		b.log(espgohome.LevelDebug, "mqttbridge: publish failed", "topic", topic, "error", err)
+	}
+}
+
+// topic joins levels after the prefix
+func (b *Bridge) topic(levels ...string) string {
+	return b.prefix() + "/" + strings.Join(levels, "/")
+}
+
+// entityTopic returns the topic of an entity, last is "state" or "set"
+func (b *Bridge) entityTopic(device, domain, objectID, last string) string {
+	return b.topic(topicLevel(device), domain, topicLevel(objectID), last)
+}
+
+func (b *Bridge) prefix() string {
+	if b.Prefix == "" {
+		return DefaultPrefix
+	}
+	return b.Prefix
+}
+
+func (b *Bridge) discoveryPrefix() string {
+	if b.DiscoveryPrefix == "" {
+		return DefaultDiscoveryPrefix
+	}
+	return b.DiscoveryPrefix
+}
+
+func (b *Bridge) clientID() string {
+	if b.ClientID == "" {
+		return DefaultClientID
+	}
+	return b.ClientID
+}
+
+func (b *Bridge) retryInterval() time.Duration {
+	if b.RetryInterval > 0 {
+		return b.RetryInterval
+	}
+	return DefaultRetryInterval
+}
+
+func (b *Bridge) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(b.Logger, b.Debug).Log(level, msg, keyvals...)
+}
+
+// topicLevel replaces the characters that can't be used in a topic level
+func topicLevel(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Domain returns the Home Assistant name of an entity type, for example
+// binary_sensor, or "" for types the bridge doesn't publish
+func Domain(t espgohome.EntityID) string {
+	switch t {
+	case espgohome.BinarySensor:
+		return "binary_sensor"
+	case espgohome.Cover:
+		return "cover"
+	case espgohome.Fan:
+		return "fan"
+	case espgohome.Light:
+		return "light"
+	case espgohome.Sensor:
+		return "sensor"
+	case espgohome.Switch:
+		return "switch"
+	case espgohome.TextSensor:
+		return "text_sensor"
+	case espgohome.Climate:
+		return "climate"
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/mqtt"
+)
+
+// command handles a message sent to a .../set topic
+func (b *Bridge) command(m mqtt.Message) {
+	levels := strings.Split(strings.TrimPrefix(m.Topic, b.prefix()+"/"), "/")
+	if len(levels) != 4 || levels[3] != "set" {
+		return
+	}
+
+	d, e, err := b.find(levels[0], levels[1], levels[2])
+	if err == nil {
+		err = execute(d, e, strings.TrimSpace(string(m.Payload)))
+	}
+	if err != nil {
+		b.log(espgohome.LevelWarn, "mqttbridge: command failed", "topic", m.Topic, "payload", string(m.Payload), "error", err)
+		return
+	}
+	b.log(espgohome.LevelDebug, "mqttbridge: command", "topic", m.Topic, "payload", string(m.Payload))
+}
+
+// find returns the entity addressed by the levels of a command topic
+func (b *Bridge) find(device, domain, objectID string) (*manager.Device, entity.Entity, error) {
+	for _, d := range b.Manager.Devices() {
+		if topicLevel(d.Name()) != device {
+			continue
+		}
+		entities := d.Entities()
+		if entities == nil || !d.Connected() {
+			return nil, nil, fmt.Errorf("%s is not connected", device)
+		}
+		for _, e := range entities.Entities() {
+			if topicLevel(e.ObjectID()) == objectID && Domain(e.Type()) == domain {
+				return d, e, nil
+			}
+		}
+		return nil, nil, manager.ErrorUnknownEntity
+	}
+	return nil, nil, manager.ErrorUnknownDevice
+}
+
+// execute sends the command in payload to e
+func execute(d *manager.Device, e entity.Entity, payload string) error {
+	switch e := e.(type) {
+	case *entity.Switch:
+		switch strings.ToUpper(payload) {
+		case "ON":
+			return e.TurnOn()
+		case "OFF":
+			return e.TurnOff()
+		case "TOGGLE":
+			return e.Toggle()
+		}
+	case *entity.Light:
+		return lightCommand(e, payload)
+	case *entity.Cover:
+		return coverCommand(e, payload)
+	case *entity.Fan:
+		return fanCommand(d, e, payload)
+	case *entity.Climate:
+		return climateCommand(d, e, payload)
+	default:
+		return fmt.Errorf("%s entities don't accept commands", Domain(e.Type()))
+	}
+	return fmt.Errorf("invalid payload %q", payload)
+}
+
+// lightCommand handles ON, OFF or a JSON object in the form of lightJSON
+func lightCommand(l *entity.Light, payload string) error {
+	switch strings.ToUpper(payload) {
+	case "ON":
+		return l.TurnOn()
+	case "OFF":
+		return l.TurnOff()
+	}
+
+	var cmd lightJSON
+	if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+		return fmt.Errorf("invalid payload %q", payload)
+	}
+	var opts []entity.LightOption
+	if cmd.Brightness != nil {
+		opts = append(opts, entity.WithBrightness(float32(*cmd.Brightness/255)))
+	}
+	if cmd.Color != nil {
+		opts = append(opts, entity.WithRGB(float32(cmd.Color.R/255), float32(cmd.Color.G/255), float32(cmd.Color.B/255)))
+	}
+	if cmd.WhiteValue != nil {
+		opts = append(opts, entity.WithWhite(float32(*cmd.WhiteValue/255)))
+	}
+	if cmd.ColorTemp != nil {
+		opts = append(opts, entity.WithColorTemperature(float32(*cmd.ColorTemp)))
+	}
+	if cmd.Effect != "" {
+		opts = append(opts, entity.WithEffect(cmd.Effect))
+	}
+	if cmd.Transition != nil {
+		opts = append(opts, entity.WithTransition(time.Duration(*cmd.Transition*float64(time.Second))))
+	}
+
+	switch strings.ToUpper(cmd.State) {
+	case "ON":
+		return l.TurnOn(opts...)
+	case "OFF":
+		return l.TurnOff(opts...)
+	case "":
+		return l.Set(opts...)
+	}
+	return fmt.Errorf("invalid light state %q", cmd.State)
+}
+
+// coverCommand handles OPEN, CLOSE, STOP, a position in percent or a JSON
+// object with position and tilt
+func coverCommand(c *entity.Cover, payload string) error {
+	switch strings.ToUpper(payload) {
+	case "OPEN":
+		return c.Open()
+	case "CLOSE":
+		return c.Close()
+	case "STOP":
+		return c.Stop()
+	}
+	if position, err := strconv.ParseFloat(payload, 64); err == nil {
+		return c.SetPosition(float32(position / 100))
+	}
+
+	var cmd coverJSON
+	if err := json.Unmarshal([]byte(payload), &cmd); err != nil || (cmd.Position == nil && cmd.Tilt == nil) {
+		return fmt.Errorf("invalid payload %q", payload)
+	}
+	if cmd.Position != nil {
+		if err := c.SetPosition(float32(*cmd.Position / 100)); err != nil {
+			return err
+		}
+	}
+	if cmd.Tilt != nil {
+		return c.SetTilt(float32(*cmd.Tilt / 100))
+	}
+	return nil
+}
+
+// fanCommand handles ON, OFF, OSCILLATE_ON, OSCILLATE_OFF or a JSON object in
+// the form of fanJSON
+func fanCommand(d *manager.Device, f *entity.Fan, payload string) error {
+	var cmd fanJSON
+	switch strings.ToUpper(payload) {
+	case "ON", "OFF":
+		cmd.State = payload
+	case "OSCILLATE_ON", "OSCILLATE_OFF":
+		cmd.Oscillating = boolPtr(strings.ToUpper(payload) == "OSCILLATE_ON")
+	default:
+		if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+			return fmt.Errorf("invalid payload %q", payload)
+		}
+	}
+
+	req := &espgohome.FanCommandRequest{Key: f.Key()}
+	switch strings.ToUpper(cmd.State) {
+	case "ON", "OFF":
+		req.HasState, req.State = true, strings.ToUpper(cmd.State) == "ON"
+	case "":
+	default:
+		return fmt.Errorf("invalid fan state %q", cmd.State)
+	}
+	if cmd.Oscillating != nil {
+		req.HasOscillating, req.Oscillating = true, *cmd.Oscillating
+	}
+	if cmd.Speed != "" {
+		speed, ok := value.ParseEnum(espgohome.FanSpeed_name, value.FanSpeedPrefixes, cmd.Speed)
+		if !ok {
+			return fmt.Errorf("invalid fan speed %q", cmd.Speed)
+		}
+		req.HasSpeed, req.Speed = true, espgohome.FanSpeed(speed)
+	}
+	if cmd.Direction != "" {
+		direction, ok := value.ParseEnum(espgohome.FanDirection_name, value.FanDirectionPrefixes, cmd.Direction)
+		if !ok {
+			return fmt.Errorf("invalid fan direction %q", cmd.Direction)
+		}
+		req.HasDirection, req.Direction = true, espgohome.FanDirection(direction)
+	}
+
+	return send(d, func(c *espgohome.ESPHomeConnection) error { return c.FanCommand(req) })
+}
+
+// climateCommand handles a JSON object in the form of climateJSON
+func climateCommand(d *manager.Device, cl *entity.Climate, payload string) error {
+	var cmd climateJSON
+	if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+		return fmt.Errorf("invalid payload %q", payload)
+	}
+
+	req := &espgohome.ClimateCommandRequest{Key: cl.Key()}
+	if cmd.Mode != "" {
+		mode, ok := value.ParseEnum(espgohome.ClimateMode_name, value.ClimateModePrefixes, cmd.Mode)
+		if !ok {
+			return fmt.Errorf("invalid climate mode %q", cmd.Mode)
+		}
+		req.HasMode, req.Mode = true, espgohome.ClimateMode(mode)
+	}
+	if cmd.TargetTemperature != nil {
+		req.HasTargetTemperature, req.TargetTemperature = true, float32(*cmd.TargetTemperature)
+	}
+	if cmd.TargetTemperatureLow != nil {
+		req.HasTargetTemperatureLow, req.TargetTemperatureLow = true, float32(*cmd.TargetTemperatureLow)
+	}
+	if cmd.TargetTemperatureHigh != nil {
+		req.HasTargetTemperatureHigh, req.TargetTemperatureHigh = true, float32(*cmd.TargetTemperatureHigh)
+	}
+	if cmd.Away != nil {
+		req.HasAway, req.Away = true, *cmd.Away
+	}
+	if cmd.FanMode != "" {
+		mode, ok := value.ParseEnum(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes, cmd.FanMode)
+		if !ok {
+			return fmt.Errorf("invalid climate fan mode %q", cmd.FanMode)
+		}
+		req.HasFanMode, req.FanMode = true, espgohome.ClimateFanMode(mode)
+	}
+	if cmd.SwingMode != "" {
+		mode, ok := value.ParseEnum(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes, cmd.SwingMode)
+		if !ok {
+			return fmt.Errorf("invalid climate swing mode %q", cmd.SwingMode)
+		}
+		req.HasSwingMode, req.SwingMode = true, espgohome.ClimateSwingMode(mode)
+	}
+
+	return send(d, func(c *espgohome.ESPHomeConnection) error { return c.ClimateCommand(req) })
+}
+
+// send runs fn with the current connection of d
+func send(d *manager.Device, fn func(c *espgohome.ESPHomeConnection) error) error {
+	c := d.Conn()
+	if c == nil {
+		return fmt.Errorf("%s is not connected", d.Name())
+	}
+	return fn(c)
+}
@@ -0,0 +1,228 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// discovery returns the topic and payload of the Home Assistant discovery
+// config of an entity, the topic is empty for entities that aren't announced
+func (b *Bridge) discovery(d *manager.Device, e espgohome.Entity) (string, []byte) {
+	t := espgohome.GetEntityType(e)
+	domain := Domain(t)
+	if domain == "" {
+		return "", nil
+	}
+	component := domain
+	if t == espgohome.TextSensor {
+		component = "sensor"
+	}
+
+	device := d.Name()
+	state := b.entityTopic(device, domain, e.GetObjectId(), "state")
+	set := b.entityTopic(device, domain, e.GetObjectId(), "set")
+	config := map[string]interface{}{
+		"name":        e.GetName(),
+		"unique_id":   uniqueID(d, domain, e),
+		"state_topic": state,
+		"availability": []map[string]string{
+			{"topic": b.topic("bridge", "availability")},
+			{"topic": b.topic(topicLevel(device), "availability")},
+		},
+		"availability_mode": "all",
+	}
+	if info := d.Info(); info != nil {
+		dev := map[string]interface{}{
+			"name":         info.Name,
+			"model":        info.Model,
+			"manufacturer": "espressif",
+			"sw_version":   "esphome " + info.EsphomeVersion,
+		}
+		if info.MacAddress != "" {
+			dev["identifiers"] = []string{info.MacAddress}
+			dev["connections"] = [][]string{{"mac", strings.ToLower(info.MacAddress)}}
+		} else {
+			dev["identifiers"] = []string{info.Name}
+		}
+		config["device"] = dev
+	}
+
+	switch e := e.(type) {
+	case *espgohome.ListEntitiesBinarySensorResponse:
+		setString(config, "device_class", e.DeviceClass)
+	case *espgohome.ListEntitiesSensorResponse:
+		setString(config, "unit_of_measurement", e.UnitOfMeasurement)
+		setString(config, "icon", e.Icon)
+		config["state_class"] = "measurement"
+	case *espgohome.ListEntitiesTextSensorResponse:
+		setString(config, "icon", e.Icon)
+	case *espgohome.ListEntitiesSwitchResponse:
+		config["command_topic"] = set
+		setString(config, "icon", e.Icon)
+		if e.AssumedState {
+			config["optimistic"] = true
+		}
+	case *espgohome.ListEntitiesLightResponse:
+		config["schema"] = "json"
+		config["command_topic"] = set
+		config["brightness"] = e.SupportsBrightness
+		config["rgb"] = e.SupportsRgb
+		config["white_value"] = e.SupportsWhiteValue
+		config["color_temp"] = e.SupportsColorTemperature
+		if e.SupportsColorTemperature {
+			config["min_mireds"] = e.MinMireds
+			config["max_mireds"] = e.MaxMireds
+		}
+		if len(e.Effects) > 0 {
+			config["effect"] = true
+			config["effect_list"] = e.Effects
+		}
+	case *espgohome.ListEntitiesCoverResponse:
+		config["command_topic"] = set
+		config["value_template"] = "{{ value_json.state }}"
+		setString(config, "device_class", e.DeviceClass)
+		if e.SupportsPosition {
+			config["position_topic"] = state
+			config["position_template"] = "{{ value_json.position }}"
+			config["set_position_topic"] = set
+		}
+		if e.SupportsTilt {
+			config["tilt_status_topic"] = state
+			config["tilt_status_template"] = "{{ value_json.tilt }}"
+			config["tilt_command_topic"] = set
+			config["tilt_command_template"] = `{"tilt": {{ tilt_position }}}`
+		}
+	case *espgohome.ListEntitiesFanResponse:
+		config["command_topic"] = set
+		config["state_value_template"] = "{{ value_json.state }}"
+		if e.SupportsOscillation {
+			config["oscillation_state_topic"] = state
+			config["oscillation_value_template"] = "{{ 'oscillate_on' if value_json.oscillating else 'oscillate_off' }}"
+			config["oscillation_command_topic"] = set
+		}
+		if e.SupportsSpeed {
+			config["preset_modes"] = enumStrings(espgohome.FanSpeed_name, value.FanSpeedPrefixes, nil)
+			config["preset_mode_state_topic"] = state
+			config["preset_mode_value_template"] = "{{ value_json.speed }}"
+			config["preset_mode_command_topic"] = set
+			config["preset_mode_command_template"] = `{"speed": "{{ value }}"}`
+		}
+	case *espgohome.ListEntitiesClimateResponse:
+		delete(config, "state_topic")
+		var modes []int32
+		for _, m := range e.SupportedModes {
+			modes = append(modes, int32(m))
+		}
+		config["modes"] = enumStrings(espgohome.ClimateMode_name, value.ClimateModePrefixes, modes)
+		config["mode_state_topic"] = state
+		config["mode_state_template"] = "{{ value_json.mode }}"
+		config["mode_command_topic"] = set
+		config["mode_command_template"] = `{"mode": "{{ value }}"}`
+		if e.SupportsCurrentTemperature {
+			config["current_temperature_topic"] = state
+			config["current_temperature_template"] = "{{ value_json.current_temperature }}"
+		}
+		if e.SupportsTwoPointTargetTemperature {
+			for _, bound := range []string{"low", "high"} {
+				config["temperature_"+bound+"_state_topic"] = state
+				config["temperature_"+bound+"_state_template"] = "{{ value_json.target_temperature_" + bound + " }}"
+				config["temperature_"+bound+"_command_topic"] = set
+				config["temperature_"+bound+"_command_template"] = `{"target_temperature_` + bound + `": {{ value }}}`
+			}
+		} else {
+			config["temperature_state_topic"] = state
+			config["temperature_state_template"] = "{{ value_json.target_temperature }}"
+			config["temperature_command_topic"] = set
+			config["temperature_command_template"] = `{"target_temperature": {{ value }}}`
+		}
+		if e.VisualMaxTemperature > e.VisualMinTemperature {
+			config["min_temp"] = e.VisualMinTemperature
+			config["max_temp"] = e.VisualMaxTemperature
+		}
+		if e.VisualTemperatureStep > 0 {
+			config["temp_step"] = e.VisualTemperatureStep
+		}
+		if e.SupportsAction {
+			config["action_topic"] = state
+			config["action_template"] = "{{ value_json.action }}"
+		}
+		if len(e.SupportedFanModes) > 0 {
+			var fanModes []int32
+			for _, m := range e.SupportedFanModes {
+				fanModes = append(fanModes, int32(m))
+			}
+			config["fan_modes"] = enumStrings(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes, fanModes)
+			config["fan_mode_state_topic"] = state
+			config["fan_mode_state_template"] = "{{ value_json.fan_mode }}"
+			config["fan_mode_command_topic"] = set
+			config["fan_mode_command_template"] = `{"fan_mode": "{{ value }}"}`
+		}
+		if len(e.SupportedSwingModes) > 0 {
+			var swingModes []int32
+			for _, m := range e.SupportedSwingModes {
+				swingModes = append(swingModes, int32(m))
+			}
+			config["swing_modes"] = enumStrings(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes, swingModes)
+			config["swing_mode_state_topic"] = state
+			config["swing_mode_state_template"] = "{{ value_json.swing_mode }}"
+			config["swing_mode_command_topic"] = set
+			config["swing_mode_command_template"] = `{"swing_mode": "{{ value }}"}`
+		}
+	}
+
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return "", nil
+	}
+	topic := strings.Join([]string{b.discoveryPrefix(), component, discoveryID(device), discoveryID(e.GetObjectId()), "config"}, "/")
+	return topic, payload
+}
+
+// uniqueID returns the unique id of an entity, made from the MAC address if
+// the device doesn't give one
+func uniqueID(d *manager.Device, domain string, e espgohome.Entity) string {
+	if u, ok := e.(interface{ GetUniqueId() string }); ok && u.GetUniqueId() != "" {
+		return u.GetUniqueId()
+	}
+	id := d.MAC()
+	if id == "" {
+		id = d.Name()
+	}
+	return discoveryID(id) + "-" + domain + "-" + e.GetObjectId()
+}
+
+// discoveryID restricts s to the characters allowed in the node and object
+// ids of a discovery topic
+func discoveryID(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// enumStrings returns the names of values, or of every value if values is nil,
+// in the order of the enum
+func enumStrings(names map[int32]string, prefixes []string, values []int32) []string {
+	if values == nil {
+		for v := int32(0); int(v) < len(names); v++ {
+			values = append(values, v)
+		}
+	}
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = value.EnumString(names, prefixes, v)
+	}
+	return s
+}
+
+func setString(config map[string]interface{}, key, value string) {
+	if value != "" {
+		config[key] = value
+	}
+}
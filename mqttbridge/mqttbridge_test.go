@@ -0,0 +1,218 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/mqtt"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// newDevice returns a device whose commands are sent to the returned channel
+func newDevice() (*server.Server, chan proto.Message) {
+	s := &server.Server{
+		Info: &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01", EsphomeVersion: "1.15.0"},
+	}
+	commands := espgohometest.Commands(s)
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature", UnitOfMeasurement: "°C", AccuracyDecimals: 1})
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesLightResponse{ObjectId: "lamp", Key: 3, Name: "Lamp", SupportsBrightness: true})
+	s.AddEntity(&espgohome.ListEntitiesCoverResponse{ObjectId: "blind", Key: 4, Name: "Blind", SupportsPosition: true})
+	s.AddEntity(&espgohome.ListEntitiesFanResponse{ObjectId: "fan", Key: 5, Name: "Fan", SupportsSpeed: true})
+	s.AddEntity(&espgohome.ListEntitiesClimateResponse{
+		ObjectId:                   "thermostat",
+		Key:                        6,
+		Name:                       "Thermostat",
+		SupportsCurrentTemperature: true,
+		SupportedModes:             []espgohome.ClimateMode{espgohome.ClimateMode_CLIMATE_MODE_OFF, espgohome.ClimateMode_CLIMATE_MODE_FAN_ONLY},
+	})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.34})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: true})
+	s.SetState(&espgohome.LightStateResponse{Key: 3, State: true, Brightness: 0.5})
+	s.SetState(&espgohome.CoverStateResponse{Key: 4, Position: 0.25, CurrentOperation: espgohome.CoverOperation_COVER_OPERATION_IS_OPENING})
+	s.SetState(&espgohome.FanStateResponse{Key: 5, State: true, Speed: espgohome.FanSpeed_FAN_SPEED_MEDIUM})
+	s.SetState(&espgohome.ClimateStateResponse{Key: 6, Mode: espgohome.ClimateMode_CLIMATE_MODE_FAN_ONLY, CurrentTemperature: 19.5, TargetTemperature: 21})
+
+	return s, commands
+}
+
+// watcher records the last message of every topic
+type watcher struct {
+	client *mqtt.Client
+
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func watch(t *testing.T, broker string) *watcher {
+	w := &watcher{client: &mqtt.Client{ClientID: "watcher"}, messages: make(map[string]string)}
+	if err := w.client.Dial(broker); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	go func() {
+		for m := range w.client.Messages() {
+			w.mu.Lock()
+			w.messages[m.Topic] = string(m.Payload)
+			w.mu.Unlock()
+		}
+	}()
+	if err := w.client.Subscribe("esphome/#"); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { w.client.Disconnect() })
+
+	return w
+}
+
+// wait waits for payload to be published to topic
+func (w *watcher) wait(t *testing.T, topic, payload string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w.mu.Lock()
+		got, ok := w.messages[topic]
+		w.mu.Unlock()
+		if ok && got == payload {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: got %q (%v), want %q", topic, got, ok, payload)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (w *watcher) publish(t *testing.T, topic, payload string) {
+	if err := w.client.Publish(mqtt.Message{Topic: topic, Payload: []byte(payload)}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	s, commands := newDevice()
+
+	broker := &mqtt.Broker{}
+	l := espgohometest.Listen(t)
+	go broker.Serve(l)
+	defer broker.Close()
+
+	m := manager.New("test-client")
+	defer m.Close()
+	b := &Bridge{Manager: m, Broker: l.Addr().String(), Discovery: true}
+	if err := b.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	w := watch(t, l.Addr().String())
+	w.wait(t, "esphome/bridge/availability", Online)
+
+	espgohometest.Connect(t, m, s)
+	w.wait(t, "esphome/kitchen/availability", Online)
+	w.wait(t, "esphome/kitchen/sensor/temperature/state", "21.3")
+	w.wait(t, "esphome/kitchen/switch/relay/state", "ON")
+	w.wait(t, "esphome/kitchen/light/lamp/state", `{"state":"ON","brightness":128}`)
+	w.wait(t, "esphome/kitchen/cover/blind/state", `{"state":"opening","position":25}`)
+	w.wait(t, "esphome/kitchen/fan/fan/state", `{"state":"ON","speed":"medium"}`)
+	w.wait(t, "esphome/kitchen/climate/thermostat/state", `{"mode":"fan_only","current_temperature":19.5,"target_temperature":21}`)
+
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+	w.wait(t, "esphome/kitchen/switch/relay/state", "OFF")
+
+	w.publish(t, "esphome/kitchen/switch/relay/set", "ON")
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 2 || !c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+	w.publish(t, "esphome/kitchen/light/lamp/set", `{"state":"ON","brightness":51,"transition":2}`)
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.LightCommandRequest); !ok || !c.State || !c.HasBrightness || c.Brightness != 0.2 || c.TransitionLength != 2000 {
+		t.Errorf("unexpected light command %v", c)
+	}
+	w.publish(t, "esphome/kitchen/cover/blind/set", "75")
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.CoverCommandRequest); !ok || !c.HasPosition || c.Position != 0.75 {
+		t.Errorf("unexpected cover command %v", c)
+	}
+	w.publish(t, "esphome/kitchen/fan/fan/set", `{"state":"ON","speed":"high"}`)
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.FanCommandRequest); !ok || !c.HasState || !c.State || !c.HasSpeed || c.Speed != espgohome.FanSpeed_FAN_SPEED_HIGH {
+		t.Errorf("unexpected fan command %v", c)
+	}
+	w.publish(t, "esphome/kitchen/climate/thermostat/set", `{"mode":"off","target_temperature":22.5}`)
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.ClimateCommandRequest); !ok || !c.HasMode || c.Mode != espgohome.ClimateMode_CLIMATE_MODE_OFF || c.TargetTemperature != 22.5 {
+		t.Errorf("unexpected climate command %v", c)
+	}
+
+	// invalid commands are ignored
+	w.publish(t, "esphome/kitchen/switch/relay/set", "MAYBE")
+	w.publish(t, "esphome/kitchen/sensor/temperature/set", "1")
+	w.publish(t, "esphome/attic/switch/relay/set", "ON")
+	w.publish(t, "esphome/kitchen/switch/relay/set", "OFF")
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+
+	config, ok := broker.Retained("homeassistant/switch/kitchen/relay/config")
+	if !ok {
+		t.Fatal("no discovery config for the switch")
+	}
+	var sw map[string]interface{}
+	if err := json.Unmarshal(config.Payload, &sw); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if sw["command_topic"] != "esphome/kitchen/switch/relay/set" || sw["unique_id"] != "AA_AA_AA_AA_AA_01-switch-relay" {
+		t.Errorf("unexpected switch config %v", sw)
+	}
+	if _, ok := broker.Retained("homeassistant/climate/kitchen/thermostat/config"); !ok {
+		t.Error("no discovery config for the climate device")
+	}
+
+	s.Close()
+	w.wait(t, "esphome/kitchen/availability", Offline)
+
+	b.Close()
+	w.wait(t, "esphome/bridge/availability", Offline)
+}
+
+func TestBrokerLost(t *testing.T) {
+	broker := &mqtt.Broker{}
+	l := espgohometest.Listen(t)
+	address := l.Addr().String()
+	go broker.Serve(l)
+
+	m := manager.New("test-client")
+	defer m.Close()
+	b := &Bridge{Manager: m, Broker: address, RetryInterval: 10 * time.Millisecond}
+	if err := b.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer b.Close()
+
+	// a new broker on the same address gets the availability again
+	broker.Close()
+	broker = &mqtt.Broker{}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("can't listen on %s again: %v", address, err)
+	}
+	go broker.Serve(l)
+	defer broker.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if m, ok := broker.Retained("esphome/bridge/availability"); ok && string(m.Payload) == Online {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the bridge didn't reconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := (&Bridge{Manager: m, Broker: "127.0.0.1:1"}).Start(); err == nil {
+		t.Error("started without a broker")
+	}
+}
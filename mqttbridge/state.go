@@ -0,0 +1,223 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// lightJSON is the state of a light and the JSON form of a light command,
+// brightness and colours are 0 - 255 as in Home Assistant's JSON schema
+type lightJSON struct {
+	State      string     `json:"state,omitempty"`
+	Brightness *float64   `json:"brightness,omitempty"`
+	Color      *colorJSON `json:"color,omitempty"`
+	WhiteValue *float64   `json:"white_value,omitempty"`
+	ColorTemp  *float64   `json:"color_temp,omitempty"`
+	Effect     string     `json:"effect,omitempty"`
+	// Transition is in seconds, only used in commands
+	Transition *float64 `json:"transition,omitempty"`
+}
+
+type colorJSON struct {
+	R float64 `json:"r"`
+	G float64 `json:"g"`
+	B float64 `json:"b"`
+}
+
+// coverJSON is the state of a cover and the JSON form of a cover command,
+// position and tilt are percentages
+type coverJSON struct {
+	State    string   `json:"state,omitempty"`
+	Position *float64 `json:"position,omitempty"`
+	Tilt     *float64 `json:"tilt,omitempty"`
+}
+
+// fanJSON is the state of a fan and the JSON form of a fan command
+type fanJSON struct {
+	State       string `json:"state,omitempty"`
+	Oscillating *bool  `json:"oscillating,omitempty"`
+	Speed       string `json:"speed,omitempty"`
+	Direction   string `json:"direction,omitempty"`
+}
+
+// climateJSON is the state of a climate device and the JSON form of a
+// climate command
+type climateJSON struct {
+	Mode                  string   `json:"mode,omitempty"`
+	Action                string   `json:"action,omitempty"`
+	CurrentTemperature    *float64 `json:"current_temperature,omitempty"`
+	TargetTemperature     *float64 `json:"target_temperature,omitempty"`
+	TargetTemperatureLow  *float64 `json:"target_temperature_low,omitempty"`
+	TargetTemperatureHigh *float64 `json:"target_temperature_high,omitempty"`
+	Away                  *bool    `json:"away,omitempty"`
+	FanMode               string   `json:"fan_mode,omitempty"`
+	SwingMode             string   `json:"swing_mode,omitempty"`
+}
+
+// onOff returns the payload Home Assistant uses for on and off
+func onOff(on bool) string {
+	return strings.ToUpper(value.OnOff(on))
+}
+
+// number converts the float32 values of the API without adding digits
+func number(v float32) *float64 {
+	f := value.Float32(v)
+	return &f
+}
+
+// scale converts a 0.0 - 1.0 value to 0 - max, rounded
+func scale(v float32, max float64) *float64 {
+	f := math.Round(float64(v) * max)
+	return &f
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// statePayload returns the payload published for the state of an entity, or
+// false if there is nothing to publish
+func statePayload(st espgohome.EntityState) (string, bool) {
+	if st.State == nil || st.Missing {
+		return "", false
+	}
+
+	var v interface{}
+	switch s := st.State.(type) {
+	case *espgohome.BinarySensorStateResponse:
+		return onOff(s.State), true
+	case *espgohome.SwitchStateResponse:
+		return onOff(s.State), true
+	case *espgohome.TextSensorStateResponse:
+		return s.State, true
+	case *espgohome.SensorStateResponse:
+		if math.IsNaN(float64(s.State)) {
+			return "", false
+		}
+		decimals := -1
+		if e, ok := st.Entity.(*espgohome.ListEntitiesSensorResponse); ok {
+			decimals = int(e.AccuracyDecimals)
+		}
+		return strconv.FormatFloat(float64(s.State), 'f', decimals, 32), true
+	case *espgohome.LightStateResponse:
+		v = lightState(st.Entity, s)
+	case *espgohome.CoverStateResponse:
+		v = coverState(st.Entity, s)
+	case *espgohome.FanStateResponse:
+		v = fanState(st.Entity, s)
+	case *espgohome.ClimateStateResponse:
+		v = climateState(st.Entity, s)
+	default:
+		return "", false
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func lightState(e espgohome.Entity, s *espgohome.LightStateResponse) lightJSON {
+	l := lightJSON{State: onOff(s.State), Effect: s.Effect}
+	info, _ := e.(*espgohome.ListEntitiesLightResponse)
+	if info == nil {
+		info = &espgohome.ListEntitiesLightResponse{}
+	}
+	if info.SupportsBrightness {
+		l.Brightness = scale(s.Brightness, 255)
+	}
+	if info.SupportsRgb {
+		l.Color = &colorJSON{R: *scale(s.Red, 255), G: *scale(s.Green, 255), B: *scale(s.Blue, 255)}
+	}
+	if info.SupportsWhiteValue {
+		l.WhiteValue = scale(s.White, 255)
+	}
+	if info.SupportsColorTemperature {
+		l.ColorTemp = number(s.ColorTemperature)
+	}
+	return l
+}
+
+func coverState(e espgohome.Entity, s *espgohome.CoverStateResponse) coverJSON {
+	info, _ := e.(*espgohome.ListEntitiesCoverResponse)
+	if info == nil {
+		info = &espgohome.ListEntitiesCoverResponse{}
+	}
+
+	var c coverJSON
+	switch {
+	case s.CurrentOperation == espgohome.CoverOperation_COVER_OPERATION_IS_OPENING:
+		c.State = "opening"
+	case s.CurrentOperation == espgohome.CoverOperation_COVER_OPERATION_IS_CLOSING:
+		c.State = "closing"
+	case !info.SupportsPosition && s.LegacyState == espgohome.LegacyCoverState_LEGACY_COVER_STATE_CLOSED:
+		c.State = "closed"
+	case info.SupportsPosition && s.Position == 0:
+		c.State = "closed"
+	default:
+		c.State = "open"
+	}
+	if info.SupportsPosition {
+		c.Position = scale(s.Position, 100)
+	}
+	if info.SupportsTilt {
+		c.Tilt = scale(s.Tilt, 100)
+	}
+	return c
+}
+
+func fanState(e espgohome.Entity, s *espgohome.FanStateResponse) fanJSON {
+	info, _ := e.(*espgohome.ListEntitiesFanResponse)
+	if info == nil {
+		info = &espgohome.ListEntitiesFanResponse{}
+	}
+
+	f := fanJSON{State: onOff(s.State)}
+	if info.SupportsOscillation {
+		f.Oscillating = boolPtr(s.Oscillating)
+	}
+	if info.SupportsSpeed {
+		f.Speed = value.EnumString(espgohome.FanSpeed_name, value.FanSpeedPrefixes, int32(s.Speed))
+	}
+	if info.SupportsDirection {
+		f.Direction = value.EnumString(espgohome.FanDirection_name, value.FanDirectionPrefixes, int32(s.Direction))
+	}
+	return f
+}
+
+func climateState(e espgohome.Entity, s *espgohome.ClimateStateResponse) climateJSON {
+	info, _ := e.(*espgohome.ListEntitiesClimateResponse)
+	if info == nil {
+		info = &espgohome.ListEntitiesClimateResponse{}
+	}
+
+	c := climateJSON{Mode: value.EnumString(espgohome.ClimateMode_name, value.ClimateModePrefixes, int32(s.Mode))}
+	if info.SupportsAction {
+		c.Action = value.EnumString(espgohome.ClimateAction_name, value.ClimateActionPrefixes, int32(s.Action))
+	}
+	if info.SupportsCurrentTemperature {
+		c.CurrentTemperature = number(s.CurrentTemperature)
+	}
+	if info.SupportsTwoPointTargetTemperature {
+		c.TargetTemperatureLow = number(s.TargetTemperatureLow)
+		c.TargetTemperatureHigh = number(s.TargetTemperatureHigh)
+	} else {
+		c.TargetTemperature = number(s.TargetTemperature)
+	}
+	if info.SupportsAway {
+		c.Away = boolPtr(s.Away)
+	}
+	if len(info.SupportedFanModes) > 0 {
+		c.FanMode = value.EnumString(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes, int32(s.FanMode))
+	}
+	if len(info.SupportedSwingModes) > 0 {
+		c.SwingMode = value.EnumString(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes, int32(s.SwingMode))
+	}
+	return c
+}
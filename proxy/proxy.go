@@ -0,0 +1,398 @@
+// Package proxy shares the native API connection to a device between many
+// API clients.
+//
+// ESPHome devices only accept a few API clients at a time. A Proxy serves a
+// device of a manager.Manager, which holds the single connection to it, as a
+// native API server: DeviceInfo and ListEntities are answered from the
+// Manager's cache, states and logs are fanned out to the clients that
+// subscribed and commands are forwarded to the device. Each client, named by
+// the client info of its HelloRequest, can be given its own password.
+//
+// The clients are disconnected when the connection to the device is lost,
+// as they would be by the device itself, and new clients are refused until it
+// is back.
+package proxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// ServerInfo is reported to clients in the HelloResponse
+const ServerInfo = "espgohome proxy"
+
+// DefaultCameraTimeout is the default of Proxy.CameraTimeout
+const DefaultCameraTimeout = 10 * time.Second
+
+// ErrorProxyClosed is returned by Serve after Close has been called
+var ErrorProxyClosed = errors.New("proxy: closed")
+
+// Proxy serves a device of a Manager to native API clients
+type Proxy struct {
+	Manager *manager.Manager
+	// Device is the name or MAC address of the device
+	Device string
+	// Clients maps the client info of the HelloRequest of each client to its
+	// password, a nil map accepts any client
+	Clients map[string]string
+	// LogLevel is the level of the log subscription to the device, the logs
+	// aren't subscribed to if it is LOG_LEVEL_NONE
+	LogLevel espgohome.LogLevel
+	// CameraTimeout limits the wait for an image from the device, it
+	// defaults to DefaultCameraTimeout
+	CameraTimeout time.Duration
+	// Logger receives the diagnostic messages of the proxy
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu        sync.Mutex
+	srv       *server.Server
+	listeners map[net.Listener]bool
+	// cameras holds the camera requests sent to the device and not answered
+	// yet, the clients asking for the same are answered with their image
+	cameras map[cameraRequest]bool
+	events  chan manager.Event
+	stop    chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+// Serve accepts clients on l until l fails or the Proxy is closed
+func (p *Proxy) Serve(l net.Listener) error {
+	if err := p.start(); err != nil {
+		l.Close()
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return ErrorProxyClosed
+	}
+	p.listeners[l] = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, l)
+		p.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if p.isClosed() {
+				return ErrorProxyClosed
+			}
+			return err
+		}
+
+		srv := p.server()
+		if srv == nil {
+			p.log(espgohome.LevelDebug, "proxy: device not connected, client refused", "device", p.Device, "client", nc.RemoteAddr().String())
+			nc.Close()
+			continue
+		}
+		go srv.ServeConn(nc)
+	}
+}
+
+// Close stops the listeners and disconnects the clients
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	started := p.events != nil
+	listeners := p.listeners
+	p.listeners = nil
+	srv := p.srv
+	p.srv = nil
+	p.mu.Unlock()
+
+	for l := range listeners {
+		l.Close()
+	}
+	if started {
+		p.Manager.RemoveListener(p.events)
+		close(p.stop)
+		<-p.done
+	}
+	if srv != nil {
+		srv.Close()
+	}
+
+	return nil
+}
+
+// start listens to the events of the Manager on the first call to Serve
+func (p *Proxy) start() error {
+	if _, err := p.Manager.Device(p.Device); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrorProxyClosed
+	}
+	if p.events != nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.listeners = make(map[net.Listener]bool)
+	p.events = make(chan manager.Event, 64)
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	p.mu.Unlock()
+
+	// the listener is added first so that no state change is missed between
+	// the copy of the states and the events
+	p.Manager.AddListener(p.events)
+	p.connected()
+	go p.run()
+
+	return nil
+}
+
+func (p *Proxy) run() {
+	defer close(p.done)
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case e := <-p.events:
+			d, err := p.Manager.Device(p.Device)
+			if err != nil || e.Device != d.Name() {
+				continue
+			}
+			switch e.Type {
+			case manager.Connected:
+				p.connected()
+			case manager.Disconnected:
+				p.disconnected()
+			case manager.StateChanged:
+				if srv := p.server(); srv != nil && e.State.State != nil {
+					srv.SetState(e.State.State)
+				}
+			}
+		}
+	}
+}
+
+// connected replaces the server with one for the current connection to the
+// device
+func (p *Proxy) connected() {
+	d, err := p.Manager.Device(p.Device)
+	if err != nil {
+		return
+	}
+	c := d.Conn()
+	entities := d.Entities()
+	if c == nil || entities == nil {
+		return
+	}
+
+	srv := &server.Server{
+		ServerInfo:       ServerInfo,
+		Info:             d.Info(),
+		Authenticate:     p.authenticate,
+		Logger:           p.Logger,
+		Debug:            p.Debug,
+		OnSwitchCommand:  func(m *espgohome.SwitchCommandRequest) { p.forward(c, m) },
+		OnLightCommand:   func(m *espgohome.LightCommandRequest) { p.forward(c, m) },
+		OnCoverCommand:   func(m *espgohome.CoverCommandRequest) { p.forward(c, m) },
+		OnFanCommand:     func(m *espgohome.FanCommandRequest) { p.forward(c, m) },
+		OnClimateCommand: func(m *espgohome.ClimateCommandRequest) { p.forward(c, m) },
+		OnExecuteService: func(m *espgohome.ExecuteServiceRequest) { p.forward(c, m) },
+	}
+	srv.OnCameraImage = func(m *espgohome.CameraImageRequest) { go p.cameraImage(srv, c, m) }
+	for _, e := range entities.Store().Entities() {
+		srv.AddEntity(e)
+	}
+	for _, svc := range entities.Services() {
+		m := &espgohome.ListEntitiesServicesResponse{Name: svc.Name, Key: svc.Key}
+		for _, a := range svc.Args {
+			m.Args = append(m.Args, &espgohome.ListEntitiesServicesArgument{Name: a.Name, Type: a.Type})
+		}
+		srv.AddService(m)
+	}
+	for _, st := range entities.Store().All() {
+		if st.State != nil {
+			srv.SetState(st.State)
+		}
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	old := p.srv
+	p.srv = srv
+	p.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	p.log(espgohome.LevelInfo, "proxy: serving device", "device", d.Name(), "entities", len(entities.Store().Entities()))
+	if p.LogLevel != espgohome.LogLevel_LOG_LEVEL_NONE {
+		go p.relayLogs(srv, c)
+	}
+}
+
+// disconnected disconnects the clients of the lost connection
+func (p *Proxy) disconnected() {
+	p.mu.Lock()
+	srv := p.srv
+	p.srv = nil
+	p.mu.Unlock()
+
+	if srv != nil {
+		p.log(espgohome.LevelInfo, "proxy: device disconnected, closing the clients", "device", p.Device)
+		srv.Close()
+	}
+}
+
+// server returns the server of the current connection, or nil if the device
+// isn't connected
+func (p *Proxy) server() *server.Server {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.srv
+}
+
+// authenticate checks the password of a client against Clients
+func (p *Proxy) authenticate(clientInfo, password string) bool {
+	if p.Clients == nil {
+		return true
+	}
+	pw, ok := p.Clients[clientInfo]
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(pw)) != 1 {
+		p.log(espgohome.LevelWarn, "proxy: client refused, invalid password", "device", p.Device, "client", clientInfo)
+		return false
+	}
+	p.log(espgohome.LevelDebug, "proxy: client authenticated", "device", p.Device, "client", clientInfo)
+	return true
+}
+
+// forward sends a command from a client to the device
+func (p *Proxy) forward(c *espgohome.ESPHomeConnection, m proto.Message) {
+	if err := c.Send(m); err != nil {
+		p.log(espgohome.LevelWarn, "proxy: command not forwarded", "device", p.Device, "error", err)
+		return
+	}
+	p.log(espgohome.LevelDebug, "proxy: command", "device", p.Device, "request", m)
+}
+
+// relayLogs sends the logs of the device to the clients of srv until the
+// connection closes or the Proxy is closed
+func (p *Proxy) relayLogs(srv *server.Server, c *espgohome.ESPHomeConnection) {
+	messages, err := c.SubscribeLogsWith(&espgohome.SubscribeLogsRequest{Level: p.LogLevel})
+	defer c.RemoveReceiver(messages)
+	if err != nil {
+		p.log(espgohome.LevelWarn, "proxy: log subscription failed", "device", p.Device, "error", err)
+		return
+	}
+
+	for {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			r := m.(*espgohome.SubscribeLogsResponse)
+			srv.Log(r.Level, r.Tag, r.Message)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// cameraRequest is a camera request sent on a connection to the device
+type cameraRequest struct {
+	conn   *espgohome.ESPHomeConnection
+	single bool
+	stream bool
+}
+
+// cameraImage requests an image from the device and sends it to the clients
+// of srv waiting for one, unless the same request is already in flight
+func (p *Proxy) cameraImage(srv *server.Server, c *espgohome.ESPHomeConnection, req *espgohome.CameraImageRequest) {
+	key := cameraRequest{c, req.Single, req.Stream}
+	p.mu.Lock()
+	if p.cameras[key] {
+		p.mu.Unlock()
+		p.log(espgohome.LevelDebug, "proxy: camera request already in flight", "device", p.Device)
+		return
+	}
+	if p.cameras == nil {
+		p.cameras = make(map[cameraRequest]bool)
+	}
+	p.cameras[key] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.cameras, key)
+		p.mu.Unlock()
+	}()
+
+	chunks, err := c.CameraImageWith(req)
+	defer c.RemoveReceiver(chunks)
+	if err != nil {
+		p.log(espgohome.LevelWarn, "proxy: camera request not forwarded", "device", p.Device, "error", err)
+		return
+	}
+
+	timeout := p.CameraTimeout
+	if timeout == 0 {
+		timeout = DefaultCameraTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var image []byte
+	for {
+		select {
+		case m, ok := <-chunks:
+			if !ok {
+				return
+			}
+			chunk := m.(*espgohome.CameraImageResponse)
+			image = append(image, chunk.Data...)
+			if chunk.Done {
+				srv.SendCameraImage(chunk.Key, image)
+				return
+			}
+		case <-timer.C:
+			p.log(espgohome.LevelWarn, "proxy: camera image timed out", "device", p.Device)
+			return
+		}
+	}
+}
+
+func (p *Proxy) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+func (p *Proxy) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(p.Logger, p.Debug).Log(level, msg, keyvals...)
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"google.golang.org/protobuf/proto"
+)
+
+// start connects a Manager to a fake device and returns the address of a
+// Proxy for it
+func start(t *testing.T) (*server.Server, string, chan proto.Message) {
+	s := &server.Server{
+		Password: "device password",
+		Info:     &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01"},
+	}
+	commands := espgohometest.Commands(s)
+	// the image takes a while so that requests can overlap
+	s.OnCameraImage = func(m *espgohome.CameraImageRequest) {
+		commands <- m
+		time.AfterFunc(50*time.Millisecond, func() { s.SendCameraImage(4, make([]byte, 3000)) })
+	}
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"})
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesCameraResponse{ObjectId: "door", Key: 4, Name: "Door"})
+	s.AddService(&espgohome.ListEntitiesServicesResponse{Name: "beep", Key: 10})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 21.5})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: true})
+
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	espgohometest.Connect(t, m, s)
+
+	p := &Proxy{
+		Manager:  m,
+		Device:   "kitchen",
+		Clients:  map[string]string{"home-assistant": "ha", "exporter": "metrics"},
+		LogLevel: espgohome.LogLevel_LOG_LEVEL_DEBUG,
+	}
+	pl := espgohometest.Listen(t)
+	go p.Serve(pl)
+	t.Cleanup(func() { p.Close() })
+
+	return s, pl.Addr().String(), commands
+}
+
+func dial(t *testing.T, address, client, password string) *espgohome.ESPHomeConnection {
+	c := &espgohome.ESPHomeConnection{ClientInfo: client, Password: password}
+	if err := c.Dial(address); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+	return c
+}
+
+func TestClients(t *testing.T) {
+	s, address, commands := start(t)
+
+	if err := dial(t, address, "home-assistant", "wrong").Connect(); err == nil {
+		t.Error("connected with the wrong password")
+	}
+	if err := dial(t, address, "exporter", "ha").Connect(); err == nil {
+		t.Error("connected with the password of another client")
+	}
+	if err := dial(t, address, "test-client", "ha").Connect(); err == nil {
+		t.Error("connected as an unknown client")
+	}
+
+	var clients []*espgohome.ESPHomeConnection
+	for _, client := range []struct{ name, password string }{{"home-assistant", "ha"}, {"exporter", "metrics"}} {
+		c := dial(t, address, client.name, client.password)
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		clients = append(clients, c)
+	}
+
+	for _, c := range clients {
+		info, err := c.DeviceInfo()
+		if err != nil || info.MacAddress != "AA:AA:AA:AA:AA:01" {
+			t.Fatalf("unexpected device info %v %v", info, err)
+		}
+		entities, services, err := c.ListEntitiesAndServices()
+		if err != nil || len(entities) != 3 || entities[1].GetObjectId() != "relay" || len(services) != 1 || services[0].Name != "beep" {
+			t.Fatalf("unexpected entities %v %v %v", entities, services, err)
+		}
+	}
+
+	var states []chan proto.Message
+	for _, c := range clients {
+		ch, err := c.SubscribeStates()
+		if err != nil {
+			t.Fatalf("subscribe states failed: %v", err)
+		}
+		states = append(states, ch)
+		// the current states are sent first
+		for i := 0; i < 2; i++ {
+			<-ch
+		}
+	}
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+	for _, ch := range states {
+		select {
+		case m := <-ch:
+			if st, ok := m.(*espgohome.SwitchStateResponse); !ok || st.State {
+				t.Errorf("unexpected state %v", m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no state received")
+		}
+	}
+
+	if err := clients[1].SwitchCommand(2, true); err != nil {
+		t.Fatalf("switch command failed: %v", err)
+	}
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 2 || !c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+
+	logs, err := clients[0].SubscribeLogs(espgohome.LogLevel_LOG_LEVEL_INFO)
+	if err != nil {
+		t.Fatalf("subscribe logs failed: %v", err)
+	}
+	defer clients[0].RemoveReceiver(logs)
+	// the proxy's subscription may not have reached the device yet
+	deadline := time.Now().Add(2 * time.Second)
+	for received := false; !received; {
+		s.Log(espgohome.LogLevel_LOG_LEVEL_INFO, "main", "hello")
+		select {
+		case m := <-logs:
+			if r := m.(*espgohome.SubscribeLogsResponse); r.Message != "hello" {
+				t.Errorf("unexpected log message %v", r)
+			}
+			received = true
+		case <-time.After(20 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("no log message received")
+			}
+		}
+	}
+}
+
+// imageSize reads an image from chunks and returns its size
+func imageSize(t *testing.T, chunks chan proto.Message) int {
+	t.Helper()
+
+	size := 0
+	for done := false; !done; {
+		select {
+		case m := <-chunks:
+			chunk := m.(*espgohome.CameraImageResponse)
+			size += len(chunk.Data)
+			done = chunk.Done
+		case <-time.After(2 * time.Second):
+			t.Fatal("no image received")
+		}
+	}
+	return size
+}
+
+func TestCameraImage(t *testing.T) {
+	_, address, commands := start(t)
+	var clients []chan proto.Message
+	for _, client := range []struct{ name, password string }{{"home-assistant", "ha"}, {"exporter", "metrics"}} {
+		c := dial(t, address, client.name, client.password)
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		chunks, err := c.CameraImageWith(&espgohome.CameraImageRequest{Single: true})
+		if err != nil {
+			t.Fatalf("camera image failed: %v", err)
+		}
+		defer c.RemoveReceiver(chunks)
+		clients = append(clients, chunks)
+	}
+
+	for _, chunks := range clients {
+		if size := imageSize(t, chunks); size != 3000 {
+			t.Errorf("got %d bytes of image, want 3000", size)
+		}
+	}
+	// both clients were answered by a single request to the device
+	if _, ok := espgohometest.NextCommand(t, commands).(*espgohome.CameraImageRequest); !ok {
+		t.Error("no camera request sent to the device")
+	}
+	select {
+	case m := <-commands:
+		t.Errorf("unexpected request %v", m)
+	default:
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	s, address, _ := start(t)
+	c := dial(t, address, "home-assistant", "ha")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	s.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the client wasn't disconnected with the device")
+	}
+
+	// clients are refused until the device is back
+	r := &espgohome.ESPHomeConnection{ClientInfo: "home-assistant", Password: "ha"}
+	if err := r.Dial(address); err == nil {
+		defer r.Close()
+		if err := r.Hello(); err == nil {
+			t.Error("a client was accepted without the device")
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// command sends a parsed Command to an entity
+type command func(e entity.Entity) error
+
+// run runs the action against the devices of m
+func (a *Action) run(m *manager.Manager) error {
+	switch {
+	case a.Func != nil:
+		return a.Func(m)
+	case a.Service != "":
+		return a.execute(m)
+	}
+
+	cmd, err := parseCommand(a.Command)
+	if err != nil {
+		return err
+	}
+	d, e, err := m.Entity(a.Entity)
+	if err != nil {
+		return err
+	}
+	if !d.Connected() {
+		return fmt.Errorf("%s is not connected", d.Name())
+	}
+	return cmd(e)
+}
+
+// execute calls the service of the action
+func (a *Action) execute(m *manager.Manager) error {
+	i := strings.LastIndex(a.Service, "/")
+	d, err := m.Device(a.Service[:i])
+	if err != nil {
+		return err
+	}
+	entities := d.Entities()
+	if entities == nil || !d.Connected() {
+		return fmt.Errorf("%s is not connected", d.Name())
+	}
+	svc := entities.Service(a.Service[i+1:])
+	if svc == nil {
+		return fmt.Errorf("unknown service %s", a.Service)
+	}
+
+	args := make([]interface{}, len(svc.Args))
+	for i, arg := range svc.Args {
+		v, ok := a.Args[arg.Name]
+		if !ok {
+			return fmt.Errorf("missing argument %s", arg.Name)
+		}
+		args[i] = serviceValue(arg.Type, v)
+	}
+	for name := range a.Args {
+		if !hasArg(svc, name) {
+			return fmt.Errorf("unknown argument %s", name)
+		}
+	}
+	return svc.Execute(args...)
+}
+
+// serviceValue converts the lists decoded from YAML to the slices
+// entity.ServiceArgument expects, other values are returned unchanged
+func serviceValue(t espgohome.ServiceArgType, v interface{}) interface{} {
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+
+	switch t {
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_BOOL_ARRAY:
+		out := make([]bool, len(list))
+		for i, x := range list {
+			if out[i], ok = x.(bool); !ok {
+				return v
+			}
+		}
+		return out
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT_ARRAY:
+		out := make([]int, len(list))
+		for i, x := range list {
+			if out[i], ok = x.(int); !ok {
+				return v
+			}
+		}
+		return out
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_FLOAT_ARRAY:
+		out := make([]float64, len(list))
+		for i, x := range list {
+			switch x := x.(type) {
+			case float64:
+				out[i] = x
+			case int:
+				out[i] = float64(x)
+			default:
+				return v
+			}
+		}
+		return out
+	case espgohome.ServiceArgType_SERVICE_ARG_TYPE_STRING_ARRAY:
+		out := make([]string, len(list))
+		for i, x := range list {
+			if out[i], ok = x.(string); !ok {
+				return v
+			}
+		}
+		return out
+	}
+	return v
+}
+
+func hasArg(svc *entity.Service, name string) bool {
+	for _, a := range svc.Args {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCommand parses the Command of an action, the entity type is only
+// checked when the command is sent
+func parseCommand(s string) (command, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	verb, values := strings.ToLower(fields[0]), fields[1:]
+
+	want := 1
+	switch verb {
+	case "on", "off", "toggle", "open", "close", "stop":
+		want = 0
+	case "range":
+		want = 2
+	}
+	if len(values) != want {
+		return nil, fmt.Errorf("%s takes %d values", verb, want)
+	}
+
+	switch verb {
+	case "on", "off":
+		on := verb == "on"
+		return func(e entity.Entity) error {
+			switch e := e.(type) {
+			case *entity.Switch:
+				return e.Set(on)
+			case *entity.Light:
+				if on {
+					return e.TurnOn()
+				}
+				return e.TurnOff()
+			case *entity.Fan:
+				if on {
+					return e.TurnOn()
+				}
+				return e.TurnOff()
+			}
+			return unsupported(e, verb)
+		}, nil
+	case "toggle":
+		return func(e entity.Entity) error {
+			switch e := e.(type) {
+			case *entity.Switch:
+				return e.Toggle()
+			case *entity.Light:
+				if e.State().On {
+					return e.TurnOff()
+				}
+				return e.TurnOn()
+			case *entity.Fan:
+				if e.State().On {
+					return e.TurnOff()
+				}
+				return e.TurnOn()
+			}
+			return unsupported(e, verb)
+		}, nil
+	case "open", "close", "stop", "position", "tilt":
+		var f float32
+		if want == 1 {
+			var err error
+			if f, err = value.ParseFloat(values[0]); err != nil {
+				return nil, err
+			}
+		}
+		return func(e entity.Entity) error {
+			c, ok := e.(*entity.Cover)
+			if !ok {
+				return unsupported(e, verb)
+			}
+			switch verb {
+			case "open":
+				return c.Open()
+			case "close":
+				return c.Close()
+			case "stop":
+				return c.Stop()
+			case "position":
+				return c.SetPosition(f)
+			default:
+				return c.SetTilt(f)
+			}
+		}, nil
+	case "brightness":
+		b, err := value.ParseFloat(values[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(e entity.Entity) error {
+			l, ok := e.(*entity.Light)
+			if !ok {
+				return unsupported(e, verb)
+			}
+			return l.TurnOn(entity.WithBrightness(b))
+		}, nil
+	case "speed", "oscillate", "direction":
+		return fanCommand(verb, values[0])
+	case "mode", "target", "range", "away", "fan", "swing":
+		return climateCommand(verb, values)
+	}
+	return nil, fmt.Errorf("unknown command %q", verb)
+}
+
+func fanCommand(verb, v string) (command, error) {
+	var set func(f *entity.Fan) error
+	switch verb {
+	case "speed":
+		speed, ok := value.ParseEnum(espgohome.FanSpeed_name, value.FanSpeedPrefixes, v)
+		if !ok {
+			return nil, fmt.Errorf("invalid fan speed %q", v)
+		}
+		set = func(f *entity.Fan) error { return f.SetSpeed(espgohome.FanSpeed(speed)) }
+	case "oscillate":
+		on, err := value.ParseOnOff(v)
+		if err != nil {
+			return nil, err
+		}
+		set = func(f *entity.Fan) error { return f.SetOscillating(on) }
+	default:
+		direction, ok := value.ParseEnum(espgohome.FanDirection_name, value.FanDirectionPrefixes, v)
+		if !ok {
+			return nil, fmt.Errorf("invalid fan direction %q", v)
+		}
+		set = func(f *entity.Fan) error { return f.SetDirection(espgohome.FanDirection(direction)) }
+	}
+	return func(e entity.Entity) error {
+		f, ok := e.(*entity.Fan)
+		if !ok {
+			return unsupported(e, verb)
+		}
+		return set(f)
+	}, nil
+}
+
+func climateCommand(verb string, values []string) (command, error) {
+	var set func(c *entity.Climate) error
+	switch verb {
+	case "mode":
+		mode, ok := value.ParseEnum(espgohome.ClimateMode_name, value.ClimateModePrefixes, values[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid climate mode %q", values[0])
+		}
+		set = func(c *entity.Climate) error { return c.SetMode(espgohome.ClimateMode(mode)) }
+	case "target":
+		t, err := value.ParseFloat(values[0])
+		if err != nil {
+			return nil, err
+		}
+		set = func(c *entity.Climate) error { return c.SetTargetTemperature(t) }
+	case "range":
+		low, err := value.ParseFloat(values[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := value.ParseFloat(values[1])
+		if err != nil {
+			return nil, err
+		}
+		set = func(c *entity.Climate) error { return c.SetTargetTemperatureRange(low, high) }
+	case "away":
+		away, err := value.ParseOnOff(values[0])
+		if err != nil {
+			return nil, err
+		}
+		set = func(c *entity.Climate) error { return c.SetAway(away) }
+	case "fan":
+		mode, ok := value.ParseEnum(espgohome.ClimateFanMode_name, value.ClimateFanPrefixes, values[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid climate fan mode %q", values[0])
+		}
+		set = func(c *entity.Climate) error { return c.SetFanMode(espgohome.ClimateFanMode(mode)) }
+	default:
+		mode, ok := value.ParseEnum(espgohome.ClimateSwingMode_name, value.ClimateSwingPrefixes, values[0])
+		if !ok {
+			return nil, fmt.Errorf("invalid climate swing mode %q", values[0])
+		}
+		set = func(c *entity.Climate) error { return c.SetSwingMode(espgohome.ClimateSwingMode(mode)) }
+	}
+	return func(e entity.Entity) error {
+		c, ok := e.(*entity.Climate)
+		if !ok {
+			return unsupported(e, verb)
+		}
+		return set(c)
+	}, nil
+}
+
+func unsupported(e entity.Entity, verb string) error {
+	return fmt.Errorf("%s is a %s, which doesn't accept %s", e.ObjectID(), e.Type(), verb)
+}
@@ -0,0 +1,282 @@
+package rules
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// Engine runs rules against the devices of a Manager. State and threshold
+// triggers only fire on changes, the initial states sent when a device
+// connects don't start rules.
+type Engine struct {
+	Manager *manager.Manager
+	// Rules must not be modified once the engine is started
+	Rules []*Rule
+	// DryRun logs the actions of the rules that run instead of running them
+	DryRun bool
+	// Logger receives the diagnostic messages of the engine and the runs of
+	// the rules at LevelInfo
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu      sync.Mutex
+	events  chan manager.Event
+	fires   chan fire
+	stop    chan struct{}
+	done    chan struct{}
+	closed  bool
+	actions sync.WaitGroup
+}
+
+// fire is sent by the timers of time triggers and debounced runs
+type fire struct {
+	rule    int
+	trigger int
+	// debounce is the generation of a debounced run, 0 for time triggers
+	debounce int
+}
+
+// ruleState is what the engine keeps about a rule between events
+type ruleState struct {
+	lastRun time.Time
+	// pending is the generation of the debounced run waiting for its timer,
+	// 0 if there is none, and trigger is the trigger that started it
+	pending int
+	trigger int
+	timer   *time.Timer
+}
+
+// Start validates the rules and starts running them
+func (e *Engine) Start() error {
+	for _, r := range e.Rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return ErrorEngineClosed
+	}
+	if e.events != nil {
+		e.mu.Unlock()
+		return nil
+	}
+	e.events = make(chan manager.Event, 64)
+	e.fires = make(chan fire)
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	e.mu.Unlock()
+
+	e.Manager.AddListener(e.events)
+	go e.run()
+
+	return nil
+}
+
+// Close stops the engine and waits for the actions being run
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	started := e.events != nil
+	e.mu.Unlock()
+
+	if started {
+		e.Manager.RemoveListener(e.events)
+		close(e.stop)
+		<-e.done
+		e.actions.Wait()
+	}
+
+	return nil
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+
+	states := make([]ruleState, len(e.Rules))
+	timers := make(map[[2]int]*time.Timer)
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+		for _, st := range states {
+			if st.timer != nil {
+				st.timer.Stop()
+			}
+		}
+	}()
+	schedule := func(i, j int, now time.Time) {
+		f := fire{rule: i, trigger: j}
+		timers[[2]int{i, j}] = time.AfterFunc(next(&e.Rules[i].When[j], now).Sub(now), func() { e.send(f) })
+	}
+	now := time.Now()
+	for i, r := range e.Rules {
+		for j := range r.When {
+			if r.When[j].time() {
+				schedule(i, j, now)
+			}
+		}
+	}
+	generation := 0
+
+	for {
+		select {
+		case ev := <-e.events:
+			if ev.Type != manager.StateChanged || ev.State.Entity == nil {
+				continue
+			}
+			current := valueOf(ev.State)
+			var previous stateValue
+			if ev.Previous != nil {
+				previous = valueOf(espgohome.EntityState{Entity: ev.State.Entity, State: ev.Previous})
+			}
+			for i, r := range e.Rules {
+				st := &states[i]
+				for j := range r.When {
+					t := &r.When[j]
+					if t.time() || !matches(t.Entity, ev) {
+						continue
+					}
+					if st.pending != 0 && st.trigger == j && !t.holds(current) {
+						e.log(espgohome.LevelDebug, "rules: debounced run cancelled", "rule", r.Name, "entity", t.Entity, "state", current.s)
+						st.timer.Stop()
+						st.pending, st.timer = 0, nil
+					}
+					if ev.Previous == nil || !t.fires(previous, current) {
+						continue
+					}
+					if r.Debounce > 0 {
+						if st.pending == 0 {
+							generation++
+							f := fire{rule: i, trigger: j, debounce: generation}
+							st.pending, st.trigger = generation, j
+							st.timer = time.AfterFunc(r.Debounce, func() { e.send(f) })
+							e.log(espgohome.LevelDebug, "rules: debouncing", "rule", r.Name, "entity", t.Entity, "state", current.s)
+						}
+						continue
+					}
+					e.attempt(i, st)
+				}
+			}
+		case f := <-e.fires:
+			st := &states[f.rule]
+			if f.debounce != 0 {
+				if f.debounce != st.pending {
+					continue
+				}
+				st.pending, st.timer = 0, nil
+			} else {
+				schedule(f.rule, f.trigger, time.Now())
+			}
+			e.attempt(f.rule, st)
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// send delivers a fire to the run loop unless the engine is closing
+func (e *Engine) send(f fire) {
+	select {
+	case e.fires <- f:
+	case <-e.stop:
+	}
+}
+
+// attempt runs the actions of a triggered rule unless it is cooling down or
+// one of its conditions doesn't hold
+func (e *Engine) attempt(i int, st *ruleState) {
+	r := e.Rules[i]
+	now := time.Now()
+	if r.Cooldown > 0 && !st.lastRun.IsZero() && now.Sub(st.lastRun) < r.Cooldown {
+		e.log(espgohome.LevelDebug, "rules: cooling down", "rule", r.Name, "last_run", st.lastRun)
+		return
+	}
+	for k := range r.If {
+		if !e.check(&r.If[k]) {
+			e.log(espgohome.LevelDebug, "rules: condition doesn't hold", "rule", r.Name, "condition", k+1)
+			return
+		}
+	}
+	st.lastRun = now
+
+	e.log(espgohome.LevelInfo, "rules: running", "rule", r.Name, "dry_run", e.DryRun)
+	e.actions.Add(1)
+	go func() {
+		defer e.actions.Done()
+		for k := range r.Then {
+			a := &r.Then[k]
+			if e.DryRun {
+				e.log(espgohome.LevelInfo, "rules: dry run", "rule", r.Name, "action", a.String())
+				continue
+			}
+			if err := a.run(e.Manager); err != nil {
+				e.log(espgohome.LevelWarn, "rules: action failed", "rule", r.Name, "action", a.String(), "error", err)
+				continue
+			}
+			e.log(espgohome.LevelDebug, "rules: action", "rule", r.Name, "action", a.String())
+		}
+	}()
+}
+
+// check reports whether a condition holds for the current states
+func (e *Engine) check(c *Condition) bool {
+	if c.Func != nil {
+		return c.Func(e.Manager)
+	}
+	i := strings.LastIndex(c.Entity, "/")
+	d, err := e.Manager.Device(c.Entity[:i])
+	if err != nil {
+		return false
+	}
+	entities := d.Entities()
+	if entities == nil || !d.Connected() {
+		return false
+	}
+	st, ok := entities.Store().GetByObjectID(c.Entity[i+1:])
+	return ok && c.holds(valueOf(st))
+}
+
+func (e *Engine) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(e.Logger, e.Debug).Log(level, msg, keyvals...)
+}
+
+// matches reports whether id is the "device/object_id" of the entity of a
+// StateChanged event, with the device named by its name or MAC
+func matches(id string, ev manager.Event) bool {
+	i := strings.LastIndex(id, "/")
+	device, objectID := id[:i], id[i+1:]
+	return objectID == ev.State.Entity.GetObjectId() && (device == ev.Device || (ev.MAC != "" && device == ev.MAC))
+}
+
+// next returns when a time trigger next fires after now
+func next(t *Trigger, now time.Time) time.Time {
+	if t.Every > 0 {
+		return now.Add(t.Every)
+	}
+	at, _ := time.Parse("15:04", t.At)
+	day := now
+	for {
+		n := time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+		if n.After(now) {
+			return n
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+}
+
+func valueOf(st espgohome.EntityState) stateValue {
+	s, n, numeric, ok := Value(st)
+	return stateValue{s, n, numeric, ok}
+}
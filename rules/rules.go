@@ -0,0 +1,305 @@
+// Package rules runs small automations next to the devices of a
+// manager.Manager.
+//
+// A Rule starts when any of its triggers fires: a state change, a value
+// crossing a threshold or a time of day. If all of its conditions hold, its
+// actions send commands to switches, lights, fans, covers and climate devices
+// or call user defined services. Rules are declared in Go or loaded from YAML
+// and run by an Engine, which also implements debouncing, cooldowns and a dry
+// run mode that only logs the actions.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// ErrorEngineClosed is returned by Start after Close has been called
+var ErrorEngineClosed = errors.New("rules: engine closed")
+
+// Rule is an automation
+type Rule struct {
+	// Name identifies the rule in the logs
+	Name string `yaml:"name"`
+	// When are the triggers of the rule, any of them starts it
+	When []Trigger `yaml:"when"`
+	// If are the conditions of the rule, all of them must hold for the
+	// actions to run
+	If []Condition `yaml:"if"`
+	// Then are the actions of the rule, run in order
+	Then []Action `yaml:"then"`
+	// Debounce is how long the state of a state or threshold trigger must
+	// last before the rule runs, a change that stops the trigger from
+	// matching in the meantime cancels the run
+	Debounce time.Duration `yaml:"debounce"`
+	// Cooldown is the least time between two runs of the rule, triggers
+	// that fire earlier are ignored
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// Trigger starts a rule. It is either a state trigger, with Entity and
+// optionally From and To, a threshold trigger, with Entity and Above, Below
+// or both, or a time trigger, with At or Every.
+type Trigger struct {
+	// Entity is the "device/object_id" of state and threshold triggers
+	Entity string `yaml:"entity"`
+	// From and To restrict a state trigger to the changes from and to these
+	// states, without them any change of the state fires
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Above and Below make a threshold trigger, which fires when the value
+	// enters the range
+	Above *float64 `yaml:"above"`
+	Below *float64 `yaml:"below"`
+	// At is the time of day of a daily trigger, as 15:04 in local time
+	At string `yaml:"at"`
+	// Every is the interval of a periodic trigger
+	Every time.Duration `yaml:"every"`
+}
+
+// Condition is checked against the current state of an entity when a rule
+// is triggered
+type Condition struct {
+	// Entity is the "device/object_id" of the entity
+	Entity string `yaml:"entity"`
+	// State is the state the entity must be in
+	State string `yaml:"state"`
+	// Above and Below bound the value of the entity
+	Above *float64 `yaml:"above"`
+	Below *float64 `yaml:"below"`
+	// Func replaces the other fields in rules declared in Go
+	Func func(m *manager.Manager) bool `yaml:"-"`
+}
+
+// Action is run when a rule is triggered and its conditions hold. It either
+// sends Command to Entity, calls Service with Args or, in rules declared in
+// Go, calls Func.
+type Action struct {
+	// Entity is the "device/object_id" of the entity Command is sent to
+	Entity string `yaml:"entity"`
+	// Command is on, off or toggle for switches, lights and fans, open,
+	// close, stop, position <p> or tilt <t> for covers, brightness <b> for
+	// lights, speed <s>, oscillate on|off or direction <d> for fans and mode
+	// <m>, target <t>, range <low> <high>, away on|off, fan <m> or swing <m>
+	// for climate devices
+	Command string `yaml:"command"`
+	// Service is the "device/name" of a user defined service
+	Service string `yaml:"service"`
+	// Args are the arguments of Service by name
+	Args map[string]interface{} `yaml:"args"`
+	// Func replaces the other fields in rules declared in Go
+	Func func(m *manager.Manager) error `yaml:"-"`
+}
+
+// Validate checks that a rule is complete and that its triggers, conditions
+// and actions are well formed
+func (r *Rule) Validate() error {
+	if err := r.validate(); err != nil {
+		return fmt.Errorf("rules: rule %q: %v", r.Name, err)
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("no name")
+	}
+	if len(r.When) == 0 {
+		return errors.New("no triggers")
+	}
+	if len(r.Then) == 0 {
+		return errors.New("no actions")
+	}
+	if r.Debounce < 0 || r.Cooldown < 0 {
+		return errors.New("negative debounce or cooldown")
+	}
+	for i := range r.When {
+		if err := r.When[i].validate(); err != nil {
+			return fmt.Errorf("trigger %d: %v", i+1, err)
+		}
+	}
+	for i := range r.If {
+		if err := r.If[i].validate(); err != nil {
+			return fmt.Errorf("condition %d: %v", i+1, err)
+		}
+	}
+	for i := range r.Then {
+		if err := r.Then[i].validate(); err != nil {
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (t *Trigger) validate() error {
+	kinds := 0
+	if t.Entity != "" {
+		kinds++
+		if err := validateID(t.Entity); err != nil {
+			return err
+		}
+		if (t.From != "" || t.To != "") && (t.Above != nil || t.Below != nil) {
+			return errors.New("from and to can't be combined with above and below")
+		}
+		if err := validateRange(t.Above, t.Below); err != nil {
+			return err
+		}
+	} else if t.From != "" || t.To != "" || t.Above != nil || t.Below != nil {
+		return errors.New("from, to, above and below need an entity")
+	}
+	if t.At != "" {
+		kinds++
+		if _, err := time.Parse("15:04", t.At); err != nil {
+			return fmt.Errorf("invalid time of day %q, expected 15:04", t.At)
+		}
+	}
+	if t.Every != 0 {
+		kinds++
+		if t.Every < 0 {
+			return errors.New("negative interval")
+		}
+	}
+	if kinds != 1 {
+		return errors.New("expected exactly one of entity, at and every")
+	}
+	return nil
+}
+
+// time reports whether t is a time trigger
+func (t *Trigger) time() bool {
+	return t.At != "" || t.Every > 0
+}
+
+// fires reports whether a change of the state of the entity of t from
+// previous to current fires t
+func (t *Trigger) fires(previous, current stateValue) bool {
+	if !current.ok {
+		return false
+	}
+	if t.threshold() {
+		return current.numeric && inRange(current.n, t.Above, t.Below) &&
+			!(previous.ok && previous.numeric && inRange(previous.n, t.Above, t.Below))
+	}
+	if previous.ok && previous.s == current.s {
+		return false
+	}
+	if t.From != "" && !(previous.ok && strings.EqualFold(previous.s, t.From)) {
+		return false
+	}
+	return t.To == "" || strings.EqualFold(current.s, t.To)
+}
+
+// holds reports whether the state that fired t still matches it, a debounced
+// run is cancelled when it stops holding
+func (t *Trigger) holds(current stateValue) bool {
+	if !current.ok {
+		return false
+	}
+	if t.threshold() {
+		return current.numeric && inRange(current.n, t.Above, t.Below)
+	}
+	return t.To == "" || strings.EqualFold(current.s, t.To)
+}
+
+func (t *Trigger) threshold() bool {
+	return t.Above != nil || t.Below != nil
+}
+
+func (c *Condition) validate() error {
+	if c.Func != nil {
+		return nil
+	}
+	if err := validateID(c.Entity); err != nil {
+		return err
+	}
+	if c.State == "" && c.Above == nil && c.Below == nil {
+		return errors.New("expected state, above or below")
+	}
+	if c.State != "" && (c.Above != nil || c.Below != nil) {
+		return errors.New("state can't be combined with above and below")
+	}
+	return validateRange(c.Above, c.Below)
+}
+
+// holds reports whether the current state of the entity of c satisfies it
+func (c *Condition) holds(current stateValue) bool {
+	if !current.ok {
+		return false
+	}
+	if c.State != "" {
+		return strings.EqualFold(current.s, c.State)
+	}
+	return current.numeric && inRange(current.n, c.Above, c.Below)
+}
+
+func (a *Action) validate() error {
+	kinds := 0
+	if a.Func != nil {
+		kinds++
+	}
+	if a.Entity != "" || a.Command != "" {
+		kinds++
+		if err := validateID(a.Entity); err != nil {
+			return err
+		}
+		if _, err := parseCommand(a.Command); err != nil {
+			return err
+		}
+	}
+	if a.Service != "" {
+		kinds++
+		if err := validateID(a.Service); err != nil {
+			return err
+		}
+	} else if len(a.Args) > 0 {
+		return errors.New("args need a service")
+	}
+	if kinds != 1 {
+		return errors.New("expected exactly one of entity and command, service and func")
+	}
+	return nil
+}
+
+// String describes the action in the logs
+func (a *Action) String() string {
+	switch {
+	case a.Func != nil:
+		return "func"
+	case a.Service != "":
+		return fmt.Sprintf("service %s %v", a.Service, a.Args)
+	default:
+		return a.Entity + " " + a.Command
+	}
+}
+
+// stateValue is the state of an entity as returned by Value
+type stateValue struct {
+	s       string
+	n       float64
+	numeric bool
+	ok      bool
+}
+
+// validateID checks a "device/object_id" id
+func validateID(id string) error {
+	i := strings.LastIndex(id, "/")
+	if i <= 0 || i == len(id)-1 {
+		return fmt.Errorf("id %q is not of the form device/object_id", id)
+	}
+	return nil
+}
+
+func validateRange(above, below *float64) error {
+	if above != nil && below != nil && *above >= *below {
+		return fmt.Errorf("above %g is not below %g", *above, *below)
+	}
+	return nil
+}
+
+func inRange(n float64, above, below *float64) bool {
+	return (above == nil || n > *above) && (below == nil || n < *below)
+}
@@ -0,0 +1,212 @@
+package rules
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/proto"
+)
+
+const testRules = `
+rules:
+  - name: motion
+    when:
+      - entity: kitchen/motion
+        to: "on"
+    if:
+      - entity: kitchen/temperature
+        below: 30
+    then:
+      - entity: kitchen/relay
+        command: "on"
+      - service: kitchen/chime
+        args: {tone: 2, pattern: [1, 2]}
+    cooldown: 1h
+  - name: heat
+    when:
+      - entity: kitchen/temperature
+        below: 18
+    then:
+      - entity: kitchen/thermostat
+        command: mode heat
+    debounce: 100ms
+`
+
+func TestLoad(t *testing.T) {
+	rules, err := Load(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Cooldown != time.Hour || rules[1].Debounce != 100*time.Millisecond ||
+		*rules[0].If[0].Below != 30 || rules[0].Then[1].Args["tone"] != 2 || rules[1].When[0].Above != nil {
+		t.Errorf("unexpected rules %+v %+v", rules[0], rules[1])
+	}
+
+	for _, bad := range []string{
+		"rules:\n  - name: a\n    when: [{entity: a/b}]\n    then: [{entity: a/c, command: on}]\n    cooldwn: 1m\n",
+		"rules:\n  - name: a\n    when: [{entity: a/b, to: on, above: 1}]\n    then: [{entity: a/c, command: on}]\n",
+		"rules:\n  - name: a\n    when: [{entity: a/b}]\n    then: [{entity: a/c, command: position}]\n",
+		"rules:\n  - name: a\n    when: [{at: \"25:00\"}]\n    then: [{entity: a/c, command: on}]\n",
+		"rules:\n  - name: a\n    when: [{entity: a}]\n    then: [{entity: a/c, command: on}]\n",
+		"rules:\n  - name: a\n    when: [{every: 1m}]\n    then: [{entity: a/c, command: on}]\n  - name: a\n    when: [{every: 1m}]\n    then: [{entity: a/c, command: on}]\n",
+		"rules:\n  - name: a\n    when: [{every: 1m}]\n    if: [{entity: a/b}]\n    then: [{entity: a/c, command: on}]\n",
+		"rules: []\n",
+	} {
+		if _, err := Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	for _, tc := range []struct {
+		state proto.Message
+		s     string
+		n     float64
+	}{
+		{&espgohome.SensorStateResponse{State: 21.3}, "21.3", 21.3},
+		{&espgohome.BinarySensorStateResponse{State: true}, "on", 1},
+		{&espgohome.LightStateResponse{State: true, Brightness: 0.5}, "on", 0.5},
+		{&espgohome.CoverStateResponse{Position: 0}, "closed", 0},
+		{&espgohome.ClimateStateResponse{Mode: espgohome.ClimateMode_CLIMATE_MODE_FAN_ONLY, CurrentTemperature: 19.5}, "fan_only", 19.5},
+	} {
+		s, n, numeric, ok := Value(espgohome.EntityState{State: tc.state})
+		if !ok || !numeric || s != tc.s || n != tc.n {
+			t.Errorf("%T: got %q %g %v %v, want %q %g", tc.state, s, n, numeric, ok, tc.s, tc.n)
+		}
+	}
+	if _, _, _, ok := Value(espgohome.EntityState{State: &espgohome.SensorStateResponse{}, Missing: true}); ok {
+		t.Errorf("missing state has a value")
+	}
+}
+
+// kitchen returns the entities, services and initial states of the device
+// the tests run rules against
+func kitchen() []proto.Message {
+	return []proto.Message{
+		&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"},
+		&espgohome.ListEntitiesBinarySensorResponse{ObjectId: "motion", Key: 2, Name: "Motion"},
+		&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 3, Name: "Relay"},
+		&espgohome.ListEntitiesClimateResponse{ObjectId: "thermostat", Key: 4, Name: "Thermostat"},
+		&espgohome.ListEntitiesServicesResponse{Name: "chime", Key: 5, Args: []*espgohome.ListEntitiesServicesArgument{
+			{Name: "tone", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT},
+			{Name: "pattern", Type: espgohome.ServiceArgType_SERVICE_ARG_TYPE_INT_ARRAY},
+		}},
+		&espgohome.SensorStateResponse{Key: 1, State: 21},
+		&espgohome.BinarySensorStateResponse{Key: 2, State: false},
+	}
+}
+
+func noCommand(t *testing.T, commands chan proto.Message, d time.Duration) {
+	t.Helper()
+
+	select {
+	case m := <-commands:
+		t.Fatalf("unexpected command %v", m)
+	case <-time.After(d):
+	}
+}
+
+func TestEngine(t *testing.T) {
+	rules, err := Load(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	m := manager.New("test-client")
+	defer m.Close()
+	s, commands := espgohometest.StartDevice(t, m, "kitchen", kitchen()...)
+	e := &Engine{Manager: m, Rules: rules}
+	if err := e.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer e.Close()
+
+	s.SetState(&espgohome.BinarySensorStateResponse{Key: 2, State: true})
+	if req, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || req.Key != 3 || !req.State {
+		t.Errorf("unexpected switch command %v", req)
+	}
+	req, ok := espgohometest.NextCommand(t, commands).(*espgohome.ExecuteServiceRequest)
+	if !ok || req.Key != 5 || len(req.Args) != 2 || req.Args[0].Int_ != 2 || len(req.Args[1].IntArray) != 2 {
+		t.Errorf("unexpected service call %v", req)
+	}
+
+	// the motion rule is cooling down
+	s.SetState(&espgohome.BinarySensorStateResponse{Key: 2, State: false})
+	s.SetState(&espgohome.BinarySensorStateResponse{Key: 2, State: true})
+	noCommand(t, commands, 50*time.Millisecond)
+
+	// leaving the range during the debounce cancels the run
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 17})
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 19})
+	noCommand(t, commands, 200*time.Millisecond)
+
+	s.SetState(&espgohome.SensorStateResponse{Key: 1, State: 17.5})
+	start := time.Now()
+	if req, ok := espgohometest.NextCommand(t, commands).(*espgohome.ClimateCommandRequest); !ok || req.Key != 4 || !req.HasMode || req.Mode != espgohome.ClimateMode_CLIMATE_MODE_HEAT {
+		t.Errorf("unexpected climate command %v", req)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("the command wasn't debounced, sent after %v", d)
+	}
+}
+
+// recordingLogger keeps the messages logged
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Enabled(espgohome.Level) bool { return true }
+
+func (l *recordingLogger) Log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) count(msg string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, m := range l.messages {
+		if m == msg {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDryRun(t *testing.T) {
+	m := manager.New("test-client")
+	defer m.Close()
+	_, commands := espgohometest.StartDevice(t, m, "kitchen", kitchen()...)
+	conditions := 0
+	logger := &recordingLogger{}
+	e := &Engine{
+		Manager: m,
+		Rules: []*Rule{{
+			Name: "periodic",
+			When: []Trigger{{Every: 20 * time.Millisecond}},
+			If:   []Condition{{Func: func(*manager.Manager) bool { conditions++; return true }}},
+			Then: []Action{{Entity: "kitchen/relay", Command: "toggle"}},
+		}},
+		DryRun: true,
+		Logger: logger,
+	}
+	if err := e.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	noCommand(t, commands, 150*time.Millisecond)
+	e.Close()
+	if n := logger.count("rules: dry run"); n < 2 || n != conditions {
+		t.Errorf("%d dry runs for %d checks of the conditions", n, conditions)
+	}
+}
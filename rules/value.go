@@ -0,0 +1,53 @@
+package rules
+
+import (
+	"strconv"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+)
+
+// Value returns the state of an entity as rules see it: a string compared
+// with the To, From and State of triggers and conditions, and a number for
+// thresholds if the state has one. ok is false for missing states.
+//
+// Binary sensors, switches, fans and lights are "on" or "off", covers are
+// "open" or "closed" and climate devices are their mode, such as "heat".
+// The numbers are the value of sensors, the brightness of lights, the
+// position of covers, the current temperature of climate devices and 1 or 0
+// for the rest.
+func Value(st espgohome.EntityState) (s string, n float64, numeric, ok bool) {
+	if st.State == nil || st.Missing {
+		return "", 0, false, false
+	}
+
+	switch m := st.State.(type) {
+	case *espgohome.BinarySensorStateResponse:
+		return value.OnOff(m.State), value.Bool(m.State), true, true
+	case *espgohome.SwitchStateResponse:
+		return value.OnOff(m.State), value.Bool(m.State), true, true
+	case *espgohome.FanStateResponse:
+		return value.OnOff(m.State), value.Bool(m.State), true, true
+	case *espgohome.SensorStateResponse:
+		n = value.Float32(m.State)
+		return strconv.FormatFloat(n, 'f', -1, 64), n, true, true
+	case *espgohome.TextSensorStateResponse:
+		n, err := strconv.ParseFloat(m.State, 64)
+		return m.State, n, err == nil, true
+	case *espgohome.LightStateResponse:
+		if m.State {
+			n = value.Float32(m.Brightness)
+		}
+		s = value.OnOff(m.State)
+		return s, n, true, true
+	case *espgohome.CoverStateResponse:
+		s = "open"
+		if m.Position == 0 {
+			s = "closed"
+		}
+		return s, value.Float32(m.Position), true, true
+	case *espgohome.ClimateStateResponse:
+		return value.EnumString(espgohome.ClimateMode_name, value.ClimateModePrefixes, int32(m.Mode)), value.Float32(m.CurrentTemperature), true, true
+	}
+	return "", 0, false, false
+}
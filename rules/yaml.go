@@ -0,0 +1,69 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of a YAML rules file
+type file struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Load reads rules from YAML and validates them. The document has a rules
+// list whose entries have the fields of Rule, Trigger, Condition and Action
+// in lower case, with durations such as 5m:
+//
+//	rules:
+//	  - name: porch light
+//	    when:
+//	      - entity: porch/motion
+//	        to: "on"
+//	    if:
+//	      - entity: porch/illuminance
+//	        below: 10
+//	    then:
+//	      - entity: porch/light
+//	        command: brightness 0.8
+//	    cooldown: 5m
+func Load(r io.Reader) ([]*Rule, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var f file
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("rules: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for i, rule := range f.Rules {
+		if rule == nil {
+			return nil, fmt.Errorf("rules: rule %d is empty", i+1)
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rules: duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	if len(f.Rules) == 0 {
+		return nil, errors.New("rules: no rules")
+	}
+	return f.Rules, nil
+}
+
+// LoadFile reads rules from a YAML file
+func LoadFile(path string) ([]*Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
@@ -0,0 +1,89 @@
+package scene
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Groups are named lists of entities across devices. A member is the
+// "device/object_id" of an entity or the name of another group.
+type Groups map[string][]string
+
+// LoadGroups reads groups from YAML:
+//
+//	groups:
+//	  lights: [kitchen/lamp, lounge/lamp]
+//	  downstairs: [lights, lounge/blind, lounge/thermostat]
+func LoadGroups(r io.Reader) (Groups, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var f struct {
+		Groups Groups `yaml:"groups"`
+	}
+	if err := dec.Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("scene: %v", err)
+	}
+	for name := range f.Groups {
+		if strings.Contains(name, "/") {
+			return nil, fmt.Errorf("scene: group name %q contains a /", name)
+		}
+		if _, err := f.Groups.Resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return f.Groups, nil
+}
+
+// LoadGroupsFile reads groups from a YAML file
+func LoadGroupsFile(path string) (Groups, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadGroups(f)
+}
+
+// Resolve expands group names and entity ids into the entity ids they
+// contain, in order and without duplicates
+func (g Groups) Resolve(members ...string) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	var expand func(members []string, path []string) error
+	expand = func(members []string, path []string) error {
+		for _, m := range members {
+			if strings.Contains(m, "/") {
+				if i := strings.LastIndex(m, "/"); i == 0 || i == len(m)-1 {
+					return fmt.Errorf("scene: entity id %q is not of the form device/object_id", m)
+				}
+				if !seen[m] {
+					seen[m] = true
+					ids = append(ids, m)
+				}
+				continue
+			}
+			group, ok := g[m]
+			if !ok {
+				return fmt.Errorf("scene: unknown group %q", m)
+			}
+			for _, p := range path {
+				if p == m {
+					return fmt.Errorf("scene: group %q contains itself", m)
+				}
+			}
+			if err := expand(group, append(path, m)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := expand(members, nil); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
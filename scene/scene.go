@@ -0,0 +1,394 @@
+// Package scene captures the states of groups of entities across the devices
+// of a manager.Manager and restores them.
+//
+// A Scene holds, for every entity, the command request that brings it back to
+// the captured state: on or off, brightness and colour for lights, position
+// and tilt for covers, mode and setpoints for climate devices and so on. The
+// states come from the state stores the devices fill with SubscribeStates.
+// Applying a scene checks every entity before sending any command, then sends
+// the commands to all the devices at once.
+package scene
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Scene is a set of entity states
+type Scene struct {
+	Name     string
+	Captured time.Time
+	States   []State
+}
+
+// State is the captured state of an entity
+type State struct {
+	// Entity is the "device/object_id" of the entity
+	Entity string
+	// Command is the command request that restores the state, one of the
+	// command requests of api.proto without its key
+	Command proto.Message
+}
+
+// ApplyError lists the entities whose commands failed
+type ApplyError struct {
+	Errors map[string]error
+}
+
+func (e *ApplyError) Error() string {
+	var msgs []string
+	for id, err := range e.Errors {
+		msgs = append(msgs, id+": "+err.Error())
+	}
+	return "scene: " + strings.Join(msgs, ", ")
+}
+
+// Capture returns a scene with the current states of the entities ids.
+// Every entity must accept commands and have a state, see Wait.
+func Capture(m *manager.Manager, name string, ids []string) (*Scene, error) {
+	s := &Scene{Name: name, Captured: time.Now()}
+	for _, id := range ids {
+		st, err := current(m, id)
+		if err != nil {
+			return nil, fmt.Errorf("scene: %s: %v", id, err)
+		}
+		cmd, err := Command(st)
+		if err != nil {
+			return nil, fmt.Errorf("scene: %s: %v", id, err)
+		}
+		s.States = append(s.States, State{Entity: id, Command: cmd})
+	}
+	return s, nil
+}
+
+// Wait waits up to timeout for the devices of the entities ids to connect
+// and send the states of the entities
+func Wait(m *manager.Manager, ids []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var err error
+		for _, id := range ids {
+			if _, err = current(m, id); err != nil {
+				err = fmt.Errorf("scene: %s: %v", id, err)
+				break
+			}
+		}
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// current returns the state of the entity id
+func current(m *manager.Manager, id string) (espgohome.EntityState, error) {
+	d, e, err := m.Entity(id)
+	if err != nil {
+		return espgohome.EntityState{}, err
+	}
+	if !d.Connected() {
+		return espgohome.EntityState{}, fmt.Errorf("%s is not connected", d.Name())
+	}
+	st, ok := d.Entities().Store().Get(e.Key())
+	if !ok || st.State == nil || st.Missing {
+		return espgohome.EntityState{}, errors.New("no state")
+	}
+	return st, nil
+}
+
+// Command returns the command request that restores st, using the metadata
+// of the entity to leave out what it doesn't support
+func Command(st espgohome.EntityState) (proto.Message, error) {
+	switch s := st.State.(type) {
+	case *espgohome.SwitchStateResponse:
+		return &espgohome.SwitchCommandRequest{State: s.State}, nil
+	case *espgohome.LightStateResponse:
+		e, _ := st.Entity.(*espgohome.ListEntitiesLightResponse)
+		req := &espgohome.LightCommandRequest{HasState: true, State: s.State}
+		if !s.State || e == nil {
+			return req, nil
+		}
+		if e.SupportsBrightness {
+			req.HasBrightness, req.Brightness = true, s.Brightness
+		}
+		if e.SupportsRgb {
+			req.HasRgb, req.Red, req.Green, req.Blue = true, s.Red, s.Green, s.Blue
+		}
+		if e.SupportsWhiteValue {
+			req.HasWhite, req.White = true, s.White
+		}
+		if e.SupportsColorTemperature {
+			req.HasColorTemperature, req.ColorTemperature = true, s.ColorTemperature
+		}
+		if len(e.Effects) > 0 {
+			req.HasEffect, req.Effect = true, s.Effect
+		}
+		return req, nil
+	case *espgohome.CoverStateResponse:
+		e, _ := st.Entity.(*espgohome.ListEntitiesCoverResponse)
+		req := &espgohome.CoverCommandRequest{}
+		if e == nil || !e.SupportsPosition {
+			req.HasLegacyCommand, req.LegacyCommand = true, espgohome.LegacyCoverCommand_LEGACY_COVER_COMMAND_OPEN
+			if s.Position == 0 {
+				req.LegacyCommand = espgohome.LegacyCoverCommand_LEGACY_COVER_COMMAND_CLOSE
+			}
+			return req, nil
+		}
+		req.HasPosition, req.Position = true, s.Position
+		if e.SupportsTilt {
+			req.HasTilt, req.Tilt = true, s.Tilt
+		}
+		return req, nil
+	case *espgohome.FanStateResponse:
+		e, _ := st.Entity.(*espgohome.ListEntitiesFanResponse)
+		req := &espgohome.FanCommandRequest{HasState: true, State: s.State}
+		if e == nil {
+			return req, nil
+		}
+		if e.SupportsSpeed {
+			req.HasSpeed, req.Speed = true, s.Speed
+		}
+		if e.SupportsOscillation {
+			req.HasOscillating, req.Oscillating = true, s.Oscillating
+		}
+		if e.SupportsDirection {
+			req.HasDirection, req.Direction = true, s.Direction
+		}
+		return req, nil
+	case *espgohome.ClimateStateResponse:
+		e, _ := st.Entity.(*espgohome.ListEntitiesClimateResponse)
+		req := &espgohome.ClimateCommandRequest{HasMode: true, Mode: s.Mode}
+		if e != nil && e.SupportsTwoPointTargetTemperature {
+			req.HasTargetTemperatureLow, req.TargetTemperatureLow = true, s.TargetTemperatureLow
+			req.HasTargetTemperatureHigh, req.TargetTemperatureHigh = true, s.TargetTemperatureHigh
+		} else {
+			req.HasTargetTemperature, req.TargetTemperature = true, s.TargetTemperature
+		}
+		if e == nil {
+			return req, nil
+		}
+		if e.SupportsAway {
+			req.HasAway, req.Away = true, s.Away
+		}
+		if len(e.SupportedFanModes) > 0 {
+			req.HasFanMode, req.FanMode = true, s.FanMode
+		}
+		if len(e.SupportedSwingModes) > 0 {
+			req.HasSwingMode, req.SwingMode = true, s.SwingMode
+		}
+		return req, nil
+	}
+	return nil, fmt.Errorf("%s entities don't accept commands", espgohome.GetMessageID(st.State))
+}
+
+// Apply sends the commands of the scene. Every entity is looked up and its
+// device checked before any command is sent, so that a scene that can't be
+// applied leaves the entities alone. The commands are then sent to the
+// devices concurrently; the ones that fail are listed in an *ApplyError.
+// transition is added to the light commands if it isn't zero.
+func (s *Scene) Apply(m *manager.Manager, transition time.Duration) error {
+	type send struct {
+		id  string
+		c   *espgohome.ESPHomeConnection
+		key uint32
+		req proto.Message
+	}
+	byDevice := make(map[*manager.Device][]send)
+	var devices []*manager.Device
+	for _, st := range s.States {
+		d, e, err := m.Entity(st.Entity)
+		if err != nil {
+			return fmt.Errorf("scene: %s: %v", st.Entity, err)
+		}
+		c := d.Conn()
+		if c == nil || !d.Connected() {
+			return fmt.Errorf("scene: %s: %s is not connected", st.Entity, d.Name())
+		}
+		if entity.CommandType(st.Command) != e.Type() {
+			return fmt.Errorf("scene: %s: %s is a %s, which doesn't accept %T", st.Entity, e.ObjectID(), e.Type(), st.Command)
+		}
+		req := proto.Clone(st.Command)
+		if l, ok := req.(*espgohome.LightCommandRequest); ok && transition > 0 {
+			l.HasTransitionLength, l.TransitionLength = true, uint32(transition/time.Millisecond)
+		}
+		if _, ok := byDevice[d]; !ok {
+			devices = append(devices, d)
+		}
+		byDevice[d] = append(byDevice[d], send{st.Entity, c, e.Key(), req})
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	for _, d := range devices {
+		wg.Add(1)
+		go func(sends []send) {
+			defer wg.Done()
+			for _, snd := range sends {
+				if err := entity.SendCommand(snd.c, snd.key, snd.req); err != nil {
+					mu.Lock()
+					errs[snd.id] = err
+					mu.Unlock()
+				}
+			}
+		}(byDevice[d])
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ApplyError{Errors: errs}
+	}
+	return nil
+}
+
+// typeName returns the name of the type of the entities req is sent to in
+// scene files
+func typeName(req proto.Message) string {
+	return strings.ToLower(entity.CommandType(req).String())
+}
+
+// stateYAML is a State in a scene file, Command holds the fields of the
+// request that are set, by their names in api.proto
+type stateYAML struct {
+	Entity  string                 `yaml:"entity"`
+	Type    string                 `yaml:"type"`
+	Command map[string]interface{} `yaml:"command"`
+}
+
+type sceneYAML struct {
+	Name     string      `yaml:"name"`
+	Captured time.Time   `yaml:"captured,omitempty"`
+	States   []stateYAML `yaml:"states"`
+}
+
+// Write writes the scene as YAML, the form Load reads
+func (s *Scene) Write(w io.Writer) error {
+	out := sceneYAML{Name: s.Name, Captured: s.Captured}
+	for _, st := range s.States {
+		fields, err := commandFields(st.Command)
+		if err != nil {
+			return err
+		}
+		out.States = append(out.States, stateYAML{st.Entity, typeName(st.Command), fields})
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// WriteFile writes the scene to a YAML file
+func (s *Scene) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads a scene from YAML:
+//
+//	name: evening
+//	states:
+//	  - entity: lounge/lamp
+//	    type: light
+//	    command: {state: true, brightness: 0.4, color_temperature: 370}
+//	  - entity: lounge/blind
+//	    type: cover
+//	    command: {position: 0}
+//
+// The has_* flags of the requests are set for the fields present.
+func Load(r io.Reader) (*Scene, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var in sceneYAML
+	if err := dec.Decode(&in); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("scene: %v", err)
+	}
+
+	s := &Scene{Name: in.Name, Captured: in.Captured}
+	for i, st := range in.States {
+		if i := strings.LastIndex(st.Entity, "/"); i <= 0 || i == len(st.Entity)-1 {
+			return nil, fmt.Errorf("scene: entity id %q is not of the form device/object_id", st.Entity)
+		}
+		var req proto.Message
+		for _, t := range entity.CommandTypes {
+			if strings.ToLower(t.String()) == st.Type {
+				req, _ = entity.NewCommand(t)
+			}
+		}
+		if req == nil {
+			return nil, fmt.Errorf("scene: state %d: unknown type %q", i+1, st.Type)
+		}
+		body, err := json.Marshal(st.Command)
+		if err != nil {
+			return nil, fmt.Errorf("scene: %s: %v", st.Entity, err)
+		}
+		if err := entity.DecodeCommand(body, req); err != nil {
+			return nil, fmt.Errorf("scene: %s: invalid command: %v", st.Entity, err)
+		}
+		s.States = append(s.States, State{Entity: st.Entity, Command: req})
+	}
+	if len(s.States) == 0 {
+		return nil, errors.New("scene: no states")
+	}
+	return s, nil
+}
+
+// LoadFile reads a scene from a YAML file
+func LoadFile(path string) (*Scene, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// commandFields returns the fields of req that are set, without the key and
+// the has_* flags, by their names in api.proto
+func commandFields(req proto.Message) (map[string]interface{}, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "key")
+	for name := range fields {
+		if strings.HasPrefix(name, "has_") {
+			continue
+		}
+		if has, ok := fields["has_"+name]; ok && has != true {
+			delete(fields, name)
+		}
+	}
+	for name := range fields {
+		if strings.HasPrefix(name, "has_") {
+			delete(fields, name)
+		}
+	}
+	return fields, nil
+}
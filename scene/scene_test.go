@@ -0,0 +1,141 @@
+package scene
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGroups(t *testing.T) {
+	g, err := LoadGroups(strings.NewReader(`
+groups:
+  lights: [kitchen/lamp, lounge/lamp]
+  downstairs: [lights, lounge/blind, kitchen/lamp]
+`))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	ids, err := g.Resolve("downstairs", "hall/switch")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if got, want := strings.Join(ids, ","), "kitchen/lamp,lounge/lamp,lounge/blind,hall/switch"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := g.Resolve("upstairs"); err == nil {
+		t.Errorf("no error for an unknown group")
+	}
+
+	for _, bad := range []string{
+		"groups:\n  a: [b]\n  b: [a]\n",
+		"groups:\n  a: [lamp/]\n",
+		"groups:\n  a/b: [c/d]\n",
+		"group:\n  a: [c/d]\n",
+	} {
+		if _, err := LoadGroups(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func TestScene(t *testing.T) {
+	m := manager.New("test-client")
+	defer m.Close()
+	_, commands := espgohometest.StartDevice(t, m, "lounge",
+		&espgohome.ListEntitiesLightResponse{ObjectId: "lamp", Key: 1, Name: "Lamp", SupportsBrightness: true, SupportsColorTemperature: true},
+		&espgohome.ListEntitiesCoverResponse{ObjectId: "blind", Key: 2, Name: "Blind", SupportsPosition: true},
+		&espgohome.ListEntitiesClimateResponse{ObjectId: "thermostat", Key: 3, Name: "Thermostat"},
+		&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 4, Name: "Temperature"},
+		&espgohome.LightStateResponse{Key: 1, State: true, Brightness: 0.4, ColorTemperature: 370},
+		&espgohome.CoverStateResponse{Key: 2, Position: 0.5},
+		&espgohome.ClimateStateResponse{Key: 3, Mode: espgohome.ClimateMode_CLIMATE_MODE_HEAT, TargetTemperature: 20.5},
+		&espgohome.SensorStateResponse{Key: 4, State: 19},
+	)
+
+	ids := []string{"lounge/lamp", "lounge/blind", "lounge/thermostat"}
+	if err := Wait(m, ids, 2*time.Second); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if _, err := Capture(m, "evening", []string{"lounge/temperature"}); err == nil {
+		t.Errorf("captured a sensor")
+	}
+	s, err := Capture(m, "evening", ids)
+	if err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if s, err = Load(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	if err := s.Apply(m, time.Second); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	got := make(map[string]proto.Message)
+	for range ids {
+		c := espgohometest.NextCommand(t, commands)
+		got[typeName(c)] = c
+	}
+	if l, ok := got["light"].(*espgohome.LightCommandRequest); !ok || l.Key != 1 || !l.HasState || !l.State || !l.HasBrightness || l.Brightness != 0.4 ||
+		!l.HasColorTemperature || l.ColorTemperature != 370 || l.HasRgb || !l.HasTransitionLength || l.TransitionLength != 1000 {
+		t.Errorf("unexpected light command %v", got["light"])
+	}
+	if c, ok := got["cover"].(*espgohome.CoverCommandRequest); !ok || c.Key != 2 || !c.HasPosition || c.Position != 0.5 || c.HasTilt {
+		t.Errorf("unexpected cover command %v", got["cover"])
+	}
+	if c, ok := got["climate"].(*espgohome.ClimateCommandRequest); !ok || c.Key != 3 || !c.HasMode || c.Mode != espgohome.ClimateMode_CLIMATE_MODE_HEAT ||
+		!c.HasTargetTemperature || c.TargetTemperature != 20.5 || c.HasAway {
+		t.Errorf("unexpected climate command %v", got["climate"])
+	}
+
+	// nothing is sent when an entity is missing
+	s.States = append(s.States, State{Entity: "hall/lamp", Command: &espgohome.LightCommandRequest{HasState: true}})
+	if err := s.Apply(m, 0); err == nil {
+		t.Errorf("no error for a missing entity")
+	}
+	select {
+	case c := <-commands:
+		t.Errorf("unexpected command %v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s, err := Load(strings.NewReader(`
+name: evening
+states:
+  - entity: lounge/lamp
+    type: light
+    command: {state: true, brightness: 0.4}
+  - entity: lounge/blind
+    type: cover
+    command: {position: 0}
+`))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if l, ok := s.States[0].Command.(*espgohome.LightCommandRequest); s.Name != "evening" || len(s.States) != 2 || !ok || !l.HasBrightness || l.HasRgb {
+		t.Errorf("unexpected scene %+v", s)
+	}
+
+	for _, bad := range []string{
+		"states:\n  - entity: a/b\n    type: sensor\n    command: {state: 1}\n",
+		"states:\n  - entity: a\n    type: light\n    command: {state: true}\n",
+		"states:\n  - entity: a/b\n    type: light\n    command: {colour: red}\n",
+		"name: empty\n",
+	} {
+		if _, err := Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/proto"
+)
+
+// validateCommand checks that the Command of a job is a valid command for at
+// least one type of entity, the type of the entity is only known once its
+// device has connected
+func validateCommand(command map[string]interface{}) error {
+	body, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	for _, t := range entity.CommandTypes {
+		req, _ := entity.NewCommand(t)
+		if err = entity.DecodeCommand(body, req); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid command: %v", err)
+}
+
+// send sends the command of j to its entity with the command methods of the
+// connection
+func (j *Job) send(m *manager.Manager) error {
+	d, e, err := m.Entity(j.Entity)
+	if err != nil {
+		return err
+	}
+	c := d.Conn()
+	if c == nil || !d.Connected() {
+		return fmt.Errorf("%s is not connected", d.Name())
+	}
+
+	req, err := j.request(e)
+	if err != nil {
+		return err
+	}
+	return entity.SendCommand(c, e.Key(), req)
+}
+
+// request returns the command request of j for e, a copy of Request or
+// Command decoded into the request type of e
+func (j *Job) request(e entity.Entity) (proto.Message, error) {
+	req, err := entity.NewCommand(e.Type())
+	if err != nil {
+		return nil, err
+	}
+	if j.Request != nil {
+		if entity.CommandType(j.Request) != e.Type() {
+			return nil, fmt.Errorf("%s is a %s, which doesn't accept %T", e.ObjectID(), e.Type(), j.Request)
+		}
+		return proto.Clone(j.Request), nil
+	}
+
+	body, err := json.Marshal(j.Command)
+	if err != nil {
+		return nil, err
+	}
+	if err := entity.DecodeCommand(body, req); err != nil {
+		return nil, fmt.Errorf("invalid command for %s: %v", e.Type(), err)
+	}
+	return req, nil
+}
@@ -0,0 +1,244 @@
+package schedule
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/proto"
+)
+
+// Greenwich
+const latitude, longitude = 51.48, -0.01
+
+func TestParse(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	for _, tc := range []struct {
+		spec, from, want string
+	}{
+		{"18:00", "2020-03-01 17:59", "2020-03-01 18:00"},
+		{"18:00", "2020-03-01 18:00", "2020-03-02 18:00"},
+		{"0 18 * * *", "2020-03-01 19:00", "2020-03-02 18:00"},
+		{"*/15 9-17 * * 1-5", "2020-03-06 17:50", "2020-03-09 09:00"},
+		{"30 6 * * 0,6", "2020-03-02 00:00", "2020-03-07 06:30"},
+		{"0 0 29 2 *", "2021-01-01 00:00", "2024-02-29 00:00"},
+		{"0 12 1 * 1", "2020-03-02 13:00", "2020-03-09 12:00"},
+		{"@weekly", "2020-03-02 00:00", "2020-03-08 00:00"},
+		{"@hourly", "2020-03-02 00:30", "2020-03-02 01:00"},
+	} {
+		spec, err := Parse(tc.spec, 0, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		if got := spec.Next(at(tc.from)); !got.Equal(at(tc.want)) {
+			t.Errorf("%s from %s: got %s, want %s", tc.spec, tc.from, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"61 * * * *", "* * *", "5-1 * * * *", "*/0 * * * *", "sunset", "sunset~5m", "25:00"} {
+		if _, err := Parse(bad, 0, 0); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func TestSun(t *testing.T) {
+	rise, set, ok := Sun(time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), latitude, longitude)
+	near := func(got time.Time, want string) bool {
+		w, _ := time.Parse("2006-01-02 15:04", want)
+		d := got.Sub(w)
+		return ok && d > -2*time.Minute && d < 2*time.Minute
+	}
+	if !near(rise, "2020-06-21 03:43") || !near(set, "2020-06-21 20:21") {
+		t.Errorf("unexpected sunrise %s and sunset %s", rise, set)
+	}
+	if _, _, ok := Sun(time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), 69.65, 18.96); ok {
+		t.Errorf("the sun sets at midsummer in Tromsø")
+	}
+
+	spec, err := Parse("sunset - 30m", latitude, longitude)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	next := spec.Next(time.Date(2020, 6, 21, 20, 0, 0, 0, time.UTC))
+	if want := set.Add(-30*time.Minute).AddDate(0, 0, 1); next.Sub(want) > 2*time.Minute || want.Sub(next) > 2*time.Minute {
+		t.Errorf("got %s, want about %s", next, want)
+	}
+}
+
+// lounge returns the entities of the device the tests schedule commands for
+func lounge() []proto.Message {
+	return []proto.Message{
+		&espgohome.ListEntitiesLightResponse{ObjectId: "lamp", Key: 1, Name: "Lamp", SupportsBrightness: true},
+		&espgohome.ListEntitiesCoverResponse{ObjectId: "blind", Key: 2, Name: "Blind", SupportsPosition: true},
+	}
+}
+
+// sleeping waits for the scheduler to wait for its clock
+func sleeping(t *testing.T, c *FakeClock) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduler isn't waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testJobs() []*Job {
+	return []*Job{
+		{
+			Name:    "lamp",
+			When:    "18:00",
+			Entity:  "lounge/lamp",
+			Command: map[string]interface{}{"state": true, "brightness": 0.8, "transition_length": 2000},
+			Missed:  MissedRunOnce,
+		},
+		{
+			Name:    "blind",
+			When:    "sunset",
+			Entity:  "lounge/blind",
+			Request: &espgohome.CoverCommandRequest{HasPosition: true, Position: 0},
+		},
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	m := manager.New("test-client")
+	defer m.Close()
+	_, commands := espgohometest.StartDevice(t, m, "lounge", lounge()...)
+
+	clock := NewFakeClock(time.Date(2020, 6, 21, 17, 0, 0, 0, time.UTC))
+	s := &Scheduler{Manager: m, Jobs: testJobs(), Latitude: latitude, Longitude: longitude, Location: time.UTC, StateFile: stateFile, Clock: clock}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	sleeping(t, clock)
+	clock.Advance(time.Hour)
+	light, ok := espgohometest.NextCommand(t, commands).(*espgohome.LightCommandRequest)
+	if !ok || light.Key != 1 || !light.HasState || !light.State || !light.HasBrightness || light.Brightness != 0.8 ||
+		!light.HasTransitionLength || light.TransitionLength != 2000 {
+		t.Errorf("unexpected light command %v", light)
+	}
+
+	sleeping(t, clock)
+	sunset := s.Next("blind")
+	if sunset.Hour() != 20 {
+		t.Errorf("unexpected sunset %s", sunset)
+	}
+	clock.Set(sunset)
+	if cover, ok := espgohometest.NextCommand(t, commands).(*espgohome.CoverCommandRequest); !ok || cover.Key != 2 || !cover.HasPosition || cover.Position != 0 {
+		t.Errorf("unexpected cover command %v", cover)
+	}
+	sleeping(t, clock)
+	s.Close()
+
+	b, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("no state file: %v", err)
+	}
+	var st state
+	if err := json.Unmarshal(b, &st); err != nil || !st.LastRuns["lamp"].Equal(time.Date(2020, 6, 21, 18, 0, 0, 0, time.UTC)) || !st.LastRuns["blind"].Equal(sunset) {
+		t.Errorf("unexpected state %s", b)
+	}
+
+	// two days later the lamp catches up once and the blind skips its runs
+	clock.Set(time.Date(2020, 6, 23, 19, 0, 0, 0, time.UTC))
+	s = &Scheduler{Manager: m, Jobs: testJobs(), Latitude: latitude, Longitude: longitude, Location: time.UTC, StateFile: stateFile, Clock: clock}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Close()
+	if _, ok := espgohometest.NextCommand(t, commands).(*espgohome.LightCommandRequest); !ok {
+		t.Errorf("the missed lamp run wasn't caught up")
+	}
+	sleeping(t, clock)
+	select {
+	case m := <-commands:
+		t.Errorf("unexpected command %v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetry(t *testing.T) {
+	m := manager.New("test-client")
+	defer m.Close()
+
+	clock := NewFakeClock(time.Date(2020, 6, 21, 17, 59, 0, 0, time.UTC))
+	jobs := testJobs()[:1]
+	s := &Scheduler{Manager: m, Jobs: jobs, Location: time.UTC, RetryInterval: time.Minute, Clock: clock}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	defer s.Close()
+
+	// the device is added after the run has failed
+	sleeping(t, clock)
+	clock.Advance(time.Minute)
+	sleeping(t, clock)
+	_, commands := espgohometest.StartDevice(t, m, "lounge", lounge()...)
+	clock.Advance(time.Minute)
+	if _, ok := espgohometest.NextCommand(t, commands).(*espgohome.LightCommandRequest); !ok {
+		t.Errorf("the failed run wasn't retried")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(strings.NewReader(`
+latitude: 51.48
+longitude: -0.01
+jobs:
+  - name: lamp
+    when: "18:00"
+    entity: lounge/lamp
+    command: {state: true, brightness: 0.8, transition_length: 2000}
+  - name: blind
+    when: sunset+15m
+    entity: lounge/blind
+    command: {position: 0}
+    missed: run_once
+`))
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(c.Jobs) != 2 || c.Latitude != 51.48 || c.Jobs[1].Missed != MissedRunOnce || c.Jobs[0].Command["transition_length"] != 2000 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	for _, bad := range []string{
+		"jobs:\n  - name: a\n    when: sunset\n    entity: a/b\n    command: {state: true}\n",
+		"jobs:\n  - name: a\n    when: \"18:00\"\n    entity: a/b\n    command: {colour: red}\n",
+		"jobs:\n  - name: a\n    when: \"18:00\"\n    entity: a\n    command: {state: true}\n",
+		"jobs:\n  - name: a\n    when: \"18:00\"\n    entity: a/b\n    command: {state: true}\n    missed: always\n",
+		"jobs:\n  - name: a\n    when: \"18:00\"\n    entity: a/b\n    comand: {state: true}\n",
+		"jobs: []\n",
+	} {
+		if _, err := Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+// Package schedule sends commands to the entities of the devices of a
+// manager.Manager at set times.
+//
+// A Job sends a command request to an entity on a schedule: a time of day, a
+// cron expression or an offset from sunrise or sunset. The Scheduler keeps
+// the time of the last run of every job in a state file, so that runs missed
+// while it was stopped can be caught up according to the policy of the job.
+// Time comes from a Clock, which tests replace with a FakeClock.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/entity"
+	"github.com/jdugan1024/espgohome/manager"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrorSchedulerClosed is returned by Start after Close has been called
+var ErrorSchedulerClosed = errors.New("schedule: scheduler closed")
+
+// Missed run policies
+const (
+	// MissedSkip drops the runs missed while the scheduler was stopped
+	MissedSkip = "skip"
+	// MissedRunOnce runs a job once when the scheduler starts if any of its
+	// runs were missed, and retries the runs that fail until they succeed
+	// or the next run is due
+	MissedRunOnce = "run_once"
+)
+
+// DefaultRetryInterval is used when Scheduler.RetryInterval is zero
+const DefaultRetryInterval = 30 * time.Second
+
+// Job is a command sent to an entity on a schedule
+type Job struct {
+	// Name identifies the job in the logs and the state file
+	Name string `yaml:"name"`
+	// When is the schedule of the job, in the syntax of Parse
+	When string `yaml:"when"`
+	// Entity is the "device/object_id" of the entity the command is sent to
+	Entity string `yaml:"entity"`
+	// Command holds the fields of the command request for the type of the
+	// entity, as in the JSON of the request, such as state, brightness and
+	// transition_length for lights. The has_* flags are set for the fields
+	// present.
+	Command map[string]interface{} `yaml:"command"`
+	// Request replaces Command in jobs declared in Go, it is one of the
+	// command requests of api.proto with the flags set and the key left out
+	Request proto.Message `yaml:"-"`
+	// Missed is MissedSkip, the default, or MissedRunOnce
+	Missed string `yaml:"missed"`
+}
+
+// Scheduler runs jobs against the devices of a Manager
+type Scheduler struct {
+	Manager *manager.Manager
+	// Jobs must not be modified once the scheduler is started
+	Jobs []*Job
+	// Latitude and Longitude locate the devices for the sunrise and sunset
+	// schedules, in degrees north and east
+	Latitude  float64
+	Longitude float64
+	// Location is the time zone of the schedules, time.Local if nil
+	Location *time.Location
+	// StateFile keeps the last runs of the jobs across restarts if set
+	StateFile string
+	// RetryInterval is the delay between the attempts at a failed run of a
+	// MissedRunOnce job
+	RetryInterval time.Duration
+	// Clock defaults to SystemClock
+	Clock Clock
+	// Logger receives the diagnostic messages of the scheduler and the runs
+	// of the jobs at LevelInfo
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu     sync.Mutex
+	specs  []Spec
+	next   []time.Time
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// state is the content of the state file
+type state struct {
+	// LastRuns are the scheduled times of the last runs by job name
+	LastRuns map[string]time.Time `json:"last_runs"`
+}
+
+// Validate checks that a job is complete, its schedule is parsed with the
+// location of the devices
+func (j *Job) Validate(latitude, longitude float64) (Spec, error) {
+	spec, err := j.validate(latitude, longitude)
+	if err != nil {
+		return nil, fmt.Errorf("schedule: job %q: %v", j.Name, err)
+	}
+	return spec, nil
+}
+
+func (j *Job) validate(latitude, longitude float64) (Spec, error) {
+	if j.Name == "" {
+		return nil, errors.New("no name")
+	}
+	spec, err := Parse(j.When, latitude, longitude)
+	if err != nil {
+		return nil, errors.New(strings.TrimPrefix(err.Error(), "schedule: "))
+	}
+	if i := strings.LastIndex(j.Entity, "/"); i <= 0 || i == len(j.Entity)-1 {
+		return nil, fmt.Errorf("entity %q is not of the form device/object_id", j.Entity)
+	}
+	switch {
+	case j.Request != nil && j.Command != nil:
+		return nil, errors.New("both a command and a request")
+	case j.Request != nil:
+		if entity.CommandType(j.Request) == espgohome.UndefinedEntity {
+			return nil, fmt.Errorf("%T is not a command request", j.Request)
+		}
+	case len(j.Command) == 0:
+		return nil, errors.New("no command")
+	default:
+		if err := validateCommand(j.Command); err != nil {
+			return nil, err
+		}
+	}
+	if j.Missed != "" && j.Missed != MissedSkip && j.Missed != MissedRunOnce {
+		return nil, fmt.Errorf("unknown missed run policy %q, expected %s or %s", j.Missed, MissedSkip, MissedRunOnce)
+	}
+	return spec, nil
+}
+
+// Start validates the jobs, catches up the missed runs and starts running
+// the jobs
+func (s *Scheduler) Start() error {
+	specs := make([]Spec, len(s.Jobs))
+	names := make(map[string]bool)
+	for i, j := range s.Jobs {
+		spec, err := j.Validate(s.Latitude, s.Longitude)
+		if err != nil {
+			return err
+		}
+		if names[j.Name] {
+			return fmt.Errorf("schedule: duplicate job %q", j.Name)
+		}
+		names[j.Name] = true
+		specs[i] = spec
+	}
+	st, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrorSchedulerClosed
+	}
+	if s.stop != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.specs = specs
+	s.next = make([]time.Time, len(s.Jobs))
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.run(st)
+
+	return nil
+}
+
+// Close stops the scheduler
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	started := s.stop != nil
+	s.mu.Unlock()
+
+	if started {
+		close(s.stop)
+		<-s.done
+	}
+
+	return nil
+}
+
+// Next returns when the job named name runs next, or the zero time if it
+// doesn't or the scheduler hasn't started
+func (s *Scheduler) Next(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, j := range s.Jobs {
+		if j.Name == name && s.next != nil {
+			return s.next[i]
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Scheduler) run(st *state) {
+	defer close(s.done)
+
+	// retries are the times failed runs of MissedRunOnce jobs are retried,
+	// zero if there is nothing to retry, and missed are their scheduled times
+	retries := make([]time.Time, len(s.Jobs))
+	missed := make([]time.Time, len(s.Jobs))
+	now := s.now()
+	for i, j := range s.Jobs {
+		s.setNext(i, s.specs[i].Next(now))
+		last, ok := st.LastRuns[j.Name]
+		if !ok {
+			continue
+		}
+		// the scheduled times between the last run and now were missed
+		for t := s.specs[i].Next(last.In(now.Location())); !t.IsZero() && !t.After(now); t = s.specs[i].Next(t) {
+			missed[i] = t
+		}
+		if missed[i].IsZero() {
+			continue
+		}
+		if j.Missed == MissedRunOnce {
+			s.log(espgohome.LevelInfo, "schedule: catching up a missed run", "job", j.Name, "scheduled", missed[i])
+			retries[i] = now
+		} else {
+			s.log(espgohome.LevelInfo, "schedule: skipping missed runs", "job", j.Name, "last_run", last)
+		}
+	}
+
+	for {
+		now := s.now()
+		var wake time.Time
+		for i := range s.Jobs {
+			for _, t := range []time.Time{s.nextRun(i), retries[i]} {
+				if !t.IsZero() && (wake.IsZero() || t.Before(wake)) {
+					wake = t
+				}
+			}
+		}
+		var timer <-chan time.Time
+		if !wake.IsZero() {
+			timer = s.clock().After(wake.Sub(now))
+		}
+
+		select {
+		case <-timer:
+			now = s.now()
+			for i, j := range s.Jobs {
+				scheduled := s.nextRun(i)
+				if !scheduled.IsZero() && !scheduled.After(now) {
+					s.setNext(i, s.specs[i].Next(now))
+				} else if !retries[i].IsZero() && !retries[i].After(now) {
+					scheduled = missed[i]
+				} else {
+					continue
+				}
+				retries[i] = time.Time{}
+				if err := s.runJob(j, scheduled, st); err != nil && j.Missed == MissedRunOnce {
+					retries[i], missed[i] = now.Add(s.retryInterval()), scheduled
+					s.log(espgohome.LevelDebug, "schedule: retrying", "job", j.Name, "retry", retries[i])
+				}
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// runJob sends the command of a job and records the run in the state file.
+// The failed runs of MissedRunOnce jobs aren't recorded so that they are
+// caught up after a restart.
+func (s *Scheduler) runJob(j *Job, scheduled time.Time, st *state) error {
+	err := j.send(s.Manager)
+	if err != nil {
+		s.log(espgohome.LevelWarn, "schedule: job failed", "job", j.Name, "entity", j.Entity, "error", err)
+		if j.Missed == MissedRunOnce {
+			return err
+		}
+	} else {
+		s.log(espgohome.LevelInfo, "schedule: job run", "job", j.Name, "entity", j.Entity, "scheduled", scheduled)
+	}
+
+	st.LastRuns[j.Name] = scheduled
+	if err := s.save(st); err != nil {
+		s.log(espgohome.LevelWarn, "schedule: saving the state failed", "file", s.StateFile, "error", err)
+	}
+	return err
+}
+
+func (s *Scheduler) setNext(i int, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next[i] = t
+	if !t.IsZero() {
+		s.log(espgohome.LevelDebug, "schedule: next run", "job", s.Jobs[i].Name, "time", t)
+	}
+}
+
+func (s *Scheduler) nextRun(i int) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.next[i]
+}
+
+// load reads the state file, a missing file is an empty state
+func (s *Scheduler) load() (*state, error) {
+	st := &state{LastRuns: make(map[string]time.Time)}
+	if s.StateFile == "" {
+		return st, nil
+	}
+	b, err := ioutil.ReadFile(s.StateFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("schedule: %s: %v", s.StateFile, err)
+	}
+	if st.LastRuns == nil {
+		st.LastRuns = make(map[string]time.Time)
+	}
+	return st, nil
+}
+
+// save replaces the state file atomically
+func (s *Scheduler) save(st *state) error {
+	if s.StateFile == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.StateFile), filepath.Base(s.StateFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.StateFile)
+}
+
+func (s *Scheduler) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return DefaultRetryInterval
+}
+
+func (s *Scheduler) now() time.Time {
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	return s.clock().Now().In(loc)
+}
+
+func (s *Scheduler) clock() Clock {
+	if s.Clock != nil {
+		return s.Clock
+	}
+	return SystemClock
+}
+
+func (s *Scheduler) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(s.Logger, s.Debug).Log(level, msg, keyvals...)
+}
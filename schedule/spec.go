@@ -0,0 +1,225 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec computes the times a job runs
+type Spec interface {
+	// Next returns the first time strictly after t, in the location of t,
+	// or the zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule:
+//
+//	15:04             every day at this time
+//	0 18 * * 1-5      a cron expression: minute, hour, day of month, month
+//	                  and day of week, with lists, ranges and steps
+//	@hourly, @daily, @weekly, @monthly
+//	sunrise, sunset   optionally with an offset such as sunset-30m
+//
+// The sun schedules need the latitude and longitude of the devices, in
+// degrees north and east.
+func Parse(s string, latitude, longitude float64) (Spec, error) {
+	s = strings.TrimSpace(s)
+	for _, event := range []string{"sunrise", "sunset"} {
+		if !strings.HasPrefix(s, event) {
+			continue
+		}
+		if latitude == 0 && longitude == 0 {
+			return nil, fmt.Errorf("schedule: %s needs a latitude and longitude", event)
+		}
+		var offset time.Duration
+		if rest := strings.TrimSpace(s[len(event):]); rest != "" {
+			if rest[0] != '+' && rest[0] != '-' {
+				return nil, fmt.Errorf("schedule: invalid %s offset %q", event, rest)
+			}
+			d, err := time.ParseDuration(strings.TrimPrefix(strings.Replace(rest, " ", "", -1), "+"))
+			if err != nil {
+				return nil, fmt.Errorf("schedule: invalid %s offset %q", event, rest)
+			}
+			offset = d
+		}
+		return &sunSpec{sunset: event == "sunset", offset: offset, latitude: latitude, longitude: longitude}, nil
+	}
+
+	switch s {
+	case "@hourly":
+		s = "0 * * * *"
+	case "@daily":
+		s = "0 0 * * *"
+	case "@weekly":
+		s = "0 0 * * 0"
+	case "@monthly":
+		s = "0 0 1 * *"
+	}
+	if t, err := time.Parse("15:04", s); err == nil {
+		s = fmt.Sprintf("%d %d * * *", t.Minute(), t.Hour())
+	}
+	spec, err := parseCron(s)
+	if err != nil {
+		return nil, fmt.Errorf("schedule: %q: %v", s, err)
+	}
+	return spec, nil
+}
+
+// cronSpec is a parsed cron expression, each field is a bit set
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set when the fields are *, if both are
+	// restricted a day matches either of them as in cron
+	domStar, dowStar bool
+}
+
+// cronFields are the names and ranges of the cron fields
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(s string) (*cronSpec, error) {
+	fields := strings.Fields(s)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("expected 15:04, a cron expression, @daily or sunrise or sunset")
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// 7 is another name for Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSpec{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, n or n-m, each
+// optionally followed by /step
+func parseCronField(f string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			i := strings.Index(part, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(part[:i])
+			hi, err2 = strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil || lo > hi {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			set |= 1 << uint(n)
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSpec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	// a satisfiable expression, even one for February 29, matches within the
+	// leap year cycle
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.day(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// day reports whether the day of t matches the day of month and day of week
+func (c *cronSpec) day(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// sunSpec runs at sunrise or sunset plus an offset
+type sunSpec struct {
+	sunset              bool
+	offset              time.Duration
+	latitude, longitude float64
+}
+
+func (s *sunSpec) Next(t time.Time) time.Time {
+	// start the day before in case the offset moves its event past t
+	day := time.Date(t.Year(), t.Month(), t.Day()-1, 12, 0, 0, 0, t.Location())
+	for i := 0; i < 370; i++ {
+		rise, set, ok := Sun(day.AddDate(0, 0, i), s.latitude, s.longitude)
+		if !ok {
+			continue
+		}
+		event := rise
+		if s.sunset {
+			event = set
+		}
+		if event = event.Add(s.offset).In(t.Location()); event.After(t) {
+			return event
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"math"
+	"time"
+)
+
+// julian2000 is the Julian date of 2000-01-01 12:00 UTC
+const julian2000 = 2451545.0
+
+// Sun returns the times of sunrise and sunset on the day of date, in the
+// location of date, at latitude and longitude in degrees north and east. ok
+// is false on the days the sun doesn't rise or set. The times follow the
+// sunrise equation used by NOAA and are accurate to a minute or two.
+func Sun(date time.Time, latitude, longitude float64) (sunrise, sunset time.Time, ok bool) {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(float64(noon.Unix())/86400 + 2440587.5 - julian2000)
+
+	// mean solar noon and the solar mean anomaly
+	j := n - longitude/360
+	m := math.Mod(357.5291+0.98560028*j, 360)
+	mr := radians(m)
+	// equation of the center and ecliptic longitude
+	c := 1.9148*math.Sin(mr) + 0.02*math.Sin(2*mr) + 0.0003*math.Sin(3*mr)
+	lambda := radians(math.Mod(m+c+180+102.9372, 360))
+	transit := julian2000 + j + 0.0053*math.Sin(mr) - 0.0069*math.Sin(2*lambda)
+
+	// declination of the sun and hour angle, with -0.833° for refraction and
+	// the radius of the sun
+	sinDelta := math.Sin(lambda) * math.Sin(radians(23.4397))
+	cosDelta := math.Cos(math.Asin(sinDelta))
+	phi := radians(latitude)
+	cosOmega := (math.Sin(radians(-0.833)) - math.Sin(phi)*sinDelta) / (math.Cos(phi) * cosDelta)
+	if cosOmega < -1 || cosOmega > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	omega := degrees(math.Acos(cosOmega))
+
+	sunrise = julianTime(transit - omega/360).In(date.Location())
+	sunset = julianTime(transit + omega/360).In(date.Location())
+	return sunrise, sunset, true
+}
+
+func julianTime(j float64) time.Time {
+	return time.Unix(0, int64((j-2440587.5)*86400*1e9)).Round(time.Second)
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of a YAML schedule file
+type Config struct {
+	// Latitude and Longitude are needed by the sunrise and sunset schedules
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Jobs      []*Job  `yaml:"jobs"`
+}
+
+// Load reads a schedule from YAML and validates its jobs:
+//
+//	latitude: 51.48
+//	longitude: -0.01
+//	jobs:
+//	  - name: porch light
+//	    when: "18:00"
+//	    entity: porch/light
+//	    command: {state: true, brightness: 0.8, transition_length: 2000}
+//	  - name: blinds
+//	    when: sunset+15m
+//	    entity: lounge/blind
+//	    command: {position: 0}
+//	    missed: run_once
+func Load(r io.Reader) (*Config, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var c Config
+	if err := dec.Decode(&c); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("schedule: %v", err)
+	}
+
+	if len(c.Jobs) == 0 {
+		return nil, errors.New("schedule: no jobs")
+	}
+	names := make(map[string]bool)
+	for i, j := range c.Jobs {
+		if j == nil {
+			return nil, fmt.Errorf("schedule: job %d is empty", i+1)
+		}
+		if _, err := j.Validate(c.Latitude, c.Longitude); err != nil {
+			return nil, err
+		}
+		if names[j.Name] {
+			return nil, fmt.Errorf("schedule: duplicate job %q", j.Name)
+		}
+		names[j.Name] = true
+	}
+	return &c, nil
+}
+
+// LoadFile reads a schedule from a YAML file
+func LoadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
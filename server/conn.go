@@ -0,0 +1,343 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// apiVersionMajor and apiVersionMinor are the protocol versions described by api.proto
+const (
+	apiVersionMajor = 1
+	apiVersionMinor = 3
+)
+
+// cameraChunkSize is the size of the CameraImageResponse chunks sent by the
+// ESP32 camera component
+const cameraChunkSize = 1024
+
+// queueSize is how many messages are queued for a client before it is
+// disconnected as too slow
+const queueSize = 256
+
+// conn is a single client connection to a Server
+type conn struct {
+	server *Server
+	nc     net.Conn
+	reader *bufio.Reader
+	// queue holds the messages waiting to be written by writeLoop, so that
+	// a client that doesn't read can't hold up SetState or Log
+	queue chan proto.Message
+	// stop is closed when the client is done, writeLoop then writes what is
+	// already queued and closes stopped
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu            sync.Mutex
+	hello         bool
+	clientInfo    string
+	authenticated bool
+	states        bool
+	logLevel      espgohome.LogLevel
+	cameraSingle  bool
+	cameraStream  bool
+	closed        bool
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	return &conn{
+		server:  s,
+		nc:      nc,
+		reader:  bufio.NewReader(nc),
+		queue:   make(chan proto.Message, queueSize),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (c *conn) serve() {
+	go c.writeLoop()
+	defer func() {
+		close(c.stop)
+		<-c.stopped
+		c.close()
+	}()
+
+	for {
+		msgType, msg, err := espgohome.ReadMessage(c.reader)
+		if err != nil {
+			if msg == nil && msgType == 0 {
+				c.log(espgohome.LevelDebug, "server: read failed", "error", err)
+				return
+			}
+			// a well framed message we don't understand, skip it
+			c.log(espgohome.LevelWarn, "server: unable to decode message", "type", msgType, "error", err)
+			continue
+		}
+
+		if !c.handle(msgType, msg) {
+			return
+		}
+	}
+}
+
+// handle processes a single message, returning false if the connection
+// should be closed
+func (c *conn) handle(msgType espgohome.MessageID, msg proto.Message) bool {
+	s := c.server
+
+	switch msgType {
+	case espgohome.HelloRequestID:
+		c.mu.Lock()
+		c.hello = true
+		c.clientInfo = msg.(*espgohome.HelloRequest).ClientInfo
+		c.mu.Unlock()
+		c.send(&espgohome.HelloResponse{
+			ApiVersionMajor: apiVersionMajor,
+			ApiVersionMinor: apiVersionMinor,
+			ServerInfo:      s.ServerInfo,
+		})
+		return true
+	case espgohome.ConnectRequestID:
+		if !c.helloDone() {
+			c.log(espgohome.LevelWarn, "server: ConnectRequest sent before HelloRequest")
+			return false
+		}
+		req := msg.(*espgohome.ConnectRequest)
+		c.mu.Lock()
+		clientInfo := c.clientInfo
+		c.mu.Unlock()
+		invalid := !s.authenticate(clientInfo, req.Password)
+		c.send(&espgohome.ConnectResponse{InvalidPassword: invalid})
+		if invalid {
+			// the spec requires an immediate close without a DisconnectRequest
+			return false
+		}
+		c.mu.Lock()
+		c.authenticated = true
+		c.mu.Unlock()
+		return true
+	case espgohome.DisconnectRequestID:
+		c.send(&espgohome.DisconnectResponse{})
+		return false
+	case espgohome.DisconnectResponseID:
+		return false
+	case espgohome.PingRequestID:
+		c.send(&espgohome.PingResponse{})
+		return true
+	case espgohome.PingResponseID:
+		return true
+	case espgohome.GetTimeRequestID:
+		c.send(&espgohome.GetTimeResponse{EpochSeconds: uint32(time.Now().Unix())})
+		return true
+	case espgohome.DeviceInfoRequestID:
+		info := s.Info
+		if info == nil {
+			info = &espgohome.DeviceInfoResponse{}
+		}
+		c.send(info)
+		return true
+	}
+
+	if !c.isAuthenticated() {
+		c.log(espgohome.LevelWarn, "server: message sent before authentication", "type", msgType)
+		return false
+	}
+
+	switch m := msg.(type) {
+	case *espgohome.ListEntitiesRequest:
+		entities, services := s.listing()
+		for _, e := range entities {
+			if pm, ok := e.(proto.Message); ok {
+				c.send(pm)
+			}
+		}
+		for _, svc := range services {
+			c.send(svc)
+		}
+		c.send(&espgohome.ListEntitiesDoneResponse{})
+	case *espgohome.SubscribeStatesRequest:
+		c.mu.Lock()
+		c.states = true
+		c.mu.Unlock()
+		for _, state := range s.currentStates() {
+			c.send(state)
+		}
+	case *espgohome.SubscribeLogsRequest:
+		c.mu.Lock()
+		c.logLevel = m.Level
+		c.mu.Unlock()
+		if m.DumpConfig {
+			for _, line := range s.Config {
+				c.send(&espgohome.SubscribeLogsResponse{Level: espgohome.LogLevel_LOG_LEVEL_INFO, Message: line})
+			}
+		}
+	case *espgohome.SwitchCommandRequest:
+		if s.OnSwitchCommand != nil {
+			s.OnSwitchCommand(m)
+		}
+	case *espgohome.LightCommandRequest:
+		if s.OnLightCommand != nil {
+			s.OnLightCommand(m)
+		}
+	case *espgohome.CoverCommandRequest:
+		if s.OnCoverCommand != nil {
+			s.OnCoverCommand(m)
+		}
+	case *espgohome.FanCommandRequest:
+		if s.OnFanCommand != nil {
+			s.OnFanCommand(m)
+		}
+	case *espgohome.ClimateCommandRequest:
+		if s.OnClimateCommand != nil {
+			s.OnClimateCommand(m)
+		}
+	case *espgohome.ExecuteServiceRequest:
+		if s.OnExecuteService != nil {
+			s.OnExecuteService(m)
+		}
+	case *espgohome.CameraImageRequest:
+		c.mu.Lock()
+		c.cameraSingle = c.cameraSingle || m.Single
+		c.cameraStream = m.Stream
+		c.mu.Unlock()
+		if s.OnCameraImage != nil {
+			s.OnCameraImage(m)
+		}
+	default:
+		c.log(espgohome.LevelDebug, "server: unsupported message", "type", msgType)
+	}
+
+	return true
+}
+
+// log logs a message with the client address added
+func (c *conn) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	c.server.log(level, msg, append([]interface{}{"client", c.nc.RemoteAddr().String()}, keyvals...)...)
+}
+
+// send queues a response to a request of the client, waiting for room in
+// the queue
+func (c *conn) send(m proto.Message) {
+	select {
+	case c.queue <- m:
+	case <-c.stopped:
+	}
+}
+
+// push queues a message sent to every client, a client whose queue is full
+// is disconnected rather than holding up the others
+func (c *conn) push(m proto.Message) {
+	select {
+	case c.queue <- m:
+	case <-c.stopped:
+	default:
+		c.log(espgohome.LevelWarn, "server: disconnecting a slow client", "message", fmt.Sprintf("%T", m))
+		c.close()
+	}
+}
+
+func (c *conn) pushImage(key uint32, image []byte) {
+	for len(image) > cameraChunkSize {
+		c.push(&espgohome.CameraImageResponse{Key: key, Data: image[:cameraChunkSize]})
+		image = image[cameraChunkSize:]
+	}
+	c.push(&espgohome.CameraImageResponse{Key: key, Data: image, Done: true})
+}
+
+// writeLoop writes the queued messages until the connection fails or the
+// client is done
+func (c *conn) writeLoop() {
+	defer close(c.stopped)
+
+	for {
+		select {
+		case m := <-c.queue:
+			if !c.write(m) {
+				return
+			}
+		case <-c.stop:
+			// the last responses, such as a DisconnectResponse, are sent
+			// before the connection is closed
+			for {
+				select {
+				case m := <-c.queue:
+					if !c.write(m) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *conn) write(m proto.Message) bool {
+	c.nc.SetWriteDeadline(time.Now().Add(c.server.writeTimeout()))
+	if err := espgohome.WriteMessage(c.nc, m); err != nil {
+		c.log(espgohome.LevelDebug, "server: send failed", "message", fmt.Sprintf("%T", m), "error", err)
+		c.close()
+		return false
+	}
+	return true
+}
+
+func (c *conn) helloDone() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hello
+}
+
+func (c *conn) isAuthenticated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.authenticated
+}
+
+func (c *conn) wantsStates() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.authenticated && c.states
+}
+
+func (c *conn) wantsLog(level espgohome.LogLevel) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.authenticated && c.logLevel != espgohome.LogLevel_LOG_LEVEL_NONE && level <= c.logLevel
+}
+
+// takeCameraRequest reports whether an image should be sent, clearing a
+// pending single image request
+func (c *conn) takeCameraRequest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.authenticated {
+		return false
+	}
+	want := c.cameraSingle || c.cameraStream
+	c.cameraSingle = false
+
+	return want
+}
+
+func (c *conn) close() {
+	c.mu.Lock()
+	closed := c.closed
+	c.closed = true
+	c.mu.Unlock()
+
+	if !closed {
+		c.nc.Close()
+	}
+}
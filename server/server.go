@@ -0,0 +1,292 @@
+// Package server implements the device side of the ESPHome native API.
+//
+// A Server holds a set of virtual entities and their current states and
+// presents them to any number of API clients, such as Home Assistant or an
+// espgohome.ESPHomeConnection. Commands sent by clients are dispatched to Go
+// callbacks.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrorServerClosed is returned by Serve after Close has been called.
+var ErrorServerClosed = errors.New("Server closed")
+
+// DefaultWriteTimeout is how long writing a message to a client may take
+// before the client is disconnected
+const DefaultWriteTimeout = 10 * time.Second
+
+// Server emulates an ESPHome device
+type Server struct {
+	// Password required in the ConnectRequest, an empty password accepts any client
+	Password string
+	// Authenticate, if set, checks the client info of the HelloRequest and
+	// the password of the ConnectRequest instead of Password
+	Authenticate func(clientInfo, password string) bool
+	// ServerInfo is reported to clients in the HelloResponse
+	ServerInfo string
+	// Info is returned in response to a DeviceInfoRequest
+	Info *espgohome.DeviceInfoResponse
+	// Config is sent line by line to clients that subscribe to logs with
+	// dump_config set, as a device logs its configuration
+	Config []string
+	// Logger receives the diagnostic messages of the server
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+	// WriteTimeout overrides DefaultWriteTimeout
+	WriteTimeout time.Duration
+
+	// Command callbacks, called from the goroutine serving the client that
+	// sent the command. A nil callback ignores the command.
+	OnSwitchCommand  func(*espgohome.SwitchCommandRequest)
+	OnLightCommand   func(*espgohome.LightCommandRequest)
+	OnCoverCommand   func(*espgohome.CoverCommandRequest)
+	OnFanCommand     func(*espgohome.FanCommandRequest)
+	OnClimateCommand func(*espgohome.ClimateCommandRequest)
+	OnExecuteService func(*espgohome.ExecuteServiceRequest)
+	OnCameraImage    func(*espgohome.CameraImageRequest)
+
+	mu        sync.Mutex
+	entities  []espgohome.Entity
+	services  []*espgohome.ListEntitiesServicesResponse
+	states    map[uint32]proto.Message
+	clients   map[*conn]bool
+	listeners map[net.Listener]bool
+	closed    bool
+}
+
+// keyed is implemented by all state messages
+type keyed interface {
+	GetKey() uint32
+}
+
+// AddEntity registers an entity, e must be one of the ListEntities*Response messages
+func (s *Server) AddEntity(e espgohome.Entity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entities = append(s.entities, e)
+}
+
+// AddService registers a user defined service that clients can execute
+func (s *Server) AddService(svc *espgohome.ListEntitiesServicesResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.services = append(s.services, svc)
+}
+
+// SetState records the current state of an entity and sends it to all
+// clients that have subscribed to states. state must be one of the
+// *StateResponse messages. Messages to each client are queued, a client that
+// falls too far behind is disconnected.
+func (s *Server) SetState(state proto.Message) {
+	k, ok := state.(keyed)
+	if !ok {
+		s.log(espgohome.LevelWarn, "server: state has no key", "message", fmt.Sprintf("%T", state))
+		return
+	}
+
+	s.mu.Lock()
+	if s.states == nil {
+		s.states = make(map[uint32]proto.Message)
+	}
+	s.states[k.GetKey()] = state
+	s.mu.Unlock()
+
+	for _, c := range s.snapshot() {
+		if c.wantsStates() {
+			c.push(state)
+		}
+	}
+}
+
+// State returns the last state set for key
+func (s *Server) State(key uint32) (proto.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	return state, ok
+}
+
+// Log sends a log message to all clients that subscribed at level or above
+func (s *Server) Log(level espgohome.LogLevel, tag string, message string) {
+	msg := &espgohome.SubscribeLogsResponse{Level: level, Tag: tag, Message: message}
+	for _, c := range s.snapshot() {
+		if c.wantsLog(level) {
+			c.push(msg)
+		}
+	}
+}
+
+// SendCameraImage sends an image to every client that has requested one,
+// splitting it into chunks as an ESP32 camera would.
+func (s *Server) SendCameraImage(key uint32, image []byte) {
+	for _, c := range s.snapshot() {
+		if c.takeCameraRequest() {
+			c.pushImage(key, image)
+		}
+	}
+}
+
+// ListenAndServe listens on the TCP address and serves clients
+func (s *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until l fails or the Server is closed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrorServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrorServerClosed
+			}
+			return err
+		}
+
+		go s.ServeConn(nc)
+	}
+}
+
+// ServeConn serves a single client until it disconnects. It can be used with
+// the net.Conn returned by ESPHomeConnection.Pipe()
+func (s *Server) ServeConn(nc net.Conn) {
+	c := newConn(s, nc)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		nc.Close()
+		return
+	}
+	if s.clients == nil {
+		s.clients = make(map[*conn]bool)
+	}
+	s.clients[c] = true
+	s.mu.Unlock()
+
+	c.serve()
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// Close stops all listeners and disconnects all clients
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.listeners = nil
+	s.mu.Unlock()
+
+	for l := range listeners {
+		l.Close()
+	}
+	for _, c := range s.snapshot() {
+		c.close()
+	}
+
+	return nil
+}
+
+// authenticate checks the password of a ConnectRequest
+func (s *Server) authenticate(clientInfo, password string) bool {
+	if s.Authenticate != nil {
+		return s.Authenticate(clientInfo, password)
+	}
+	return s.Password == "" || password == s.Password
+}
+
+func (s *Server) writeTimeout() time.Duration {
+	if s.WriteTimeout > 0 {
+		return s.WriteTimeout
+	}
+	return DefaultWriteTimeout
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// snapshot returns the currently connected clients so that messages can be
+// sent without holding the lock
+func (s *Server) snapshot() []*conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clients := make([]*conn, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+
+	return clients
+}
+
+func (s *Server) listing() ([]espgohome.Entity, []*espgohome.ListEntitiesServicesResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entities := make([]espgohome.Entity, len(s.entities))
+	copy(entities, s.entities)
+	services := make([]*espgohome.ListEntitiesServicesResponse, len(s.services))
+	copy(services, s.services)
+
+	return entities, services
+}
+
+func (s *Server) currentStates() []proto.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]proto.Message, 0, len(s.states))
+	for _, e := range s.entities {
+		if state, ok := s.states[e.GetKey()]; ok {
+			states = append(states, state)
+		}
+	}
+
+	return states
+}
+
+func (s *Server) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(s.Logger, s.Debug).Log(level, msg, keyvals...)
+}
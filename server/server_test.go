@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestServer() *Server {
+	s := &Server{
+		Password:   "secret",
+		ServerInfo: "test-server",
+		Info:       &espgohome.DeviceInfoResponse{Name: "gadget", MacAddress: "AC:BC:32:89:0E:A9"},
+	}
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"})
+	s.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 2, Name: "Temperature"})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 1, State: true})
+
+	return s
+}
+
+func connect(t *testing.T, s *Server, password string) *espgohome.ESPHomeConnection {
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client", Password: password}
+	go s.ServeConn(c.Pipe())
+
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+
+	return c
+}
+
+func TestHandshake(t *testing.T) {
+	s := newTestServer()
+	c := connect(t, s, "secret")
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	info, err := c.DeviceInfo()
+	if err != nil {
+		t.Fatalf("device info failed: %v", err)
+	}
+	if info.Name != "gadget" {
+		t.Errorf("expected name gadget, got %q", info.Name)
+	}
+
+	entities, err := c.ListEntities()
+	if err != nil {
+		t.Fatalf("list entities failed: %v", err)
+	}
+	if len(entities) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(entities))
+	}
+	if entities[0].GetObjectId() != "relay" || entities[1].GetObjectId() != "temperature" {
+		t.Errorf("unexpected entities: %v", entities)
+	}
+
+	if err := c.Disconnect(); err != nil {
+		t.Errorf("disconnect failed: %v", err)
+	}
+}
+
+func TestBadPassword(t *testing.T) {
+	s := newTestServer()
+	c := connect(t, s, "wrong")
+
+	if err := c.Connect(); err == nil {
+		t.Error("succeeded with the wrong password!")
+	}
+}
+
+func TestUnauthenticatedRequest(t *testing.T) {
+	s := newTestServer()
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+
+	r := bufio.NewReader(client)
+
+	// net.Pipe is unbuffered so each request has to be read before the next is sent
+	espgohome.WriteMessage(client, &espgohome.HelloRequest{})
+	if _, _, err := espgohome.ReadMessage(r); err != nil {
+		t.Fatalf("expected HelloResponse: %v", err)
+	}
+	espgohome.WriteMessage(client, &espgohome.ListEntitiesRequest{})
+	if msgType, _, err := espgohome.ReadMessage(r); err == nil {
+		t.Errorf("expected the connection to be closed, got %s", msgType)
+	}
+}
+
+func TestStates(t *testing.T) {
+	s := newTestServer()
+	c := connect(t, s, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	states, err := c.SubscribeStates()
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	m := <-states
+	if sw, ok := m.(*espgohome.SwitchStateResponse); !ok || !sw.State {
+		t.Errorf("expected initial switch state, got %v", m)
+	}
+
+	go s.SetState(&espgohome.SensorStateResponse{Key: 2, State: 21.5})
+
+	m = <-states
+	if sensor, ok := m.(*espgohome.SensorStateResponse); !ok || sensor.State != 21.5 {
+		t.Errorf("expected sensor state, got %v", m)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	s := newTestServer()
+	switches := make(chan *espgohome.SwitchCommandRequest, 1)
+	lights := make(chan *espgohome.LightCommandRequest, 1)
+	s.OnSwitchCommand = func(req *espgohome.SwitchCommandRequest) {
+		switches <- req
+	}
+	s.OnLightCommand = func(req *espgohome.LightCommandRequest) {
+		lights <- req
+	}
+
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	r := bufio.NewReader(client)
+
+	espgohome.WriteMessage(client, &espgohome.HelloRequest{})
+	espgohome.ReadMessage(r)
+	espgohome.WriteMessage(client, &espgohome.ConnectRequest{Password: "secret"})
+	espgohome.ReadMessage(r)
+	espgohome.WriteMessage(client, &espgohome.SwitchCommandRequest{Key: 1, State: false})
+	espgohome.WriteMessage(client, &espgohome.LightCommandRequest{Key: 3, HasBrightness: true, Brightness: 0.5})
+
+	select {
+	case req := <-switches:
+		if req.Key != 1 || req.State {
+			t.Errorf("unexpected switch command: %v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("switch command not dispatched")
+	}
+
+	select {
+	case req := <-lights:
+		if req.Key != 3 || req.Brightness != 0.5 {
+			t.Errorf("unexpected light command: %v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("light command not dispatched")
+	}
+}
+
+func TestLogs(t *testing.T) {
+	s := newTestServer()
+	c := connect(t, s, "secret")
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+
+	logs, err := c.SubscribeLogs(espgohome.LogLevel_LOG_LEVEL_INFO)
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	// make sure the subscription has been processed
+	if err := c.Ping(); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	go func() {
+		s.Log(espgohome.LogLevel_LOG_LEVEL_DEBUG, "app", "too verbose")
+		s.Log(espgohome.LogLevel_LOG_LEVEL_WARN, "app", "warning")
+	}()
+
+	m := (<-logs).(*espgohome.SubscribeLogsResponse)
+	if m.Message != "warning" {
+		t.Errorf("expected the warning, got %q", m.Message)
+	}
+}
+
+func TestListenAndClose(t *testing.T) {
+	s := newTestServer()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(l)
+	}()
+
+	c := &espgohome.ESPHomeConnection{ClientInfo: "test-client", Password: "secret"}
+	if err := c.Dial(l.Addr().String()); err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	if err := c.Hello(); err != nil {
+		t.Fatalf("hello failed: %v", err)
+	}
+
+	s.Close()
+	if err := <-done; err != ErrorServerClosed {
+		t.Errorf("expected ErrorServerClosed, got %v", err)
+	}
+}
+
+func TestSlowClient(t *testing.T) {
+	s := newTestServer()
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+
+	r := bufio.NewReader(client)
+	for _, req := range []proto.Message{
+		&espgohome.HelloRequest{},
+		&espgohome.ConnectRequest{Password: "secret"},
+	} {
+		espgohome.WriteMessage(client, req)
+		if _, _, err := espgohome.ReadMessage(r); err != nil {
+			t.Fatalf("handshake failed: %v", err)
+		}
+	}
+	espgohome.WriteMessage(client, &espgohome.SubscribeStatesRequest{})
+
+	// the client never reads the states, SetState mustn't wait for it
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*queueSize; i++ {
+			s.SetState(&espgohome.SensorStateResponse{Key: 2, State: float32(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SetState is blocked by a slow client")
+	}
+
+	// the queued states are followed by the end of the connection
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := espgohome.ReadMessage(r)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatal("the slow client wasn't disconnected")
+		}
+		if err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CSVHeader are the columns of the CSV sink, the same for every type of entity
+var CSVHeader = []string{"time", "device", "type", "object_id", "name", "unit", "device_class", "field", "value"}
+
+// CSV writes readings to W as CSV, one reading per row
+type CSV struct {
+	W io.Writer
+	// NoHeader leaves out the header row, for appending to a file that
+	// already has one
+	NoHeader bool
+
+	mu     sync.Mutex
+	header bool
+}
+
+// WriteReadings implements Sink
+func (s *CSV) WriteReadings(readings []Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := csv.NewWriter(s.W)
+	if !s.NoHeader && !s.header {
+		w.Write(CSVHeader)
+	}
+	for _, r := range readings {
+		w.Write([]string{
+			r.Time.UTC().Format(time.RFC3339Nano),
+			r.Device,
+			r.Type,
+			r.ObjectID,
+			r.Name,
+			r.Unit,
+			r.DeviceClass,
+			r.Field,
+			strconv.FormatFloat(r.Value, 'f', -1, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	s.header = true
+	return nil
+}
@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the requests of InfluxHTTP without a Client
+const DefaultTimeout = 30 * time.Second
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+// LineProtocol writes readings to W as InfluxDB line protocol
+type LineProtocol struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// WriteReadings implements Sink
+func (s *LineProtocol) WriteReadings(readings []Reading) error {
+	b := AppendLineProtocol(nil, readings)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.W.Write(b)
+	return err
+}
+
+// InfluxHTTP posts readings as line protocol to an InfluxDB write endpoint
+type InfluxHTTP struct {
+	// URL is the write endpoint with its parameters, such as
+	// http://localhost:8086/api/v2/write?org=home&bucket=esphome
+	URL string
+	// Token is sent as "Authorization: Token <token>" if set
+	Token string
+	// Client defaults to a client with DefaultTimeout, a client without a
+	// timeout can hold up the batches forever
+	Client *http.Client
+}
+
+// WriteReadings implements Sink
+func (s *InfluxHTTP) WriteReadings(readings []Reading) error {
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(AppendLineProtocol(nil, readings)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sink: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// AppendLineProtocol appends readings to b as InfluxDB line protocol, with
+// the entity type as the measurement, the device and entity metadata as
+// tags and nanosecond timestamps. Consecutive readings of the same state are
+// written as the fields of a single line. Values that aren't finite are
+// left out, as line protocol can't represent them.
+func AppendLineProtocol(b []byte, readings []Reading) []byte {
+	for i := 0; i < len(readings); {
+		r := readings[i]
+		j := i
+		var fields []byte
+		for ; j < len(readings) && sameState(r, readings[j]); j++ {
+			v := readings[j].Value
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			if len(fields) > 0 {
+				fields = append(fields, ',')
+			}
+			fields = append(fields, tagEscaper.Replace(readings[j].Field)...)
+			fields = append(fields, '=')
+			fields = strconv.AppendFloat(fields, v, 'f', -1, 64)
+		}
+		i = j
+		if len(fields) == 0 {
+			continue
+		}
+
+		b = append(b, measurementEscaper.Replace(r.Type)...)
+		b = appendTag(b, "device", r.Device)
+		b = appendTag(b, "object_id", r.ObjectID)
+		b = appendTag(b, "name", r.Name)
+		b = appendTag(b, "unit", r.Unit)
+		b = appendTag(b, "device_class", r.DeviceClass)
+		b = append(b, ' ')
+		b = append(b, fields...)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, r.Time.UnixNano(), 10)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// sameState reports whether a and b come from the same state
+func sameState(a, b Reading) bool {
+	return a.Time.Equal(b.Time) && a.Device == b.Device && a.Type == b.Type && a.ObjectID == b.ObjectID
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// appendTag appends a tag unless its value is empty, which line protocol
+// doesn't allow
+func appendTag(b []byte, key, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = append(b, ',')
+	b = append(b, key...)
+	b = append(b, '=')
+	return append(b, tagEscaper.Replace(value)...)
+}
@@ -0,0 +1,337 @@
+// Package sink writes the raw readings of the devices of a manager.Manager
+// to files, streams and HTTP endpoints, as InfluxDB line protocol or CSV.
+//
+// The numeric values of sensor, binary sensor and climate states become
+// Readings, labelled with the metadata of the entity from ListEntities. A
+// Batcher collects the readings of the state changes and writes them to a
+// Sink in batches, retrying with an exponential backoff when a write fails.
+package sink
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/internal/value"
+	"github.com/jdugan1024/espgohome/manager"
+)
+
+// Default settings used when the Batcher fields are zero
+const (
+	DefaultBatchSize     = 1000
+	DefaultFlushInterval = 10 * time.Second
+	DefaultMinBackoff    = time.Second
+	DefaultMaxBackoff    = time.Minute
+	DefaultMaxPending    = 100000
+	DefaultCloseTimeout  = 10 * time.Second
+)
+
+// ErrorBatcherClosed is returned by Start after Close has been called
+var ErrorBatcherClosed = errors.New("sink: batcher closed")
+
+// Reading is a numeric value of the state of an entity
+type Reading struct {
+	Time   time.Time
+	Device string
+	// Type is the entity type, sensor, binary_sensor or climate
+	Type     string
+	ObjectID string
+	Name     string
+	// Unit is the unit of measurement of a sensor
+	Unit string
+	// DeviceClass is the device class of a binary sensor
+	DeviceClass string
+	// Field names the value: value for sensors, state for binary sensors and
+	// current_temperature, target_temperature, target_temperature_low or
+	// target_temperature_high for climate devices
+	Field string
+	Value float64
+}
+
+// Sink receives batches of readings
+type Sink interface {
+	WriteReadings(readings []Reading) error
+}
+
+// Readings returns the readings of a state of a device, none for missing
+// states and the types of entities that have no numeric value
+func Readings(device string, st espgohome.EntityState, t time.Time) []Reading {
+	if st.State == nil || st.Missing {
+		return nil
+	}
+	r := Reading{Time: t, Device: device, ObjectID: st.Entity.GetObjectId(), Name: st.Entity.GetName()}
+
+	switch m := st.State.(type) {
+	case *espgohome.SensorStateResponse:
+		r.Type = "sensor"
+		if e, ok := st.Entity.(*espgohome.ListEntitiesSensorResponse); ok {
+			r.Unit = e.UnitOfMeasurement
+		}
+		r.Field, r.Value = "value", value.Float32(m.State)
+		return []Reading{r}
+	case *espgohome.BinarySensorStateResponse:
+		r.Type = "binary_sensor"
+		if e, ok := st.Entity.(*espgohome.ListEntitiesBinarySensorResponse); ok {
+			r.DeviceClass = e.DeviceClass
+		}
+		r.Field, r.Value = "state", value.Bool(m.State)
+		return []Reading{r}
+	case *espgohome.ClimateStateResponse:
+		r.Type = "climate"
+		e, _ := st.Entity.(*espgohome.ListEntitiesClimateResponse)
+		var readings []Reading
+		add := func(field string, v float32) {
+			rf := r
+			rf.Field, rf.Value = field, value.Float32(v)
+			readings = append(readings, rf)
+		}
+		if e == nil || e.SupportsCurrentTemperature {
+			add("current_temperature", m.CurrentTemperature)
+		}
+		if e != nil && e.SupportsTwoPointTargetTemperature {
+			add("target_temperature_low", m.TargetTemperatureLow)
+			add("target_temperature_high", m.TargetTemperatureHigh)
+		} else {
+			add("target_temperature", m.TargetTemperature)
+		}
+		return readings
+	}
+	return nil
+}
+
+// Batcher writes the readings of the state changes of the devices of a
+// Manager to a Sink
+type Batcher struct {
+	Manager *manager.Manager
+	Sink    Sink
+	// BatchSize is the largest number of readings written at once, a full
+	// batch is written without waiting for FlushInterval
+	BatchSize int
+	// FlushInterval is how long readings wait for a batch to fill
+	FlushInterval time.Duration
+	// MinBackoff and MaxBackoff bound the delay before a failed write is
+	// retried
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxPending is the number of readings kept while the writes fail, the
+	// oldest are dropped beyond it
+	MaxPending int
+	// CloseTimeout bounds the last write made by Close
+	CloseTimeout time.Duration
+	// Logger receives the diagnostic messages of the batcher
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+
+	mu     sync.Mutex
+	events chan manager.Event
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// Start listens to the events of the Manager
+func (b *Batcher) Start() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrorBatcherClosed
+	}
+	if b.events != nil {
+		b.mu.Unlock()
+		return nil
+	}
+	b.events = make(chan manager.Event, 64)
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	b.mu.Unlock()
+
+	b.Manager.AddListener(b.events)
+	go b.run()
+
+	return nil
+}
+
+// Close stops listening to the Manager and makes a last attempt at writing
+// the pending readings
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	started := b.events != nil
+	b.mu.Unlock()
+
+	if started {
+		b.Manager.RemoveListener(b.events)
+		close(b.stop)
+		<-b.done
+	}
+
+	return nil
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	var (
+		pending  []Reading
+		inflight []Reading
+		results  = make(chan error, 1)
+		backoff  time.Duration
+		// retry fires when a failed write can be retried, it is nil unless
+		// the writes are backing off
+		retry <-chan time.Time
+	)
+	ticker := time.NewTicker(b.flushInterval())
+	defer ticker.Stop()
+
+	// write starts writing a batch unless one is already being written or
+	// the writes are backing off, partial batches are only written if force
+	// is set
+	write := func(force bool) {
+		if inflight != nil || retry != nil || len(pending) == 0 {
+			return
+		}
+		if !force && len(pending) < b.batchSize() {
+			return
+		}
+		n := len(pending)
+		if n > b.batchSize() {
+			n = b.batchSize()
+		}
+		inflight = pending[:n:n]
+		pending = pending[n:]
+		go func(batch []Reading) { results <- b.Sink.WriteReadings(batch) }(inflight)
+	}
+	// limit drops the oldest pending readings beyond MaxPending
+	limit := func() {
+		dropped := len(pending) + len(inflight) - b.maxPending()
+		if dropped > len(pending) {
+			dropped = len(pending)
+		}
+		if dropped > 0 {
+			b.log(espgohome.LevelWarn, "sink: too many pending readings, dropping the oldest", "dropped", dropped)
+			pending = pending[dropped:]
+		}
+	}
+
+	for {
+		select {
+		case e := <-b.events:
+			if e.Type == manager.StateChanged {
+				pending = append(pending, Readings(e.Device, e.State, e.Time)...)
+				limit()
+				write(false)
+			}
+		case <-ticker.C:
+			write(true)
+		case <-retry:
+			retry = nil
+			write(true)
+		case err := <-results:
+			if err != nil {
+				backoff = nextBackoff(backoff, b.minBackoff(), b.maxBackoff())
+				retry = time.After(backoff)
+				b.log(espgohome.LevelWarn, "sink: write failed", "readings", len(inflight), "retry", backoff, "error", err)
+				pending = append(inflight, pending...)
+				inflight = nil
+				limit()
+				continue
+			}
+			backoff = 0
+			b.log(espgohome.LevelDebug, "sink: readings written", "readings", len(inflight))
+			inflight = nil
+			write(false)
+		case <-b.stop:
+			// the write in flight and the last one must end before the
+			// deadline, results is buffered for a write left behind
+			deadline := time.NewTimer(b.closeTimeout())
+			defer deadline.Stop()
+			if inflight != nil {
+				select {
+				case err := <-results:
+					if err != nil {
+						pending = append(inflight, pending...)
+					}
+				case <-deadline.C:
+					b.log(espgohome.LevelWarn, "sink: readings lost", "readings", len(inflight)+len(pending), "error", "write timed out")
+					return
+				}
+			}
+			if len(pending) > 0 {
+				go func() { results <- b.Sink.WriteReadings(pending) }()
+				select {
+				case err := <-results:
+					if err != nil {
+						b.log(espgohome.LevelWarn, "sink: readings lost", "readings", len(pending), "error", err)
+					}
+				case <-deadline.C:
+					b.log(espgohome.LevelWarn, "sink: readings lost", "readings", len(pending), "error", "write timed out")
+				}
+			}
+			return
+		}
+	}
+}
+
+// nextBackoff doubles the backoff within min and max
+func nextBackoff(backoff, min, max time.Duration) time.Duration {
+	backoff *= 2
+	if backoff < min {
+		backoff = min
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (b *Batcher) batchSize() int {
+	if b.BatchSize > 0 {
+		return b.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (b *Batcher) flushInterval() time.Duration {
+	if b.FlushInterval > 0 {
+		return b.FlushInterval
+	}
+	return DefaultFlushInterval
+}
+
+func (b *Batcher) minBackoff() time.Duration {
+	if b.MinBackoff > 0 {
+		return b.MinBackoff
+	}
+	return DefaultMinBackoff
+}
+
+func (b *Batcher) maxBackoff() time.Duration {
+	if b.MaxBackoff > 0 {
+		return b.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
+
+func (b *Batcher) maxPending() int {
+	if b.MaxPending > 0 {
+		return b.MaxPending
+	}
+	return DefaultMaxPending
+}
+
+func (b *Batcher) closeTimeout() time.Duration {
+	if b.CloseTimeout > 0 {
+		return b.CloseTimeout
+	}
+	return DefaultCloseTimeout
+}
+
+func (b *Batcher) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(b.Logger, b.Debug).Log(level, msg, keyvals...)
+}
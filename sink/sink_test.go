@@ -0,0 +1,237 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+)
+
+var at = time.Unix(1583020800, 500)
+
+func TestReadings(t *testing.T) {
+	temperature := espgohome.EntityState{
+		Entity: &espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Name: "Temperature", UnitOfMeasurement: "°C"},
+		State:  &espgohome.SensorStateResponse{State: 21.3},
+	}
+	rs := Readings("kitchen", temperature, at)
+	if len(rs) != 1 || rs[0] != (Reading{at, "kitchen", "sensor", "temperature", "Temperature", "°C", "", "value", 21.3}) {
+		t.Errorf("unexpected sensor readings %+v", rs)
+	}
+
+	door := espgohome.EntityState{
+		Entity: &espgohome.ListEntitiesBinarySensorResponse{ObjectId: "door", DeviceClass: "door"},
+		State:  &espgohome.BinarySensorStateResponse{State: true},
+	}
+	if rs := Readings("kitchen", door, at); len(rs) != 1 || rs[0].DeviceClass != "door" || rs[0].Field != "state" || rs[0].Value != 1 {
+		t.Errorf("unexpected binary sensor readings %+v", rs)
+	}
+
+	thermostat := espgohome.EntityState{
+		Entity: &espgohome.ListEntitiesClimateResponse{ObjectId: "thermostat", SupportsCurrentTemperature: true, SupportsTwoPointTargetTemperature: true},
+		State:  &espgohome.ClimateStateResponse{CurrentTemperature: 20, TargetTemperatureLow: 18, TargetTemperatureHigh: 24},
+	}
+	rs = Readings("kitchen", thermostat, at)
+	if len(rs) != 3 || rs[0].Field != "current_temperature" || rs[1].Value != 18 || rs[2].Field != "target_temperature_high" {
+		t.Errorf("unexpected climate readings %+v", rs)
+	}
+
+	temperature.Missing = true
+	if rs := Readings("kitchen", temperature, at); len(rs) != 0 {
+		t.Errorf("readings for a missing state %+v", rs)
+	}
+	text := espgohome.EntityState{Entity: &espgohome.ListEntitiesTextSensorResponse{ObjectId: "version"}, State: &espgohome.TextSensorStateResponse{State: "1.15"}}
+	if rs := Readings("kitchen", text, at); len(rs) != 0 {
+		t.Errorf("readings for a text sensor %+v", rs)
+	}
+}
+
+func TestLineProtocol(t *testing.T) {
+	readings := []Reading{
+		{at, "kitchen", "sensor", "temperature", "Kitchen Temperature", "°C", "", "value", 21.5},
+		{at, "kitchen", "climate", "thermostat", "", "", "", "current_temperature", 20},
+		{at, "kitchen", "climate", "thermostat", "", "", "", "target_temperature", 21},
+		{at, "kitchen", "sensor", "broken", "", "", "", "value", math.NaN()},
+	}
+	var buf bytes.Buffer
+	if err := (&LineProtocol{W: &buf}).WriteReadings(readings); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want := `sensor,device=kitchen,object_id=temperature,name=Kitchen\ Temperature,unit=°C value=21.5 1583020800000000500
+climate,device=kitchen,object_id=thermostat current_temperature=20,target_temperature=21 1583020800000000500
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	s := &CSV{W: &buf}
+	s.WriteReadings([]Reading{{at, "kitchen", "sensor", "temperature", "Temperature, inside", "°C", "", "value", 21.5}})
+	s.WriteReadings([]Reading{{at, "kitchen", "binary_sensor", "door", "Door", "", "door", "state", 1}})
+
+	want := `time,device,type,object_id,name,unit,device_class,field,value
+2020-03-01T00:00:00.0000005Z,kitchen,sensor,temperature,"Temperature, inside",°C,,value,21.5
+2020-03-01T00:00:00.0000005Z,kitchen,binary_sensor,door,Door,,door,state,1
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestInfluxHTTP(t *testing.T) {
+	var body, auth string
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body, auth = string(b), r.Header.Get("Authorization")
+		w.WriteHeader(status)
+		w.Write([]byte("bucket not found"))
+	}))
+	defer ts.Close()
+
+	s := &InfluxHTTP{URL: ts.URL + "/api/v2/write?org=home&bucket=esphome", Token: "t0ken"}
+	if err := s.WriteReadings([]Reading{{at, "kitchen", "sensor", "temperature", "", "", "", "value", 21.5}}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if auth != "Token t0ken" || body != "sensor,device=kitchen,object_id=temperature value=21.5 1583020800000000500\n" {
+		t.Errorf("unexpected request %q %q", auth, body)
+	}
+
+	status = http.StatusNotFound
+	if err := s.WriteReadings([]Reading{{at, "kitchen", "sensor", "temperature", "", "", "", "value", 21.5}}); err == nil || !strings.Contains(err.Error(), "bucket not found") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// flakySink fails its first writes
+type flakySink struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	readings []Reading
+}
+
+func (s *flakySink) WriteReadings(readings []Reading) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.readings = append(s.readings, readings...)
+	return nil
+}
+
+func (s *flakySink) written() ([]Reading, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Reading(nil), s.readings...), s.attempts
+}
+
+func TestBatcher(t *testing.T) {
+	dev := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "kitchen"}}
+	dev.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature", UnitOfMeasurement: "°C"})
+	dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: 20})
+
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	s := &flakySink{failures: 2}
+	b := &Batcher{Manager: m, Sink: s, BatchSize: 2, FlushInterval: 20 * time.Millisecond, MinBackoff: 10 * time.Millisecond}
+	if err := b.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	d := espgohometest.Connect(t, m, dev)
+
+	// the initial state comes first
+	deadline := time.Now().Add(2 * time.Second)
+	for !d.Entities().Sensor("temperature").HasState() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no initial state")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for next := float32(21); ; next++ {
+		readings, attempts := s.written()
+		if len(readings) >= 3 {
+			if attempts < 3 || readings[0].Value != 20 || readings[0].Unit != "°C" || readings[0].Device != "kitchen" {
+				t.Errorf("unexpected readings %+v after %d attempts", readings, attempts)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readings not written: %+v after %d attempts", readings, attempts)
+		}
+		if next < 23 {
+			dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: next})
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the pending readings are written by Close at the latest
+	dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: 30})
+	time.Sleep(50 * time.Millisecond)
+	b.Close()
+	if readings, _ := s.written(); readings[len(readings)-1].Value != 30 {
+		t.Errorf("the last reading wasn't written: %+v", readings)
+	}
+}
+
+// hungSink never returns from a write until released
+type hungSink struct {
+	release chan struct{}
+	writes  chan int
+}
+
+func (s *hungSink) WriteReadings(readings []Reading) error {
+	s.writes <- len(readings)
+	<-s.release
+	return nil
+}
+
+func TestCloseTimeout(t *testing.T) {
+	dev := &server.Server{Info: &espgohome.DeviceInfoResponse{Name: "kitchen"}}
+	dev.AddEntity(&espgohome.ListEntitiesSensorResponse{ObjectId: "temperature", Key: 1, Name: "Temperature"})
+	dev.SetState(&espgohome.SensorStateResponse{Key: 1, State: 20})
+
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	s := &hungSink{release: make(chan struct{}), writes: make(chan int, 4)}
+	defer close(s.release)
+	b := &Batcher{Manager: m, Sink: s, BatchSize: 1, CloseTimeout: 50 * time.Millisecond}
+	if err := b.Start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	espgohometest.Connect(t, m, dev)
+	select {
+	case <-s.writes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing written")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close waits for a hung write")
+	}
+}
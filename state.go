@@ -0,0 +1,298 @@
+package espgohome
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EntityState is a snapshot of an entity and its most recent state
+type EntityState struct {
+	Entity Entity
+	Type   EntityID
+	// State is the most recent *StateResponse, nil until the first state arrives
+	State proto.Message
+	// Missing is true when the device reported that it has no valid state
+	// yet, see missing_state in api.proto
+	Missing bool
+	Updated time.Time
+}
+
+// StateFilter selects which entities a StateCallback is interested in
+type StateFilter func(e Entity) bool
+
+// EntityTypeFilter matches entities of the given types
+func EntityTypeFilter(types ...EntityID) StateFilter {
+	return func(e Entity) bool {
+		t := GetEntityType(e)
+		for _, want := range types {
+			if t == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ObjectIDFilter matches entities with the given object ids
+func ObjectIDFilter(ids ...string) StateFilter {
+	return func(e Entity) bool {
+		for _, id := range ids {
+			if e.GetObjectId() == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// StateCallback is called when the state of an entity changes, previous is
+// nil for the first state received
+type StateCallback func(state EntityState, previous proto.Message)
+
+// CallbackID identifies a registered StateCallback
+type CallbackID int
+
+type stateCallback struct {
+	fn      StateCallback
+	filters []StateFilter
+}
+
+func (cb *stateCallback) matches(e Entity) bool {
+	for _, f := range cb.filters {
+		if !f(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// objectKey identifies an entity by its type and object id, entities of
+// different types can have the same object id
+type objectKey struct {
+	t  EntityID
+	id string
+}
+
+// StateStore joins the entities from ListEntities with the states from
+// SubscribeStates and keeps the most recent state of each entity
+type StateStore struct {
+	mu         sync.Mutex
+	entities   map[uint32]Entity
+	order      []uint32
+	byObjectID map[objectKey]uint32
+	states     map[uint32]*EntityState
+	callbacks  map[CallbackID]*stateCallback
+	nextID     CallbackID
+}
+
+// NewStateStore creates a StateStore for the given entities
+func NewStateStore(entities []Entity) *StateStore {
+	s := &StateStore{
+		entities:   make(map[uint32]Entity),
+		byObjectID: make(map[objectKey]uint32),
+		states:     make(map[uint32]*EntityState),
+		callbacks:  make(map[CallbackID]*stateCallback),
+	}
+	s.AddEntities(entities)
+
+	return s
+}
+
+// AddEntities adds entity metadata to the store, replacing entities with the same key
+func (s *StateStore) AddEntities(entities []Entity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entities {
+		key := e.GetKey()
+		if _, ok := s.entities[key]; !ok {
+			s.order = append(s.order, key)
+		}
+		s.entities[key] = e
+		s.byObjectID[objectKey{GetEntityType(e), e.GetObjectId()}] = key
+		if st, ok := s.states[key]; ok {
+			st.Entity = e
+		}
+	}
+}
+
+// Entities returns the entities known to the store in the order they were added
+func (s *StateStore) Entities() []Entity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entities := make([]Entity, 0, len(s.order))
+	for _, key := range s.order {
+		entities = append(entities, s.entities[key])
+	}
+
+	return entities
+}
+
+// Get returns the state of the entity with the given key
+func (s *StateStore) Get(key uint32) (EntityState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.get(key)
+}
+
+// GetByObjectID returns the state of the entity with the given object id.
+// If entities of different types have the id, the first one added is
+// returned, GetByTypeAndObjectID selects one of them.
+func (s *StateStore) GetByObjectID(id string) (EntityState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.order {
+		if s.entities[key].GetObjectId() == id {
+			return s.get(key)
+		}
+	}
+
+	return EntityState{}, false
+}
+
+// GetByTypeAndObjectID returns the state of the entity of type t with the
+// given object id
+func (s *StateStore) GetByTypeAndObjectID(t EntityID, id string) (EntityState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.byObjectID[objectKey{t, id}]
+	if !ok {
+		return EntityState{}, false
+	}
+
+	return s.get(key)
+}
+
+// All returns the state of every entity in the order they were added
+func (s *StateStore) All() []EntityState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]EntityState, 0, len(s.order))
+	for _, key := range s.order {
+		st, _ := s.get(key)
+		states = append(states, st)
+	}
+
+	return states
+}
+
+func (s *StateStore) get(key uint32) (EntityState, bool) {
+	e, ok := s.entities[key]
+	if !ok {
+		return EntityState{}, false
+	}
+	if st, ok := s.states[key]; ok {
+		return *st, true
+	}
+
+	return EntityState{Entity: e, Type: GetEntityType(e)}, true
+}
+
+// AddCallback registers fn to be called when an entity matching all of the
+// filters changes state
+func (s *StateStore) AddCallback(fn StateCallback, filters ...StateFilter) CallbackID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.callbacks[s.nextID] = &stateCallback{fn: fn, filters: filters}
+
+	return s.nextID
+}
+
+// RemoveCallback unregisters a callback
+func (s *StateStore) RemoveCallback(id CallbackID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.callbacks, id)
+}
+
+// Update records a state message, calling any matching callbacks if the
+// state changed. It returns false if the state is for an unknown entity.
+func (s *StateStore) Update(state proto.Message) bool {
+	k, ok := state.(interface{ GetKey() uint32 })
+	if !ok {
+		return false
+	}
+	key := k.GetKey()
+
+	s.mu.Lock()
+	e, ok := s.entities[key]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+
+	var previous proto.Message
+	st, ok := s.states[key]
+	if ok {
+		previous = st.State
+	} else {
+		st = &EntityState{Entity: e, Type: GetEntityType(e)}
+		s.states[key] = st
+	}
+
+	changed := previous == nil || !proto.Equal(previous, state)
+	if force, ok := e.(interface{ GetForceUpdate() bool }); ok && force.GetForceUpdate() {
+		changed = true
+	}
+
+	st.State = state
+	st.Updated = time.Now()
+	st.Missing = false
+	if m, ok := state.(interface{ GetMissingState() bool }); ok {
+		st.Missing = m.GetMissingState()
+	}
+	snapshot := *st
+
+	callbacks := []StateCallback{}
+	if changed {
+		for _, cb := range s.callbacks {
+			if cb.matches(e) {
+				callbacks = append(callbacks, cb.fn)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(snapshot, previous)
+	}
+
+	return true
+}
+
+// Run updates the store with every message received on states until the
+// channel is closed, states is usually the channel returned by SubscribeStates
+func (s *StateStore) Run(states chan protoreflect.ProtoMessage) {
+	for m := range states {
+		s.Update(m)
+	}
+}
+
+// TrackStates lists the entities on the device, subscribes to their states
+// and returns a StateStore that is kept up to date until the connection closes
+func (c *ESPHomeConnection) TrackStates() (*StateStore, error) {
+	entities, err := c.ListEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	store := NewStateStore(entities)
+	states, err := c.SubscribeStates()
+	if err != nil {
+		return nil, err
+	}
+	go store.Run(states)
+
+	return store, nil
+}
@@ -0,0 +1,108 @@
+package espgohome
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func testEntities() []Entity {
+	return []Entity{
+		&ListEntitiesSwitchResponse{ObjectId: "relay", Key: 1, Name: "Relay"},
+		&ListEntitiesSensorResponse{ObjectId: "temperature", Key: 2, Name: "Temperature"},
+		&ListEntitiesBinarySensorResponse{ObjectId: "door", Key: 3, Name: "Door"},
+	}
+}
+
+func TestStateStore(t *testing.T) {
+	s := NewStateStore(testEntities())
+
+	st, ok := s.GetByObjectID("temperature")
+	if !ok {
+		t.Fatal("temperature not found")
+	}
+	if st.State != nil || st.Type != Sensor {
+		t.Errorf("unexpected initial state: %v", st)
+	}
+
+	if !s.Update(&SensorStateResponse{Key: 2, MissingState: true}) {
+		t.Error("update of known entity failed")
+	}
+	st, _ = s.Get(2)
+	if !st.Missing {
+		t.Error("expected missing state")
+	}
+
+	s.Update(&SensorStateResponse{Key: 2, State: 21.5})
+	st, _ = s.Get(2)
+	if st.Missing || st.State.(*SensorStateResponse).State != 21.5 {
+		t.Errorf("unexpected state: %v", st)
+	}
+
+	if s.Update(&SwitchStateResponse{Key: 99}) {
+		t.Error("update of unknown entity succeeded")
+	}
+
+	if n := len(s.All()); n != 3 {
+		t.Errorf("expected 3 states, got %d", n)
+	}
+}
+
+func TestSharedObjectID(t *testing.T) {
+	s := NewStateStore([]Entity{
+		&ListEntitiesSensorResponse{ObjectId: "fan", Key: 1, Name: "Fan Speed"},
+		&ListEntitiesSwitchResponse{ObjectId: "fan", Key: 2, Name: "Fan"},
+	})
+	s.Update(&SensorStateResponse{Key: 1, State: 1200})
+	s.Update(&SwitchStateResponse{Key: 2, State: true})
+
+	if st, ok := s.GetByTypeAndObjectID(Switch, "fan"); !ok || st.Entity.GetKey() != 2 {
+		t.Errorf("unexpected switch %v", st.Entity)
+	}
+	if st, ok := s.GetByTypeAndObjectID(Sensor, "fan"); !ok || st.Entity.GetKey() != 1 {
+		t.Errorf("unexpected sensor %v", st.Entity)
+	}
+	if st, ok := s.GetByObjectID("fan"); !ok || st.Entity.GetKey() != 1 {
+		t.Errorf("expected the first entity, got %v", st.Entity)
+	}
+	if _, ok := s.GetByTypeAndObjectID(Light, "fan"); ok {
+		t.Error("found a light")
+	}
+}
+
+func TestStateCallbacks(t *testing.T) {
+	s := NewStateStore(testEntities())
+
+	switches := 0
+	var previous proto.Message
+	id := s.AddCallback(func(st EntityState, prev proto.Message) {
+		switches++
+		previous = prev
+	}, EntityTypeFilter(Switch))
+
+	doors := 0
+	s.AddCallback(func(st EntityState, prev proto.Message) {
+		doors++
+	}, ObjectIDFilter("door"))
+
+	s.Update(&SwitchStateResponse{Key: 1, State: true})
+	s.Update(&SwitchStateResponse{Key: 1, State: true})
+	s.Update(&SwitchStateResponse{Key: 1, State: false})
+	s.Update(&BinarySensorStateResponse{Key: 3, State: true})
+
+	if switches != 2 {
+		t.Errorf("expected 2 switch changes, got %d", switches)
+	}
+	if p, ok := previous.(*SwitchStateResponse); !ok || !p.State {
+		t.Errorf("unexpected previous state: %v", previous)
+	}
+	if doors != 1 {
+		t.Errorf("expected 1 door change, got %d", doors)
+	}
+
+	s.RemoveCallback(id)
+	s.Update(&SwitchStateResponse{Key: 1, State: true})
+	if switches != 2 {
+		t.Errorf("callback called after removal")
+	}
+}
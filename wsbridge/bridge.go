@@ -0,0 +1,362 @@
+// Package wsbridge relays the native API of the devices of a manager.Manager
+// to WebSocket clients, for browser based tools that can't open TCP sockets.
+//
+// A client connects with the device in the query, for example
+// ws://host:6080/?device=kitchen, and authenticates with the bridge's token,
+// either as "Authorization: Bearer <token>" or as the token query parameter
+// since browsers can't set headers on a WebSocket. The device password is
+// never seen by the client.
+//
+// In the default JSON mode each text frame holds one message:
+//
+//	{"type": "SwitchCommandRequest", "message": {"key": 2, "state": true}}
+//
+// with the message encoded by protojson. With mode=binary each binary frame
+// holds one message framed as on the native API.
+//
+// The client shares the bridge's connection to the device: it receives every
+// message the device sends on it, including the replies to other clients,
+// and its hello, connect, disconnect and ping requests are answered by the
+// bridge rather than forwarded. The WebSocket is closed when the connection to
+// the device is lost.
+package wsbridge
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/manager"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Modes of a WebSocket, selected with the mode query parameter
+const (
+	ModeJSON   = "json"
+	ModeBinary = "binary"
+)
+
+// ServerInfo is sent in the HelloResponse to clients
+const ServerInfo = "espgohome wsbridge"
+
+// queueSize is how many messages are queued for a client before it is
+// disconnected as too slow
+const queueSize = 256
+
+// ErrorUnknownType is returned for a JSON message of an unknown type
+var ErrorUnknownType = errors.New("wsbridge: unknown message type")
+
+// relayed are the messages a device sends that are relayed to the clients
+var relayed = []espgohome.MessageID{
+	espgohome.DeviceInfoResponseID,
+	espgohome.ListEntitiesBinarySensorResponseID,
+	espgohome.ListEntitiesCoverResponseID,
+	espgohome.ListEntitiesFanResponseID,
+	espgohome.ListEntitiesLightResponseID,
+	espgohome.ListEntitiesSensorResponseID,
+	espgohome.ListEntitiesSwitchResponseID,
+	espgohome.ListEntitiesTextSensorResponseID,
+	espgohome.ListEntitiesServicesResponseID,
+	espgohome.ListEntitiesCameraResponseID,
+	espgohome.ListEntitiesClimateResponseID,
+	espgohome.ListEntitiesDoneResponseID,
+	espgohome.BinarySensorStateResponseID,
+	espgohome.CoverStateResponseID,
+	espgohome.FanStateResponseID,
+	espgohome.LightStateResponseID,
+	espgohome.SensorStateResponseID,
+	espgohome.SwitchStateResponseID,
+	espgohome.TextSensorStateResponseID,
+	espgohome.ClimateStateResponseID,
+	espgohome.SubscribeLogsResponseID,
+	espgohome.HomeassistantServiceResponseID,
+	espgohome.SubscribeHomeAssistantStateResponseID,
+	espgohome.CameraImageResponseID,
+}
+
+// messageIDs maps the message names used in JSON mode to their MessageID
+var messageIDs = make(map[string]espgohome.MessageID)
+
+func init() {
+	for id := espgohome.MessageID(1); id < 256; id++ {
+		if name := id.String(); !strings.HasPrefix(name, "MessageID(") {
+			messageIDs[strings.TrimSuffix(name, "ID")] = id
+		}
+	}
+}
+
+// Bridge is an http.Handler accepting WebSocket clients
+type Bridge struct {
+	Manager *manager.Manager
+	// Token authenticates the clients, every client is refused if it is empty
+	Token string
+	// Logger receives the diagnostic messages of the bridge
+	Logger espgohome.Logger
+	// Debug logs at LevelDebug with the standard log package if Logger is nil
+	Debug bool
+}
+
+// ServeHTTP authenticates the client and relays the device's messages over
+// the WebSocket
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !b.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wsbridge"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = ModeJSON
+	case ModeJSON, ModeBinary:
+	default:
+		http.Error(w, fmt.Sprintf("unknown mode %q", mode), http.StatusBadRequest)
+		return
+	}
+
+	d, err := b.device(r.URL.Query().Get("device"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	c := d.Conn()
+	if c == nil {
+		http.Error(w, d.Name()+" is not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	// browsers send an Origin, the token is what is checked
+	srv := websocket.Server{Handler: func(ws *websocket.Conn) {
+		s := &session{bridge: b, device: d, conn: c, ws: ws, binary: mode == ModeBinary}
+		s.run()
+	}}
+	srv.ServeHTTP(w, r)
+}
+
+// authorized checks the token of r
+func (b *Bridge) authorized(r *http.Request) bool {
+	if b.Token == "" {
+		return false
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(b.Token)) == 1
+}
+
+// device returns the device with the given name or MAC address, id can be
+// empty if the Manager has a single device
+func (b *Bridge) device(id string) (*manager.Device, error) {
+	if id == "" {
+		devices := b.Manager.Devices()
+		if len(devices) != 1 {
+			return nil, fmt.Errorf("%d devices, select one with the device parameter", len(devices))
+		}
+		return devices[0], nil
+	}
+
+	d, err := b.Manager.Device(id)
+	if err != nil {
+		return nil, fmt.Errorf("%v %q", err, id)
+	}
+	return d, nil
+}
+
+func (b *Bridge) log(level espgohome.Level, msg string, keyvals ...interface{}) {
+	espgohome.ResolveLogger(b.Logger, b.Debug).Log(level, msg, keyvals...)
+}
+
+// jsonMessage is a message in JSON mode
+type jsonMessage struct {
+	Type    string          `json:"type,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+	// Error reports a message from the client that couldn't be sent
+	Error string `json:"error,omitempty"`
+}
+
+// session relays the messages between a WebSocket and a device
+type session struct {
+	bridge *Bridge
+	device *manager.Device
+	conn   *espgohome.ESPHomeConnection
+	ws     *websocket.Conn
+	binary bool
+
+	// wmu serializes the writes to ws
+	wmu sync.Mutex
+}
+
+func (s *session) run() {
+	defer s.ws.Close()
+
+	messages := make(chan protoreflect.ProtoMessage)
+	s.conn.AddReceiver(messages, relayed...)
+	defer s.conn.RemoveReceiver(messages)
+
+	remote := s.ws.Request().RemoteAddr
+	s.bridge.log(espgohome.LevelInfo, "wsbridge: client connected", "client", remote, "device", s.device.Name(), "binary", s.binary)
+	defer s.bridge.log(espgohome.LevelInfo, "wsbridge: client disconnected", "client", remote, "device", s.device.Name())
+
+	// the receiver is drained at once into a queue so that a slow client
+	// doesn't hold up the connection it shares with the manager, a client
+	// that lets the queue fill up is disconnected
+	done := make(chan struct{})
+	defer close(done)
+	queue := make(chan protoreflect.ProtoMessage, queueSize)
+	go func() {
+		defer close(queue)
+		full := false
+		for {
+			select {
+			case m, ok := <-messages:
+				if !ok {
+					return
+				}
+				if full {
+					continue
+				}
+				select {
+				case queue <- m:
+				default:
+					s.bridge.log(espgohome.LevelWarn, "wsbridge: disconnecting a slow client", "client", remote, "device", s.device.Name())
+					full = true
+					s.ws.Close()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// the device side ends the session by closing the WebSocket, which ends
+	// the loop below
+	go func() {
+		defer s.ws.Close()
+		for m := range queue {
+			if s.write(m) != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(s.ws, &frame); err != nil {
+			return
+		}
+		m, err := s.decode(frame)
+		if err == nil {
+			var quit bool
+			quit, err = s.handle(m)
+			if quit {
+				return
+			}
+		}
+		if err != nil {
+			s.bridge.log(espgohome.LevelDebug, "wsbridge: invalid message", "client", remote, "error", err)
+			if s.binary {
+				return
+			}
+			s.writeJSON(jsonMessage{Error: err.Error()})
+		}
+	}
+}
+
+// handle answers the connection level requests and forwards the others, it
+// returns true when the client disconnects
+func (s *session) handle(m proto.Message) (bool, error) {
+	switch m.(type) {
+	case *espgohome.HelloRequest:
+		// the version of api.proto
+		return false, s.write(&espgohome.HelloResponse{ApiVersionMajor: 1, ApiVersionMinor: 3, ServerInfo: ServerInfo})
+	case *espgohome.ConnectRequest:
+		return false, s.write(&espgohome.ConnectResponse{})
+	case *espgohome.PingRequest:
+		return false, s.write(&espgohome.PingResponse{})
+	case *espgohome.DisconnectRequest:
+		s.write(&espgohome.DisconnectResponse{})
+		return true, nil
+	case *espgohome.PingResponse, *espgohome.GetTimeResponse:
+		// replies to the device's requests, which the bridge answers
+		return false, nil
+	}
+	return false, s.conn.Send(m)
+}
+
+// decode decodes a frame from the client
+func (s *session) decode(frame []byte) (proto.Message, error) {
+	if s.binary {
+		msgType, m, err := espgohome.ReadMessage(bufio.NewReader(bytes.NewReader(frame)))
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %v", msgType, err)
+		}
+		return m, nil
+	}
+
+	var jm jsonMessage
+	if err := json.Unmarshal(frame, &jm); err != nil {
+		return nil, err
+	}
+	id, ok := messageIDs[jm.Type]
+	if !ok {
+		return nil, fmt.Errorf("%v %q", ErrorUnknownType, jm.Type)
+	}
+	m, err := espgohome.DecodeMessage(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(jm.Message) > 0 {
+		if err := protojson.Unmarshal(jm.Message, m); err != nil {
+			return nil, fmt.Errorf("%s: %v", jm.Type, err)
+		}
+	}
+	return m, nil
+}
+
+// write sends m to the client
+func (s *session) write(m proto.Message) error {
+	if s.binary {
+		var buf bytes.Buffer
+		if err := espgohome.WriteMessage(&buf, m); err != nil {
+			return err
+		}
+		s.wmu.Lock()
+		defer s.wmu.Unlock()
+		return websocket.Message.Send(s.ws, buf.Bytes())
+	}
+
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b); err != nil {
+		return err
+	}
+	return s.writeJSON(jsonMessage{
+		Type:    strings.TrimSuffix(espgohome.GetMessageID(m).String(), "ID"),
+		Message: compact.Bytes(),
+	})
+}
+
+func (s *session) writeJSON(jm jsonMessage) error {
+	b, err := json.Marshal(jm)
+	if err != nil {
+		return err
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return websocket.Message.Send(s.ws, string(b))
+}
@@ -0,0 +1,178 @@
+package wsbridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdugan1024/espgohome"
+	"github.com/jdugan1024/espgohome/espgohometest"
+	"github.com/jdugan1024/espgohome/manager"
+	"github.com/jdugan1024/espgohome/server"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+const token = "secret"
+
+// start connects a Manager to a fake device and serves a Bridge for it
+func start(t *testing.T) (*server.Server, *httptest.Server, chan proto.Message) {
+	s := &server.Server{
+		Info:     &espgohome.DeviceInfoResponse{Name: "kitchen", MacAddress: "AA:AA:AA:AA:AA:01"},
+		Password: "device password",
+	}
+	commands := espgohometest.Commands(s)
+	s.AddEntity(&espgohome.ListEntitiesSwitchResponse{ObjectId: "relay", Key: 2, Name: "Relay"})
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: true})
+
+	m := manager.New("test-client")
+	t.Cleanup(func() { m.Close() })
+	espgohometest.Connect(t, m, s)
+
+	ts := httptest.NewServer(&Bridge{Manager: m, Token: token})
+	t.Cleanup(ts.Close)
+
+	return s, ts, commands
+}
+
+func dial(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/?" + query
+	ws, err := websocket.Dial(url, "", ts.URL)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	ws.SetDeadline(time.Now().Add(2 * time.Second))
+	return ws
+}
+
+// receiveJSON returns the next message of type typ
+func receiveJSON(t *testing.T, ws *websocket.Conn, typ string) jsonMessage {
+	t.Helper()
+
+	for {
+		var jm jsonMessage
+		if err := websocket.JSON.Receive(ws, &jm); err != nil {
+			t.Fatalf("no %s received: %v", typ, err)
+		}
+		if jm.Type == typ || jm.Error != "" {
+			return jm
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	_, ts, commands := start(t)
+	ws := dial(t, ts, "device=kitchen&token="+token)
+
+	websocket.Message.Send(ws, `{"type": "HelloRequest", "message": {"client_info": "browser"}}`)
+	if jm := receiveJSON(t, ws, "HelloResponse"); !strings.Contains(string(jm.Message), ServerInfo) {
+		t.Errorf("unexpected hello response %s", jm.Message)
+	}
+	// the device password isn't needed
+	websocket.Message.Send(ws, `{"type": "ConnectRequest"}`)
+	if jm := receiveJSON(t, ws, "ConnectResponse"); jm.Error != "" {
+		t.Errorf("connect failed: %s", jm.Error)
+	}
+
+	websocket.Message.Send(ws, `{"type": "DeviceInfoRequest"}`)
+	jm := receiveJSON(t, ws, "DeviceInfoResponse")
+	var info map[string]interface{}
+	if err := json.Unmarshal(jm.Message, &info); err != nil || info["mac_address"] != "AA:AA:AA:AA:AA:01" {
+		t.Errorf("unexpected device info %s", jm.Message)
+	}
+
+	websocket.Message.Send(ws, `{"type": "SubscribeStatesRequest"}`)
+	if jm := receiveJSON(t, ws, "SwitchStateResponse"); string(jm.Message) != `{"key":2,"state":true}` {
+		t.Errorf("unexpected state %s", jm.Message)
+	}
+
+	websocket.Message.Send(ws, `{"type": "SwitchCommandRequest", "message": {"key": 2, "state": false}}`)
+	if c, ok := espgohometest.NextCommand(t, commands).(*espgohome.SwitchCommandRequest); !ok || c.Key != 2 || c.State {
+		t.Errorf("unexpected switch command %v", c)
+	}
+
+	websocket.Message.Send(ws, `{"type": "TeleportRequest"}`)
+	if jm := receiveJSON(t, ws, ""); !strings.Contains(jm.Error, ErrorUnknownType.Error()) {
+		t.Errorf("unexpected error %q", jm.Error)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	s, ts, _ := start(t)
+	ws := dial(t, ts, "mode=binary&token="+token)
+
+	send := func(m proto.Message) {
+		var buf bytes.Buffer
+		espgohome.WriteMessage(&buf, m)
+		if err := websocket.Message.Send(ws, buf.Bytes()); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+	receive := func(want espgohome.MessageID) proto.Message {
+		t.Helper()
+		for {
+			var frame []byte
+			if err := websocket.Message.Receive(ws, &frame); err != nil {
+				t.Fatalf("no %s received: %v", want, err)
+			}
+			id, m, err := espgohome.ReadMessage(bufio.NewReader(bytes.NewReader(frame)))
+			if err != nil {
+				t.Fatalf("invalid frame: %v", err)
+			}
+			if id == want {
+				return m
+			}
+		}
+	}
+
+	send(&espgohome.PingRequest{})
+	receive(espgohome.PingResponseID)
+
+	send(&espgohome.SubscribeStatesRequest{})
+	receive(espgohome.SwitchStateResponseID)
+	s.SetState(&espgohome.SwitchStateResponse{Key: 2, State: false})
+	if st := receive(espgohome.SwitchStateResponseID).(*espgohome.SwitchStateResponse); st.State {
+		t.Errorf("unexpected state %v", st)
+	}
+
+	// the WebSocket closes with the connection to the device
+	s.Close()
+	var frame []byte
+	for {
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			break
+		}
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	_, ts, _ := start(t)
+
+	for _, query := range []string{"", "token=wrong"} {
+		resp, err := http.Get(ts.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%q: got status %d, want 401", query, resp.StatusCode)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/?device=attic", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown device: got status %d, want 404", resp.StatusCode)
+	}
+}